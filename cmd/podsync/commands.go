@@ -0,0 +1,1130 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/hashicorp/go-multierror"
+	"github.com/jessevdk/go-flags"
+	"github.com/pelletier/go-toml"
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/mxpv/podsync/pkg/builder"
+	"github.com/mxpv/podsync/pkg/db"
+	"github.com/mxpv/podsync/pkg/events"
+	"github.com/mxpv/podsync/pkg/feed"
+	"github.com/mxpv/podsync/pkg/fs"
+	"github.com/mxpv/podsync/pkg/model"
+	"github.com/mxpv/podsync/services/update"
+)
+
+type UpdateCommand struct {
+	Args struct {
+		Feeds []string `positional-arg-name:"feed" description:"IDs of feeds to update (all feeds by default)"`
+	} `positional-args:"yes"`
+}
+
+type ListCommand struct {
+	Feeds    struct{}            `command:"feeds" description:"List feeds with episode counts"`
+	Episodes ListEpisodesCommand `command:"episodes" description:"List episodes of a feed"`
+}
+
+type ListEpisodesCommand struct {
+	Status string `long:"status" description:"Only list episodes with the given status (new, downloaded, error, cleaned, filtered)"`
+	Args   struct {
+		Feed string `positional-arg-name:"feed" required:"yes"`
+	} `positional-args:"yes"`
+}
+
+type RetryCommand struct {
+	Args struct {
+		Feed    string `positional-arg-name:"feed" required:"yes"`
+		Episode string `positional-arg-name:"episode" description:"Episode to download again (failed episodes by default)"`
+	} `positional-args:"yes"`
+}
+
+type DeleteEpisodeCommand struct {
+	Args struct {
+		Feed    string `positional-arg-name:"feed" required:"yes"`
+		Episode string `positional-arg-name:"episode" required:"yes"`
+	} `positional-args:"yes"`
+}
+
+type CleanupCommand struct {
+	DryRun bool `long:"dry-run" description:"Only print episodes that would be removed"`
+	Args   struct {
+		Feeds []string `positional-arg-name:"feed" description:"IDs of feeds to clean up (all feeds by default)"`
+	} `positional-args:"yes"`
+}
+
+type FilterCommand struct {
+	DryRun bool `long:"dry-run" description:"Only print episodes that would be removed"`
+	Args   struct {
+		Feeds []string `positional-arg-name:"feed" description:"IDs of feeds to filter (all feeds by default)"`
+	} `positional-args:"yes"`
+}
+
+type DBCommand struct {
+	Stats   struct{}         `command:"stats" description:"Print database statistics"`
+	Migrate DBMigrateCommand `command:"migrate" description:"Copy an existing Badger database into the SQLite database"`
+}
+
+type DBMigrateCommand struct {
+	From string `long:"from" description:"Badger database directory to migrate (database.dir by default)"`
+}
+
+type ExportCommand struct {
+	Args struct {
+		File string `positional-arg-name:"file" description:"File to write the dump to (stdout by default)"`
+	} `positional-args:"yes"`
+}
+
+type ImportCommand struct {
+	Args struct {
+		File string `positional-arg-name:"file" required:"yes" description:"Dump to restore (- for stdin)"`
+	} `positional-args:"yes"`
+}
+
+type CheckConfigCommand struct {
+	Args struct {
+		Feeds []string `positional-arg-name:"feed" description:"IDs of feeds to print the effective configuration of (all feeds by default)"`
+	} `positional-args:"yes"`
+}
+
+type ImportFeedsCommand struct {
+	Template string `long:"template" description:"ID of a configured feed to copy settings from"`
+	Output   string `long:"output" short:"o" description:"File to write the TOML fragment to (stdout by default)"`
+	Args     struct {
+		File string `positional-arg-name:"file" required:"yes" description:"YouTube subscriptions CSV (Google Takeout) or OPML file (- for stdin)"`
+	} `positional-args:"yes"`
+}
+
+// commandName returns the full name of the active command, e.g. "list feeds"
+func commandName(cmd *flags.Command) string {
+	var names []string
+	for ; cmd != nil; cmd = cmd.Active {
+		names = append(names, cmd.Name)
+	}
+	return strings.Join(names, " ")
+}
+
+// readOnlyCommands don't modify the database, so they can share it with each other
+// and with a running server using SQLite.
+var readOnlyCommands = map[string]bool{
+	"list feeds":    true,
+	"list episodes": true,
+	"db stats":      true,
+	"export":        true,
+}
+
+// remoteCommands are sent to the running server when its database is locked (see runRemote).
+// Other commands read or write files on the local machine or replace the database, so they
+// require the server to be stopped.
+var remoteCommands = map[string]bool{
+	"update":         true,
+	"list feeds":     true,
+	"list episodes":  true,
+	"retry":          true,
+	"delete-episode": true,
+	"cleanup":        true,
+	"filter":         true,
+	"db stats":       true,
+}
+
+// cli holds state shared by commands
+type cli struct {
+	opts     *Opts
+	cfg      *Config
+	database db.Storage
+	storage  fs.Storage
+	events   *events.Bus
+	out      io.Writer
+}
+
+// runCommand runs the command, args are the command line arguments it was parsed from
+func runCommand(ctx context.Context, opts *Opts, name string, args []string) error {
+	c := &cli{opts: opts, out: os.Stdout}
+
+	if name == "check-config" {
+		return c.checkConfig()
+	}
+
+	// Importing feeds only generates configuration, so the database isn't needed
+	if name == "import-feeds" {
+		cfg, err := LoadConfig(opts.ConfigPath)
+		if err != nil {
+			return errors.Wrap(err, "failed to load configuration file")
+		}
+		c.cfg = cfg
+		return c.importFeeds()
+	}
+
+	readOnly := readOnlyCommands[name]
+	if readOnly && !opts.Debug {
+		// Keep the output clean
+		log.SetLevel(log.WarnLevel)
+	}
+
+	cfg, err := LoadConfig(opts.ConfigPath)
+	if err != nil {
+		return errors.Wrap(err, "failed to load configuration file")
+	}
+	c.cfg = cfg
+
+	// Commands changing data are sent to the running server, so they don't race with its updates.
+	// The database is used directly when the server isn't running.
+	if remoteCommands[name] && !readOnly && len(cfg.Server.Auth.Users) > 0 {
+		if err := c.runRemote(ctx, args); !errors.Is(err, errServerUnavailable) {
+			return err
+		}
+	}
+
+	dbConfig := cfg.Database
+	dbConfig.ReadOnly = readOnly
+	c.database, err = db.Open(&dbConfig)
+	if err != nil {
+		if strings.Contains(err.Error(), "Another process is using this Badger database") {
+			if remoteCommands[name] {
+				return errors.Wrap(c.runRemote(ctx, args), "database is in use by another podsync process")
+			}
+			return errors.Errorf("database is in use by another podsync process, stop the server before running %q", name)
+		}
+		return err
+	}
+	defer func() {
+		if err := c.database.Close(); err != nil {
+			log.WithError(err).Error("failed to close database")
+		}
+	}()
+
+	c.storage, err = openStorage(cfg)
+	if err != nil {
+		return errors.Wrap(err, "failed to open storage")
+	}
+
+	if !readOnly {
+		c.events = newEventBus(cfg, c.database)
+		defer closeEventBus(c.events)
+	}
+
+	return c.run(ctx, name)
+}
+
+// run dispatches a command that needs the database
+func (c *cli) run(ctx context.Context, name string) error {
+	switch name {
+	case "update":
+		return c.update(ctx)
+	case "list feeds":
+		return c.listFeeds(ctx)
+	case "list episodes":
+		return c.listEpisodes(ctx)
+	case "retry":
+		return c.retry(ctx)
+	case "delete-episode":
+		return c.deleteEpisode(ctx)
+	case "cleanup":
+		return c.cleanup(ctx)
+	case "filter":
+		return c.filter(ctx)
+	case "db stats":
+		return c.dbStats(ctx)
+	case "db migrate":
+		return c.dbMigrate(ctx)
+	case "export":
+		return c.export(ctx)
+	case "import":
+		return c.importDump(ctx)
+	default:
+		return errors.Errorf("unknown command %q", name)
+	}
+}
+
+// print writes v as JSON if requested, otherwise renders a human readable table
+func (c *cli) print(v interface{}, table func(w io.Writer)) error {
+	if c.opts.JSON {
+		encoder := json.NewEncoder(c.out)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(v)
+	}
+
+	w := tabwriter.NewWriter(c.out, 0, 0, 2, ' ', 0)
+	table(w)
+	return w.Flush()
+}
+
+// feedConfigs returns configs of the given feeds, or all feeds sorted by ID
+func (c *cli) feedConfigs(ids []string) ([]*feed.Config, error) {
+	if len(ids) == 0 {
+		for id := range c.cfg.Feeds {
+			ids = append(ids, id)
+		}
+		sort.Strings(ids)
+	}
+
+	configs := make([]*feed.Config, 0, len(ids))
+	for _, id := range ids {
+		cfg, ok := c.cfg.Feeds[id]
+		if !ok {
+			return nil, errors.Errorf("unknown feed %q", id)
+		}
+		configs = append(configs, cfg)
+	}
+
+	return configs, nil
+}
+
+type updateResult struct {
+	FeedID string `json:"feed_id"`
+	Error  string `json:"error,omitempty"`
+}
+
+func (c *cli) update(ctx context.Context) error {
+	configs, err := c.feedConfigs(c.opts.Update.Args.Feeds)
+	if err != nil {
+		return err
+	}
+
+	manager, err := newManager(ctx, c.cfg, c.database, c.storage, c.events)
+	if err != nil {
+		return err
+	}
+
+	var (
+		results []updateResult
+		failed  int
+	)
+
+	for _, feedConfig := range configs {
+		result := updateResult{FeedID: feedConfig.ID}
+		if err := manager.Update(ctx, feedConfig); err != nil {
+			result.Error = err.Error()
+			failed++
+		}
+		results = append(results, result)
+	}
+
+	if err := manager.ApplyDiskQuota(ctx); err != nil {
+		log.WithError(err).Error("failed to apply disk quota")
+	}
+
+	if err := c.print(results, func(w io.Writer) {
+		fmt.Fprintln(w, "FEED\tRESULT")
+		for _, result := range results {
+			status := "updated"
+			if result.Error != "" {
+				status = result.Error
+			}
+			fmt.Fprintf(w, "%s\t%s\n", result.FeedID, status)
+		}
+	}); err != nil {
+		return err
+	}
+
+	if failed > 0 {
+		return errors.Errorf("%d feed(s) failed to update", failed)
+	}
+
+	return nil
+}
+
+type feedSummary struct {
+	ID         string                      `json:"id"`
+	Title      string                      `json:"title,omitempty"`
+	URL        string                      `json:"url,omitempty"`
+	Configured bool                        `json:"configured"`
+	Episodes   map[model.EpisodeStatus]int `json:"episodes"`
+	Size       int64                       `json:"size"`
+	UpdatedAt  *time.Time                  `json:"updated_at,omitempty"`
+}
+
+func (c *cli) listFeeds(ctx context.Context) error {
+	summaries := map[string]*feedSummary{}
+	for id, cfg := range c.cfg.Feeds {
+		url := cfg.URL
+		if cfg.IsMerged() {
+			urls := make([]string, 0, len(cfg.Sources))
+			for _, source := range cfg.Sources {
+				urls = append(urls, source.URL)
+			}
+			url = strings.Join(urls, " ")
+		}
+		summaries[id] = &feedSummary{ID: id, URL: url, Configured: true, Episodes: map[model.EpisodeStatus]int{}}
+	}
+
+	// Feeds removed from the config are listed too, as their data is still around
+	if err := c.database.WalkFeeds(ctx, func(f *model.Feed) error {
+		summary, ok := summaries[f.ID]
+		if !ok {
+			summary = &feedSummary{ID: f.ID, Episodes: map[model.EpisodeStatus]int{}}
+			summaries[f.ID] = summary
+		}
+
+		summary.Title = f.Title
+		if !f.UpdatedAt.IsZero() {
+			updatedAt := f.UpdatedAt
+			summary.UpdatedAt = &updatedAt
+		}
+		return nil
+	}); err != nil {
+		return errors.Wrap(err, "failed to walk feeds")
+	}
+
+	list := make([]*feedSummary, 0, len(summaries))
+	for _, summary := range summaries {
+		if err := c.database.WalkEpisodes(ctx, summary.ID, func(episode *model.Episode) error {
+			summary.Episodes[episode.Status]++
+			if episode.Status == model.EpisodeDownloaded {
+				summary.Size += feed.EpisodeDiskSize(episode)
+			}
+			return nil
+		}); err != nil {
+			return errors.Wrapf(err, "failed to walk episodes of %q", summary.ID)
+		}
+		list = append(list, summary)
+	}
+
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].ID < list[j].ID
+	})
+
+	return c.print(list, func(w io.Writer) {
+		fmt.Fprintln(w, "FEED\tDOWNLOADED\tNEW\tERROR\tCLEANED\tSIZE\tUPDATED\tTITLE")
+		for _, summary := range list {
+			updated := "-"
+			if summary.UpdatedAt != nil {
+				updated = summary.UpdatedAt.Local().Format(time.DateTime)
+			}
+
+			title := summary.Title
+			if !summary.Configured {
+				title += " (not in config)"
+			}
+
+			fmt.Fprintf(w, "%s\t%d\t%d\t%d\t%d\t%s\t%s\t%s\n",
+				summary.ID,
+				summary.Episodes[model.EpisodeDownloaded],
+				summary.Episodes[model.EpisodeNew],
+				summary.Episodes[model.EpisodeError],
+				summary.Episodes[model.EpisodeCleaned],
+				feed.ByteSize(summary.Size),
+				updated,
+				title)
+		}
+	})
+}
+
+func (c *cli) listEpisodes(ctx context.Context) error {
+	var (
+		cmd    = c.opts.List.Episodes
+		feedID = cmd.Args.Feed
+		list   = []*model.Episode{}
+	)
+
+	if _, err := c.database.GetFeed(ctx, feedID); errors.Is(err, model.ErrNotFound) {
+		return errors.Errorf("unknown feed %q", feedID)
+	} else if err != nil {
+		return errors.Wrapf(err, "failed to query feed %q", feedID)
+	}
+
+	if err := c.database.WalkEpisodes(ctx, feedID, func(episode *model.Episode) error {
+		if cmd.Status == "" || string(episode.Status) == cmd.Status {
+			list = append(list, episode)
+		}
+		return nil
+	}); err != nil {
+		return errors.Wrapf(err, "failed to walk episodes of %q", feedID)
+	}
+
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].PubDate.After(list[j].PubDate)
+	})
+
+	return c.print(list, func(w io.Writer) {
+		fmt.Fprintln(w, "EPISODE\tSTATUS\tPUBLISHED\tSIZE\tPINNED\tTITLE")
+		for _, episode := range list {
+			var pinned, size = "", "-"
+			if episode.Pinned {
+				pinned = "yes"
+			}
+			if episode.Status == model.EpisodeDownloaded {
+				size = feed.ByteSize(feed.EpisodeDiskSize(episode)).String()
+			}
+
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\n",
+				episode.ID,
+				episode.Status,
+				episode.PubDate.Format(time.DateOnly),
+				size,
+				pinned,
+				episode.Title)
+		}
+	})
+}
+
+type retryResult struct {
+	EpisodeID string              `json:"episode_id"`
+	Status    model.EpisodeStatus `json:"status"`
+}
+
+func (c *cli) retry(ctx context.Context) error {
+	var (
+		args = c.opts.Retry.Args
+		ids  []string
+	)
+
+	configs, err := c.feedConfigs([]string{args.Feed})
+	if err != nil {
+		return err
+	}
+
+	if args.Episode != "" {
+		// Removed and failed episodes are downloaded again on the next update
+		err := c.database.UpdateEpisode(args.Feed, args.Episode, func(episode *model.Episode) error {
+			if episode.Status == model.EpisodeDownloaded {
+				return errors.Errorf("episode %q is already downloaded", args.Episode)
+			}
+			episode.Status = model.EpisodeNew
+			return nil
+		})
+		if errors.Is(err, model.ErrNotFound) {
+			return errors.Errorf("episode %q not found in %q", args.Episode, args.Feed)
+		} else if err != nil {
+			return err
+		}
+		ids = append(ids, args.Episode)
+	} else if err := c.database.WalkEpisodes(ctx, args.Feed, func(episode *model.Episode) error {
+		if episode.Status == model.EpisodeError {
+			ids = append(ids, episode.ID)
+		}
+		return nil
+	}); err != nil {
+		return err
+	}
+
+	if len(ids) == 0 {
+		log.Warnf("no failed episodes in %q", args.Feed)
+	}
+
+	manager, err := newManager(ctx, c.cfg, c.database, c.storage, c.events)
+	if err != nil {
+		return err
+	}
+
+	// Episodes no longer listed by the source are dropped by the update
+	updateErr := manager.Update(ctx, configs[0])
+	if err := manager.ApplyDiskQuota(ctx); err != nil {
+		log.WithError(err).Error("failed to apply disk quota")
+	}
+
+	results := make([]retryResult, 0, len(ids))
+	for _, id := range ids {
+		result := retryResult{EpisodeID: id, Status: "removed"}
+		if episode, err := c.database.GetEpisode(ctx, args.Feed, id); err == nil {
+			result.Status = episode.Status
+		}
+		results = append(results, result)
+	}
+
+	if err := c.print(results, func(w io.Writer) {
+		fmt.Fprintln(w, "EPISODE\tSTATUS")
+		for _, result := range results {
+			fmt.Fprintf(w, "%s\t%s\n", result.EpisodeID, result.Status)
+		}
+	}); err != nil {
+		return err
+	}
+
+	return updateErr
+}
+
+func (c *cli) deleteEpisode(ctx context.Context) error {
+	args := c.opts.DeleteEpisode.Args
+
+	configs, err := c.feedConfigs([]string{args.Feed})
+	if err != nil {
+		return err
+	}
+
+	manager, err := update.NewUpdater(c.cfg.Feeds, nil, c.cfg.Server.Hostname, nil, nil, c.database, c.storage, c.cfg.DiskQuota, c.events)
+	if err != nil {
+		return err
+	}
+
+	if err := manager.DeleteEpisode(ctx, configs[0], args.Episode); err != nil {
+		if errors.Is(err, model.ErrNotFound) {
+			return errors.Errorf("episode %q not found in %q", args.Episode, args.Feed)
+		}
+		return err
+	}
+
+	if err := manager.BuildXML(ctx, configs[0]); err != nil {
+		return errors.Wrap(err, "failed to rebuild XML feed")
+	}
+
+	return c.print(retryResult{EpisodeID: args.Episode, Status: model.EpisodeCleaned}, func(w io.Writer) {
+		fmt.Fprintf(w, "deleted %s from %s\n", args.Episode, args.Feed)
+	})
+}
+
+func (c *cli) cleanup(ctx context.Context) error {
+	cmd := c.opts.Cleanup
+
+	configs, err := c.feedConfigs(cmd.Args.Feeds)
+	if err != nil {
+		return err
+	}
+
+	manager, err := update.NewUpdater(c.cfg.Feeds, nil, c.cfg.Server.Hostname, nil, nil, c.database, c.storage, c.cfg.DiskQuota, c.events)
+	if err != nil {
+		return err
+	}
+
+	var (
+		result  *multierror.Error
+		removed = []update.Removal{}
+	)
+
+	for _, feedConfig := range configs {
+		list, err := manager.Cleanup(ctx, feedConfig, cmd.DryRun)
+		if err != nil {
+			result = multierror.Append(result, errors.Wrapf(err, "cleanup of %q failed", feedConfig.ID))
+		}
+		removed = append(removed, list...)
+	}
+
+	// Disk quota applies to all feeds at once
+	if len(cmd.Args.Feeds) == 0 {
+		list, err := manager.EnforceDiskQuota(ctx, cmd.DryRun)
+		if err != nil {
+			result = multierror.Append(result, errors.Wrap(err, "disk quota eviction failed"))
+		}
+		removed = append(removed, list...)
+	}
+
+	if !cmd.DryRun {
+		if err := c.rebuildFeeds(ctx, manager, removed); err != nil {
+			result = multierror.Append(result, err)
+		}
+	}
+
+	if err := c.printRemovals(removed, cmd.DryRun); err != nil {
+		return err
+	}
+
+	return result.ErrorOrNil()
+}
+
+func (c *cli) filter(ctx context.Context) error {
+	cmd := c.opts.Filter
+
+	configs, err := c.feedConfigs(cmd.Args.Feeds)
+	if err != nil {
+		return err
+	}
+
+	manager, err := update.NewUpdater(c.cfg.Feeds, nil, c.cfg.Server.Hostname, nil, nil, c.database, c.storage, c.cfg.DiskQuota, c.events)
+	if err != nil {
+		return err
+	}
+
+	var (
+		result  *multierror.Error
+		removed = []update.Removal{}
+	)
+
+	for _, feedConfig := range configs {
+		list, err := manager.ApplyFilters(ctx, feedConfig, cmd.DryRun)
+		if err != nil {
+			result = multierror.Append(result, errors.Wrapf(err, "filtering of %q failed", feedConfig.ID))
+		}
+		removed = append(removed, list...)
+	}
+
+	if !cmd.DryRun {
+		if err := c.rebuildFeeds(ctx, manager, removed); err != nil {
+			result = multierror.Append(result, err)
+		}
+	}
+
+	if err := c.printRemovals(removed, cmd.DryRun); err != nil {
+		return err
+	}
+
+	return result.ErrorOrNil()
+}
+
+// rebuildFeeds rebuilds XML of feeds episodes were removed from
+func (c *cli) rebuildFeeds(ctx context.Context, manager *update.Manager, removed []update.Removal) error {
+	var result *multierror.Error
+
+	changed := map[string]struct{}{}
+	for _, removal := range removed {
+		changed[removal.FeedID] = struct{}{}
+	}
+
+	for feedID := range changed {
+		if err := manager.BuildXML(ctx, c.cfg.Feeds[feedID]); err != nil {
+			result = multierror.Append(result, errors.Wrapf(err, "failed to rebuild XML feed of %q", feedID))
+		}
+	}
+
+	return result.ErrorOrNil()
+}
+
+func (c *cli) printRemovals(removed []update.Removal, dryRun bool) error {
+	return c.print(removed, func(w io.Writer) {
+		action := "REMOVED"
+		if dryRun {
+			action = "WOULD REMOVE"
+		}
+
+		fmt.Fprintf(w, "FEED\tEPISODE\tSIZE\t%s\n", action)
+		for _, removal := range removed {
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\n",
+				removal.FeedID,
+				removal.Episode.ID,
+				feed.ByteSize(feed.EpisodeDiskSize(removal.Episode)),
+				removal.Episode.Title)
+		}
+	})
+}
+
+type configCheck struct {
+	Valid  bool     `json:"valid"`
+	Feeds  int      `json:"feeds,omitempty"`
+	Errors []string `json:"errors,omitempty"`
+	// Effective holds feed settings after applying defaults and templates
+	Effective map[string]map[string]interface{} `json:"effective,omitempty"`
+}
+
+func (c *cli) checkConfig() error {
+	var check configCheck
+
+	cfg, err := LoadConfig(c.opts.ConfigPath)
+	if err != nil {
+		var merr *multierror.Error
+		if errors.As(err, &merr) {
+			for _, err := range merr.Errors {
+				check.Errors = append(check.Errors, err.Error())
+			}
+		} else {
+			check.Errors = append(check.Errors, err.Error())
+		}
+	} else {
+		check.Valid = true
+		check.Feeds = len(cfg.Feeds)
+		check.Effective = map[string]map[string]interface{}{}
+
+		ids := c.opts.CheckConfig.Args.Feeds
+		if len(ids) == 0 {
+			ids = sortedKeys(cfg.effective)
+		}
+		for _, id := range ids {
+			table, ok := cfg.effective[id]
+			if !ok {
+				return errors.Errorf("feed %q not found in config", id)
+			}
+			check.Effective[id] = table
+		}
+	}
+
+	var effective strings.Builder
+	for _, id := range sortedKeys(check.Effective) {
+		out, err := renderFeed(id, check.Effective[id], "")
+		if err != nil {
+			return errors.Wrapf(err, "failed to render configuration of %q", id)
+		}
+		effective.WriteString(out + "\n")
+	}
+
+	if err := c.print(check, func(w io.Writer) {
+		if check.Valid {
+			fmt.Fprint(w, effective.String())
+			fmt.Fprintf(w, "%s is valid (feeds: %d)\n", c.opts.ConfigPath, check.Feeds)
+			return
+		}
+
+		fmt.Fprintf(w, "%s is invalid:\n", c.opts.ConfigPath)
+		for _, msg := range check.Errors {
+			fmt.Fprintf(w, "  - %s\n", msg)
+		}
+	}); err != nil {
+		return err
+	}
+
+	if !check.Valid {
+		return errors.New("invalid configuration")
+	}
+
+	return nil
+}
+
+type dbStats struct {
+	Type          string                      `json:"type"`
+	Path          string                      `json:"path"`
+	Version       int                         `json:"version"`
+	DiskSize      int64                       `json:"disk_size"`
+	Feeds         int                         `json:"feeds"`
+	Episodes      map[model.EpisodeStatus]int `json:"episodes"`
+	EpisodesSize  int64                       `json:"episodes_size"`
+	Tokens        int                         `json:"tokens"`
+	AccessRecords int                         `json:"access_records"`
+}
+
+func (c *cli) dbStats(ctx context.Context) error {
+	stats := dbStats{
+		Type:     c.cfg.Database.Type,
+		Path:     c.cfg.Database.Dir,
+		Episodes: map[model.EpisodeStatus]int{},
+	}
+
+	version, err := c.database.Version()
+	if err != nil {
+		return errors.Wrap(err, "failed to read database version")
+	}
+	stats.Version = version
+
+	if err := filepath.Walk(c.cfg.Database.Dir, func(_ string, info os.FileInfo, err error) error {
+		if err == nil && !info.IsDir() {
+			stats.DiskSize += info.Size()
+		}
+		return nil
+	}); err != nil {
+		return err
+	}
+
+	var feedIDs []string
+	if err := c.database.WalkFeeds(ctx, func(f *model.Feed) error {
+		feedIDs = append(feedIDs, f.ID)
+		return nil
+	}); err != nil {
+		return errors.Wrap(err, "failed to walk feeds")
+	}
+	stats.Feeds = len(feedIDs)
+
+	for _, feedID := range feedIDs {
+		if err := c.database.WalkEpisodes(ctx, feedID, func(episode *model.Episode) error {
+			stats.Episodes[episode.Status]++
+			if episode.Status == model.EpisodeDownloaded {
+				stats.EpisodesSize += feed.EpisodeDiskSize(episode)
+			}
+			return nil
+		}); err != nil {
+			return errors.Wrapf(err, "failed to walk episodes of %q", feedID)
+		}
+
+		if err := c.database.WalkAccess(ctx, feedID, func(*model.Access) error {
+			stats.AccessRecords++
+			return nil
+		}); err != nil {
+			return errors.Wrapf(err, "failed to walk access records of %q", feedID)
+		}
+	}
+
+	if err := c.database.WalkTokens(ctx, func(*model.Token) error {
+		stats.Tokens++
+		return nil
+	}); err != nil {
+		return errors.Wrap(err, "failed to walk tokens")
+	}
+
+	return c.print(stats, func(w io.Writer) {
+		fmt.Fprintf(w, "type\t%s\n", stats.Type)
+		fmt.Fprintf(w, "path\t%s\n", stats.Path)
+		fmt.Fprintf(w, "version\t%d\n", stats.Version)
+		fmt.Fprintf(w, "disk size\t%s\n", feed.ByteSize(stats.DiskSize))
+		fmt.Fprintf(w, "feeds\t%d\n", stats.Feeds)
+		for _, status := range []model.EpisodeStatus{model.EpisodeNew, model.EpisodeDownloaded, model.EpisodeError, model.EpisodeCleaned, model.EpisodeFiltered} {
+			fmt.Fprintf(w, "episodes (%s)\t%d\n", status, stats.Episodes[status])
+		}
+		fmt.Fprintf(w, "downloaded size\t%s\n", feed.ByteSize(stats.EpisodesSize))
+		fmt.Fprintf(w, "tokens\t%d\n", stats.Tokens)
+		fmt.Fprintf(w, "access records\t%d\n", stats.AccessRecords)
+	})
+}
+
+func (c *cli) dbMigrate(ctx context.Context) error {
+	if c.cfg.Database.Type != db.TypeSQLite {
+		return errors.Errorf("set database.type to %q to migrate to SQLite", db.TypeSQLite)
+	}
+
+	empty := true
+	if err := c.database.WalkFeeds(ctx, func(*model.Feed) error {
+		empty = false
+		return nil
+	}); err != nil {
+		return errors.Wrap(err, "failed to read SQLite database")
+	}
+	if !empty {
+		return errors.New("SQLite database already has feeds, migration can only be done once")
+	}
+
+	from := c.opts.DB.Migrate.From
+	if from == "" {
+		from = c.cfg.Database.Dir
+	}
+
+	source, err := db.NewBadger(&db.Config{Dir: from, Badger: c.cfg.Database.Badger, ReadOnly: true})
+	if err != nil {
+		return errors.Wrapf(err, "failed to open Badger database %q", from)
+	}
+	defer source.Close()
+
+	// Records are copied into a new database that replaces the empty one only once complete,
+	// so a failed migration leaves nothing behind and can be run again
+	dir := c.cfg.Database.Dir
+	tmpDir, err := os.MkdirTemp(dir, ".migrate-")
+	if err != nil {
+		return errors.Wrap(err, "failed to create temp directory")
+	}
+	defer os.RemoveAll(tmpDir)
+
+	target, err := db.NewSQLite(&db.Config{Dir: tmpDir})
+	if err != nil {
+		return errors.Wrap(err, "failed to create SQLite database")
+	}
+
+	stats, err := db.Copy(ctx, source, target)
+	if closeErr := target.Close(); err == nil && closeErr != nil {
+		err = errors.Wrap(closeErr, "failed to close SQLite database")
+	}
+	if err != nil {
+		return errors.Wrap(err, "migration failed")
+	}
+
+	if err := c.database.Close(); err != nil {
+		return errors.Wrap(err, "failed to close SQLite database")
+	}
+
+	path := filepath.Join(dir, db.SQLiteFileName)
+	for _, suffix := range []string{"-wal", "-shm"} {
+		if err := os.Remove(path + suffix); err != nil && !os.IsNotExist(err) {
+			return errors.Wrap(err, "failed to remove SQLite journal")
+		}
+	}
+
+	if err := os.Rename(filepath.Join(tmpDir, db.SQLiteFileName), path); err != nil {
+		return errors.Wrap(err, "failed to replace SQLite database")
+	}
+
+	return c.print(stats, func(w io.Writer) {
+		fmt.Fprintf(w, "migrated %d feeds, %d episodes, %d tokens and %d access records from %s\n",
+			stats.Feeds, stats.Episodes, stats.Tokens, stats.Access, from)
+	})
+}
+
+func (c *cli) export(ctx context.Context) error {
+	file := c.opts.Export.Args.File
+	if file == "" || file == "-" {
+		stats, err := db.Export(ctx, c.database, c.out)
+		if err != nil {
+			return err
+		}
+
+		log.WithFields(log.Fields{"feeds": stats.Feeds, "episodes": stats.Episodes, "tokens": stats.Tokens}).Debug("export completed")
+		return nil
+	}
+
+	// Write to a temp file first, so an existing backup is never left half written
+	tmp, err := os.CreateTemp(filepath.Dir(file), filepath.Base(file)+".*")
+	if err != nil {
+		return errors.Wrap(err, "failed to create dump file")
+	}
+	defer os.Remove(tmp.Name())
+
+	stats, err := db.Export(ctx, c.database, tmp)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+
+	if err := os.Rename(tmp.Name(), file); err != nil {
+		return errors.Wrap(err, "failed to save dump file")
+	}
+
+	return c.print(stats, func(w io.Writer) {
+		fmt.Fprintf(w, "exported %d feeds, %d episodes and %d tokens to %s\n", stats.Feeds, stats.Episodes, stats.Tokens, file)
+	})
+}
+
+func (c *cli) importDump(ctx context.Context) error {
+	file := c.opts.Import.Args.File
+
+	var reader io.Reader = os.Stdin
+	if file != "-" {
+		f, err := os.Open(file)
+		if err != nil {
+			return errors.Wrap(err, "failed to open dump file")
+		}
+		defer f.Close()
+		reader = f
+	}
+
+	stats, err := db.Import(ctx, c.database, reader)
+	if err != nil {
+		return errors.Wrap(err, "import failed")
+	}
+
+	return c.print(stats, func(w io.Writer) {
+		fmt.Fprintf(w, "imported %d feeds, %d episodes and %d tokens\n", stats.Feeds, stats.Episodes, stats.Tokens)
+	})
+}
+
+type importedFeed struct {
+	ID    string `json:"id,omitempty"`
+	URL   string `json:"url"`
+	Title string `json:"title,omitempty"`
+	Error string `json:"error,omitempty"` // Why the subscription was skipped
+}
+
+var feedIDReplacer = regexp.MustCompile(`[^a-z0-9]+`)
+
+// importFeeds converts a subscriptions export to [feeds] configuration blocks
+func (c *cli) importFeeds() error {
+	cmd := c.opts.ImportFeeds
+
+	var reader io.Reader = os.Stdin
+	if cmd.Args.File != "-" {
+		f, err := os.Open(cmd.Args.File)
+		if err != nil {
+			return errors.Wrap(err, "failed to open subscriptions file")
+		}
+		defer f.Close()
+		reader = f
+	}
+
+	subscriptions, err := feed.ReadSubscriptions(reader)
+	if err != nil {
+		return errors.Wrap(err, "failed to read subscriptions")
+	}
+
+	template := map[string]interface{}{}
+	if cmd.Template != "" {
+		if _, ok := c.cfg.Feeds[cmd.Template]; !ok {
+			return errors.Errorf("template feed %q not found in config", cmd.Template)
+		}
+
+		tree, err := toml.LoadFile(c.opts.ConfigPath)
+		if err != nil {
+			return errors.Wrap(err, "failed to read config file")
+		}
+		if block, ok := tree.GetPath([]string{"feeds", cmd.Template}).(*toml.Tree); ok {
+			template = block.ToMap()
+		}
+		delete(template, "url")
+		delete(template, "sources")
+	}
+
+	// Subscriptions already in the config are skipped
+	var (
+		configured = map[string]struct{}{}
+		ids        = map[string]struct{}{}
+	)
+	for id, cfg := range c.cfg.Feeds {
+		ids[id] = struct{}{}
+		urls := []string{cfg.URL}
+		for _, source := range cfg.Sources {
+			urls = append(urls, source.URL)
+		}
+		for _, url := range urls {
+			if info, err := builder.ParseURL(url); err == nil {
+				configured[fmt.Sprintf("%s/%s", info.Provider, info.ItemID)] = struct{}{}
+			}
+		}
+	}
+
+	var (
+		imported = []importedFeed{}
+		fragment strings.Builder
+	)
+
+	for _, sub := range subscriptions {
+		result := importedFeed{URL: sub.URL, Title: sub.Title}
+
+		info, err := builder.ParseURL(sub.URL)
+		if err != nil {
+			result.Error = err.Error()
+			log.WithError(err).Warnf("skipping %q", sub.URL)
+			imported = append(imported, result)
+			continue
+		}
+
+		key := fmt.Sprintf("%s/%s", info.Provider, info.ItemID)
+		if _, ok := configured[key]; ok {
+			result.Error = "already configured"
+			log.Infof("skipping %q: already configured", sub.URL)
+			imported = append(imported, result)
+			continue
+		}
+		configured[key] = struct{}{}
+
+		result.ID = uniqueFeedID(sub.Title, info.ItemID, ids)
+		imported = append(imported, result)
+
+		block := make(map[string]interface{}, len(template)+1)
+		for key, value := range template {
+			block[key] = value
+		}
+		block["url"] = sub.URL
+
+		// Titles are kept as comments on a single line
+		out, err := renderFeed(result.ID, block, strings.Join(strings.Fields(sub.Title), " "))
+		if err != nil {
+			return errors.Wrapf(err, "failed to build configuration of %q", result.ID)
+		}
+		fragment.WriteString(out + "\n")
+	}
+
+	if cmd.Output == "" {
+		// The fragment is the output, skipped subscriptions are logged
+		_, err := io.WriteString(c.out, fragment.String())
+		return err
+	}
+
+	if err := os.WriteFile(cmd.Output, []byte(fragment.String()), 0o644); err != nil {
+		return errors.Wrap(err, "failed to write configuration")
+	}
+
+	return c.print(imported, func(w io.Writer) {
+		fmt.Fprintln(w, "ID\tURL\tTITLE")
+		for _, feed := range imported {
+			id := feed.ID
+			if feed.Error != "" {
+				id = "skipped: " + feed.Error
+			}
+			fmt.Fprintf(w, "%s\t%s\t%s\n", id, feed.URL, feed.Title)
+		}
+	})
+}
+
+// uniqueFeedID derives a feed ID from the title (or the item ID for titles without latin characters)
+func uniqueFeedID(title string, itemID string, ids map[string]struct{}) string {
+	base := strings.Trim(feedIDReplacer.ReplaceAllString(strings.ToLower(title), "_"), "_")
+	if base == "" {
+		base = itemID
+	}
+
+	id := base
+	for i := 2; ; i++ {
+		if _, ok := ids[id]; !ok {
+			break
+		}
+		id = fmt.Sprintf("%s_%d", base, i)
+	}
+
+	ids[id] = struct{}{}
+	return id
+}
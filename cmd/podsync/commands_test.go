@@ -0,0 +1,302 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/jessevdk/go-flags"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/mxpv/podsync/pkg/db"
+	"github.com/mxpv/podsync/pkg/feed"
+	"github.com/mxpv/podsync/pkg/fs"
+	"github.com/mxpv/podsync/pkg/model"
+	"github.com/mxpv/podsync/services/update"
+)
+
+func TestCommandName(t *testing.T) {
+	opts := Opts{}
+	parser := flags.NewParser(&opts, flags.HelpFlag)
+	parser.SubcommandsOptional = true
+
+	_, err := parser.ParseArgs([]string{"--json", "list", "episodes", "--status", "error", "abc"})
+	require.NoError(t, err)
+	assert.Equal(t, "list episodes", commandName(parser.Active))
+	assert.Equal(t, "abc", opts.List.Episodes.Args.Feed)
+	assert.Equal(t, "error", opts.List.Episodes.Status)
+	assert.True(t, opts.JSON)
+
+	// Serving stays the default
+	opts = Opts{}
+	parser = flags.NewParser(&opts, flags.HelpFlag)
+	parser.SubcommandsOptional = true
+	_, err = parser.ParseArgs([]string{"--headless"})
+	require.NoError(t, err)
+	assert.Nil(t, parser.Active)
+	assert.True(t, opts.Headless)
+}
+
+func newTestCLI(t *testing.T, opts *Opts) (*cli, *bytes.Buffer) {
+	ctx := context.Background()
+	now := time.Now().UTC()
+
+	database, err := db.NewBadger(&db.Config{Dir: t.TempDir()})
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = database.Close() })
+
+	storage, err := fs.NewLocal(t.TempDir(), false, false)
+	require.NoError(t, err)
+
+	err = database.AddFeed(ctx, "a", &model.Feed{Title: "A", Episodes: []*model.Episode{
+		{ID: "1", Title: "New", Status: model.EpisodeDownloaded, Size: 10, PubDate: now},
+		{ID: "2", Title: "Old", Status: model.EpisodeDownloaded, Size: 10, PubDate: now.AddDate(0, 0, -1)},
+		{ID: "3", Title: "Failed", Status: model.EpisodeError, PubDate: now.AddDate(0, 0, -2)},
+	}})
+	require.NoError(t, err)
+
+	err = database.AddFeed(ctx, "removed", &model.Feed{Title: "Removed"})
+	require.NoError(t, err)
+
+	out := &bytes.Buffer{}
+	return &cli{
+		opts: opts,
+		cfg: &Config{Feeds: map[string]*feed.Config{
+			"a": {ID: "a", URL: "https://youtube.com/a", Format: model.FormatAudio, Clean: &feed.Cleanup{KeepLast: 1}},
+		}},
+		database: database,
+		storage:  storage,
+		out:      out,
+	}, out
+}
+
+func TestListFeeds(t *testing.T) {
+	c, out := newTestCLI(t, &Opts{JSON: true})
+	require.NoError(t, c.listFeeds(context.Background()))
+
+	var list []feedSummary
+	require.NoError(t, json.Unmarshal(out.Bytes(), &list))
+	require.Len(t, list, 2)
+
+	assert.Equal(t, "a", list[0].ID)
+	assert.True(t, list[0].Configured)
+	assert.Equal(t, 2, list[0].Episodes[model.EpisodeDownloaded])
+	assert.Equal(t, 1, list[0].Episodes[model.EpisodeError])
+	assert.EqualValues(t, 20, list[0].Size)
+
+	assert.Equal(t, "removed", list[1].ID)
+	assert.False(t, list[1].Configured)
+}
+
+func TestListEpisodes(t *testing.T) {
+	opts := &Opts{}
+	opts.List.Episodes.Args.Feed = "a"
+	opts.List.Episodes.Status = "error"
+
+	c, out := newTestCLI(t, opts)
+	require.NoError(t, c.listEpisodes(context.Background()))
+	assert.Contains(t, out.String(), "Failed")
+	assert.NotContains(t, out.String(), "Old")
+
+	opts.List.Episodes.Args.Feed = "missing"
+	assert.Error(t, c.listEpisodes(context.Background()))
+}
+
+func TestCleanupDryRun(t *testing.T) {
+	opts := &Opts{JSON: true}
+	opts.Cleanup.DryRun = true
+
+	c, out := newTestCLI(t, opts)
+	require.NoError(t, c.cleanup(context.Background()))
+
+	var removed []update.Removal
+	require.NoError(t, json.Unmarshal(out.Bytes(), &removed))
+	require.Len(t, removed, 1)
+	assert.Equal(t, "2", removed[0].Episode.ID)
+
+	episode, err := c.database.GetEpisode(context.Background(), "a", "2")
+	require.NoError(t, err)
+	assert.Equal(t, model.EpisodeDownloaded, episode.Status)
+}
+
+func TestFilter(t *testing.T) {
+	opts := &Opts{JSON: true}
+	opts.Filter.DryRun = true
+
+	c, out := newTestCLI(t, opts)
+	c.cfg.Feeds["a"].Filters.Title = "New"
+	require.NoError(t, c.filter(context.Background()))
+
+	var removed []update.Removal
+	require.NoError(t, json.Unmarshal(out.Bytes(), &removed))
+	require.Len(t, removed, 1)
+	assert.Equal(t, "2", removed[0].Episode.ID)
+
+	episode, err := c.database.GetEpisode(context.Background(), "a", "2")
+	require.NoError(t, err)
+	assert.Equal(t, model.EpisodeDownloaded, episode.Status)
+
+	opts.Filter.DryRun = false
+	out.Reset()
+	require.NoError(t, c.filter(context.Background()))
+
+	episode, err = c.database.GetEpisode(context.Background(), "a", "2")
+	require.NoError(t, err)
+	assert.Equal(t, model.EpisodeFiltered, episode.Status)
+}
+
+func TestImportFeeds(t *testing.T) {
+	path := setup(t, `
+[server]
+data_dir = "/data"
+
+[feeds]
+  [feeds.defaults]
+  url = "https://www.youtube.com/channel/UCxC5Ls6DwqV0e-CYcAKkExQ"
+  format = "audio"
+  page_size = 5
+  filters = { not_title = "(?i)#shorts" }
+`)
+	defer os.Remove(path)
+
+	subscriptions := filepath.Join(t.TempDir(), "subscriptions.csv")
+	require.NoError(t, os.WriteFile(subscriptions, []byte(`Channel Id,Channel Url,Channel Title
+UCxC5Ls6DwqV0e-CYcAKkExQ,http://www.youtube.com/channel/UCxC5Ls6DwqV0e-CYcAKkExQ,Level1Techs
+UC5XPnUk8Vvv_pWslhwom6Og,http://www.youtube.com/channel/UC5XPnUk8Vvv_pWslhwom6Og,Defaults!
+UCrlakW-ewUT8sOod6Wmzyow,http://www.youtube.com/channel/UCrlakW-ewUT8sOod6Wmzyow,日本語
+`), 0o644))
+
+	opts := &Opts{ConfigPath: path}
+	opts.ImportFeeds.Template = "defaults"
+	opts.ImportFeeds.Args.File = subscriptions
+
+	cfg, err := LoadConfig(path)
+	require.NoError(t, err)
+
+	out := &bytes.Buffer{}
+	c := &cli{opts: opts, cfg: cfg, out: out}
+	require.NoError(t, c.importFeeds())
+
+	// The fragment has to be valid configuration once added to [feeds]
+	fragment := out.String()
+	assert.NotContains(t, fragment, "[feeds]\n")
+	assert.Contains(t, fragment, "# Defaults!")
+
+	require.NoError(t, os.WriteFile(path, []byte("[server]\ndata_dir = \"/data\"\n\n[feeds]\n"+fragment), 0o644))
+	imported, err := LoadConfig(path)
+	require.NoError(t, err)
+	require.Len(t, imported.Feeds, 2)
+
+	// Existing feeds are skipped and IDs don't clash with configured ones
+	defaults := imported.Feeds["defaults_2"]
+	require.NotNil(t, defaults)
+	assert.Equal(t, "http://www.youtube.com/channel/UC5XPnUk8Vvv_pWslhwom6Og", defaults.URL)
+	assert.Equal(t, model.FormatAudio, defaults.Format)
+	assert.Equal(t, 5, defaults.PageSize)
+	assert.Equal(t, "(?i)#shorts", defaults.Filters.NotTitle)
+
+	assert.Equal(t, "http://www.youtube.com/channel/UCrlakW-ewUT8sOod6Wmzyow", imported.Feeds["UCrlakW-ewUT8sOod6Wmzyow"].URL)
+}
+
+func TestCheckConfig(t *testing.T) {
+	path := setup(t, `
+[feeds]
+  [feeds.A]
+  clean = { keep_last = -1 }
+`)
+
+	out := &bytes.Buffer{}
+	c := &cli{opts: &Opts{ConfigPath: path, JSON: true}, out: out}
+	assert.Error(t, c.checkConfig())
+
+	var check configCheck
+	require.NoError(t, json.Unmarshal(out.Bytes(), &check))
+	assert.False(t, check.Valid)
+	assert.NotEmpty(t, check.Errors)
+}
+
+func TestCheckConfigEffective(t *testing.T) {
+	t.Setenv("TEST_OWNER_EMAIL", "me@example.com")
+
+	path := setup(t, `
+[server]
+data_dir = "/data"
+
+[templates.audio]
+format = "audio"
+filters = { not_title = "(?i)trailer" }
+
+[feeds]
+  [feeds.A]
+  url = "https://youtube.com/channel/UCxC5Ls6DwqV0e-CYcAKkExQ"
+  extends = ["audio"]
+  custom = { ownerEmail = "${TEST_OWNER_EMAIL}" }
+
+  [feeds.B]
+  url = "https://youtube.com/channel/UC5XPnUk8Vvv_pWslhwom6Og"
+`)
+	defer os.Remove(path)
+
+	opts := &Opts{ConfigPath: path}
+	opts.CheckConfig.Args.Feeds = []string{"A"}
+
+	out := &bytes.Buffer{}
+	c := &cli{opts: opts, out: out}
+	require.NoError(t, c.checkConfig())
+
+	assert.Contains(t, out.String(), "[feeds.A]")
+	assert.Contains(t, out.String(), `format = "audio"`)
+	assert.Contains(t, out.String(), "[feeds.A.filters]")
+	// References aren't expanded, secrets stay out of the output
+	assert.Contains(t, out.String(), "${TEST_OWNER_EMAIL}")
+	assert.NotContains(t, out.String(), "me@example.com")
+	assert.NotContains(t, out.String(), "[feeds.B]")
+	assert.Contains(t, out.String(), "is valid (feeds: 2)")
+}
+
+func TestDBMigrate(t *testing.T) {
+	ctx := context.Background()
+
+	source, _ := newTestCLI(t, &Opts{})
+	badgerDir := t.TempDir()
+	badger, err := db.NewBadger(&db.Config{Dir: badgerDir})
+	require.NoError(t, err)
+	_, err = db.Copy(ctx, source.database, badger)
+	require.NoError(t, err)
+	require.NoError(t, badger.Close())
+
+	dir := t.TempDir()
+	database, err := db.NewSQLite(&db.Config{Dir: dir})
+	require.NoError(t, err)
+	defer database.Close()
+
+	opts := &Opts{}
+	opts.DB.Migrate.From = badgerDir
+	c := &cli{
+		opts:     opts,
+		cfg:      &Config{Database: db.Config{Type: db.TypeSQLite, Dir: dir}},
+		database: database,
+		out:      &bytes.Buffer{},
+	}
+	require.NoError(t, c.dbMigrate(ctx))
+
+	migrated, err := db.NewSQLite(&db.Config{Dir: dir})
+	require.NoError(t, err)
+	defer migrated.Close()
+
+	episode, err := migrated.GetEpisode(ctx, "a", "3")
+	require.NoError(t, err)
+	assert.Equal(t, "Failed", episode.Title)
+
+	// Temp databases are cleaned up
+	entries, err := os.ReadDir(dir)
+	require.NoError(t, err)
+	for _, entry := range entries {
+		assert.False(t, entry.IsDir(), entry.Name())
+	}
+}
@@ -13,10 +13,13 @@ import (
 	log "github.com/sirupsen/logrus"
 
 	"github.com/mxpv/podsync/pkg/db"
+	"github.com/mxpv/podsync/pkg/events"
 	"github.com/mxpv/podsync/pkg/feed"
 	"github.com/mxpv/podsync/pkg/fs"
 	"github.com/mxpv/podsync/pkg/model"
+	"github.com/mxpv/podsync/pkg/notify"
 	"github.com/mxpv/podsync/pkg/ytdl"
+	"github.com/mxpv/podsync/services/reconcile"
 	"github.com/mxpv/podsync/services/web"
 )
 
@@ -38,6 +41,21 @@ type Config struct {
 	Downloader ytdl.Config `toml:"downloader"`
 	// Global cleanup policy applied to feeds that don't specify their own cleanup policy
 	Cleanup *feed.Cleanup `toml:"cleanup"`
+	// DiskQuota is an optional limit of the total size of episodes across all feeds
+	DiskQuota *feed.DiskQuota `toml:"disk_quota"`
+	// RemovedFeeds configures what happens to data of feeds deleted from the config
+	RemovedFeeds *feed.RemovedFeeds `toml:"removed_feeds"`
+	// Reconcile configures periodic reconciliation of storage contents with the database
+	Reconcile reconcile.Config `toml:"reconcile"`
+	// Events configures sinks of episode and feed lifecycle events (webhooks)
+	Events events.Config `toml:"events"`
+	// Notifications configures messages sent to chat, push and email services
+	Notifications notify.Config `toml:"notifications"`
+	// TranscodeProfiles is a list of named ffmpeg profiles feeds can refer to with transcode_profile
+	TranscodeProfiles map[string]*feed.TranscodeProfile `toml:"transcode_profiles"`
+	// Defaults ([defaults]) and templates ([templates.X]) are merged into feed tables when loading the config,
+	// effective holds the resulting tables of each feed (see applyTemplates), with ${...} references not expanded
+	effective map[string]map[string]interface{}
 }
 
 type Log struct {
@@ -62,8 +80,41 @@ func LoadConfig(path string) (*Config, error) {
 		return nil, errors.Wrapf(err, "failed to read config file: %s", path)
 	}
 
-	config := Config{}
-	if err := toml.Unmarshal(data, &config); err != nil {
+	tree, err := toml.LoadBytes(data)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to unmarshal toml")
+	}
+
+	// Tables printed by check-config keep ${...} references as written, so secrets aren't shown
+	raw := tree.ToMap()
+
+	// Expand ${VAR} and ${file:...} references before anything reads the values
+	if err := interpolate(tree, nil); err != nil {
+		return nil, err
+	}
+
+	// Feeds inherit settings from [defaults] and [templates.X] before anything else is applied
+	effective, err := applyTemplates(tree.ToMap())
+	if err != nil {
+		return nil, err
+	}
+
+	for id, table := range effective {
+		feedTree, err := toml.TreeFromMap(table)
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to apply templates to %q", id)
+		}
+		tree.SetPath([]string{"feeds", id}, feedTree)
+	}
+
+	// Interpolation doesn't change the structure of tables, templates apply to the raw values the same way
+	shown, err := applyTemplates(raw)
+	if err != nil {
+		return nil, err
+	}
+
+	config := Config{effective: shown}
+	if err := tree.Unmarshal(&config); err != nil {
 		return nil, errors.Wrap(err, "failed to unmarshal toml")
 	}
 
@@ -104,6 +155,21 @@ func (c *Config) validate() error {
 		}
 	}
 
+	for user, password := range c.Server.Auth.Users {
+		if password == "" {
+			result = multierror.Append(result, errors.Errorf("password is required for user %q", user))
+		}
+	}
+
+	if _, err := web.ParseTrustedProxies(c.Server.TrustedProxies); err != nil {
+		result = multierror.Append(result, err)
+	}
+
+	// Tokens are created via the API, which is available to basic auth users only
+	if c.Server.Auth.Tokens && len(c.Server.Auth.Users) == 0 {
+		result = multierror.Append(result, errors.New("server auth tokens require at least one user to manage them"))
+	}
+
 	switch c.Storage.Type {
 	case "local":
 		if c.Storage.Local.DataDir == "" {
@@ -113,26 +179,122 @@ func (c *Config) validate() error {
 		if c.Storage.S3.EndpointURL == "" || c.Storage.S3.Region == "" || c.Storage.S3.Bucket == "" {
 			result = multierror.Append(result, errors.New("S3 storage requires endpoint_url, region and bucket to be set"))
 		}
+		if (c.Storage.S3.AccessKeyID == "") != (c.Storage.S3.SecretAccessKey == "") {
+			result = multierror.Append(result, errors.New("S3 access_key_id and secret_access_key must be set together"))
+		}
 	default:
 		result = multierror.Append(result, errors.Errorf("unknown storage type: %s", c.Storage.Type))
 	}
 
+	if err := c.Database.Validate(); err != nil {
+		result = multierror.Append(result, err)
+	}
+
+	if c.Cleanup != nil {
+		if err := feed.ValidateCleanup(c.Cleanup); err != nil {
+			result = multierror.Append(result, errors.Wrap(err, "invalid global cleanup policy"))
+		}
+	}
+
+	if c.DiskQuota != nil {
+		if err := feed.ValidateDiskQuota(c.DiskQuota); err != nil {
+			result = multierror.Append(result, errors.Wrap(err, "invalid disk_quota"))
+		}
+	}
+
+	if c.RemovedFeeds != nil {
+		if err := feed.ValidateRemovedFeeds(c.RemovedFeeds); err != nil {
+			result = multierror.Append(result, errors.Wrap(err, "invalid removed_feeds"))
+		}
+	}
+
+	if err := c.Reconcile.Validate(); err != nil {
+		result = multierror.Append(result, errors.Wrap(err, "invalid reconcile configuration"))
+	}
+	if c.Reconcile.Action == reconcile.ActionQuarantine && c.Storage.Type == "s3" {
+		result = multierror.Append(result, errors.New("reconcile action \"quarantine\" is not supported with S3 storage"))
+	}
+
+	if err := c.Events.Validate(); err != nil {
+		result = multierror.Append(result, errors.Wrap(err, "invalid events configuration"))
+	}
+
+	if err := c.Notifications.Validate(); err != nil {
+		result = multierror.Append(result, errors.Wrap(err, "invalid notifications configuration"))
+	}
+
 	if len(c.Feeds) == 0 {
 		result = multierror.Append(result, errors.New("at least one feed must be specified"))
 	}
 
 	for id, f := range c.Feeds {
-		if f.URL == "" {
-			result = multierror.Append(result, errors.Errorf("URL is required for %q", id))
+		if f.URL == "" && len(f.Sources) == 0 {
+			result = multierror.Append(result, errors.Errorf("URL or sources are required for %q", id))
+		}
+		if err := feed.ValidateSources(f.URL, f.Sources); err != nil {
+			result = multierror.Append(result, errors.Wrapf(err, "invalid sources for %q", id))
 		}
 		if err := feed.ValidateFilenameTemplate(f.FilenameTemplate); err != nil {
 			result = multierror.Append(result, errors.Wrapf(err, "invalid filename_template for %q", id))
 		}
+		if err := f.Filters.Compile(); err != nil {
+			result = multierror.Append(result, errors.Wrapf(err, "invalid filters.expr for %q", id))
+		}
 		if f.Format == model.FormatCustom {
 			if err := feed.ValidateCustomExtension(f.CustomFormat.Extension); err != nil {
 				result = multierror.Append(result, errors.Wrapf(err, "invalid custom_format.extension for %q", id))
 			}
 		}
+		if err := feed.ValidateMetadata(f.Metadata); err != nil {
+			result = multierror.Append(result, errors.Wrapf(err, "invalid metadata for %q", id))
+		}
+		if f.Clean != nil {
+			if err := feed.ValidateCleanup(f.Clean); err != nil {
+				result = multierror.Append(result, errors.Wrapf(err, "invalid cleanup policy for %q", id))
+			}
+		}
+		if err := feed.ValidatePins(&f.Pin); err != nil {
+			result = multierror.Append(result, errors.Wrapf(err, "invalid pin for %q", id))
+		}
+		if err := feed.ValidateArtwork(f.Artwork); err != nil {
+			result = multierror.Append(result, errors.Wrapf(err, "invalid artwork for %q", id))
+		}
+		if f.TranscodeProfileName != "" {
+			profile, ok := c.TranscodeProfiles[f.TranscodeProfileName]
+			if !ok {
+				result = multierror.Append(result, errors.Errorf("unknown transcode_profile %q for %q", f.TranscodeProfileName, id))
+			}
+			f.TranscodeProfile = profile
+		}
+
+		names := make(map[string]struct{}, len(f.Renditions))
+		for _, rendition := range f.Renditions {
+			if err := feed.ValidateRenditionName(rendition.Name); err != nil {
+				result = multierror.Append(result, errors.Wrapf(err, "invalid rendition for %q", id))
+				continue
+			}
+			if _, ok := names[rendition.Name]; ok {
+				result = multierror.Append(result, errors.Errorf("duplicate rendition %q for %q", rendition.Name, id))
+			}
+			names[rendition.Name] = struct{}{}
+
+			renditionID := fmt.Sprintf("%s-%s", id, rendition.Name)
+			if _, ok := c.Feeds[renditionID]; ok {
+				result = multierror.Append(result, errors.Errorf("rendition %q of %q clashes with feed %q", rendition.Name, id, renditionID))
+			}
+
+			profile, ok := c.TranscodeProfiles[rendition.TranscodeProfileName]
+			if !ok {
+				result = multierror.Append(result, errors.Errorf("unknown transcode_profile %q for rendition %q of %q", rendition.TranscodeProfileName, rendition.Name, id))
+			}
+			rendition.TranscodeProfile = profile
+		}
+	}
+
+	for name, profile := range c.TranscodeProfiles {
+		if err := feed.ValidateTranscodeProfile(profile); err != nil {
+			result = multierror.Append(result, errors.Wrapf(err, "invalid transcode profile %q", name))
+		}
 	}
 
 	return result.ErrorOrNil()
@@ -163,10 +325,18 @@ func (c *Config) applyDefaults(configPath string) {
 		}
 	}
 
+	if c.Database.Type == "" {
+		c.Database.Type = db.TypeBadger
+	}
+
 	if c.Database.Dir == "" {
 		c.Database.Dir = filepath.Join(filepath.Dir(configPath), "db")
 	}
 
+	if len(c.Events.Webhooks) > 0 && c.Events.DeadLetter == "" {
+		c.Events.DeadLetter = filepath.Join(filepath.Dir(configPath), events.DefaultDeadLetter)
+	}
+
 	for _, _feed := range c.Feeds {
 		if _feed.UpdatePeriod == 0 {
 			_feed.UpdatePeriod = model.DefaultUpdatePeriod
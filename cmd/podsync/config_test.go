@@ -2,6 +2,7 @@ package main
 
 import (
 	"os"
+	"path/filepath"
 	"testing"
 	"time"
 
@@ -9,7 +10,9 @@ import (
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 
+	"github.com/mxpv/podsync/pkg/events"
 	"github.com/mxpv/podsync/pkg/model"
+	"github.com/mxpv/podsync/pkg/notify"
 )
 
 func TestLoadConfig(t *testing.T) {
@@ -460,6 +463,137 @@ data_dir = "/data"
 	})
 }
 
+func TestInterpolation(t *testing.T) {
+	t.Run("expands variables and secret files", func(t *testing.T) {
+		secret := filepath.Join(t.TempDir(), "webhook")
+		require.NoError(t, os.WriteFile(secret, []byte("https://hooks.example.com/s3cr3t\n"), 0o600))
+
+		t.Setenv("TEST_YOUTUBE_KEY", "yt-key")
+		t.Setenv("TEST_S3_KEY", "AKIA")
+		t.Setenv("TEST_S3_SECRET", "shh")
+		t.Setenv("TEST_OWNER", "me@example.com")
+
+		path := setup(t, `
+[tokens]
+youtube = "${TEST_YOUTUBE_KEY}"
+vimeo = ["${TEST_YOUTUBE_KEY}-1", "plain"]
+
+[storage]
+type = "s3"
+  [storage.s3]
+  endpoint_url = "https://s3.example.com"
+  region = "us-east-1"
+  bucket = "podsync"
+  access_key_id = "${TEST_S3_KEY}"
+  secret_access_key = "${TEST_S3_SECRET}"
+
+[[events.webhooks]]
+url = "${file:`+secret+`}"
+
+[feeds]
+  [feeds.A]
+  url = "https://youtube.com/watch?v=ygIUF678y40"
+  custom = { ownerEmail = "${TEST_OWNER}" }
+
+  [[feeds.A.post_episode_download]]
+  command = ["sh", "-c", "echo $${EPISODE_TITLE} for ${TEST_OWNER}"]
+
+  [[feeds.A.post_feed_update]]
+  command = ["sh", "-c", "echo ${FEED_TITLE} updated for ${TEST_OWNER}"]
+`)
+		defer os.Remove(path)
+
+		config, err := LoadConfig(path)
+		require.NoError(t, err)
+
+		assert.Equal(t, StringSlice{"yt-key"}, config.Tokens[model.ProviderYoutube])
+		assert.Equal(t, StringSlice{"yt-key-1", "plain"}, config.Tokens[model.ProviderVimeo])
+		assert.Equal(t, "AKIA", config.Storage.S3.AccessKeyID)
+		assert.Equal(t, "shh", config.Storage.S3.SecretAccessKey)
+		require.Len(t, config.Events.Webhooks, 1)
+		assert.Equal(t, "https://hooks.example.com/s3cr3t", config.Events.Webhooks[0].URL)
+		assert.Equal(t, "me@example.com", config.Feeds["A"].Custom.OwnerEmail)
+		assert.Equal(t, []string{"sh", "-c", "echo ${EPISODE_TITLE} for me@example.com"}, config.Feeds["A"].PostEpisodeDownload[0].Command)
+		// Hook variables are set when running the hook, they're left for the shell
+		assert.Equal(t, []string{"sh", "-c", "echo ${FEED_TITLE} updated for me@example.com"}, config.Feeds["A"].PostFeedUpdate[0].Command)
+	})
+
+	t.Run("reports missing variables", func(t *testing.T) {
+		path := setup(t, `
+[server]
+data_dir = "/data"
+
+[feeds]
+  [feeds.A]
+  url = "https://youtube.com/channel/${TEST_MISSING_VARIABLE}"
+  custom = { author = "${FEED_TITLE}" }
+
+  [[feeds.A.post_episode_download]]
+  command = ["cat", "${file:/nonexistent/secret}"]
+
+[notifications]
+  [[notifications.channels]]
+  type = "ntfy"
+  url = "https://ntfy.sh/${broken"
+`)
+		defer os.Remove(path)
+
+		_, err := LoadConfig(path)
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "feeds.A.url: environment variable TEST_MISSING_VARIABLE is not set")
+		assert.Contains(t, err.Error(), `feeds.A.post_episode_download[0].command[1]: failed to read secret file "/nonexistent/secret"`)
+		assert.Contains(t, err.Error(), "notifications.channels[0].url: unterminated ${ reference")
+		// Hook variables are only available to hook commands
+		assert.Contains(t, err.Error(), "feeds.A.custom.author: environment variable FEED_TITLE is not set")
+	})
+}
+
+func TestAuthTokensRequireUsers(t *testing.T) {
+	const file = `
+[server]
+data_dir = "/data"
+
+  [server.auth]
+  tokens = true
+
+[feeds]
+  [feeds.A]
+  url = "https://youtube.com/watch?v=ygIUF678y40"
+`
+	path := setup(t, file)
+	defer os.Remove(path)
+
+	_, err := LoadConfig(path)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "tokens require at least one user")
+}
+
+func TestWebhookRetries(t *testing.T) {
+	const file = `
+[server]
+data_dir = "/data"
+
+[[events.webhooks]]
+url = "https://hooks.example.com/a"
+retries = 0
+
+[[events.webhooks]]
+url = "https://hooks.example.com/b"
+
+[feeds]
+  [feeds.A]
+  url = "https://youtube.com/watch?v=ygIUF678y40"
+`
+	path := setup(t, file)
+	defer os.Remove(path)
+
+	config, err := LoadConfig(path)
+	require.NoError(t, err)
+	require.Len(t, config.Events.Webhooks, 2)
+	assert.Equal(t, 0, config.Events.Webhooks[0].RetryCount())
+	assert.Equal(t, events.DefaultWebhookRetries, config.Events.Webhooks[1].RetryCount())
+}
+
 func TestNoIndexConfig(t *testing.T) {
 	t.Run("disabled by default", func(t *testing.T) {
 		const file = `
@@ -499,6 +633,449 @@ no_index = true
 	})
 }
 
+func TestTranscodeProfiles(t *testing.T) {
+	t.Run("resolves profile", func(t *testing.T) {
+		const file = `
+[server]
+data_dir = "/data"
+
+[transcode_profiles]
+  [transcode_profiles.commute]
+  audio_codec = "opus"
+  audio_bitrate = "32k"
+  channels = 1
+  loudnorm = true
+  speed = 1.25
+
+[feeds]
+  [feeds.A]
+  url = "https://youtube.com/watch?v=ygIUF678y40"
+  transcode_profile = "commute"
+`
+		path := setup(t, file)
+		defer os.Remove(path)
+
+		config, err := LoadConfig(path)
+		require.NoError(t, err)
+
+		profile := config.Feeds["A"].TranscodeProfile
+		require.NotNil(t, profile)
+		assert.Equal(t, "opus", profile.AudioCodec)
+		assert.Equal(t, "32k", profile.AudioBitrate)
+		assert.Equal(t, 1, profile.Channels)
+		assert.True(t, profile.Loudnorm)
+		assert.EqualValues(t, 1.25, profile.Speed)
+	})
+
+	t.Run("rejects unknown profile", func(t *testing.T) {
+		const file = `
+[server]
+data_dir = "/data"
+
+[feeds]
+  [feeds.A]
+  url = "https://youtube.com/watch?v=ygIUF678y40"
+  transcode_profile = "missing"
+`
+		path := setup(t, file)
+		defer os.Remove(path)
+
+		_, err := LoadConfig(path)
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), `unknown transcode_profile "missing"`)
+	})
+
+	t.Run("rejects invalid profile", func(t *testing.T) {
+		const file = `
+[server]
+data_dir = "/data"
+
+[transcode_profiles]
+  [transcode_profiles.bad]
+  audio_codec = "wav"
+
+[feeds]
+  [feeds.A]
+  url = "https://youtube.com/watch?v=ygIUF678y40"
+`
+		path := setup(t, file)
+		defer os.Remove(path)
+
+		_, err := LoadConfig(path)
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), `invalid transcode profile "bad"`)
+	})
+}
+
+func TestRenditions(t *testing.T) {
+	t.Run("resolves rendition profiles", func(t *testing.T) {
+		const file = `
+[server]
+data_dir = "/data"
+
+[transcode_profiles]
+  [transcode_profiles.audio64]
+  audio_codec = "aac"
+  audio_bitrate = "64k"
+
+  [transcode_profiles.video720]
+  video_codec = "h264"
+  max_height = 720
+
+[feeds]
+  [feeds.A]
+  url = "https://youtube.com/watch?v=ygIUF678y40"
+
+  [[feeds.A.renditions]]
+  name = "audio"
+  transcode_profile = "audio64"
+
+  [[feeds.A.renditions]]
+  name = "720p"
+  transcode_profile = "video720"
+`
+		path := setup(t, file)
+		defer os.Remove(path)
+
+		config, err := LoadConfig(path)
+		require.NoError(t, err)
+
+		renditions := config.Feeds["A"].Renditions
+		require.Len(t, renditions, 2)
+		assert.Equal(t, "audio", renditions[0].Name)
+		require.NotNil(t, renditions[0].TranscodeProfile)
+		assert.Equal(t, "64k", renditions[0].TranscodeProfile.AudioBitrate)
+		assert.Equal(t, "720p", renditions[1].Name)
+		require.NotNil(t, renditions[1].TranscodeProfile)
+		assert.Equal(t, 720, renditions[1].TranscodeProfile.MaxHeight)
+	})
+
+	t.Run("rejects invalid renditions", func(t *testing.T) {
+		const file = `
+[server]
+data_dir = "/data"
+
+[transcode_profiles]
+  [transcode_profiles.audio64]
+  audio_codec = "aac"
+
+[feeds]
+  [feeds.A]
+  url = "https://youtube.com/watch?v=ygIUF678y40"
+
+  [[feeds.A.renditions]]
+  name = "audio"
+  transcode_profile = "audio64"
+
+  [[feeds.A.renditions]]
+  name = "audio"
+  transcode_profile = "missing"
+
+  [[feeds.A.renditions]]
+  name = "../bad"
+  transcode_profile = "audio64"
+`
+		path := setup(t, file)
+		defer os.Remove(path)
+
+		_, err := LoadConfig(path)
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), `duplicate rendition "audio"`)
+		assert.Contains(t, err.Error(), `unknown transcode_profile "missing"`)
+		assert.Contains(t, err.Error(), "invalid rendition")
+	})
+}
+
+func TestMergedFeeds(t *testing.T) {
+	const file = `
+[server]
+data_dir = "/data"
+
+[feeds]
+  [feeds.bundle]
+  page_size = 20
+  filters = { expr = "duration > 60" }
+
+  [[feeds.bundle.sources]]
+  url = "https://youtube.com/channel/UCxC5Ls6DwqV0e-CYcAKkExQ"
+  page_size = 5
+  filters = { not_title = "(?i)shorts", expr = "!is_short" }
+
+  [[feeds.bundle.sources]]
+  url = "https://soundcloud.com/user/sets/playlist"
+`
+	path := setup(t, file)
+	defer os.Remove(path)
+
+	config, err := LoadConfig(path)
+	require.NoError(t, err)
+
+	sources := config.Feeds["bundle"].Sources
+	require.Len(t, sources, 2)
+	assert.Equal(t, 5, sources[0].PageSize)
+	assert.Equal(t, "(?i)shorts", sources[0].Filters.NotTitle)
+	assert.Equal(t, "https://soundcloud.com/user/sets/playlist", sources[1].URL)
+
+	// Expressions are compiled once when the config is loaded
+	assert.NotNil(t, config.Feeds["bundle"].Filters.CompiledExpr())
+	assert.False(t, config.Feeds["bundle"].Filters.DetectShorts())
+	assert.True(t, sources[0].Filters.DetectShorts())
+
+	path = setup(t, `
+[server]
+data_dir = "/data"
+
+[feeds]
+  [feeds.bundle]
+  url = "https://youtube.com/channel/UCxC5Ls6DwqV0e-CYcAKkExQ"
+
+  [[feeds.bundle.sources]]
+  url = "https://soundcloud.com/user/sets/playlist"
+`)
+	defer os.Remove(path)
+
+	_, err = LoadConfig(path)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "url and sources can't be combined")
+}
+
+func TestTemplates(t *testing.T) {
+	t.Run("merges defaults and templates", func(t *testing.T) {
+		const file = `
+[server]
+data_dir = "/data"
+
+[defaults]
+format = "audio"
+update_period = "12h"
+youtube_dl_args = ["--no-mtime"]
+custom = { lang = "en", explicit = true }
+
+[templates]
+  [templates.base]
+  quality = "low"
+  filters = { not_title = "(?i)#shorts", min_duration = 60 }
+
+  [templates.commute]
+  extends = "base"
+  page_size = 5
+  youtube_dl_args = ["--embed-chapters"]
+  custom = { category = "News" }
+
+  [[templates.commute.post_episode_download]]
+  command = ["echo", "done"]
+
+[feeds]
+  [feeds.A]
+  url = "https://youtube.com/channel/UCxC5Ls6DwqV0e-CYcAKkExQ"
+  extends = ["commute"]
+  filters = { min_duration = 300 }
+  custom = { lang = "de" }
+
+  [feeds.B]
+  url = "https://youtube.com/channel/UC5XPnUk8Vvv_pWslhwom6Og"
+  format = "video"
+`
+		path := setup(t, file)
+		defer os.Remove(path)
+
+		config, err := LoadConfig(path)
+		require.NoError(t, err)
+
+		a := config.Feeds["A"]
+		assert.Equal(t, model.FormatAudio, a.Format)
+		assert.Equal(t, model.QualityLow, a.Quality)
+		assert.Equal(t, 5, a.PageSize)
+		assert.Equal(t, 12*time.Hour, a.UpdatePeriod)
+		// Arrays are replaced
+		assert.Equal(t, []string{"--embed-chapters"}, a.YouTubeDLArgs)
+		require.Len(t, a.PostEpisodeDownload, 1)
+		// Tables are merged
+		assert.Equal(t, "(?i)#shorts", a.Filters.NotTitle)
+		assert.EqualValues(t, 300, a.Filters.MinDuration)
+		assert.Equal(t, "de", a.Custom.Language)
+		assert.Equal(t, "News", a.Custom.Category)
+		assert.True(t, a.Custom.Explicit)
+
+		b := config.Feeds["B"]
+		assert.Equal(t, model.FormatVideo, b.Format)
+		assert.Equal(t, model.DefaultQuality, b.Quality)
+		assert.Equal(t, []string{"--no-mtime"}, b.YouTubeDLArgs)
+		assert.Equal(t, "en", b.Custom.Language)
+		assert.Empty(t, b.Filters.NotTitle)
+
+		assert.NotContains(t, config.effective["A"], "extends")
+		assert.Equal(t, "low", config.effective["A"]["quality"])
+	})
+
+	t.Run("rejects invalid templates", func(t *testing.T) {
+		const file = `
+[server]
+data_dir = "/data"
+
+[defaults]
+url = "https://youtube.com/channel/UCxC5Ls6DwqV0e-CYcAKkExQ"
+
+[templates]
+  [templates.a]
+  extends = ["b"]
+
+  [templates.b]
+  extends = ["a"]
+
+[feeds]
+  [feeds.A]
+  url = "https://youtube.com/channel/UCxC5Ls6DwqV0e-CYcAKkExQ"
+  extends = ["a"]
+
+  [feeds.B]
+  url = "https://youtube.com/channel/UC5XPnUk8Vvv_pWslhwom6Og"
+  extends = ["missing"]
+`
+		path := setup(t, file)
+		defer os.Remove(path)
+
+		_, err := LoadConfig(path)
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), `"url" can only be set on feeds`)
+		assert.Contains(t, err.Error(), "templates extend each other: a -> b -> a")
+		assert.Contains(t, err.Error(), `unknown template "missing"`)
+	})
+}
+
+func TestMetadata(t *testing.T) {
+	const file = `
+[server]
+data_dir = "/data"
+
+[feeds]
+  [feeds.A]
+  url = "https://youtube.com/watch?v=ygIUF678y40"
+  metadata = { enabled = true, genre = "Talk", cover = "feed" }
+
+  [feeds.B]
+  url = "https://youtube.com/watch?v=ygIUF678y40"
+  metadata = { enabled = true, cover = "thumbnail" }
+`
+	path := setup(t, file)
+	defer os.Remove(path)
+
+	_, err := LoadConfig(path)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), `invalid metadata for "B"`)
+	assert.NotContains(t, err.Error(), `invalid metadata for "A"`)
+}
+
+func TestCleanupPolicies(t *testing.T) {
+	const file = `
+[server]
+data_dir = "/data"
+
+[cleanup]
+max_size = "20GB"
+keep_newer_than = 7
+
+[disk_quota]
+max_size = 1000000
+evict = "least_listened"
+dry_run = true
+
+[feeds]
+  [feeds.A]
+  url = "https://youtube.com/watch?v=ygIUF678y40"
+  clean = { keep_last = 10, max_age = 30, max_size = "512MiB" }
+
+  [feeds.B]
+  url = "https://youtube.com/watch?v=ygIUF678y40"
+`
+	path := setup(t, file)
+	defer os.Remove(path)
+
+	config, err := LoadConfig(path)
+	require.NoError(t, err)
+
+	clean := config.Feeds["A"].Clean
+	require.NotNil(t, clean)
+	assert.Equal(t, 10, clean.KeepLast)
+	assert.Equal(t, 30, clean.MaxAge)
+	assert.EqualValues(t, 512*1024*1024, clean.MaxSize)
+
+	clean = config.Feeds["B"].Clean
+	require.NotNil(t, clean)
+	assert.EqualValues(t, 20*1000*1000*1000, clean.MaxSize)
+	assert.Equal(t, 7, clean.KeepNewerThan)
+
+	require.NotNil(t, config.DiskQuota)
+	assert.EqualValues(t, 1000000, config.DiskQuota.MaxSize)
+	assert.Equal(t, "least_listened", config.DiskQuota.Evict)
+	assert.True(t, config.DiskQuota.DryRun)
+}
+
+func TestNotifications(t *testing.T) {
+	const file = `
+[storage]
+  [storage.local]
+  data_dir = "/data"
+
+[notifications]
+broken_after = 5
+
+  [notifications.templates.new_episode]
+  title = "{{.FeedTitle}}"
+
+  [[notifications.channels]]
+  type = "telegram"
+  token = "123:abc"
+  chat_id = "42"
+  kinds = ["new_episode", "feed_broken"]
+
+    [notifications.channels.templates.feed_broken]
+    message = "{{.FeedID}} is down"
+
+  [[notifications.channels]]
+  type = "email"
+  host = "smtp.example.com"
+  from = "podsync@example.com"
+  to = ["me@example.com"]
+
+[feeds]
+  [feeds.A]
+  url = "https://youtube.com/watch?v=ygIUF678y40"
+`
+	path := setup(t, file)
+	defer os.Remove(path)
+
+	config, err := LoadConfig(path)
+	require.NoError(t, err)
+
+	assert.Equal(t, 5, config.Notifications.BrokenAfter)
+	assert.Equal(t, "{{.FeedTitle}}", config.Notifications.Templates[notify.NewEpisode].Title)
+	require.Len(t, config.Notifications.Channels, 2)
+	assert.Equal(t, notify.ChannelTelegram, config.Notifications.Channels[0].Type)
+	assert.Equal(t, []notify.Kind{notify.NewEpisode, notify.FeedBroken}, config.Notifications.Channels[0].Kinds)
+	assert.Equal(t, "{{.FeedID}} is down", config.Notifications.Channels[0].Templates[notify.FeedBroken].Message)
+	assert.Equal(t, []string{"me@example.com"}, config.Notifications.Channels[1].To)
+
+	t.Run("invalid channel", func(t *testing.T) {
+		path := setup(t, `
+[storage]
+  [storage.local]
+  data_dir = "/data"
+
+[[notifications.channels]]
+type = "telegram"
+
+[feeds]
+  [feeds.A]
+  url = "https://youtube.com/watch?v=ygIUF678y40"
+`)
+		defer os.Remove(path)
+
+		_, err := LoadConfig(path)
+		assert.Error(t, err)
+	})
+}
+
 func setup(t *testing.T, file string) string {
 	t.Helper()
 
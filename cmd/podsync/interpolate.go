@@ -0,0 +1,167 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+
+	"github.com/hashicorp/go-multierror"
+	"github.com/pelletier/go-toml"
+	"github.com/pkg/errors"
+
+	"github.com/mxpv/podsync/pkg/feed"
+)
+
+var envNamePattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// interpolate expands references in all string values of the config:
+//   - ${NAME} is replaced with the value of the environment variable NAME
+//   - ${file:/run/secrets/x} is replaced with the contents of the file, without trailing newlines
+//   - $${ is replaced with a literal ${
+//
+// Hook commands are run with variables describing the hook context (see feed.HookVariables),
+// references to them are left for the shell.
+// Errors name the key of the value that couldn't be expanded.
+func interpolate(tree *toml.Tree, path []string) error {
+	var result *multierror.Error
+
+	for _, key := range tree.Keys() {
+		keyPath := append(append([]string{}, path...), key)
+		name := strings.Join(keyPath, ".")
+
+		switch value := tree.GetPath([]string{key}).(type) {
+		case string:
+			expanded, err := expand(value, false)
+			if err != nil {
+				result = multierror.Append(result, errors.Wrap(err, name))
+			} else if expanded != value {
+				tree.SetPath([]string{key}, expanded)
+			}
+
+		case []interface{}:
+			hook := key == "command" && isHookTable(path)
+			changed := false
+			list := make([]interface{}, len(value))
+			for i, item := range value {
+				list[i] = item
+				if str, ok := item.(string); ok {
+					expanded, err := expand(str, hook)
+					if err != nil {
+						result = multierror.Append(result, errors.Wrapf(err, "%s[%d]", name, i))
+						continue
+					}
+					changed = changed || expanded != str
+					list[i] = expanded
+				}
+			}
+			if changed {
+				tree.SetPath([]string{key}, list)
+			}
+
+		case *toml.Tree:
+			if err := interpolate(value, keyPath); err != nil {
+				result = multierror.Append(result, err)
+			}
+
+		case []*toml.Tree:
+			for i, table := range value {
+				tablePath := append(append([]string{}, path...), fmt.Sprintf("%s[%d]", key, i))
+				if err := interpolate(table, tablePath); err != nil {
+					result = multierror.Append(result, err)
+				}
+			}
+		}
+	}
+
+	return result.ErrorOrNil()
+}
+
+// isHookTable returns true if the path refers to a hook table, e.g. feeds.A.post_episode_download[0]
+func isHookTable(path []string) bool {
+	if len(path) == 0 {
+		return false
+	}
+
+	name := path[len(path)-1]
+	if i := strings.IndexByte(name, '['); i >= 0 {
+		name = name[:i]
+	}
+
+	for _, hook := range feed.Hooks {
+		if name == hook {
+			return true
+		}
+	}
+	return false
+}
+
+// expand replaces ${...} references in a string, hook keeps references to hook variables as is
+func expand(value string, hook bool) (string, error) {
+	if !strings.Contains(value, "${") {
+		return value, nil
+	}
+
+	var out strings.Builder
+	for i := 0; i < len(value); {
+		switch {
+		case strings.HasPrefix(value[i:], "$${"):
+			out.WriteString("${")
+			i += 3
+
+		case strings.HasPrefix(value[i:], "${"):
+			end := strings.IndexByte(value[i+2:], '}')
+			if end < 0 {
+				return "", errors.New("unterminated ${ reference (use $${ for a literal ${)")
+			}
+
+			ref := value[i+2 : i+2+end]
+			if _, ok := feed.HookVariables[ref]; ok && hook {
+				out.WriteString(value[i : i+end+3])
+				i += end + 3
+				continue
+			}
+
+			resolved, err := resolveReference(ref)
+			if err != nil {
+				return "", err
+			}
+
+			out.WriteString(resolved)
+			i += end + 3
+
+		default:
+			out.WriteByte(value[i])
+			i++
+		}
+	}
+
+	return out.String(), nil
+}
+
+func resolveReference(ref string) (string, error) {
+	if strings.HasPrefix(ref, "file:") {
+		path := strings.TrimPrefix(ref, "file:")
+		if path == "" {
+			return "", errors.New("${file:} reference requires a path")
+		}
+
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return "", errors.Wrapf(err, "failed to read secret file %q", path)
+		}
+
+		return strings.TrimRight(string(data), "\r\n"), nil
+	}
+
+	if !envNamePattern.MatchString(ref) {
+		return "", errors.Errorf("invalid environment variable name %q", ref)
+	}
+
+	value, ok := os.LookupEnv(ref)
+	if !ok {
+		return "", errors.Errorf("environment variable %s is not set", ref)
+	}
+
+	return value, nil
+}
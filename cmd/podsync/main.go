@@ -11,16 +11,21 @@ import (
 
 	"github.com/jessevdk/go-flags"
 	"github.com/mxpv/podsync/pkg/feed"
+	"github.com/mxpv/podsync/pkg/media"
 	"github.com/mxpv/podsync/pkg/model"
+	"github.com/mxpv/podsync/pkg/notify"
 	"github.com/mxpv/podsync/services/migrate"
+	"github.com/mxpv/podsync/services/reconcile"
 	"github.com/mxpv/podsync/services/update"
 	"github.com/mxpv/podsync/services/web"
+	"github.com/pkg/errors"
 	"github.com/robfig/cron/v3"
 	log "github.com/sirupsen/logrus"
 	"golang.org/x/sync/errgroup"
 	"gopkg.in/natefinch/lumberjack.v2"
 
 	"github.com/mxpv/podsync/pkg/db"
+	"github.com/mxpv/podsync/pkg/events"
 	"github.com/mxpv/podsync/pkg/fs"
 	"github.com/mxpv/podsync/pkg/ytdl"
 )
@@ -30,8 +35,25 @@ type Opts struct {
 	Headless               bool   `long:"headless"`
 	MigrateFilenames       bool   `long:"migrate-filenames" description:"Migrate existing downloaded filenames to current filename_template and exit"`
 	MigrateFilenamesDryRun bool   `long:"migrate-filenames-dry-run" description:"Preview filename migration without writing changes (requires --migrate-filenames)"`
+	Reconcile              bool   `long:"reconcile" description:"Reconcile storage with the database and exit"`
+	ReconcileAction        string `long:"reconcile-action" description:"What to do with orphaned files: report, delete or quarantine (overrides reconcile.action)"`
 	Debug                  bool   `long:"debug"`
+	Server                 string `long:"server" description:"URL of the running server to send commands to when its database is locked (derived from [server] by default)"`
 	NoBanner               bool   `long:"no-banner"`
+	JSON                   bool   `long:"json" description:"Print command output as JSON"`
+
+	Serve         struct{}             `command:"serve" description:"Run the web server and update feeds on schedule (default)"`
+	Update        UpdateCommand        `command:"update" description:"Update feeds once and exit"`
+	List          ListCommand          `command:"list" description:"List feeds or episodes"`
+	Retry         RetryCommand         `command:"retry" description:"Download failed or removed episodes again"`
+	DeleteEpisode DeleteEpisodeCommand `command:"delete-episode" description:"Delete episode files and keep the episode from being downloaded again"`
+	Cleanup       CleanupCommand       `command:"cleanup" description:"Apply cleanup policies and disk quota"`
+	Filter        FilterCommand        `command:"filter" description:"Remove downloaded episodes that no longer match feed filters"`
+	CheckConfig   CheckConfigCommand   `command:"check-config" description:"Validate the configuration file and print the effective configuration of feeds"`
+	DB            DBCommand            `command:"db" description:"Database maintenance"`
+	Export        ExportCommand        `command:"export" description:"Dump feeds, episodes and tokens to a JSON lines file"`
+	Import        ImportCommand        `command:"import" description:"Restore a dump created with export"`
+	ImportFeeds   ImportFeedsCommand   `command:"import-feeds" description:"Generate feed configuration from YouTube subscriptions (Google Takeout CSV) or OPML"`
 }
 
 const banner = `
@@ -66,17 +88,35 @@ func main() {
 
 	// Parse args
 	opts := Opts{}
-	_, err := flags.Parse(&opts)
+	parser := flags.NewParser(&opts, flags.HelpFlag|flags.PassDoubleDash)
+	parser.SubcommandsOptional = true
+	_, err := parser.Parse()
 	if err != nil {
+		if flagsErr, ok := err.(*flags.Error); ok && flagsErr.Type == flags.ErrHelp {
+			fmt.Println(flagsErr.Message)
+			return
+		}
 		log.WithError(err).Fatal("failed to parse command line arguments")
 	}
 
 	if opts.Debug {
 		log.SetLevel(log.DebugLevel)
 	}
+
+	// Run a subcommand, serving is the default
+	if parser.Active != nil && parser.Active.Name != "serve" {
+		if err := runCommand(ctx, &opts, commandName(parser.Active), os.Args[1:]); err != nil {
+			fmt.Fprintf(os.Stderr, "error: %v\n", err)
+			os.Exit(1)
+		}
+		return
+	}
 	if opts.MigrateFilenamesDryRun && !opts.MigrateFilenames {
 		log.Fatal("--migrate-filenames-dry-run requires --migrate-filenames")
 	}
+	if opts.ReconcileAction != "" && !opts.Reconcile {
+		log.Fatal("--reconcile-action requires --reconcile")
+	}
 
 	if !opts.NoBanner {
 		log.Info(banner)
@@ -113,7 +153,7 @@ func main() {
 		}
 	}
 
-	database, err := db.NewBadger(&cfg.Database)
+	database, err := db.Open(&cfg.Database)
 	if err != nil {
 		log.WithError(err).Fatal("failed to open database")
 	}
@@ -123,15 +163,7 @@ func main() {
 		}
 	}()
 
-	var storage fs.Storage
-	switch cfg.Storage.Type {
-	case "local":
-		storage, err = fs.NewLocal(cfg.Storage.Local.DataDir, cfg.Server.WebUIEnabled, cfg.Server.NoListing)
-	case "s3":
-		storage, err = fs.NewS3(cfg.Storage.S3) // serving files from S3 is not supported, so no WebUI either
-	default:
-		log.Fatalf("unknown storage type: %s", cfg.Storage.Type)
-	}
+	storage, err := openStorage(cfg)
 	if err != nil {
 		log.WithError(err).Fatal("failed to open storage")
 	}
@@ -158,35 +190,47 @@ func main() {
 		return
 	}
 
-	downloader, err := ytdl.New(ctx, cfg.Downloader)
-	if err != nil {
-		log.WithError(err).Fatal("youtube-dl error")
-	}
+	if opts.Reconcile {
+		action := cfg.Reconcile.Action
+		if opts.ReconcileAction != "" {
+			action = reconcile.Action(opts.ReconcileAction)
+		}
+		if err := (reconcile.Config{Action: action}).Validate(); err != nil {
+			log.WithError(err).Fatal("invalid --reconcile-action")
+		}
+		if action == reconcile.ActionQuarantine && cfg.Storage.Type == "s3" {
+			log.Fatal("quarantine is not supported with storage.type = \"s3\"; use delete or report")
+		}
 
-	// Run updater thread
-	log.Debug("creating key providers")
-	keys := map[model.Provider]feed.KeyProvider{}
-	for name, list := range cfg.Tokens {
-		provider, err := feed.NewKeyProvider(list)
-		if err != nil {
-			log.WithError(err).Fatalf("failed to create key provider for %q", name)
+		if err := runReconcile(ctx, cfg, database, storage, action); err != nil {
+			log.WithError(err).Fatal("reconciliation failed")
 		}
-		keys[name] = provider
+		return
 	}
 
-	log.Debug("creating update manager")
-	manager, err := update.NewUpdater(cfg.Feeds, keys, cfg.Server.Hostname, downloader, database, storage)
+	bus := newEventBus(cfg, database)
+	defer closeEventBus(bus)
+
+	// Run updater thread
+	manager, err := newManager(ctx, cfg, database, storage, bus)
 	if err != nil {
 		log.WithError(err).Fatal("failed to create updater")
 	}
 
+	if err := manager.HandleRemovedFeeds(ctx, cfg.RemovedFeeds); err != nil {
+		log.WithError(err).Error("failed to handle removed feeds")
+	}
+
 	// In Headless mode, do one round of feed updates and quit
 	if opts.Headless {
 		for _, _feed := range cfg.Feeds {
 			if err := manager.Update(ctx, _feed); err != nil {
-				log.WithError(err).Errorf("failed to update feed: %s", _feed.URL)
+				log.WithError(err).Errorf("failed to update feed: %s", _feed.ID)
 			}
 		}
+		if err := manager.ApplyDiskQuota(ctx); err != nil {
+			log.WithError(err).Error("failed to apply disk quota")
+		}
 		return
 	}
 
@@ -206,16 +250,34 @@ func main() {
 	c := cron.New(cron.WithChain(cron.SkipIfStillRunning(cron.DiscardLogger)))
 	m := make(map[string]cron.EntryID)
 
+	// Reconciliation runs on the updates goroutine, so it never races with downloads
+	reconciles := make(chan struct{}, 1)
+
+	// So do commands changing data sent to the server by the CLI
+	jobs := make(chan func())
+
 	// Run updates listener
 	group.Go(func() error {
 		for {
 			select {
 			case _feed := <-updates:
 				if err := manager.Update(ctx, _feed); err != nil {
-					log.WithError(err).Errorf("failed to update feed: %s", _feed.URL)
+					log.WithError(err).Errorf("failed to update feed: %s", _feed.ID)
 				} else {
 					log.Infof("next update of %s: %s", _feed.ID, c.Entry(m[_feed.ID]).Next)
 				}
+				// Disk quota spans all feeds, so it's applied once the queued updates are done
+				if len(updates) == 0 {
+					if err := manager.ApplyDiskQuota(ctx); err != nil {
+						log.WithError(err).Error("failed to apply disk quota")
+					}
+				}
+			case <-reconciles:
+				if err := runReconcile(ctx, cfg, database, storage, cfg.Reconcile.Action); err != nil {
+					log.WithError(err).Error("reconciliation failed")
+				}
+			case job := <-jobs:
+				job()
 			case <-ctx.Done():
 				return ctx.Err()
 			}
@@ -251,6 +313,19 @@ func main() {
 			}
 		}
 
+		if cfg.Reconcile.Schedule != "" {
+			if _, err := c.AddFunc(cfg.Reconcile.Schedule, func() {
+				select {
+				case reconciles <- struct{}{}:
+				default:
+					// Already queued
+				}
+			}); err != nil {
+				log.WithError(err).Fatal("can't create cron task for reconciliation")
+			}
+			log.Debugf("-> reconcile (schedule '%s')", cfg.Reconcile.Schedule)
+		}
+
 		c.Start()
 
 		for {
@@ -268,7 +343,8 @@ func main() {
 	}
 
 	// Run web server
-	srv := web.New(cfg.Server, storage, database)
+	srv := web.New(cfg.Server, storage, database, cfg.Feeds)
+	srv.HandleCommands(newCommandRunner(cfg, database, storage, bus, jobs))
 
 	group.Go(func() error {
 		log.Infof("running listener at %s", srv.Addr)
@@ -303,3 +379,95 @@ func main() {
 		}
 	})
 }
+
+func runReconcile(ctx context.Context, cfg *Config, database db.Storage, storage fs.Storage, action reconcile.Action) error {
+	service := reconcile.New(cfg.Feeds, database, storage, action, cfg.Reconcile.GracePeriod)
+	result, err := service.Run(ctx)
+	if err != nil {
+		return err
+	}
+
+	log.WithFields(log.Fields{
+		"files":           result.Files,
+		"orphans":         result.Orphans,
+		"orphan_size":     result.OrphanSize,
+		"missing":         result.Missing,
+		"size_mismatches": result.SizeMismatches,
+		"temp_dirs":       result.TempDirs,
+		"action":          action,
+	}).Info("reconciliation completed")
+
+	return nil
+}
+
+func openStorage(cfg *Config) (fs.Storage, error) {
+	switch cfg.Storage.Type {
+	case "local":
+		return fs.NewLocal(cfg.Storage.Local.DataDir, cfg.Server.WebUIEnabled, cfg.Server.NoListing)
+	case "s3":
+		return fs.NewS3(cfg.Storage.S3) // serving files from S3 is not supported, so no WebUI either
+	default:
+		return nil, errors.Errorf("unknown storage type: %s", cfg.Storage.Type)
+	}
+}
+
+// newEventBus creates an event bus delivering events to configured sinks
+func newEventBus(cfg *Config, database db.Storage) *events.Bus {
+	bus := events.NewBus()
+
+	var deadLetter *events.DeadLetter
+	if cfg.Events.DeadLetter != "" {
+		deadLetter = events.NewDeadLetter(cfg.Events.DeadLetter)
+	}
+
+	for _, webhook := range cfg.Events.Webhooks {
+		bus.Subscribe(events.NewWebhook(webhook, deadLetter))
+	}
+
+	if len(cfg.Notifications.Channels) > 0 {
+		bus.Subscribe(notify.New(&cfg.Notifications, cfg.Server.Hostname, database))
+	}
+
+	return bus
+}
+
+// closeEventBus gives sinks some time to deliver pending events
+func closeEventBus(bus *events.Bus) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	bus.Close(ctx)
+}
+
+// newManager creates an update manager able to download episodes
+func newManager(ctx context.Context, cfg *Config, database db.Storage, storage fs.Storage, bus *events.Bus) (*update.Manager, error) {
+	downloader, err := ytdl.New(ctx, cfg.Downloader)
+	if err != nil {
+		return nil, errors.Wrap(err, "youtube-dl error")
+	}
+
+	// ffmpeg is only needed when episodes are post-processed after download
+	var processor update.Processor
+	for _, _feed := range cfg.Feeds {
+		if _feed.TranscodeProfile != nil || len(_feed.Renditions) > 0 || _feed.Metadata.Enabled || _feed.Artwork.Enabled {
+			ffmpeg, err := media.NewFFmpeg()
+			if err != nil {
+				return nil, errors.Wrap(err, "ffmpeg is required for transcoding, tagging and artwork")
+			}
+			processor = ffmpeg
+			break
+		}
+	}
+
+	log.Debug("creating key providers")
+	keys := map[model.Provider]feed.KeyProvider{}
+	for name, list := range cfg.Tokens {
+		provider, err := feed.NewKeyProvider(list)
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to create key provider for %q", name)
+		}
+		keys[name] = provider
+	}
+
+	log.Debug("creating update manager")
+	return update.NewUpdater(cfg.Feeds, keys, cfg.Server.Hostname, downloader, processor, database, storage, cfg.DiskQuota, bus)
+}
@@ -0,0 +1,142 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/jessevdk/go-flags"
+	"github.com/pkg/errors"
+
+	"github.com/mxpv/podsync/pkg/db"
+	"github.com/mxpv/podsync/pkg/events"
+	"github.com/mxpv/podsync/pkg/fs"
+	"github.com/mxpv/podsync/services/web"
+)
+
+// errServerUnavailable is returned by runRemote when no server serves commands at the URL
+var errServerUnavailable = errors.New("podsync server can't be reached")
+
+// runRemote sends the command to the running server, so it can run against the database the server holds.
+// The server authenticates the request with the first basic auth user of the configuration.
+func (c *cli) runRemote(ctx context.Context, args []string) error {
+	users := c.cfg.Server.Auth.Users
+	if len(users) == 0 {
+		return errors.New("running commands against the server requires [server.auth] users")
+	}
+
+	names := make([]string, 0, len(users))
+	for name := range users {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	body, err := json.Marshal(web.CommandRequest{Args: args})
+	if err != nil {
+		return err
+	}
+
+	url := serverURL(c.cfg, c.opts.Server) + "/api/commands"
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.SetBasicAuth(names[0], users[names[0]])
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return errors.Wrapf(errServerUnavailable, "%s (see --server)", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotFound {
+		return errors.Wrapf(errServerUnavailable, "no commands API at %s (see --server)", url)
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		message, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return errors.Errorf("server failed to run the command: %s %s", resp.Status, strings.TrimSpace(string(message)))
+	}
+
+	var result web.CommandResponse
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return errors.Wrap(err, "failed to decode server response")
+	}
+
+	if _, err := io.WriteString(c.out, result.Output); err != nil {
+		return err
+	}
+
+	if result.Error != "" {
+		return errors.New(result.Error)
+	}
+
+	return nil
+}
+
+// serverURL returns the base URL of the API of the local server, unless overridden
+func serverURL(cfg *Config, override string) string {
+	if override != "" {
+		return strings.TrimSuffix(override, "/")
+	}
+
+	scheme := "http"
+	if cfg.Server.TLS {
+		scheme = "https"
+	}
+
+	host := cfg.Server.BindAddress
+	if host == "" || host == "*" {
+		host = "localhost"
+	}
+
+	port := cfg.Server.Port
+	if port == 0 {
+		port = 8080
+	}
+
+	if strings.Contains(host, ":") {
+		// IPv6 address
+		host = "[" + host + "]"
+	}
+
+	return fmt.Sprintf("%s://%s:%d", scheme, host, port)
+}
+
+// newCommandRunner runs commands sent by runRemote against the database of the server.
+// Commands changing data are queued to run between feed updates, so they never race with them.
+func newCommandRunner(cfg *Config, database db.Storage, storage fs.Storage, bus *events.Bus, jobs chan<- func()) web.CommandRunner {
+	return func(ctx context.Context, args []string, out io.Writer) error {
+		opts := Opts{}
+		parser := flags.NewParser(&opts, flags.HelpFlag|flags.PassDoubleDash)
+		if _, err := parser.ParseArgs(args); err != nil {
+			return err
+		}
+
+		name := commandName(parser.Active)
+		if !remoteCommands[name] {
+			return errors.Errorf("command %q can't run against the running server", name)
+		}
+
+		c := &cli{opts: &opts, cfg: cfg, database: database, storage: storage, events: bus, out: out}
+		if readOnlyCommands[name] {
+			return c.run(ctx, name)
+		}
+
+		done := make(chan error, 1)
+		select {
+		case jobs <- func() { done <- c.run(ctx, name) }:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+
+		// The command is cancelled along with the request, its output is only read once it finished
+		return <-done
+	}
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/mxpv/podsync/services/update"
+	"github.com/mxpv/podsync/services/web"
+)
+
+func TestRunRemote(t *testing.T) {
+	ctx := context.Background()
+	users := map[string]string{"admin": "secret", "other": "password"}
+
+	// The server runs commands changing data on its update queue
+	server, _ := newTestCLI(t, &Opts{})
+	server.cfg.Server.Auth.Users = users
+	jobs := make(chan func())
+	go func() {
+		for job := range jobs {
+			job()
+		}
+	}()
+	defer close(jobs)
+
+	srv := web.New(server.cfg.Server, server.storage, server.database, server.cfg.Feeds)
+	srv.HandleCommands(newCommandRunner(server.cfg, server.database, server.storage, nil, jobs))
+	ts := httptest.NewServer(srv.Handler)
+	defer ts.Close()
+
+	out := &bytes.Buffer{}
+	c := &cli{opts: &Opts{Server: ts.URL}, cfg: &Config{}, out: out}
+	c.cfg.Server.Auth.Users = users
+
+	require.NoError(t, c.runRemote(ctx, []string{"-c", "local.toml", "--json", "list", "feeds"}))
+	var list []feedSummary
+	require.NoError(t, json.Unmarshal(out.Bytes(), &list))
+	require.Len(t, list, 2)
+	assert.Equal(t, "a", list[0].ID)
+
+	out.Reset()
+	require.NoError(t, c.runRemote(ctx, []string{"--json", "cleanup", "--dry-run"}))
+	var removed []update.Removal
+	require.NoError(t, json.Unmarshal(out.Bytes(), &removed))
+	require.Len(t, removed, 1)
+
+	// Errors of commands are returned by the client
+	assert.EqualError(t, c.runRemote(ctx, []string{"list", "episodes", "missing"}), `unknown feed "missing"`)
+	assert.Error(t, c.runRemote(ctx, []string{"export", "dump.jsonl"}))
+
+	// Wrong credentials
+	c.cfg.Server.Auth.Users = map[string]string{"admin": "wrong"}
+	assert.Error(t, c.runRemote(ctx, []string{"list", "feeds"}))
+
+	// No users to authenticate with
+	c.cfg.Server.Auth.Users = nil
+	assert.Error(t, c.runRemote(ctx, []string{"list", "feeds"}))
+
+	// The database is used directly when the server isn't running
+	c.cfg.Server.Auth.Users = users
+	ts.Close()
+	assert.ErrorIs(t, c.runRemote(ctx, []string{"list", "feeds"}), errServerUnavailable)
+}
+
+func TestServerURL(t *testing.T) {
+	cfg := &Config{}
+	assert.Equal(t, "http://localhost:8080", serverURL(cfg, ""))
+	assert.Equal(t, "https://podsync.example.com", serverURL(cfg, "https://podsync.example.com/"))
+
+	cfg.Server.BindAddress = "::1"
+	cfg.Server.Port = 9090
+	cfg.Server.TLS = true
+	assert.Equal(t, "https://[::1]:9090", serverURL(cfg, ""))
+}
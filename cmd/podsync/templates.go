@@ -0,0 +1,219 @@
+package main
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/hashicorp/go-multierror"
+	"github.com/pelletier/go-toml"
+	"github.com/pkg/errors"
+)
+
+// applyTemplates resolves the [defaults] table and [templates.X] tables referenced by feeds with
+// `extends = ["X", ...]`, and returns the effective tables of all feeds. root is a parsed config file.
+//
+// Settings are merged in order: defaults, templates in the order they're listed in extends
+// (a template extending other templates is resolved the same way) and the feed itself.
+// Tables are merged key by key, while values of other types, including arrays, are replaced as a whole.
+func applyTemplates(root map[string]interface{}) (map[string]map[string]interface{}, error) {
+	var (
+		result    *multierror.Error
+		defaults  = map[string]interface{}{}
+		templates = map[string]map[string]interface{}{}
+		feeds     = map[string]interface{}{}
+	)
+
+	if value, ok := root["defaults"]; ok {
+		table, ok := value.(map[string]interface{})
+		if !ok {
+			return nil, errors.New("defaults must be a table")
+		}
+		defaults = table
+		if err := checkTemplate(defaults); err != nil {
+			result = multierror.Append(result, errors.Wrap(err, "invalid defaults"))
+		}
+	}
+
+	if value, ok := root["templates"]; ok {
+		tables, ok := value.(map[string]interface{})
+		if !ok {
+			return nil, errors.New("templates must be a table")
+		}
+		for name, value := range tables {
+			table, ok := value.(map[string]interface{})
+			if !ok {
+				result = multierror.Append(result, errors.Errorf("template %q must be a table", name))
+				continue
+			}
+			if err := checkTemplate(table); err != nil {
+				result = multierror.Append(result, errors.Wrapf(err, "invalid template %q", name))
+			}
+			templates[name] = table
+		}
+	}
+
+	if value, ok := root["feeds"]; ok {
+		if tables, ok := value.(map[string]interface{}); ok {
+			feeds = tables
+		}
+	}
+
+	resolver := &templateResolver{templates: templates, resolved: map[string]map[string]interface{}{}}
+	effective := make(map[string]map[string]interface{}, len(feeds))
+
+	for id, value := range feeds {
+		table, ok := value.(map[string]interface{})
+		if !ok {
+			continue
+		}
+
+		merged, err := resolver.resolve(table, nil)
+		if err != nil {
+			result = multierror.Append(result, errors.Wrapf(err, "failed to apply templates to %q", id))
+			continue
+		}
+
+		effective[id] = mergeTables(defaults, merged)
+	}
+
+	return effective, result.ErrorOrNil()
+}
+
+// checkTemplate rejects settings that can't be shared between feeds
+func checkTemplate(table map[string]interface{}) error {
+	for _, key := range []string{"url", "sources"} {
+		if _, ok := table[key]; ok {
+			return errors.Errorf("%q can only be set on feeds", key)
+		}
+	}
+	return nil
+}
+
+type templateResolver struct {
+	templates map[string]map[string]interface{}
+	resolved  map[string]map[string]interface{}
+}
+
+// resolve merges templates listed in the table's extends key and then the table itself.
+// stack holds names of templates being resolved to detect cycles.
+func (r *templateResolver) resolve(table map[string]interface{}, stack []string) (map[string]interface{}, error) {
+	names, err := extendsList(table["extends"])
+	if err != nil {
+		return nil, err
+	}
+
+	merged := map[string]interface{}{}
+	for _, name := range names {
+		base, err := r.template(name, stack)
+		if err != nil {
+			return nil, err
+		}
+		merged = mergeTables(merged, base)
+	}
+
+	merged = mergeTables(merged, table)
+	delete(merged, "extends")
+	return merged, nil
+}
+
+func (r *templateResolver) template(name string, stack []string) (map[string]interface{}, error) {
+	if resolved, ok := r.resolved[name]; ok {
+		return resolved, nil
+	}
+
+	for _, parent := range stack {
+		if parent == name {
+			return nil, errors.Errorf("templates extend each other: %s", strings.Join(append(stack, name), " -> "))
+		}
+	}
+
+	table, ok := r.templates[name]
+	if !ok {
+		return nil, errors.Errorf("unknown template %q", name)
+	}
+
+	resolved, err := r.resolve(table, append(stack, name))
+	if err != nil {
+		return nil, err
+	}
+
+	r.resolved[name] = resolved
+	return resolved, nil
+}
+
+// extendsList accepts both a single template name and a list of names
+func extendsList(value interface{}) ([]string, error) {
+	switch v := value.(type) {
+	case nil:
+		return nil, nil
+	case string:
+		return []string{v}, nil
+	case []interface{}:
+		names := make([]string, 0, len(v))
+		for _, item := range v {
+			name, ok := item.(string)
+			if !ok {
+				return nil, errors.New("extends must be a list of template names")
+			}
+			names = append(names, name)
+		}
+		return names, nil
+	default:
+		return nil, errors.New("extends must be a list of template names")
+	}
+}
+
+// mergeTables returns a copy of base with values of override merged in.
+// Nested tables are merged recursively, other values of override replace the ones of base.
+func mergeTables(base map[string]interface{}, override map[string]interface{}) map[string]interface{} {
+	merged := make(map[string]interface{}, len(base)+len(override))
+	for key, value := range base {
+		merged[key] = value
+	}
+
+	for key, value := range override {
+		table, isTable := value.(map[string]interface{})
+		baseTable, baseIsTable := merged[key].(map[string]interface{})
+		if isTable && baseIsTable {
+			merged[key] = mergeTables(baseTable, table)
+		} else {
+			merged[key] = value
+		}
+	}
+
+	return merged
+}
+
+// renderFeed formats a feed table as a [feeds.<id>] block, which can be placed under an existing [feeds] table.
+// An optional comment is put above the feed URL.
+func renderFeed(id string, table map[string]interface{}, comment string) (string, error) {
+	tree, err := toml.TreeFromMap(map[string]interface{}{"feeds": map[string]interface{}{id: table}})
+	if err != nil {
+		return "", err
+	}
+
+	if comment != "" {
+		if url := tree.GetPath([]string{"feeds", id, "url"}); url != nil {
+			tree.SetPathWithComment([]string{"feeds", id, "url"}, comment, false, url)
+		}
+	}
+
+	out, err := tree.ToTomlString()
+	if err != nil {
+		return "", err
+	}
+
+	// Drop the parent table
+	out = strings.TrimPrefix(strings.TrimSpace(out), "[feeds]")
+	return strings.TrimSpace(out) + "\n", nil
+}
+
+// sortedKeys returns feed IDs in a stable order for printing
+func sortedKeys(tables map[string]map[string]interface{}) []string {
+	keys := make([]string, 0, len(tables))
+	for key := range tables {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -13,6 +13,13 @@ type Builder interface {
 	Build(ctx context.Context, cfg *feed.Config) (*model.Feed, error)
 }
 
+// Classifier is implemented by builders that need extra requests to tell the content type of episodes
+type Classifier interface {
+	// Classify turns on detection of YouTube Shorts and passes content types of stored episodes,
+	// which are kept instead of being detected again
+	Classify(shorts bool, known map[string]model.ContentType)
+}
+
 func New(ctx context.Context, provider model.Provider, key string, downloader Downloader) (Builder, error) {
 	switch provider {
 	case model.ProviderYoutube:
@@ -30,8 +30,18 @@ const (
 	ldBytesPerSecond        = 100000
 	lowAudioBytesPerSecond  = 48000 / 8
 	highAudioBytesPerSecond = 128000 / 8
+
+	// maxShortDuration is the longest a YouTube Short can be
+	maxShortDuration = 3 * 60
+	// minPremiereCountdown and maxPremiereCountdown bound how much longer than the video a premiere
+	// broadcast lasts because of its countdown
+	minPremiereCountdown = 30 * time.Second
+	maxPremiereCountdown = 5 * time.Minute
 )
 
+// shortsURL serves 200 for Shorts and redirects to the regular watch page otherwise
+const shortsURL = "https://www.youtube.com/shorts/%s"
+
 type apiKey string
 
 func (key apiKey) Get() (string, string) {
@@ -42,6 +52,17 @@ type YouTubeBuilder struct {
 	client     *youtube.Service
 	key        apiKey
 	downloader Downloader
+	// web is used to check video pages the API doesn't tell about (e.g. Shorts)
+	web       *http.Client
+	shortsURL string
+	// shorts enables detection of Shorts, known are content types of stored episodes (see Classify)
+	shorts bool
+	known  map[string]model.ContentType
+}
+
+func (yt *YouTubeBuilder) Classify(shorts bool, known map[string]model.ContentType) {
+	yt.shorts = shorts
+	yt.known = known
 }
 
 // Cost: 100 units (call: 1, snippet: 99)
@@ -314,7 +335,114 @@ func (yt *YouTubeBuilder) getSize(duration int64, feed *model.Feed) int64 {
 	return duration * ldBytesPerSecond
 }
 
-// Cost: 5 units (call: 1, snippet: 2, contentDetails: 2)
+// isShort checks whether the video is a YouTube Short
+func (yt *YouTubeBuilder) isShort(ctx context.Context, videoID string) (bool, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodHead, fmt.Sprintf(yt.shortsURL, videoID), nil)
+	if err != nil {
+		return false, err
+	}
+
+	resp, err := yt.web.Do(req)
+	if err != nil {
+		return false, err
+	}
+	defer resp.Body.Close()
+
+	return resp.StatusCode == http.StatusOK, nil
+}
+
+// broadcastType tells finished live streams apart from premieres, which the API reports the same way.
+// A premiere broadcast plays the uploaded video after a countdown, so it lasts a bit longer than the video,
+// while the recording of a live stream is as long as the stream.
+func (yt *YouTubeBuilder) broadcastType(details *youtube.VideoLiveStreamingDetails, seconds int64) model.ContentType {
+	start, err1 := yt.parseDate(details.ActualStartTime)
+	end, err2 := yt.parseDate(details.ActualEndTime)
+	if err1 != nil || err2 != nil || seconds <= 1 {
+		return model.ContentLiveVOD
+	}
+
+	countdown := end.Sub(start) - time.Duration(seconds)*time.Second
+	if countdown >= minPremiereCountdown && countdown <= maxPremiereCountdown {
+		return model.ContentPremiere
+	}
+
+	return model.ContentLiveVOD
+}
+
+// contentType classifies the video. Stored episodes keep their content type, Shorts are checked only
+// when filters need them and the video is short enough, to avoid extra requests.
+// Short videos are left unclassified when not checked.
+func (yt *YouTubeBuilder) contentType(ctx context.Context, video *youtube.Video, seconds int64) model.ContentType {
+	if contentType, ok := yt.known[video.Id]; ok {
+		return contentType
+	}
+
+	if video.LiveStreamingDetails != nil && video.LiveStreamingDetails.ActualStartTime != "" {
+		return yt.broadcastType(video.LiveStreamingDetails, seconds)
+	}
+
+	if seconds <= maxShortDuration {
+		if !yt.shorts {
+			return ""
+		}
+
+		short, err := yt.isShort(ctx, video.Id)
+		if err != nil {
+			log.WithError(err).WithField("video_id", video.Id).Warn("failed to check whether video is a short")
+			return ""
+		} else if short {
+			return model.ContentShort
+		}
+	}
+
+	return model.ContentVideo
+}
+
+// queryMembersOnly returns IDs of members-only videos of a channel feed.
+// YouTube lists them in a playlist named after the uploads playlist, which doesn't exist for
+// channels without memberships.
+// Cost: 1 unit per page
+func (yt *YouTubeBuilder) queryMembersOnly(ctx context.Context, feed *model.Feed) map[string]struct{} {
+	if !strings.HasPrefix(feed.ItemID, "UU") || feed.LinkType == model.TypePlaylist {
+		return nil
+	}
+
+	var (
+		playlistID = "UUMO" + strings.TrimPrefix(feed.ItemID, "UU")
+		ids        = map[string]struct{}{}
+		token      string
+	)
+
+	for {
+		req := yt.client.PlaylistItems.List([]string{"snippet"}).MaxResults(maxYoutubeResults).PlaylistId(playlistID)
+		if token != "" {
+			req = req.PageToken(token)
+		}
+
+		resp, err := req.Context(ctx).Do(yt.key)
+		if err != nil {
+			if token == "" {
+				log.WithError(err).Debug("no members-only videos found")
+			} else {
+				log.WithError(err).Warn("failed to query members-only videos")
+			}
+			return ids
+		}
+
+		for _, item := range resp.Items {
+			if item.Snippet != nil && item.Snippet.ResourceId != nil {
+				ids[item.Snippet.ResourceId.VideoId] = struct{}{}
+			}
+		}
+
+		token = resp.NextPageToken
+		if token == "" || len(resp.Items) == 0 {
+			return ids
+		}
+	}
+}
+
+// Cost: 5 units (call: 1, snippet: 2, contentDetails: 2, liveStreamingDetails: 0)
 // See https://developers.google.com/youtube/v3/docs/videos/list#part
 func (yt *YouTubeBuilder) queryVideoDescriptions(ctx context.Context, playlist map[string]*youtube.PlaylistItemSnippet, feed *model.Feed) error {
 	// Make the list of video ids
@@ -339,9 +467,11 @@ func (yt *YouTubeBuilder) queryVideoDescriptions(ctx context.Context, playlist m
 	// Show how many API calls will be required
 	log.Debugf("Expected to make %d API calls to get the descriptions for %d episode(s).", len(idsList), len(ids))
 
+	membersOnly := yt.queryMembersOnly(ctx, feed)
+
 	// Loop in each slices of 50 (or less) IDs and query their description
 	for _, idsI := range idsList {
-		req, err := yt.client.Videos.List([]string{"id", "snippet", "contentDetails"}).Id(idsI).Context(ctx).Do(yt.key)
+		req, err := yt.client.Videos.List([]string{"id", "snippet", "contentDetails", "liveStreamingDetails"}).Id(idsI).Context(ctx).Do(yt.key)
 		if err != nil {
 			return errors.Wrap(err, "failed to query video descriptions")
 		}
@@ -354,8 +484,9 @@ func (yt *YouTubeBuilder) queryVideoDescriptions(ctx context.Context, playlist m
 				image    = yt.selectThumbnail(snippet.Thumbnails, feed.Quality, videoID)
 			)
 
-			// Skip unreleased/airing Premiere videos
+			// Skip unreleased/airing Premiere videos and live streams, they're picked up once finished
 			if snippet.LiveBroadcastContent == "upcoming" || snippet.LiveBroadcastContent == "live" {
+				log.WithField("video_id", videoID).Debugf("skipping %s broadcast", snippet.LiveBroadcastContent)
 				continue
 			}
 
@@ -401,6 +532,9 @@ func (yt *YouTubeBuilder) queryVideoDescriptions(ctx context.Context, playlist m
 				VideoURL:    videoURL,
 				PubDate:     pubDate,
 				Order:       order,
+				Tags:        snippet.Tags,
+				ContentType: yt.contentType(ctx, video, seconds),
+				MembersOnly: isMembersOnly(membersOnly, videoID),
 				Status:      model.EpisodeNew,
 			})
 		}
@@ -409,6 +543,12 @@ func (yt *YouTubeBuilder) queryVideoDescriptions(ctx context.Context, playlist m
 	return nil
 }
 
+// isMembersOnly returns true if the video is in the set returned by queryMembersOnly
+func isMembersOnly(ids map[string]struct{}, videoID string) bool {
+	_, ok := ids[videoID]
+	return ok
+}
+
 // Cost:
 // ASC mode = (3 units + 5 units) * X pages = 8 units per page
 // DESC mode = 3 units * (number of pages in the entire playlist) + 5 units
@@ -520,5 +660,12 @@ func NewYouTubeBuilder(key string, ytdlp Downloader) (*YouTubeBuilder, error) {
 		return nil, errors.Wrap(err, "failed to create youtube client")
 	}
 
-	return &YouTubeBuilder{client: yt, key: apiKey(key), downloader: ytdlp}, nil
+	web := &http.Client{
+		Timeout: 10 * time.Second,
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+
+	return &YouTubeBuilder{client: yt, key: apiKey(key), downloader: ytdlp, web: web, shortsURL: shortsURL}, nil
 }
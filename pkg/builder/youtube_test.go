@@ -2,9 +2,13 @@ package builder
 
 import (
 	"context"
+	"fmt"
 	"net/http"
+	"net/http/httptest"
+	"path"
 	"testing"
 
+	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 	"google.golang.org/api/option"
 	"google.golang.org/api/youtube/v3"
@@ -170,3 +174,76 @@ func TestParseURLWithHandles(t *testing.T) {
 		})
 	}
 }
+
+func TestYouTubeContentType(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, http.MethodHead, r.Method)
+		if r.URL.Path == "/shorts/short1" {
+			w.WriteHeader(http.StatusOK)
+			return
+		}
+		http.Redirect(w, r, "/watch?v="+path.Base(r.URL.Path), http.StatusSeeOther)
+	}))
+	defer server.Close()
+
+	yt := &YouTubeBuilder{
+		web:       &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse }},
+		shortsURL: server.URL + "/shorts/%s",
+	}
+
+	ctx := context.Background()
+	// Shorts aren't checked unless filters need them
+	assert.Equal(t, model.ContentType(""), yt.contentType(ctx, &youtube.Video{Id: "short1"}, 45))
+
+	yt.Classify(true, map[string]model.ContentType{"known1": model.ContentVideo})
+	assert.Equal(t, model.ContentShort, yt.contentType(ctx, &youtube.Video{Id: "short1"}, 45))
+	assert.Equal(t, model.ContentVideo, yt.contentType(ctx, &youtube.Video{Id: "video1"}, 45))
+	// Long videos can't be Shorts and aren't checked
+	assert.Equal(t, model.ContentVideo, yt.contentType(ctx, &youtube.Video{Id: "short1"}, 600))
+	// Stored episodes keep their content type
+	assert.Equal(t, model.ContentVideo, yt.contentType(ctx, &youtube.Video{Id: "known1"}, 45))
+
+	// Live stream recordings last as long as the broadcast
+	live := &youtube.Video{Id: "live1", LiveStreamingDetails: &youtube.VideoLiveStreamingDetails{
+		ActualStartTime: "2024-01-01T10:00:00Z",
+		ActualEndTime:   "2024-01-01T12:00:00Z",
+	}}
+	assert.Equal(t, model.ContentLiveVOD, yt.contentType(ctx, live, 7195))
+
+	// Premieres play the uploaded video after a countdown
+	premiere := &youtube.Video{Id: "premiere1", LiveStreamingDetails: &youtube.VideoLiveStreamingDetails{
+		ActualStartTime: "2024-01-01T10:00:00Z",
+		ActualEndTime:   "2024-01-01T10:12:00Z",
+	}}
+	assert.Equal(t, model.ContentPremiere, yt.contentType(ctx, premiere, 600))
+
+	// Scheduled broadcasts that never went live are regular videos
+	scheduled := &youtube.Video{Id: "video2", LiveStreamingDetails: &youtube.VideoLiveStreamingDetails{
+		ScheduledStartTime: "2024-01-01T10:00:00Z",
+	}}
+	assert.Equal(t, model.ContentVideo, yt.contentType(ctx, scheduled, 600))
+}
+
+func TestYouTubeMembersOnlyPages(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "UUMO_channel", r.URL.Query().Get("playlistId"))
+		w.Header().Set("Content-Type", "application/json")
+		if r.URL.Query().Get("pageToken") == "" {
+			fmt.Fprint(w, `{"nextPageToken": "page2", "items": [{"snippet": {"resourceId": {"videoId": "first"}}}]}`)
+			return
+		}
+		assert.Equal(t, "page2", r.URL.Query().Get("pageToken"))
+		fmt.Fprint(w, `{"items": [{"snippet": {"resourceId": {"videoId": "second"}}}]}`)
+	}))
+	defer server.Close()
+
+	client, err := youtube.NewService(context.Background(), option.WithHTTPClient(server.Client()), option.WithEndpoint(server.URL))
+	require.NoError(t, err)
+
+	yt := &YouTubeBuilder{client: client, key: apiKey("test-api-key")}
+	ids := yt.queryMembersOnly(context.Background(), &model.Feed{ItemID: "UU_channel", LinkType: model.TypeChannel})
+
+	assert.True(t, isMembersOnly(ids, "first"))
+	assert.True(t, isMembersOnly(ids, "second"))
+	assert.False(t, isMembersOnly(ids, "public"))
+}
@@ -5,6 +5,8 @@ import (
 	"encoding/json"
 	"fmt"
 	"os"
+	"strings"
+	"time"
 
 	"github.com/dgraph-io/badger"
 	"github.com/dgraph-io/badger/options"
@@ -15,11 +17,19 @@ import (
 )
 
 const (
-	versionPath   = "podsync/version"
-	feedPrefix    = "feed/"
-	feedPath      = "feed/%s"
-	episodePrefix = "episode/%s/"
-	episodePath   = "episode/%s/%s" // FeedID + EpisodeID
+	// keyPrefix doesn't follow the schema version, schema changes are handled by migrations
+	keyPrefix      = "podsync/v1/"
+	versionPath    = "podsync/version"
+	feedPrefix     = "feed/"
+	feedPath       = "feed/%s"
+	episodesPrefix = "episode/"
+	episodePrefix  = "episode/%s/"
+	episodePath    = "episode/%s/%s" // FeedID + EpisodeID
+	tokenPrefix    = "token/"
+	tokenPath      = "token/%s" // Secret hash
+	accessesPrefix = "access/"
+	accessPrefix   = "access/%s/"
+	accessPath     = "access/%s/%s/%s/%s" // FeedID + Day + File + Client
 )
 
 // BadgerConfig represents BadgerDB configuration parameters
@@ -41,6 +51,10 @@ func NewBadger(config *Config) (*Badger, error) {
 
 	log.Infof("opening database %q", dir)
 
+	if err := validateMigrations(migrations, CurrentVersion); err != nil {
+		return nil, errors.Wrap(err, "invalid database migrations")
+	}
+
 	// Make sure database directory exists
 	if err := os.MkdirAll(dir, 0755); err != nil {
 		return nil, errors.Wrap(err, "could not mkdir database dir")
@@ -57,6 +71,10 @@ func NewBadger(config *Config) (*Badger, error) {
 		}
 	}
 
+	if config.ReadOnly {
+		opts.ReadOnly = true
+	}
+
 	db, err := badger.Open(opts)
 	if err != nil {
 		return nil, errors.Wrap(err, "failed to open database")
@@ -64,16 +82,36 @@ func NewBadger(config *Config) (*Badger, error) {
 
 	storage := &Badger{db: db}
 
-	if err := db.Update(func(txn *badger.Txn) error {
-		if err := storage.setObj(txn, []byte(versionPath), CurrentVersion, false); err != nil && err != model.ErrAlreadyExists {
-			return err
+	if config.ReadOnly {
+		if err := checkReadOnlyVersion(storage, CurrentVersion); err != nil {
+			_ = db.Close()
+			return nil, err
 		}
-		return nil
-	}); err != nil {
-		return nil, errors.Wrap(err, "failed to read database version")
+		return storage, nil
+	}
+
+	if err := storage.init(dir); err != nil {
+		_ = db.Close()
+		return nil, err
 	}
 
-	return &Badger{db: db}, nil
+	return storage, nil
+}
+
+// init writes the current version to a new database, or migrates an existing one
+func (b *Badger) init(dir string) error {
+	err := b.db.Update(func(txn *badger.Txn) error {
+		return b.setObj(txn, []byte(versionPath), CurrentVersion, false)
+	})
+
+	switch err {
+	case nil:
+		return nil
+	case model.ErrAlreadyExists:
+		return runMigrations(dir, b, migrations, CurrentVersion)
+	default:
+		return errors.Wrap(err, "failed to write database version")
+	}
 }
 
 func (b *Badger) Close() error {
@@ -155,6 +193,9 @@ func (b *Badger) WalkFeeds(_ context.Context, cb func(feed *model.Feed) error) e
 				return err
 			}
 
+			// Builders don't always fill in the ID, the key is authoritative
+			feed.ID = strings.TrimPrefix(string(item.Key()), string(opts.Prefix))
+
 			return cb(feed)
 		})
 	})
@@ -178,6 +219,14 @@ func (b *Badger) DeleteFeed(_ context.Context, feedID string) error {
 			return errors.Wrapf(err, "failed to iterate episodes for feed %q", feedID)
 		}
 
+		// Access stats
+		opts.Prefix = b.getKey(accessPrefix, feedID)
+		if err := b.iterator(txn, opts, func(item *badger.Item) error {
+			return txn.Delete(item.KeyCopy(nil))
+		}); err != nil {
+			return errors.Wrapf(err, "failed to iterate access records for feed %q", feedID)
+		}
+
 		return nil
 	})
 }
@@ -246,6 +295,220 @@ func (b *Badger) walkEpisodes(txn *badger.Txn, feedID string, cb func(episode *m
 	})
 }
 
+func (b *Badger) CountEpisodes(_ context.Context, status model.EpisodeStatus, since time.Time) (int, error) {
+	count := 0
+	err := b.db.View(func(txn *badger.Txn) error {
+		opts := badger.DefaultIteratorOptions
+		opts.Prefix = b.getKey(episodesPrefix)
+		opts.PrefetchValues = true
+		return b.iterator(txn, opts, func(item *badger.Item) error {
+			episode := &model.Episode{}
+			if err := b.unmarshalObj(item, episode); err != nil {
+				return err
+			}
+
+			if episode.Status == status && episode.PubDate.After(since) {
+				count++
+			}
+
+			return nil
+		})
+	})
+
+	return count, err
+}
+
+func (b *Badger) AddToken(_ context.Context, token *model.Token) error {
+	key := b.getKey(tokenPath, token.Hash)
+	return b.db.Update(func(txn *badger.Txn) error {
+		return b.setObj(txn, key, token, true)
+	})
+}
+
+func (b *Badger) GetToken(_ context.Context, hash string) (*model.Token, error) {
+	var (
+		token model.Token
+		key   = b.getKey(tokenPath, hash)
+	)
+
+	if err := b.db.View(func(txn *badger.Txn) error {
+		return b.getObj(txn, key, &token)
+	}); err != nil {
+		return nil, err
+	}
+
+	return &token, nil
+}
+
+func (b *Badger) WalkTokens(_ context.Context, cb func(token *model.Token) error) error {
+	return b.db.View(func(txn *badger.Txn) error {
+		opts := badger.DefaultIteratorOptions
+		opts.Prefix = b.getKey(tokenPrefix)
+		opts.PrefetchValues = true
+		return b.iterator(txn, opts, func(item *badger.Item) error {
+			token := &model.Token{}
+			if err := b.unmarshalObj(item, token); err != nil {
+				return err
+			}
+
+			return cb(token)
+		})
+	})
+}
+
+func (b *Badger) DeleteToken(_ context.Context, hash string) error {
+	key := b.getKey(tokenPath, hash)
+	return b.db.Update(func(txn *badger.Txn) error {
+		return txn.Delete(key)
+	})
+}
+
+func (b *Badger) RecordAccess(_ context.Context, access *model.Access) error {
+	file := access.File
+	if file == "" {
+		file = "-"
+	}
+
+	key := b.getKey(accessPath, access.FeedID, access.Day, file, access.Client)
+	return b.db.Update(func(txn *badger.Txn) error {
+		var existing model.Access
+		if err := b.getObj(txn, key, &existing); err == nil {
+			existing.Requests += access.Requests
+			if access.LastSeen.After(existing.LastSeen) {
+				existing.LastSeen = access.LastSeen
+			}
+			return b.setObj(txn, key, &existing, true)
+		} else if err != model.ErrNotFound {
+			return err
+		}
+
+		return b.setObj(txn, key, access, true)
+	})
+}
+
+func (b *Badger) WalkAccess(_ context.Context, feedID string, cb func(access *model.Access) error) error {
+	return b.db.View(func(txn *badger.Txn) error {
+		opts := badger.DefaultIteratorOptions
+		opts.Prefix = b.getKey(accessPrefix, feedID)
+		if feedID == "" {
+			opts.Prefix = b.getKey(accessesPrefix)
+		}
+		opts.PrefetchValues = true
+		return b.iterator(txn, opts, func(item *badger.Item) error {
+			access := &model.Access{}
+			if err := b.unmarshalObj(item, access); err != nil {
+				return err
+			}
+
+			return cb(access)
+		})
+	})
+}
+
+func (b *Badger) DeleteAccess(_ context.Context, feedID string, file string) error {
+	return b.db.Update(func(txn *badger.Txn) error {
+		opts := badger.DefaultIteratorOptions
+		opts.Prefix = b.getKey(accessPrefix, feedID)
+		opts.PrefetchValues = file != ""
+		return b.iterator(txn, opts, func(item *badger.Item) error {
+			if file != "" {
+				access := &model.Access{}
+				if err := b.unmarshalObj(item, access); err != nil {
+					return err
+				}
+				if access.File != file {
+					return nil
+				}
+			}
+
+			return txn.Delete(item.KeyCopy(nil))
+		})
+	})
+}
+
+func (b *Badger) backup(path string) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+
+	if _, err := b.db.Backup(f, 0); err != nil {
+		_ = f.Close()
+		return err
+	}
+
+	return f.Close()
+}
+
+func (b *Badger) migrate(m Migration) error {
+	// All records are migrated before anything is written, so a failing migration leaves the database intact
+	updates := map[string]Object{}
+	if err := b.db.View(func(txn *badger.Txn) error {
+		if m.Feed != nil {
+			if err := b.rewrite(txn, b.getKey(feedPrefix), updates, m.Feed); err != nil {
+				return errors.Wrap(err, "failed to migrate feeds")
+			}
+		}
+
+		if m.Episode != nil {
+			if err := b.rewrite(txn, b.getKey(episodesPrefix), updates, func(key string, obj Object) error {
+				// Episode keys are FeedID/EpisodeID
+				feedID := strings.SplitN(key, "/", 2)[0]
+				return m.Episode(feedID, obj)
+			}); err != nil {
+				return errors.Wrap(err, "failed to migrate episodes")
+			}
+		}
+
+		return nil
+	}); err != nil {
+		return err
+	}
+
+	// Large databases don't fit into a single transaction (badger.ErrTxnTooBig), records are written in batches
+	batch := b.db.NewWriteBatch()
+	defer batch.Cancel()
+
+	for key, obj := range updates {
+		data, err := b.marshalObj(obj)
+		if err != nil {
+			return errors.Wrapf(err, "failed to serialize object for key %q", key)
+		}
+		if err := batch.Set([]byte(key), data); err != nil {
+			return errors.Wrap(err, "failed to write migrated records")
+		}
+	}
+
+	if err := batch.Flush(); err != nil {
+		return errors.Wrap(err, "failed to write migrated records")
+	}
+
+	return b.db.Update(func(txn *badger.Txn) error {
+		return b.setObj(txn, []byte(versionPath), m.Version, true)
+	})
+}
+
+// rewrite passes JSON objects under the prefix to cb and collects them into updates
+func (b *Badger) rewrite(txn *badger.Txn, prefix []byte, updates map[string]Object, cb func(key string, obj Object) error) error {
+	opts := badger.DefaultIteratorOptions
+	opts.Prefix = prefix
+	opts.PrefetchValues = true
+	return b.iterator(txn, opts, func(item *badger.Item) error {
+		obj := Object{}
+		if err := b.unmarshalObj(item, &obj); err != nil {
+			return err
+		}
+
+		key := string(item.Key())
+		if err := cb(strings.TrimPrefix(key, string(prefix)), obj); err != nil {
+			return errors.Wrapf(err, "failed to migrate %q", key)
+		}
+
+		updates[key] = obj
+		return nil
+	})
+}
+
 func (b *Badger) iterator(txn *badger.Txn, opts badger.IteratorOptions, callback func(item *badger.Item) error) error {
 	iter := txn.NewIterator(opts)
 	defer iter.Close()
@@ -263,7 +526,7 @@ func (b *Badger) iterator(txn *badger.Txn, opts badger.IteratorOptions, callback
 
 func (b *Badger) getKey(format string, a ...interface{}) []byte {
 	resourcePath := fmt.Sprintf(format, a...)
-	fullPath := fmt.Sprintf("podsync/v%d/%s", CurrentVersion, resourcePath)
+	fullPath := keyPrefix + resourcePath
 
 	return []byte(fullPath)
 }
@@ -89,6 +89,23 @@ func TestBadger_WalkFeeds(t *testing.T) {
 	assert.Equal(t, called, 1)
 }
 
+func TestBadger_WalkFeedsSetsID(t *testing.T) {
+	db, err := NewBadger(&Config{Dir: t.TempDir()})
+	require.NoError(t, err)
+	defer db.Close()
+
+	err = db.AddFeed(testCtx, "configured", &model.Feed{ID: "", Title: "No ID"})
+	require.NoError(t, err)
+
+	var ids []string
+	err = db.WalkFeeds(testCtx, func(feed *model.Feed) error {
+		ids = append(ids, feed.ID)
+		return nil
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"configured"}, ids)
+}
+
 func TestBadger_DeleteFeed(t *testing.T) {
 	dir := t.TempDir()
 
@@ -162,6 +179,122 @@ func TestBadger_WalkEpisodes(t *testing.T) {
 	assert.Equal(t, called, 2)
 }
 
+func TestBadger_Tokens(t *testing.T) {
+	dir := t.TempDir()
+
+	db, err := NewBadger(&Config{Dir: dir})
+	require.NoError(t, err)
+	defer db.Close()
+
+	token := &model.Token{ID: "1", Name: "alice", Hash: "abc", CreatedAt: time.Now().UTC()}
+	err = db.AddToken(testCtx, token)
+	require.NoError(t, err)
+
+	// Tokens must not show up as feeds
+	err = db.WalkFeeds(testCtx, func(feed *model.Feed) error {
+		assert.Fail(t, "unexpected feed")
+		return nil
+	})
+	assert.NoError(t, err)
+
+	found, err := db.GetToken(testCtx, "abc")
+	require.NoError(t, err)
+	assert.Equal(t, "alice", found.Name)
+
+	_, err = db.GetToken(testCtx, "xyz")
+	assert.ErrorIs(t, err, model.ErrNotFound)
+
+	count := 0
+	err = db.WalkTokens(testCtx, func(token *model.Token) error {
+		count++
+		return nil
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, 1, count)
+
+	err = db.DeleteToken(testCtx, "abc")
+	assert.NoError(t, err)
+
+	_, err = db.GetToken(testCtx, "abc")
+	assert.ErrorIs(t, err, model.ErrNotFound)
+}
+
+func TestBadger_RecordAccess(t *testing.T) {
+	dir := t.TempDir()
+
+	db, err := NewBadger(&Config{Dir: dir})
+	require.NoError(t, err)
+	defer db.Close()
+
+	now := time.Now().UTC()
+	access := model.Access{FeedID: "1", File: "1.mp3", Day: "2024-01-01", Client: "abc", Requests: 1, FirstSeen: now, LastSeen: now}
+
+	// Range requests by the same client are merged into a single record
+	for i := 0; i < 3; i++ {
+		record := access
+		record.LastSeen = now.Add(time.Duration(i) * time.Minute)
+		err = db.RecordAccess(testCtx, &record)
+		require.NoError(t, err)
+	}
+
+	// XML fetch
+	err = db.RecordAccess(testCtx, &model.Access{FeedID: "1", Day: "2024-01-01", Client: "abc", Requests: 1})
+	require.NoError(t, err)
+
+	var list []*model.Access
+	err = db.WalkAccess(testCtx, "1", func(access *model.Access) error {
+		list = append(list, access)
+		return nil
+	})
+	require.NoError(t, err)
+	require.Len(t, list, 2)
+
+	for _, item := range list {
+		if item.File == "1.mp3" {
+			assert.Equal(t, 3, item.Requests)
+			assert.Equal(t, now.Add(2*time.Minute), item.LastSeen)
+		} else {
+			assert.Equal(t, 1, item.Requests)
+		}
+	}
+}
+
+func TestBadger_DeleteAccess(t *testing.T) {
+	dir := t.TempDir()
+
+	db, err := NewBadger(&Config{Dir: dir})
+	require.NoError(t, err)
+	defer db.Close()
+
+	for _, access := range []*model.Access{
+		{FeedID: "1", File: "1.mp3", Day: "2024-01-01", Client: "abc", Requests: 1},
+		{FeedID: "1", File: "2.mp3", Day: "2024-01-01", Client: "abc", Requests: 1},
+		{FeedID: "1", Day: "2024-01-01", Client: "abc", Requests: 1},
+		{FeedID: "1-video", File: "1.mp4", Day: "2024-01-01", Client: "abc", Requests: 1},
+	} {
+		require.NoError(t, db.RecordAccess(testCtx, access))
+	}
+
+	files := func(feedID string) []string {
+		var list []string
+		err := db.WalkAccess(testCtx, feedID, func(access *model.Access) error {
+			list = append(list, access.File)
+			return nil
+		})
+		require.NoError(t, err)
+		return list
+	}
+
+	// Records of a single file
+	require.NoError(t, db.DeleteAccess(testCtx, "1", "1.mp3"))
+	assert.ElementsMatch(t, []string{"", "2.mp3"}, files("1"))
+
+	// All records of a feed, records of other feeds are kept
+	require.NoError(t, db.DeleteAccess(testCtx, "1", ""))
+	assert.Empty(t, files("1"))
+	assert.Equal(t, []string{"1.mp4"}, files("1-video"))
+}
+
 func getFeed() *model.Feed {
 	return &model.Feed{
 		ID:             "1",
@@ -1,7 +1,44 @@
 package db
 
+import (
+	"github.com/pkg/errors"
+)
+
+const (
+	// TypeBadger keeps the database in a BadgerDB directory (default)
+	TypeBadger = "badger"
+	// TypeSQLite keeps the database in a single SQLite file inside Dir
+	TypeSQLite = "sqlite"
+)
+
 type Config struct {
+	// Type is a database backend to use, either "badger" (default) or "sqlite"
+	Type string `toml:"type"`
 	// Dir is a directory to keep database files
 	Dir    string        `toml:"dir"`
 	Badger *BadgerConfig `toml:"badger"`
+	// ReadOnly opens the database without write access, so it can be shared with other read-only processes
+	ReadOnly bool `toml:"-"`
+}
+
+// Validate checks the database backend type
+func (c *Config) Validate() error {
+	switch c.Type {
+	case "", TypeBadger, TypeSQLite:
+		return nil
+	default:
+		return errors.Errorf("unknown database type %q (supported: %s, %s)", c.Type, TypeBadger, TypeSQLite)
+	}
+}
+
+// Open opens the database backend selected by the config
+func Open(config *Config) (Storage, error) {
+	switch config.Type {
+	case "", TypeBadger:
+		return NewBadger(config)
+	case TypeSQLite:
+		return NewSQLite(config)
+	default:
+		return nil, errors.Errorf("unknown database type %q", config.Type)
+	}
 }
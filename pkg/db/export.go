@@ -0,0 +1,349 @@
+package db
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"io"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/mxpv/podsync/pkg/model"
+)
+
+const (
+	// ExportFormat identifies podsync database dumps
+	ExportFormat = "podsync-export"
+	// ExportVersion is the version of the dump layout
+	ExportVersion = 1
+
+	recordHeader  = "header"
+	recordFeed    = "feed"
+	recordEpisode = "episode"
+	recordToken   = "token"
+
+	// Episode descriptions can be long
+	maxRecordSize = 16 * 1024 * 1024
+)
+
+// record is a single line of an NDJSON database dump.
+// The first line is a header, feeds are followed by their episodes.
+type record struct {
+	Type string `json:"type"`
+
+	// Header
+	Format    string     `json:"format,omitempty"`
+	Version   int        `json:"version,omitempty"`
+	DBVersion int        `json:"db_version,omitempty"`
+	CreatedAt *time.Time `json:"created_at,omitempty"`
+
+	FeedID  string         `json:"feed_id,omitempty"`
+	Feed    *model.Feed    `json:"feed,omitempty"`
+	Episode *model.Episode `json:"episode,omitempty"`
+	Token   *model.Token   `json:"token,omitempty"`
+}
+
+// DumpStats counts exported or imported records
+type DumpStats struct {
+	Feeds    int `json:"feeds"`
+	Episodes int `json:"episodes"`
+	Tokens   int `json:"tokens"`
+	Access   int `json:"access,omitempty"`
+}
+
+// Export writes feeds, episodes and access tokens to w as newline delimited JSON.
+// Download stats are not exported.
+func Export(ctx context.Context, storage Storage, w io.Writer) (*DumpStats, error) {
+	version, err := storage.Version()
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to read database version")
+	}
+
+	var (
+		stats   = &DumpStats{}
+		encoder = json.NewEncoder(w)
+		now     = time.Now().UTC()
+	)
+
+	if err := encoder.Encode(record{
+		Type:      recordHeader,
+		Format:    ExportFormat,
+		Version:   ExportVersion,
+		DBVersion: version,
+		CreatedAt: &now,
+	}); err != nil {
+		return nil, errors.Wrap(err, "failed to write header")
+	}
+
+	var feeds []*model.Feed
+	if err := storage.WalkFeeds(ctx, func(feed *model.Feed) error {
+		feeds = append(feeds, feed)
+		return nil
+	}); err != nil {
+		return nil, errors.Wrap(err, "failed to walk feeds")
+	}
+
+	for _, feed := range feeds {
+		if err := encoder.Encode(record{Type: recordFeed, FeedID: feed.ID, Feed: feed}); err != nil {
+			return nil, errors.Wrapf(err, "failed to write feed %q", feed.ID)
+		}
+		stats.Feeds++
+
+		if err := storage.WalkEpisodes(ctx, feed.ID, func(episode *model.Episode) error {
+			stats.Episodes++
+			return encoder.Encode(record{Type: recordEpisode, FeedID: feed.ID, Episode: episode})
+		}); err != nil {
+			return nil, errors.Wrapf(err, "failed to write episodes of %q", feed.ID)
+		}
+	}
+
+	if err := storage.WalkTokens(ctx, func(token *model.Token) error {
+		stats.Tokens++
+		return encoder.Encode(record{Type: recordToken, Token: token})
+	}); err != nil {
+		return nil, errors.Wrap(err, "failed to write tokens")
+	}
+
+	return stats, nil
+}
+
+// Import restores a dump written by Export.
+// The whole dump is validated before anything is written. Importing the same dump again is a no-op:
+// feeds, episodes and tokens from the dump replace records with the same IDs, other records are kept.
+func Import(ctx context.Context, storage Storage, r io.Reader) (*DumpStats, error) {
+	records, err := readDump(r)
+	if err != nil {
+		return nil, err
+	}
+
+	var (
+		stats = &DumpStats{}
+		feeds = map[string]*model.Feed{}
+	)
+
+	for _, rec := range records {
+		switch rec.Type {
+		case recordFeed:
+			rec.Feed.ID = rec.FeedID
+			rec.Feed.Episodes = nil
+			if err := storage.AddFeed(ctx, rec.FeedID, rec.Feed); err != nil {
+				return nil, errors.Wrapf(err, "failed to import feed %q", rec.FeedID)
+			}
+			feeds[rec.FeedID] = rec.Feed
+			stats.Feeds++
+
+		case recordEpisode:
+			if err := importEpisode(ctx, storage, feeds[rec.FeedID], rec.Episode); err != nil {
+				return nil, errors.Wrapf(err, "failed to import episode %q of %q", rec.Episode.ID, rec.FeedID)
+			}
+			stats.Episodes++
+
+		case recordToken:
+			if err := storage.AddToken(ctx, rec.Token); err != nil {
+				return nil, errors.Wrapf(err, "failed to import token %q", rec.Token.ID)
+			}
+			stats.Tokens++
+		}
+	}
+
+	return stats, nil
+}
+
+// importEpisode overwrites an existing episode, or inserts a new one
+func importEpisode(ctx context.Context, storage Storage, feed *model.Feed, episode *model.Episode) error {
+	err := storage.UpdateEpisode(feed.ID, episode.ID, func(existing *model.Episode) error {
+		*existing = *episode
+		return nil
+	})
+	if !errors.Is(err, model.ErrNotFound) {
+		return err
+	}
+
+	// AddFeed only inserts episodes that don't exist yet
+	insert := *feed
+	insert.Episodes = []*model.Episode{episode}
+	return storage.AddFeed(ctx, feed.ID, &insert)
+}
+
+// readDump reads and validates all records of a dump
+func readDump(r io.Reader) ([]*record, error) {
+	var (
+		scanner = bufio.NewScanner(r)
+		records []*record
+		feeds   = map[string]struct{}{}
+		line    int
+		version int
+	)
+
+	scanner.Buffer(make([]byte, 64*1024), maxRecordSize)
+
+	for scanner.Scan() {
+		line++
+
+		data := scanner.Bytes()
+		if len(data) == 0 {
+			continue
+		}
+
+		rec := &record{}
+		if err := json.Unmarshal(data, rec); err != nil {
+			return nil, errors.Wrapf(err, "line %d: invalid record", line)
+		}
+
+		// Dumps of older databases are upgraded the same way the database would be
+		if version < CurrentVersion && (rec.Type == recordFeed || rec.Type == recordEpisode) {
+			upgraded, err := upgradeRecord(data, version, migrations)
+			if err != nil {
+				return nil, errors.Wrapf(err, "line %d: failed to migrate record", line)
+			}
+
+			rec = &record{}
+			if err := json.Unmarshal(upgraded, rec); err != nil {
+				return nil, errors.Wrapf(err, "line %d: invalid migrated record", line)
+			}
+		}
+
+		if err := validateRecord(rec, len(records) == 0, feeds); err != nil {
+			return nil, errors.Wrapf(err, "line %d", line)
+		}
+
+		if rec.Type == recordHeader {
+			version = rec.DBVersion
+		}
+
+		records = append(records, rec)
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, errors.Wrap(err, "failed to read dump")
+	}
+
+	if len(records) == 0 {
+		return nil, errors.New("dump is empty")
+	}
+
+	return records, nil
+}
+
+func validateRecord(rec *record, first bool, feeds map[string]struct{}) error {
+	if first != (rec.Type == recordHeader) {
+		return errors.New("dump must start with a single header")
+	}
+
+	switch rec.Type {
+	case recordHeader:
+		if rec.Format != ExportFormat {
+			return errors.Errorf("unsupported format %q", rec.Format)
+		}
+		if rec.Version < 1 || rec.Version > ExportVersion {
+			return errors.Errorf("unsupported dump version %d (supported up to %d)", rec.Version, ExportVersion)
+		}
+		if rec.DBVersion < 1 || rec.DBVersion > CurrentVersion {
+			return errors.Errorf("dump was taken from database version %d, supported up to %d", rec.DBVersion, CurrentVersion)
+		}
+
+	case recordFeed:
+		if rec.FeedID == "" || rec.Feed == nil {
+			return errors.New("feed record requires feed_id and feed")
+		}
+		feeds[rec.FeedID] = struct{}{}
+
+	case recordEpisode:
+		if rec.Episode == nil || rec.Episode.ID == "" {
+			return errors.New("episode record requires an episode with ID")
+		}
+		if _, ok := feeds[rec.FeedID]; !ok {
+			return errors.Errorf("episode %q belongs to unknown feed %q", rec.Episode.ID, rec.FeedID)
+		}
+
+	case recordToken:
+		if rec.Token == nil || rec.Token.Hash == "" || rec.Token.ID == "" {
+			return errors.New("token record requires a token with ID and hash")
+		}
+
+	default:
+		return errors.Errorf("unknown record type %q", rec.Type)
+	}
+
+	return nil
+}
+
+// upgradeRecord applies migrations newer than the given database version to a feed or episode record
+func upgradeRecord(data []byte, version int, list []Migration) ([]byte, error) {
+	raw := Object{}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return nil, err
+	}
+
+	feedID, _ := raw["feed_id"].(string)
+	feed, _ := raw["feed"].(Object)
+	episode, _ := raw["episode"].(Object)
+
+	for _, m := range list {
+		if m.Version <= version {
+			continue
+		}
+
+		if feed != nil && m.Feed != nil {
+			if err := m.Feed(feedID, feed); err != nil {
+				return nil, errors.Wrapf(err, "migration to version %d failed", m.Version)
+			}
+		}
+
+		if episode != nil && m.Episode != nil {
+			if err := m.Episode(feedID, episode); err != nil {
+				return nil, errors.Wrapf(err, "migration to version %d failed", m.Version)
+			}
+		}
+	}
+
+	return json.Marshal(raw)
+}
+
+// Copy copies all records, including download stats, from one database to another.
+// It is used to migrate between database backends, the target is expected to be empty.
+func Copy(ctx context.Context, from Storage, to Storage) (*DumpStats, error) {
+	stats := &DumpStats{}
+
+	var feeds []*model.Feed
+	if err := from.WalkFeeds(ctx, func(feed *model.Feed) error {
+		feeds = append(feeds, feed)
+		return nil
+	}); err != nil {
+		return nil, errors.Wrap(err, "failed to walk feeds")
+	}
+
+	for _, feed := range feeds {
+		feed.Episodes = nil
+		if err := from.WalkEpisodes(ctx, feed.ID, func(episode *model.Episode) error {
+			feed.Episodes = append(feed.Episodes, episode)
+			return nil
+		}); err != nil {
+			return nil, errors.Wrapf(err, "failed to read episodes of %q", feed.ID)
+		}
+
+		if err := to.AddFeed(ctx, feed.ID, feed); err != nil {
+			return nil, errors.Wrapf(err, "failed to copy feed %q", feed.ID)
+		}
+		stats.Feeds++
+		stats.Episodes += len(feed.Episodes)
+	}
+
+	// Renditions record stats under their own feed IDs, which aren't stored as feeds
+	if err := from.WalkAccess(ctx, "", func(access *model.Access) error {
+		stats.Access++
+		return to.RecordAccess(ctx, access)
+	}); err != nil {
+		return nil, errors.Wrap(err, "failed to copy download stats")
+	}
+
+	if err := from.WalkTokens(ctx, func(token *model.Token) error {
+		stats.Tokens++
+		return to.AddToken(ctx, token)
+	}); err != nil {
+		return nil, errors.Wrap(err, "failed to copy tokens")
+	}
+
+	return stats, nil
+}
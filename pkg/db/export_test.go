@@ -0,0 +1,106 @@
+package db
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/mxpv/podsync/pkg/model"
+)
+
+func TestExportImport(t *testing.T) {
+	source, err := NewBadger(&Config{Dir: t.TempDir()})
+	require.NoError(t, err)
+	defer source.Close()
+
+	feed := getFeed()
+	require.NoError(t, source.AddFeed(testCtx, feed.ID, feed))
+	require.NoError(t, source.AddToken(testCtx, &model.Token{ID: "t1", Name: "phone", Hash: "abc"}))
+
+	dump := &bytes.Buffer{}
+	stats, err := Export(testCtx, source, dump)
+	require.NoError(t, err)
+	assert.Equal(t, &DumpStats{Feeds: 1, Episodes: 2, Tokens: 1}, stats)
+
+	target, err := NewBadger(&Config{Dir: t.TempDir()})
+	require.NoError(t, err)
+	defer target.Close()
+
+	// Existing episodes are replaced by the dump
+	require.NoError(t, target.AddFeed(testCtx, feed.ID, &model.Feed{Episodes: []*model.Episode{{ID: "1", Title: "Stale"}}}))
+
+	// Importing twice yields the same state
+	for i := 0; i < 2; i++ {
+		stats, err = Import(testCtx, target, bytes.NewReader(dump.Bytes()))
+		require.NoError(t, err)
+		assert.Equal(t, &DumpStats{Feeds: 1, Episodes: 2, Tokens: 1}, stats)
+	}
+
+	expected, err := source.GetFeed(testCtx, feed.ID)
+	require.NoError(t, err)
+	actual, err := target.GetFeed(testCtx, feed.ID)
+	require.NoError(t, err)
+	assert.Equal(t, expected, actual)
+
+	token, err := target.GetToken(testCtx, "abc")
+	require.NoError(t, err)
+	assert.Equal(t, "phone", token.Name)
+}
+
+func TestImportValidation(t *testing.T) {
+	storage, err := NewBadger(&Config{Dir: t.TempDir()})
+	require.NoError(t, err)
+	defer storage.Close()
+
+	const header = `{"type":"header","format":"podsync-export","version":1,"db_version":1}`
+
+	for name, dump := range map[string]string{
+		"empty":           "",
+		"no header":       `{"type":"feed","feed_id":"a","feed":{}}`,
+		"wrong format":    `{"type":"header","format":"other","version":1,"db_version":1}`,
+		"future version":  `{"type":"header","format":"podsync-export","version":99,"db_version":1}`,
+		"future database": `{"type":"header","format":"podsync-export","version":1,"db_version":99}`,
+		"orphan episode":  header + "\n" + `{"type":"episode","feed_id":"a","episode":{"id":"1"}}`,
+		"unknown type":    header + "\n" + `{"type":"something"}`,
+		"broken json":     header + "\n" + `{"type":`,
+		"valid then bad":  header + "\n" + `{"type":"feed","feed_id":"a","feed":{}}` + "\n" + `{"type":"token","token":{}}`,
+	} {
+		t.Run(name, func(t *testing.T) {
+			_, err := Import(testCtx, storage, strings.NewReader(dump))
+			assert.Error(t, err)
+		})
+	}
+
+	// Nothing is written unless the whole dump is valid
+	_, err = storage.GetFeed(testCtx, "a")
+	assert.ErrorIs(t, err, model.ErrNotFound)
+}
+
+func TestUpgradeRecord(t *testing.T) {
+	list := []Migration{
+		{Version: 2, Episode: func(feedID string, episode Object) error {
+			episode["title"] = feedID + ": " + episode["title"].(string)
+			return nil
+		}},
+		{Version: 3, Feed: func(_ string, feed Object) error {
+			feed["title"] = "Renamed"
+			return nil
+		}},
+	}
+
+	data, err := upgradeRecord([]byte(`{"type":"episode","feed_id":"a","episode":{"id":"1","title":"First"}}`), 1, list)
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"type":"episode","feed_id":"a","episode":{"id":"1","title":"a: First"}}`, string(data))
+
+	// Migrations the dump already went through are skipped
+	data, err = upgradeRecord([]byte(`{"type":"feed","feed_id":"a","feed":{"title":"Old"}}`), 3, list)
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"type":"feed","feed_id":"a","feed":{"title":"Old"}}`, string(data))
+
+	data, err = upgradeRecord([]byte(`{"type":"feed","feed_id":"a","feed":{"title":"Old"}}`), 2, list)
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"type":"feed","feed_id":"a","feed":{"title":"Renamed"}}`, string(data))
+}
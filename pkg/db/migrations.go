@@ -0,0 +1,143 @@
+package db
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+)
+
+// BackupDir is a directory inside the database directory where backups are saved before migrations
+const BackupDir = "backups"
+
+// Object is a JSON decoded database record, migrations modify it in place
+type Object = map[string]interface{}
+
+// Migration upgrades the database schema from Version-1 to Version.
+// On SQLite each migration runs in a single transaction together with the version bump.
+// On Badger records are migrated first and written in batches afterwards, the version is bumped once all of them
+// are written. A migration that fails to write leaves the database partially migrated, restore it from the backup.
+type Migration struct {
+	// Version is the schema version after the migration is applied
+	Version int
+	// Description is logged when the migration runs
+	Description string
+	// Feed rewrites a feed record, nil leaves feeds intact
+	Feed func(feedID string, feed Object) error
+	// Episode rewrites an episode record, nil leaves episodes intact
+	Episode func(feedID string, episode Object) error
+	// SQLite statements run before records are rewritten (e.g. to add columns or indexes)
+	SQLite []string
+}
+
+// migrations must be ordered by version without gaps, the last one defines CurrentVersion.
+// Append new migrations to the end and bump CurrentVersion, never change migrations that were released.
+var migrations []Migration
+
+// migrator is implemented by database backends
+type migrator interface {
+	Version() (int, error)
+	// backup saves a copy of the database to the given path
+	backup(path string) error
+	// migrate applies a migration and sets the database version in a single transaction
+	migrate(m Migration) error
+}
+
+// runMigrations upgrades the database to the target version, taking a backup first.
+// Databases created by a newer binary are rejected.
+func runMigrations(dir string, db migrator, list []Migration, target int) error {
+	version, err := db.Version()
+	if err != nil {
+		return errors.Wrap(err, "failed to read database version")
+	}
+
+	if err := checkVersion(version, target); err != nil {
+		return err
+	}
+
+	var pending []Migration
+	for _, m := range list {
+		if m.Version > version && m.Version <= target {
+			pending = append(pending, m)
+		}
+	}
+
+	if len(pending) == 0 {
+		return nil
+	}
+
+	if err := os.MkdirAll(filepath.Join(dir, BackupDir), 0755); err != nil {
+		return errors.Wrap(err, "failed to create backup directory")
+	}
+
+	path := backupPath(dir, version)
+	log.Infof("backing up database to %q before migrating from version %d to %d", path, version, target)
+	if err := db.backup(path); err != nil {
+		return errors.Wrap(err, "failed to back up database")
+	}
+
+	for _, m := range pending {
+		log.Infof("migrating database to version %d: %s", m.Version, m.Description)
+		if err := db.migrate(m); err != nil {
+			return errors.Wrapf(err, "migration to version %d failed, backup is saved to %q", m.Version, path)
+		}
+	}
+
+	return nil
+}
+
+// backupPath returns a name for a new backup file that doesn't exist yet
+func backupPath(dir string, version int) string {
+	name := fmt.Sprintf("podsync-v%d-%s", version, time.Now().UTC().Format("20060102T150405"))
+	path := filepath.Join(dir, BackupDir, name+".bak")
+	for i := 1; ; i++ {
+		if _, err := os.Stat(path); os.IsNotExist(err) {
+			return path
+		}
+		path = filepath.Join(dir, BackupDir, fmt.Sprintf("%s-%d.bak", name, i))
+	}
+}
+
+// checkVersion makes sure the binary can work with the database
+func checkVersion(version int, target int) error {
+	if version > target {
+		return errors.Errorf("database version %d is newer than supported version %d, upgrade podsync", version, target)
+	}
+	return nil
+}
+
+// validateMigrations makes sure migrations are ordered and end at the target version
+func validateMigrations(list []Migration, target int) error {
+	for i, m := range list {
+		if m.Version != i+2 {
+			return errors.Errorf("migration #%d upgrades to version %d, expected %d", i, m.Version, i+2)
+		}
+	}
+
+	if last := len(list) + 1; last != target {
+		return errors.Errorf("migrations end at version %d, but current version is %d", last, target)
+	}
+
+	return nil
+}
+
+// checkReadOnlyVersion rejects databases read-only processes can't work with, as they can't migrate them
+func checkReadOnlyVersion(db migrator, target int) error {
+	version, err := db.Version()
+	if err != nil {
+		return errors.Wrap(err, "failed to read database version")
+	}
+
+	if err := checkVersion(version, target); err != nil {
+		return err
+	}
+
+	if version < target {
+		return errors.Errorf("database version %d is older than version %d, start podsync once to migrate it", version, target)
+	}
+
+	return nil
+}
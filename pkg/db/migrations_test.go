@@ -0,0 +1,271 @@
+package db
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/dgraph-io/badger"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/mxpv/podsync/pkg/model"
+)
+
+func TestMigrationsAreValid(t *testing.T) {
+	assert.NoError(t, validateMigrations(migrations, CurrentVersion))
+
+	assert.Error(t, validateMigrations([]Migration{{Version: 3}}, 3))
+	assert.Error(t, validateMigrations([]Migration{{Version: 2}}, 3))
+	assert.NoError(t, validateMigrations([]Migration{{Version: 2}, {Version: 3}}, 3))
+}
+
+var testMigrations = []Migration{
+	{
+		Version:     2,
+		Description: "add retries to episodes",
+		Episode: func(feedID string, episode Object) error {
+			episode["retries"] = 0
+			episode["title"] = feedID + ": " + episode["title"].(string)
+			return nil
+		},
+		SQLite: []string{`ALTER TABLE episodes ADD COLUMN retries INTEGER NOT NULL DEFAULT 0`},
+	},
+	{
+		Version:     3,
+		Description: "rename feed title",
+		Feed: func(feedID string, feed Object) error {
+			feed["title"] = "Migrated " + feedID
+			return nil
+		},
+	},
+}
+
+func TestRunMigrations(t *testing.T) {
+	for name, open := range map[string]func(dir string) (Storage, error){
+		"badger": func(dir string) (Storage, error) { return NewBadger(&Config{Dir: dir}) },
+		"sqlite": func(dir string) (Storage, error) { return NewSQLite(&Config{Dir: dir}) },
+	} {
+		t.Run(name, func(t *testing.T) {
+			dir := t.TempDir()
+
+			storage, err := open(dir)
+			require.NoError(t, err)
+			defer storage.Close()
+
+			feed := getFeed()
+			require.NoError(t, storage.AddFeed(testCtx, feed.ID, feed))
+
+			db := storage.(migrator)
+
+			// Failed migrations are rolled back
+			err = runMigrations(dir, db, []Migration{{
+				Version: 2,
+				Episode: func(string, Object) error { return errors.New("failed") },
+			}}, 2)
+			assert.Error(t, err)
+
+			version, err := db.Version()
+			require.NoError(t, err)
+			assert.Equal(t, 1, version)
+
+			err = runMigrations(dir, db, testMigrations, 3)
+			require.NoError(t, err)
+
+			version, err = db.Version()
+			require.NoError(t, err)
+			assert.Equal(t, 3, version)
+
+			actual, err := storage.GetFeed(testCtx, feed.ID)
+			require.NoError(t, err)
+			assert.Equal(t, "Migrated 1", actual.Title)
+			assert.Equal(t, "1: Episode title 1", actual.Episodes[0].Title)
+			assert.Equal(t, feed.Episodes[1].Size, actual.Episodes[1].Size)
+
+			// Migrations that were applied already are skipped
+			err = runMigrations(dir, db, testMigrations, 3)
+			require.NoError(t, err)
+
+			actual, err = storage.GetFeed(testCtx, feed.ID)
+			require.NoError(t, err)
+			assert.Equal(t, "1: Episode title 1", actual.Episodes[0].Title)
+
+			// Backups are taken before each run that has pending migrations
+			backups, err := os.ReadDir(filepath.Join(dir, BackupDir))
+			require.NoError(t, err)
+			assert.NotEmpty(t, backups)
+
+			// Binaries that are older than the database refuse to open it
+			err = runMigrations(dir, db, testMigrations[:1], 2)
+			assert.Error(t, err)
+		})
+	}
+}
+
+func TestVersion2Migration(t *testing.T) {
+	v2 := Migration{
+		Version:     2,
+		Description: "prefix episode titles",
+		Feed: func(feedID string, feed Object) error {
+			feed["title"] = "Migrated " + feedID
+			return nil
+		},
+		Episode: func(feedID string, episode Object) error {
+			episode["title"] = feedID + ": " + episode["title"].(string)
+			return nil
+		},
+		SQLite: []string{`ALTER TABLE episodes ADD COLUMN retries INTEGER NOT NULL DEFAULT 0`},
+	}
+
+	for name, open := range map[string]func(dir string) (Storage, error){
+		"badger": func(dir string) (Storage, error) { return NewBadger(&Config{Dir: dir}) },
+		"sqlite": func(dir string) (Storage, error) { return NewSQLite(&Config{Dir: dir}) },
+	} {
+		t.Run(name, func(t *testing.T) {
+			dir := t.TempDir()
+
+			storage, err := open(dir)
+			require.NoError(t, err)
+			defer storage.Close()
+
+			feed := getFeed()
+			require.NoError(t, storage.AddFeed(testCtx, feed.ID, feed))
+
+			dump := &bytes.Buffer{}
+			_, err = Export(testCtx, storage, dump)
+			require.NoError(t, err)
+
+			// Register the migration the way a release bumping the version to 2 would
+			saved := migrations
+			migrations = append(append([]Migration{}, saved...), v2)
+			defer func() { migrations = saved }()
+			require.NoError(t, validateMigrations(migrations, 2))
+
+			require.NoError(t, runMigrations(dir, storage.(migrator), migrations, 2))
+
+			version, err := storage.Version()
+			require.NoError(t, err)
+			assert.Equal(t, 2, version)
+
+			actual, err := storage.GetFeed(testCtx, feed.ID)
+			require.NoError(t, err)
+			assert.Equal(t, "Migrated 1", actual.Title)
+
+			titles := map[string]string{}
+			for _, episode := range actual.Episodes {
+				titles[episode.ID] = episode.Title
+			}
+			assert.Equal(t, map[string]string{"1": "1: Episode title 1", "2": "1: Episode title 2"}, titles)
+
+			// Dumps taken before the migration are upgraded to the same records
+			scanner := bufio.NewScanner(dump)
+			for scanner.Scan() {
+				upgraded, err := upgradeRecord(scanner.Bytes(), 1, migrations)
+				require.NoError(t, err)
+
+				rec := &record{}
+				require.NoError(t, json.Unmarshal(upgraded, rec))
+				switch rec.Type {
+				case recordFeed:
+					assert.Equal(t, actual.Title, rec.Feed.Title)
+				case recordEpisode:
+					assert.Equal(t, titles[rec.Episode.ID], rec.Episode.Title)
+				}
+			}
+			require.NoError(t, scanner.Err())
+		})
+	}
+}
+
+func TestBadger_MigrationInBatches(t *testing.T) {
+	dir := t.TempDir()
+
+	// Small tables limit the size of a single transaction
+	db, err := badger.Open(badger.DefaultOptions(dir).WithMaxTableSize(1 << 16))
+	require.NoError(t, err)
+
+	storage := &Badger{db: db}
+	defer storage.Close()
+	require.NoError(t, storage.init(dir))
+
+	const count = 500
+	require.Less(t, db.MaxBatchCount(), int64(count))
+
+	for i := 0; i < count; i += 10 {
+		feed := &model.Feed{ID: "1"}
+		for j := i; j < i+10; j++ {
+			feed.Episodes = append(feed.Episodes, &model.Episode{ID: fmt.Sprintf("%d", j), Title: "Episode"})
+		}
+		require.NoError(t, storage.AddFeed(testCtx, "1", feed))
+	}
+
+	err = runMigrations(dir, storage, []Migration{{
+		Version: 2,
+		Episode: func(_ string, episode Object) error {
+			episode["title"] = "Migrated"
+			return nil
+		},
+	}}, 2)
+	require.NoError(t, err)
+
+	migrated := 0
+	require.NoError(t, storage.WalkEpisodes(testCtx, "1", func(episode *model.Episode) error {
+		if episode.Title == "Migrated" {
+			migrated++
+		}
+		return nil
+	}))
+	assert.Equal(t, count, migrated)
+}
+
+func TestSQLite_MigrationUpdatesColumns(t *testing.T) {
+	dir := t.TempDir()
+	storage := newTestSQLite(t)
+
+	require.NoError(t, storage.AddFeed(testCtx, "1", &model.Feed{Episodes: []*model.Episode{
+		{ID: "1", Status: model.EpisodeError},
+	}}))
+
+	err := runMigrations(dir, storage, []Migration{{
+		Version: 2,
+		Episode: func(_ string, episode Object) error {
+			episode["status"] = string(model.EpisodeNew)
+			return nil
+		},
+	}}, 2)
+	require.NoError(t, err)
+
+	var status string
+	require.NoError(t, storage.db.QueryRow(`SELECT status FROM episodes`).Scan(&status))
+	assert.Equal(t, string(model.EpisodeNew), status)
+}
+
+func TestOpenNewerDatabase(t *testing.T) {
+	for name, open := range map[string]func(config *Config) (Storage, error){
+		"badger": func(config *Config) (Storage, error) { return NewBadger(config) },
+		"sqlite": func(config *Config) (Storage, error) { return NewSQLite(config) },
+	} {
+		t.Run(name, func(t *testing.T) {
+			dir := t.TempDir()
+
+			storage, err := open(&Config{Dir: dir})
+			require.NoError(t, err)
+
+			// Pretend a newer binary migrated the database
+			err = storage.(migrator).migrate(Migration{Version: CurrentVersion + 1})
+			require.NoError(t, err)
+			require.NoError(t, storage.Close())
+
+			_, err = open(&Config{Dir: dir})
+			assert.ErrorContains(t, err, "newer than supported")
+
+			_, err = open(&Config{Dir: dir, ReadOnly: true})
+			assert.ErrorContains(t, err, "newer than supported")
+		})
+	}
+}
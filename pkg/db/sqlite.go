@@ -0,0 +1,672 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+	_ "modernc.org/sqlite" // Pure Go SQLite driver, no cgo needed for ARM builds
+
+	"github.com/mxpv/podsync/pkg/model"
+)
+
+// SQLiteFileName is a name of the SQLite database file inside the database directory
+const SQLiteFileName = "podsync.db"
+
+// sqliteSchema creates tables for a new database.
+// Columns are there for querying with ordinary tools and for indexes, the data column holds
+// the complete JSON encoded object (same encoding as in Badger), so no fields are lost.
+var sqliteSchema = []string{
+	`CREATE TABLE IF NOT EXISTS meta (
+		key   TEXT PRIMARY KEY,
+		value TEXT NOT NULL
+	)`,
+	`CREATE TABLE IF NOT EXISTS feeds (
+		id         TEXT PRIMARY KEY,
+		title      TEXT NOT NULL DEFAULT '',
+		provider   TEXT NOT NULL DEFAULT '',
+		item_url   TEXT NOT NULL DEFAULT '',
+		updated_at TIMESTAMP,
+		removed_at TIMESTAMP,
+		data       TEXT NOT NULL
+	)`,
+	`CREATE TABLE IF NOT EXISTS episodes (
+		feed_id  TEXT NOT NULL,
+		id       TEXT NOT NULL,
+		title    TEXT NOT NULL DEFAULT '',
+		status   TEXT NOT NULL DEFAULT '',
+		pub_date TIMESTAMP,
+		size     INTEGER NOT NULL DEFAULT 0,
+		pinned   INTEGER NOT NULL DEFAULT 0,
+		data     TEXT NOT NULL,
+		PRIMARY KEY (feed_id, id)
+	)`,
+	`CREATE INDEX IF NOT EXISTS episodes_status_pub_date ON episodes (status, pub_date)`,
+	`CREATE INDEX IF NOT EXISTS episodes_feed_pub_date ON episodes (feed_id, pub_date)`,
+	`CREATE TABLE IF NOT EXISTS tokens (
+		hash TEXT PRIMARY KEY,
+		id   TEXT NOT NULL,
+		name TEXT NOT NULL DEFAULT '',
+		data TEXT NOT NULL
+	)`,
+	`CREATE UNIQUE INDEX IF NOT EXISTS tokens_id ON tokens (id)`,
+	`CREATE TABLE IF NOT EXISTS access (
+		feed_id   TEXT NOT NULL,
+		day       TEXT NOT NULL,
+		file      TEXT NOT NULL,
+		client    TEXT NOT NULL,
+		requests  INTEGER NOT NULL DEFAULT 0,
+		last_seen TIMESTAMP,
+		data      TEXT NOT NULL,
+		PRIMARY KEY (feed_id, day, file, client)
+	)`,
+}
+
+type SQLite struct {
+	db *sql.DB
+}
+
+var _ Storage = (*SQLite)(nil)
+
+func NewSQLite(config *Config) (*SQLite, error) {
+	var (
+		dir  = config.Dir
+		path = filepath.Join(dir, SQLiteFileName)
+	)
+
+	log.Infof("opening database %q", path)
+
+	if err := validateMigrations(migrations, CurrentVersion); err != nil {
+		return nil, errors.Wrap(err, "invalid database migrations")
+	}
+
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, errors.Wrap(err, "could not mkdir database dir")
+	}
+
+	query := url.Values{}
+	query.Add("_pragma", "busy_timeout(10000)")
+	query.Add("_pragma", "journal_mode(WAL)")
+	query.Add("_pragma", "synchronous(NORMAL)")
+	if config.ReadOnly {
+		query.Set("mode", "ro")
+	}
+
+	db, err := sql.Open("sqlite", "file:"+path+"?"+query.Encode())
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to open database")
+	}
+
+	// SQLite allows a single writer, serialize access within the process instead of retrying on SQLITE_BUSY
+	db.SetMaxOpenConns(1)
+
+	storage := &SQLite{db: db}
+
+	if err := db.Ping(); err != nil {
+		_ = db.Close()
+		return nil, errors.Wrap(err, "failed to open database")
+	}
+
+	if config.ReadOnly {
+		if err := checkReadOnlyVersion(storage, CurrentVersion); err != nil {
+			_ = db.Close()
+			return nil, err
+		}
+		return storage, nil
+	}
+
+	if err := storage.init(dir); err != nil {
+		_ = db.Close()
+		return nil, err
+	}
+
+	return storage, nil
+}
+
+// init creates the schema of a new database, or migrates an existing one
+func (s *SQLite) init(dir string) error {
+	var tables int
+	if err := s.db.QueryRow(`SELECT COUNT(*) FROM sqlite_master WHERE type = 'table' AND name = 'meta'`).Scan(&tables); err != nil {
+		return errors.Wrap(err, "failed to read database schema")
+	}
+
+	if tables > 0 {
+		return runMigrations(dir, s, migrations, CurrentVersion)
+	}
+
+	// The schema always matches the current version, migrations are only needed for existing databases
+	return s.tx(context.Background(), func(tx *sql.Tx) error {
+		for _, stmt := range sqliteSchema {
+			if _, err := tx.Exec(stmt); err != nil {
+				return errors.Wrap(err, "failed to create database schema")
+			}
+		}
+
+		return setSQLiteVersion(tx, CurrentVersion)
+	})
+}
+
+func (s *SQLite) Close() error {
+	log.Debug("closing database")
+	return s.db.Close()
+}
+
+func (s *SQLite) Version() (int, error) {
+	var value string
+	if err := s.db.QueryRow(`SELECT value FROM meta WHERE key = 'version'`).Scan(&value); err != nil {
+		if err == sql.ErrNoRows {
+			return -1, model.ErrNotFound
+		}
+		return -1, err
+	}
+
+	return strconv.Atoi(value)
+}
+
+func (s *SQLite) AddFeed(ctx context.Context, feedID string, feed *model.Feed) error {
+	return s.tx(ctx, func(tx *sql.Tx) error {
+		data, err := json.Marshal(feed)
+		if err != nil {
+			return errors.Wrapf(err, "failed to serialize feed %q", feedID)
+		}
+
+		// Insert or update feed info
+		if _, err := tx.ExecContext(ctx, `
+			INSERT INTO feeds (id, title, provider, item_url, updated_at, removed_at, data) VALUES (?, ?, ?, ?, ?, ?, ?)
+			ON CONFLICT (id) DO UPDATE SET
+				title = excluded.title,
+				provider = excluded.provider,
+				item_url = excluded.item_url,
+				updated_at = excluded.updated_at,
+				removed_at = excluded.removed_at,
+				data = excluded.data`,
+			feedID, feed.Title, string(feed.Provider), feed.ItemURL, nullTime(feed.UpdatedAt), nullTime(feed.RemovedAt), data,
+		); err != nil {
+			return errors.Wrapf(err, "failed to save feed %q", feedID)
+		}
+
+		// Append new episodes
+		for _, episode := range feed.Episodes {
+			if err := s.putEpisode(ctx, tx, feedID, episode, false); err != nil {
+				return errors.Wrapf(err, "failed to save episode %q", feedID)
+			}
+		}
+
+		return nil
+	})
+}
+
+func (s *SQLite) GetFeed(ctx context.Context, feedID string) (*model.Feed, error) {
+	feed := &model.Feed{}
+	if err := s.getObj(ctx, feed, `SELECT data FROM feeds WHERE id = ?`, feedID); err != nil {
+		return nil, err
+	}
+
+	if err := s.WalkEpisodes(ctx, feedID, func(episode *model.Episode) error {
+		feed.Episodes = append(feed.Episodes, episode)
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+
+	return feed, nil
+}
+
+func (s *SQLite) WalkFeeds(ctx context.Context, cb func(feed *model.Feed) error) error {
+	var feeds []*model.Feed
+	if err := s.query(ctx, func(rows *sql.Rows) error {
+		var (
+			id   string
+			data []byte
+		)
+		if err := rows.Scan(&id, &data); err != nil {
+			return err
+		}
+
+		feed := &model.Feed{}
+		if err := json.Unmarshal(data, feed); err != nil {
+			return err
+		}
+
+		// Builders don't always fill in the ID, the key is authoritative
+		feed.ID = id
+		feeds = append(feeds, feed)
+		return nil
+	}, `SELECT id, data FROM feeds ORDER BY id`); err != nil {
+		return err
+	}
+
+	for _, feed := range feeds {
+		if err := cb(feed); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (s *SQLite) DeleteFeed(ctx context.Context, feedID string) error {
+	return s.tx(ctx, func(tx *sql.Tx) error {
+		for _, stmt := range []string{
+			`DELETE FROM feeds WHERE id = ?`,
+			`DELETE FROM episodes WHERE feed_id = ?`,
+			`DELETE FROM access WHERE feed_id = ?`,
+		} {
+			if _, err := tx.ExecContext(ctx, stmt, feedID); err != nil {
+				return errors.Wrapf(err, "failed to delete feed %q", feedID)
+			}
+		}
+
+		return nil
+	})
+}
+
+func (s *SQLite) GetEpisode(ctx context.Context, feedID string, episodeID string) (*model.Episode, error) {
+	episode := &model.Episode{}
+	if err := s.getObj(ctx, episode, `SELECT data FROM episodes WHERE feed_id = ? AND id = ?`, feedID, episodeID); err != nil {
+		return nil, err
+	}
+
+	return episode, nil
+}
+
+func (s *SQLite) UpdateEpisode(feedID string, episodeID string, cb func(episode *model.Episode) error) error {
+	ctx := context.Background()
+	return s.tx(ctx, func(tx *sql.Tx) error {
+		var data []byte
+		if err := tx.QueryRowContext(ctx, `SELECT data FROM episodes WHERE feed_id = ? AND id = ?`, feedID, episodeID).Scan(&data); err != nil {
+			if err == sql.ErrNoRows {
+				return model.ErrNotFound
+			}
+			return err
+		}
+
+		episode := &model.Episode{}
+		if err := json.Unmarshal(data, episode); err != nil {
+			return err
+		}
+
+		if err := cb(episode); err != nil {
+			return err
+		}
+
+		if episode.ID != episodeID {
+			return errors.New("can't change episode ID")
+		}
+
+		return s.putEpisode(ctx, tx, feedID, episode, true)
+	})
+}
+
+func (s *SQLite) DeleteEpisode(feedID, episodeID string) error {
+	_, err := s.db.Exec(`DELETE FROM episodes WHERE feed_id = ? AND id = ?`, feedID, episodeID)
+	return err
+}
+
+func (s *SQLite) WalkEpisodes(ctx context.Context, feedID string, cb func(episode *model.Episode) error) error {
+	var episodes []*model.Episode
+	if err := s.query(ctx, func(rows *sql.Rows) error {
+		episode := &model.Episode{}
+		if err := scanObj(rows, episode); err != nil {
+			return err
+		}
+		episodes = append(episodes, episode)
+		return nil
+	}, `SELECT data FROM episodes WHERE feed_id = ? ORDER BY id`, feedID); err != nil {
+		return err
+	}
+
+	for _, episode := range episodes {
+		if err := cb(episode); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (s *SQLite) CountEpisodes(ctx context.Context, status model.EpisodeStatus, since time.Time) (int, error) {
+	var count int
+	err := s.db.QueryRowContext(ctx, `SELECT COUNT(*) FROM episodes WHERE status = ? AND pub_date > ?`,
+		string(status), formatTime(since)).Scan(&count)
+	return count, err
+}
+
+func (s *SQLite) AddToken(ctx context.Context, token *model.Token) error {
+	data, err := json.Marshal(token)
+	if err != nil {
+		return errors.Wrap(err, "failed to serialize token")
+	}
+
+	_, err = s.db.ExecContext(ctx, `
+		INSERT INTO tokens (hash, id, name, data) VALUES (?, ?, ?, ?)
+		ON CONFLICT (hash) DO UPDATE SET id = excluded.id, name = excluded.name, data = excluded.data`,
+		token.Hash, token.ID, token.Name, data)
+	return err
+}
+
+func (s *SQLite) GetToken(ctx context.Context, hash string) (*model.Token, error) {
+	token := &model.Token{}
+	if err := s.getObj(ctx, token, `SELECT data FROM tokens WHERE hash = ?`, hash); err != nil {
+		return nil, err
+	}
+
+	return token, nil
+}
+
+func (s *SQLite) WalkTokens(ctx context.Context, cb func(token *model.Token) error) error {
+	var tokens []*model.Token
+	if err := s.query(ctx, func(rows *sql.Rows) error {
+		token := &model.Token{}
+		if err := scanObj(rows, token); err != nil {
+			return err
+		}
+		tokens = append(tokens, token)
+		return nil
+	}, `SELECT data FROM tokens ORDER BY hash`); err != nil {
+		return err
+	}
+
+	for _, token := range tokens {
+		if err := cb(token); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (s *SQLite) DeleteToken(ctx context.Context, hash string) error {
+	_, err := s.db.ExecContext(ctx, `DELETE FROM tokens WHERE hash = ?`, hash)
+	return err
+}
+
+func (s *SQLite) RecordAccess(ctx context.Context, access *model.Access) error {
+	file := access.File
+	if file == "" {
+		file = "-"
+	}
+
+	return s.tx(ctx, func(tx *sql.Tx) error {
+		record := *access
+
+		var data []byte
+		err := tx.QueryRowContext(ctx, `SELECT data FROM access WHERE feed_id = ? AND day = ? AND file = ? AND client = ?`,
+			access.FeedID, access.Day, file, access.Client).Scan(&data)
+		switch err {
+		case nil:
+			if err := json.Unmarshal(data, &record); err != nil {
+				return err
+			}
+			record.Requests += access.Requests
+			if access.LastSeen.After(record.LastSeen) {
+				record.LastSeen = access.LastSeen
+			}
+		case sql.ErrNoRows:
+			// First access of the day
+		default:
+			return err
+		}
+
+		data, err = json.Marshal(&record)
+		if err != nil {
+			return errors.Wrap(err, "failed to serialize access record")
+		}
+
+		_, err = tx.ExecContext(ctx, `
+			INSERT INTO access (feed_id, day, file, client, requests, last_seen, data) VALUES (?, ?, ?, ?, ?, ?, ?)
+			ON CONFLICT (feed_id, day, file, client) DO UPDATE SET
+				requests = excluded.requests,
+				last_seen = excluded.last_seen,
+				data = excluded.data`,
+			access.FeedID, access.Day, file, access.Client, record.Requests, nullTime(record.LastSeen), data)
+		return err
+	})
+}
+
+func (s *SQLite) WalkAccess(ctx context.Context, feedID string, cb func(access *model.Access) error) error {
+	var records []*model.Access
+	if err := s.query(ctx, func(rows *sql.Rows) error {
+		access := &model.Access{}
+		if err := scanObj(rows, access); err != nil {
+			return err
+		}
+		records = append(records, access)
+		return nil
+	}, `SELECT data FROM access WHERE feed_id = ? OR ? = '' ORDER BY feed_id, day, file, client`, feedID, feedID); err != nil {
+		return err
+	}
+
+	for _, access := range records {
+		if err := cb(access); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (s *SQLite) DeleteAccess(ctx context.Context, feedID string, file string) error {
+	if file == "" {
+		_, err := s.db.ExecContext(ctx, `DELETE FROM access WHERE feed_id = ?`, feedID)
+		return err
+	}
+
+	_, err := s.db.ExecContext(ctx, `DELETE FROM access WHERE feed_id = ? AND file = ?`, feedID, file)
+	return err
+}
+
+func (s *SQLite) backup(path string) error {
+	_, err := s.db.Exec(`VACUUM INTO ?`, path)
+	return err
+}
+
+func (s *SQLite) migrate(m Migration) error {
+	ctx := context.Background()
+	return s.tx(ctx, func(tx *sql.Tx) error {
+		for _, stmt := range m.SQLite {
+			if _, err := tx.ExecContext(ctx, stmt); err != nil {
+				return errors.Wrapf(err, "failed to execute %q", stmt)
+			}
+		}
+
+		if m.Feed != nil {
+			if err := rewriteRows(ctx, tx, `SELECT id, '', data FROM feeds`, func(feedID, _ string, obj Object) error {
+				if err := m.Feed(feedID, obj); err != nil {
+					return err
+				}
+
+				data, feed, err := remarshal(obj, &model.Feed{})
+				if err != nil {
+					return err
+				}
+
+				_, err = tx.ExecContext(ctx, `UPDATE feeds SET title = ?, provider = ?, item_url = ?, updated_at = ?, removed_at = ?, data = ? WHERE id = ?`,
+					feed.Title, string(feed.Provider), feed.ItemURL, nullTime(feed.UpdatedAt), nullTime(feed.RemovedAt), data, feedID)
+				return err
+			}); err != nil {
+				return errors.Wrap(err, "failed to migrate feeds")
+			}
+		}
+
+		if m.Episode != nil {
+			if err := rewriteRows(ctx, tx, `SELECT feed_id, id, data FROM episodes`, func(feedID, episodeID string, obj Object) error {
+				if err := m.Episode(feedID, obj); err != nil {
+					return err
+				}
+
+				data, episode, err := remarshal(obj, &model.Episode{})
+				if err != nil {
+					return err
+				}
+
+				_, err = tx.ExecContext(ctx, `UPDATE episodes SET title = ?, status = ?, pub_date = ?, size = ?, pinned = ?, data = ? WHERE feed_id = ? AND id = ?`,
+					episode.Title, string(episode.Status), nullTime(episode.PubDate), episode.Size, episode.Pinned, data, feedID, episodeID)
+				return err
+			}); err != nil {
+				return errors.Wrap(err, "failed to migrate episodes")
+			}
+		}
+
+		return setSQLiteVersion(tx, m.Version)
+	})
+}
+
+func (s *SQLite) putEpisode(ctx context.Context, tx *sql.Tx, feedID string, episode *model.Episode, overwrite bool) error {
+	data, err := json.Marshal(episode)
+	if err != nil {
+		return errors.Wrapf(err, "failed to serialize episode %q", episode.ID)
+	}
+
+	conflict := `DO NOTHING`
+	if overwrite {
+		conflict = `DO UPDATE SET
+			title = excluded.title,
+			status = excluded.status,
+			pub_date = excluded.pub_date,
+			size = excluded.size,
+			pinned = excluded.pinned,
+			data = excluded.data`
+	}
+
+	_, err = tx.ExecContext(ctx, fmt.Sprintf(`
+		INSERT INTO episodes (feed_id, id, title, status, pub_date, size, pinned, data) VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT (feed_id, id) %s`, conflict),
+		feedID, episode.ID, episode.Title, string(episode.Status), nullTime(episode.PubDate), episode.Size, episode.Pinned, data)
+	return err
+}
+
+// Walk callbacks are invoked after rows are closed, so they are free to query and update the database
+func (s *SQLite) query(ctx context.Context, scan func(rows *sql.Rows) error, query string, args ...interface{}) error {
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		if err := scan(rows); err != nil {
+			return err
+		}
+	}
+
+	return rows.Err()
+}
+
+func (s *SQLite) getObj(ctx context.Context, out interface{}, query string, args ...interface{}) error {
+	var data []byte
+	if err := s.db.QueryRowContext(ctx, query, args...).Scan(&data); err != nil {
+		if err == sql.ErrNoRows {
+			return model.ErrNotFound
+		}
+		return err
+	}
+
+	return json.Unmarshal(data, out)
+}
+
+func (s *SQLite) tx(ctx context.Context, cb func(tx *sql.Tx) error) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+
+	if err := cb(tx); err != nil {
+		_ = tx.Rollback()
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func setSQLiteVersion(tx *sql.Tx, version int) error {
+	if _, err := tx.Exec(`INSERT OR REPLACE INTO meta (key, value) VALUES ('version', ?)`, strconv.Itoa(version)); err != nil {
+		return errors.Wrap(err, "failed to write database version")
+	}
+	return nil
+}
+
+// rewriteRows reads (key, key, data) rows first, so cb is free to update them
+func rewriteRows(ctx context.Context, tx *sql.Tx, query string, cb func(key1, key2 string, obj Object) error) error {
+	type row struct {
+		key1, key2 string
+		obj        Object
+	}
+
+	rows, err := tx.QueryContext(ctx, query)
+	if err != nil {
+		return err
+	}
+
+	var list []row
+	for rows.Next() {
+		var (
+			r    row
+			data []byte
+		)
+		if err := rows.Scan(&r.key1, &r.key2, &data); err != nil {
+			_ = rows.Close()
+			return err
+		}
+		if err := json.Unmarshal(data, &r.obj); err != nil {
+			_ = rows.Close()
+			return err
+		}
+		list = append(list, r)
+	}
+	if err := rows.Close(); err != nil {
+		return err
+	}
+
+	for _, r := range list {
+		if err := cb(r.key1, r.key2, r.obj); err != nil {
+			return errors.Wrapf(err, "failed to migrate %q", path.Join(r.key1, r.key2))
+		}
+	}
+
+	return nil
+}
+
+// remarshal encodes a migrated object and decodes it into out to fill indexed columns
+func remarshal[T any](obj Object, out *T) ([]byte, *T, error) {
+	data, err := json.Marshal(obj)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if err := json.Unmarshal(data, out); err != nil {
+		return nil, nil, err
+	}
+
+	return data, out, nil
+}
+
+func scanObj(rows *sql.Rows, out interface{}) error {
+	var data []byte
+	if err := rows.Scan(&data); err != nil {
+		return err
+	}
+
+	return json.Unmarshal(data, out)
+}
+
+// formatTime stores times as sortable UTC strings, so they can be compared in SQL
+func formatTime(t time.Time) string {
+	return t.UTC().Format("2006-01-02T15:04:05.000000000Z")
+}
+
+func nullTime(t time.Time) interface{} {
+	if t.IsZero() {
+		return nil
+	}
+	return formatTime(t)
+}
@@ -0,0 +1,331 @@
+package db
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/mxpv/podsync/pkg/model"
+)
+
+func newTestSQLite(t *testing.T) *SQLite {
+	t.Helper()
+
+	db, err := NewSQLite(&Config{Dir: t.TempDir()})
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = db.Close() })
+
+	return db
+}
+
+func TestOpen(t *testing.T) {
+	storage, err := Open(&Config{Type: TypeSQLite, Dir: t.TempDir()})
+	require.NoError(t, err)
+	assert.IsType(t, &SQLite{}, storage)
+	assert.NoError(t, storage.Close())
+
+	storage, err = Open(&Config{Dir: t.TempDir()})
+	require.NoError(t, err)
+	assert.IsType(t, &Badger{}, storage)
+	assert.NoError(t, storage.Close())
+
+	_, err = Open(&Config{Type: "postgres", Dir: t.TempDir()})
+	assert.Error(t, err)
+	assert.Error(t, (&Config{Type: "postgres"}).Validate())
+}
+
+func TestSQLite_Version(t *testing.T) {
+	db := newTestSQLite(t)
+
+	ver, err := db.Version()
+	assert.NoError(t, err)
+	assert.Equal(t, CurrentVersion, ver)
+}
+
+func TestSQLite_Feeds(t *testing.T) {
+	db := newTestSQLite(t)
+
+	feed := getFeed()
+	err := db.AddFeed(testCtx, feed.ID, feed)
+	require.NoError(t, err)
+
+	actual, err := db.GetFeed(testCtx, feed.ID)
+	require.NoError(t, err)
+	assert.Equal(t, feed, actual)
+
+	// Existing episodes are not overwritten, new ones are appended
+	feed.Title = "Updated"
+	feed.Episodes[0].Title = "Changed"
+	feed.Episodes = append(feed.Episodes, &model.Episode{ID: "3", Title: "Episode title 3"})
+	err = db.AddFeed(testCtx, feed.ID, feed)
+	require.NoError(t, err)
+
+	actual, err = db.GetFeed(testCtx, feed.ID)
+	require.NoError(t, err)
+	assert.Equal(t, "Updated", actual.Title)
+	require.Len(t, actual.Episodes, 3)
+	assert.Equal(t, "Episode title 1", actual.Episodes[0].Title)
+
+	_, err = db.GetFeed(testCtx, "unknown")
+	assert.ErrorIs(t, err, model.ErrNotFound)
+
+	err = db.AddFeed(testCtx, "configured", &model.Feed{Title: "No ID"})
+	require.NoError(t, err)
+
+	var ids []string
+	err = db.WalkFeeds(testCtx, func(feed *model.Feed) error {
+		ids = append(ids, feed.ID)
+		return nil
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"1", "configured"}, ids)
+
+	err = db.RecordAccess(testCtx, &model.Access{FeedID: feed.ID, Day: "2024-01-01", Client: "abc", Requests: 1})
+	require.NoError(t, err)
+
+	err = db.DeleteFeed(testCtx, feed.ID)
+	require.NoError(t, err)
+
+	_, err = db.GetFeed(testCtx, feed.ID)
+	assert.ErrorIs(t, err, model.ErrNotFound)
+
+	_, err = db.GetEpisode(testCtx, feed.ID, "1")
+	assert.ErrorIs(t, err, model.ErrNotFound)
+
+	err = db.WalkAccess(testCtx, feed.ID, func(*model.Access) error {
+		assert.Fail(t, "unexpected access record")
+		return nil
+	})
+	assert.NoError(t, err)
+}
+
+func TestSQLite_Episodes(t *testing.T) {
+	db := newTestSQLite(t)
+
+	feed := getFeed()
+	err := db.AddFeed(testCtx, feed.ID, feed)
+	require.NoError(t, err)
+
+	// Callbacks are allowed to write to the database
+	err = db.WalkEpisodes(testCtx, feed.ID, func(episode *model.Episode) error {
+		return db.UpdateEpisode(feed.ID, episode.ID, func(episode *model.Episode) error {
+			episode.Size = 333
+			episode.Status = model.EpisodeDownloaded
+			return nil
+		})
+	})
+	require.NoError(t, err)
+
+	episode, err := db.GetEpisode(testCtx, feed.ID, "2")
+	require.NoError(t, err)
+	assert.EqualValues(t, 333, episode.Size)
+	assert.Equal(t, model.EpisodeDownloaded, episode.Status)
+
+	err = db.UpdateEpisode(feed.ID, "2", func(episode *model.Episode) error {
+		episode.ID = "changed"
+		return nil
+	})
+	assert.Error(t, err)
+
+	err = db.UpdateEpisode(feed.ID, "unknown", func(*model.Episode) error { return nil })
+	assert.ErrorIs(t, err, model.ErrNotFound)
+
+	err = db.DeleteEpisode(feed.ID, "1")
+	require.NoError(t, err)
+
+	var ids []string
+	err = db.WalkEpisodes(testCtx, feed.ID, func(episode *model.Episode) error {
+		ids = append(ids, episode.ID)
+		return nil
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"2"}, ids)
+}
+
+func TestCountEpisodes(t *testing.T) {
+	badger, err := NewBadger(&Config{Dir: t.TempDir()})
+	require.NoError(t, err)
+	defer badger.Close()
+
+	for name, storage := range map[string]Storage{"badger": badger, "sqlite": newTestSQLite(t)} {
+		t.Run(name, func(t *testing.T) {
+			now := time.Now().UTC()
+
+			err := storage.AddFeed(testCtx, "1", &model.Feed{Episodes: []*model.Episode{
+				{ID: "1", Status: model.EpisodeError, PubDate: now.Add(-time.Hour)},
+				{ID: "2", Status: model.EpisodeError, PubDate: now.Add(-48 * time.Hour)},
+				{ID: "3", Status: model.EpisodeDownloaded, PubDate: now},
+			}})
+			require.NoError(t, err)
+
+			err = storage.AddFeed(testCtx, "2", &model.Feed{Episodes: []*model.Episode{
+				{ID: "1", Status: model.EpisodeError, PubDate: now},
+			}})
+			require.NoError(t, err)
+
+			count, err := storage.CountEpisodes(testCtx, model.EpisodeError, now.Add(-24*time.Hour))
+			assert.NoError(t, err)
+			assert.Equal(t, 2, count)
+
+			count, err = storage.CountEpisodes(testCtx, model.EpisodeNew, time.Time{})
+			assert.NoError(t, err)
+			assert.Equal(t, 0, count)
+		})
+	}
+}
+
+func TestSQLite_Tokens(t *testing.T) {
+	db := newTestSQLite(t)
+
+	token := &model.Token{ID: "1", Name: "alice", Hash: "abc", CreatedAt: time.Now().UTC()}
+	err := db.AddToken(testCtx, token)
+	require.NoError(t, err)
+
+	token.LastUsedAt = time.Now().UTC()
+	err = db.AddToken(testCtx, token)
+	require.NoError(t, err)
+
+	found, err := db.GetToken(testCtx, "abc")
+	require.NoError(t, err)
+	assert.Equal(t, token, found)
+
+	count := 0
+	err = db.WalkTokens(testCtx, func(*model.Token) error {
+		count++
+		return nil
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, 1, count)
+
+	err = db.DeleteToken(testCtx, "abc")
+	require.NoError(t, err)
+
+	_, err = db.GetToken(testCtx, "abc")
+	assert.ErrorIs(t, err, model.ErrNotFound)
+}
+
+func TestSQLite_RecordAccess(t *testing.T) {
+	db := newTestSQLite(t)
+
+	now := time.Now().UTC()
+	access := model.Access{FeedID: "1", File: "1.mp3", Day: "2024-01-01", Client: "abc", Requests: 1, FirstSeen: now, LastSeen: now}
+
+	for i := 0; i < 3; i++ {
+		record := access
+		record.LastSeen = now.Add(time.Duration(i) * time.Minute)
+		err := db.RecordAccess(testCtx, &record)
+		require.NoError(t, err)
+	}
+
+	err := db.RecordAccess(testCtx, &model.Access{FeedID: "1", Day: "2024-01-01", Client: "abc", Requests: 1})
+	require.NoError(t, err)
+
+	var list []*model.Access
+	err = db.WalkAccess(testCtx, "1", func(access *model.Access) error {
+		list = append(list, access)
+		return nil
+	})
+	require.NoError(t, err)
+	require.Len(t, list, 2)
+
+	for _, item := range list {
+		if item.File == "1.mp3" {
+			assert.Equal(t, 3, item.Requests)
+			assert.Equal(t, now.Add(2*time.Minute), item.LastSeen)
+		} else {
+			assert.Equal(t, 1, item.Requests)
+		}
+	}
+}
+
+func TestSQLite_DeleteAccess(t *testing.T) {
+	db := newTestSQLite(t)
+
+	for _, access := range []*model.Access{
+		{FeedID: "1", File: "1.mp3", Day: "2024-01-01", Client: "abc", Requests: 1},
+		{FeedID: "1", File: "2.mp3", Day: "2024-01-01", Client: "abc", Requests: 1},
+		{FeedID: "1", Day: "2024-01-01", Client: "abc", Requests: 1},
+		{FeedID: "1-video", File: "1.mp4", Day: "2024-01-01", Client: "abc", Requests: 1},
+	} {
+		require.NoError(t, db.RecordAccess(testCtx, access))
+	}
+
+	files := func(feedID string) []string {
+		var list []string
+		err := db.WalkAccess(testCtx, feedID, func(access *model.Access) error {
+			list = append(list, access.File)
+			return nil
+		})
+		require.NoError(t, err)
+		return list
+	}
+
+	// Records of a single file
+	require.NoError(t, db.DeleteAccess(testCtx, "1", "1.mp3"))
+	assert.ElementsMatch(t, []string{"", "2.mp3"}, files("1"))
+
+	// All records of a feed, records of other feeds are kept
+	require.NoError(t, db.DeleteAccess(testCtx, "1", ""))
+	assert.Empty(t, files("1"))
+	assert.Equal(t, []string{"1.mp4"}, files("1-video"))
+}
+
+func TestSQLite_ReadOnly(t *testing.T) {
+	dir := t.TempDir()
+
+	db, err := NewSQLite(&Config{Dir: dir})
+	require.NoError(t, err)
+	defer db.Close()
+
+	feed := getFeed()
+	require.NoError(t, db.AddFeed(testCtx, feed.ID, feed))
+
+	// Read-only processes can open the database while the server has it open
+	reader, err := NewSQLite(&Config{Dir: dir, ReadOnly: true})
+	require.NoError(t, err)
+	defer reader.Close()
+
+	actual, err := reader.GetFeed(testCtx, feed.ID)
+	require.NoError(t, err)
+	assert.Len(t, actual.Episodes, 2)
+
+	assert.Error(t, reader.AddFeed(testCtx, "2", &model.Feed{}))
+}
+
+func TestCopy(t *testing.T) {
+	source, err := NewBadger(&Config{Dir: t.TempDir()})
+	require.NoError(t, err)
+	defer source.Close()
+
+	feed := getFeed()
+	require.NoError(t, source.AddFeed(testCtx, feed.ID, feed))
+	require.NoError(t, source.AddToken(testCtx, &model.Token{ID: "1", Name: "alice", Hash: "abc"}))
+	require.NoError(t, source.RecordAccess(testCtx, &model.Access{FeedID: feed.ID, Day: "2024-01-01", Client: "abc", Requests: 5}))
+	require.NoError(t, source.RecordAccess(testCtx, &model.Access{FeedID: feed.ID + "-video", File: "1.mp4", Day: "2024-01-01", Client: "abc", Requests: 3}))
+
+	target := newTestSQLite(t)
+
+	stats, err := Copy(testCtx, source, target)
+	require.NoError(t, err)
+	assert.Equal(t, &DumpStats{Feeds: 1, Episodes: 2, Tokens: 1, Access: 2}, stats)
+
+	actual, err := target.GetFeed(testCtx, feed.ID)
+	require.NoError(t, err)
+	assert.Equal(t, feed, actual)
+
+	token, err := target.GetToken(testCtx, "abc")
+	require.NoError(t, err)
+	assert.Equal(t, "alice", token.Name)
+
+	requests := map[string]int{}
+	err = target.WalkAccess(testCtx, "", func(access *model.Access) error {
+		requests[access.FeedID+"/"+access.File] = access.Requests
+		return nil
+	})
+	assert.NoError(t, err)
+
+	// Stats of renditions are copied, although renditions aren't stored as feeds
+	assert.Equal(t, map[string]int{feed.ID + "/": 5, feed.ID + "-video/1.mp4": 3}, requests)
+}
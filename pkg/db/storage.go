@@ -2,6 +2,7 @@ package db
 
 import (
 	"context"
+	"time"
 
 	"github.com/mxpv/podsync/pkg/model"
 )
@@ -24,7 +25,7 @@ type Storage interface {
 	// GetFeed gets a feed by ID
 	GetFeed(ctx context.Context, feedID string) (*model.Feed, error)
 
-	// WalkFeeds iterates over feeds saved to database
+	// WalkFeeds iterates over feeds saved to database, feed IDs are set to the IDs feeds are saved under
 	WalkFeeds(ctx context.Context, cb func(feed *model.Feed) error) error
 
 	// DeleteFeed deletes feed and all related data from database
@@ -41,4 +42,28 @@ type Storage interface {
 
 	// WalkEpisodes iterates over episodes that belong to the given feed ID
 	WalkEpisodes(ctx context.Context, feedID string, cb func(episode *model.Episode) error) error
+
+	// CountEpisodes counts episodes of all feeds with the given status published after since
+	CountEpisodes(ctx context.Context, status model.EpisodeStatus, since time.Time) (int, error)
+
+	// AddToken inserts or updates an access token (tokens are keyed by secret hash)
+	AddToken(ctx context.Context, token *model.Token) error
+
+	// GetToken gets an access token by secret hash
+	GetToken(ctx context.Context, hash string) (*model.Token, error)
+
+	// WalkTokens iterates over access tokens
+	WalkTokens(ctx context.Context, cb func(token *model.Token) error) error
+
+	// DeleteToken deletes an access token by secret hash
+	DeleteToken(ctx context.Context, hash string) error
+
+	// RecordAccess merges an access record with the existing record of the same client, file and day
+	RecordAccess(ctx context.Context, access *model.Access) error
+
+	// WalkAccess iterates over access records of the given feed ID, or of all feeds if feedID is empty
+	WalkAccess(ctx context.Context, feedID string, cb func(access *model.Access) error) error
+
+	// DeleteAccess deletes access records of the given feed ID, only those of the file unless file is empty
+	DeleteAccess(ctx context.Context, feedID string, file string) error
 }
@@ -0,0 +1,116 @@
+package events
+
+import (
+	"net/url"
+	"time"
+
+	"github.com/hashicorp/go-multierror"
+	"github.com/pkg/errors"
+)
+
+const (
+	// DefaultWebhookRetries is the number of retries after a failed webhook delivery
+	DefaultWebhookRetries = 3
+	// DefaultWebhookTimeout limits a single webhook request
+	DefaultWebhookTimeout = 10 * time.Second
+	// DefaultDeadLetter is a file name of the dead letter log next to the config file
+	DefaultDeadLetter = "dead_letter.jsonl"
+)
+
+// Config configures event sinks
+type Config struct {
+	// DeadLetter is a file events that couldn't be delivered are appended to (as JSON lines)
+	DeadLetter string `toml:"dead_letter"`
+	// Webhooks POST events as JSON to HTTP endpoints
+	Webhooks []*WebhookConfig `toml:"webhooks"`
+}
+
+// WebhookConfig configures a webhook sink
+type WebhookConfig struct {
+	// URL to POST events to
+	URL string `toml:"url"`
+	// Events is a list of event types to send, all events are sent when empty
+	Events []Type `toml:"events"`
+	// Feeds is a list of feed IDs to send events of, all feeds when empty
+	Feeds []string `toml:"feeds"`
+	// Headers are added to each request (e.g. Authorization)
+	Headers map[string]string `toml:"headers"`
+	// Secret signs request bodies with HMAC-SHA256, the signature is sent in the X-Podsync-Signature header
+	Secret string `toml:"secret"`
+	// Retries is the number of retries with exponential backoff after a failed delivery (default 3, 0 disables retries)
+	Retries *int `toml:"retries"`
+	// Timeout of a single request (default 10s)
+	Timeout time.Duration `toml:"timeout"`
+}
+
+// RetryCount returns the configured number of retries or the default one
+func (c *WebhookConfig) RetryCount() int {
+	if c.Retries == nil {
+		return DefaultWebhookRetries
+	}
+	return *c.Retries
+}
+
+// Accepts returns true if the webhook is subscribed to the event
+func (c *WebhookConfig) Accepts(event *Event) bool {
+	return contains(c.Events, event.Type) && contains(c.Feeds, event.FeedID)
+}
+
+// contains returns true if list is empty or contains value
+func contains[T comparable](list []T, value T) bool {
+	if len(list) == 0 {
+		return true
+	}
+	for _, item := range list {
+		if item == value {
+			return true
+		}
+	}
+	return false
+}
+
+// Validate checks event sinks configuration
+func (c *Config) Validate() error {
+	var result *multierror.Error
+
+	for i, webhook := range c.Webhooks {
+		if err := webhook.Validate(); err != nil {
+			result = multierror.Append(result, errors.Wrapf(err, "webhook #%d", i+1))
+		}
+	}
+
+	return result.ErrorOrNil()
+}
+
+// Validate checks the webhook URL, event types and limits
+func (c *WebhookConfig) Validate() error {
+	parsed, err := url.Parse(c.URL)
+	if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+		return errors.Errorf("invalid url %q", c.URL)
+	}
+
+	for _, name := range c.Events {
+		if !isKnown(name) {
+			return errors.Errorf("unknown event %q", name)
+		}
+	}
+
+	if c.Retries != nil && *c.Retries < 0 {
+		return errors.New("retries can't be negative")
+	}
+
+	if c.Timeout < 0 {
+		return errors.New("timeout can't be negative")
+	}
+
+	return nil
+}
+
+func isKnown(name Type) bool {
+	for _, known := range Types {
+		if name == known {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,186 @@
+package events
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/mxpv/podsync/pkg/model"
+)
+
+// Type is a kind of episode or feed lifecycle event
+type Type string
+
+const (
+	// FeedUpdated is emitted after a feed was successfully updated
+	FeedUpdated = Type("feed_updated")
+	// FeedUpdateFailed is emitted when a feed update fails
+	FeedUpdateFailed = Type("feed_update_failed")
+	// EpisodeDiscovered is emitted for episodes seen for the first time
+	EpisodeDiscovered = Type("episode_discovered")
+	// DownloadStarted is emitted before an episode is downloaded
+	DownloadStarted = Type("download_started")
+	// DownloadSucceeded is emitted after an episode was downloaded and saved to storage
+	DownloadSucceeded = Type("download_succeeded")
+	// DownloadFailed is emitted when an episode couldn't be downloaded or processed
+	DownloadFailed = Type("download_failed")
+	// EpisodeCleaned is emitted after episode files were removed by cleanup, disk quota, filters or manually
+	EpisodeCleaned = Type("episode_cleaned")
+)
+
+// Types lists all event types
+var Types = []Type{
+	FeedUpdated,
+	FeedUpdateFailed,
+	EpisodeDiscovered,
+	DownloadStarted,
+	DownloadSucceeded,
+	DownloadFailed,
+	EpisodeCleaned,
+}
+
+// queueSize is the number of events a slow handler can lag behind before events are dropped
+const queueSize = 1024
+
+// Event describes something that happened to a feed or an episode
+type Event struct {
+	// ID is a unique identifier of the event, receivers can use it to discard duplicate deliveries
+	ID     string    `json:"id"`
+	Type   Type      `json:"type"`
+	Time   time.Time `json:"time"`
+	FeedID string    `json:"feed_id"`
+	// Episode is set for episode events
+	Episode *model.Episode `json:"episode,omitempty"`
+	// File is a storage path of the downloaded episode
+	File string `json:"file,omitempty"`
+	// Error is set for failure events
+	Error string `json:"error,omitempty"`
+}
+
+// Handler receives events published to a bus
+type Handler interface {
+	Handle(ctx context.Context, event *Event) error
+}
+
+// HandlerFunc adapts a function to the Handler interface
+type HandlerFunc func(ctx context.Context, event *Event) error
+
+func (f HandlerFunc) Handle(ctx context.Context, event *Event) error {
+	return f(ctx, event)
+}
+
+// Bus delivers events to subscribed handlers.
+// Each handler has its own queue and goroutine, so slow handlers (e.g. webhooks being retried)
+// never block feed updates. A nil bus discards events.
+type Bus struct {
+	lock   sync.RWMutex
+	queues []chan *Event
+	closed bool
+	group  sync.WaitGroup
+	ctx    context.Context
+	cancel context.CancelFunc
+}
+
+func NewBus() *Bus {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &Bus{ctx: ctx, cancel: cancel}
+}
+
+// Subscribe starts delivering events published from now on to the handler
+func (b *Bus) Subscribe(handler Handler) {
+	queue := make(chan *Event, queueSize)
+
+	b.lock.Lock()
+	b.queues = append(b.queues, queue)
+	b.lock.Unlock()
+
+	b.group.Add(1)
+	go func() {
+		defer b.group.Done()
+		for event := range queue {
+			if err := handler.Handle(b.ctx, event); err != nil {
+				log.WithError(err).WithField("event", event.Type).Error("failed to handle event")
+			}
+		}
+	}()
+}
+
+// Publish queues the event for delivery, filling in its ID and time.
+// Events are dropped when a handler's queue is full.
+func (b *Bus) Publish(event Event) {
+	if b == nil {
+		return
+	}
+
+	if event.ID == "" {
+		event.ID = newID()
+	}
+	if event.Time.IsZero() {
+		event.Time = time.Now().UTC()
+	}
+	if event.Episode != nil {
+		// Handlers run concurrently with the publisher, which may keep changing the episode
+		episode := *event.Episode
+		event.Episode = &episode
+	}
+
+	b.lock.RLock()
+	defer b.lock.RUnlock()
+
+	if b.closed {
+		return
+	}
+
+	for _, queue := range b.queues {
+		select {
+		case queue <- &event:
+		default:
+			log.WithField("event", event.Type).Warn("event queue is full, dropping event")
+		}
+	}
+}
+
+// Close stops accepting events and waits for handlers to process queued events.
+// When ctx is done first, handlers are canceled.
+func (b *Bus) Close(ctx context.Context) {
+	if b == nil {
+		return
+	}
+
+	b.lock.Lock()
+	if b.closed {
+		b.lock.Unlock()
+		return
+	}
+	b.closed = true
+	for _, queue := range b.queues {
+		close(queue)
+	}
+	b.lock.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		b.group.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-ctx.Done():
+		log.Warn("canceling delivery of pending events")
+		b.cancel()
+		<-done
+	}
+
+	b.cancel()
+}
+
+func newID() string {
+	buf := make([]byte, 16)
+	_, _ = rand.Read(buf)
+	return hex.EncodeToString(buf)
+}
@@ -0,0 +1,81 @@
+package events
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/mxpv/podsync/pkg/model"
+)
+
+func TestBus(t *testing.T) {
+	var (
+		bus      = NewBus()
+		lock     sync.Mutex
+		received []*Event
+	)
+
+	bus.Subscribe(HandlerFunc(func(_ context.Context, event *Event) error {
+		lock.Lock()
+		defer lock.Unlock()
+		received = append(received, event)
+		return nil
+	}))
+
+	episode := &model.Episode{ID: "1", Title: "One"}
+	bus.Publish(Event{Type: DownloadStarted, FeedID: "a", Episode: episode})
+	bus.Publish(Event{Type: DownloadFailed, FeedID: "a", Error: "failed"})
+
+	// Events are copied, changes after publishing don't leak to handlers
+	episode.Title = "Changed"
+
+	bus.Close(context.Background())
+
+	// Events published after close are discarded
+	bus.Publish(Event{Type: FeedUpdated})
+
+	require.Len(t, received, 2)
+	assert.Equal(t, DownloadStarted, received[0].Type)
+	assert.Equal(t, "One", received[0].Episode.Title)
+	assert.NotEmpty(t, received[0].ID)
+	assert.NotEqual(t, received[0].ID, received[1].ID)
+	assert.False(t, received[0].Time.IsZero())
+	assert.Equal(t, "failed", received[1].Error)
+}
+
+func TestBusCloseCancelsHandlers(t *testing.T) {
+	bus := NewBus()
+	bus.Subscribe(HandlerFunc(func(ctx context.Context, _ *Event) error {
+		<-ctx.Done()
+		return ctx.Err()
+	}))
+
+	bus.Publish(Event{Type: FeedUpdated})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	bus.Close(ctx)
+}
+
+func TestNilBus(t *testing.T) {
+	var bus *Bus
+	bus.Publish(Event{Type: FeedUpdated})
+	bus.Close(context.Background())
+}
+
+func TestConfigValidate(t *testing.T) {
+	valid := &WebhookConfig{URL: "https://example.com/hook", Events: []Type{DownloadFailed}}
+	assert.NoError(t, valid.Validate())
+
+	assert.Error(t, (&WebhookConfig{URL: "example.com"}).Validate())
+	assert.Error(t, (&WebhookConfig{URL: "https://example.com", Events: []Type{"unknown"}}).Validate())
+	negative := -1
+	assert.Error(t, (&WebhookConfig{URL: "https://example.com", Retries: &negative}).Validate())
+
+	config := Config{Webhooks: []*WebhookConfig{valid, {URL: "ftp://example.com"}}}
+	assert.ErrorContains(t, config.Validate(), "webhook #2")
+}
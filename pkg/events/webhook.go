@@ -0,0 +1,197 @@
+package events
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	// SignatureHeader carries "sha256=<hex HMAC of the body>" when a webhook secret is set
+	SignatureHeader = "X-Podsync-Signature"
+	// EventHeader carries the event type
+	EventHeader = "X-Podsync-Event"
+	// DeliveryHeader carries the event ID, it's the same for all retries of a delivery
+	DeliveryHeader = "X-Podsync-Delivery"
+)
+
+// Webhook POSTs events as JSON to an HTTP endpoint
+type Webhook struct {
+	config     *WebhookConfig
+	client     *http.Client
+	deadLetter *DeadLetter
+	// backoff is the delay before the first retry, doubled for each next retry
+	backoff time.Duration
+}
+
+func NewWebhook(config *WebhookConfig, deadLetter *DeadLetter) *Webhook {
+	timeout := config.Timeout
+	if timeout == 0 {
+		timeout = DefaultWebhookTimeout
+	}
+
+	return &Webhook{
+		config:     config,
+		client:     &http.Client{Timeout: timeout},
+		deadLetter: deadLetter,
+		backoff:    time.Second,
+	}
+}
+
+// Handle delivers the event, retrying failed requests.
+// Events that couldn't be delivered are written to the dead letter log, the returned error is logged by the bus.
+func (w *Webhook) Handle(ctx context.Context, event *Event) error {
+	if !w.config.Accepts(event) {
+		return nil
+	}
+
+	body, err := json.Marshal(event)
+	if err != nil {
+		return errors.Wrap(err, "failed to serialize event")
+	}
+
+	var (
+		retries  = w.config.RetryCount()
+		attempts = 0
+		delay    = w.backoff
+	)
+
+	for {
+		attempts++
+
+		retry, err := w.send(ctx, event, body)
+		if err == nil {
+			return nil
+		}
+
+		if !retry || attempts > retries {
+			return w.failed(event, attempts, err)
+		}
+
+		log.WithError(err).WithField("url", w.config.URL).Debugf("webhook delivery failed, retrying in %s", delay)
+
+		select {
+		case <-time.After(delay):
+			delay *= 2
+		case <-ctx.Done():
+			return w.failed(event, attempts, err)
+		}
+	}
+}
+
+// send makes a single delivery attempt, returns whether a failed request is worth retrying
+func (w *Webhook) send(ctx context.Context, event *Event, body []byte) (bool, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, w.config.URL, bytes.NewReader(body))
+	if err != nil {
+		return false, err
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "Podsync")
+	req.Header.Set(EventHeader, string(event.Type))
+	req.Header.Set(DeliveryHeader, event.ID)
+	for name, value := range w.config.Headers {
+		req.Header.Set(name, value)
+	}
+
+	if w.config.Secret != "" {
+		req.Header.Set(SignatureHeader, "sha256="+Sign(w.config.Secret, body))
+	}
+
+	resp, err := w.client.Do(req)
+	if err != nil {
+		return true, err
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 64*1024))
+
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return false, nil
+	}
+
+	// Client errors won't go away by themselves, except for timeouts and rate limits
+	retry := resp.StatusCode >= 500 || resp.StatusCode == http.StatusRequestTimeout || resp.StatusCode == http.StatusTooManyRequests
+	return retry, errors.Errorf("unexpected status %s", resp.Status)
+}
+
+func (w *Webhook) failed(event *Event, attempts int, err error) error {
+	w.deadLetter.Write(w.config.URL, event, attempts, err)
+	return errors.Wrapf(err, "failed to deliver event to %s after %d attempt(s)", w.config.URL, attempts)
+}
+
+// Sign returns hex encoded HMAC-SHA256 of the body, receivers compute the same to verify requests
+func Sign(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// DeadLetter appends events that couldn't be delivered to a JSON lines file, so they can be inspected or replayed.
+// A nil DeadLetter discards failed deliveries.
+type DeadLetter struct {
+	lock sync.Mutex
+	path string
+}
+
+type deadLetterRecord struct {
+	Time     time.Time `json:"time"`
+	Sink     string    `json:"sink"`
+	Attempts int       `json:"attempts"`
+	Error    string    `json:"error"`
+	Event    *Event    `json:"event"`
+}
+
+func NewDeadLetter(path string) *DeadLetter {
+	return &DeadLetter{path: path}
+}
+
+// Write records a failed delivery.
+// The delivery error itself is not logged here, it's returned by the sink and logged by the bus.
+func (d *DeadLetter) Write(sink string, event *Event, attempts int, deliveryErr error) {
+	if d == nil {
+		return
+	}
+
+	logger := log.WithFields(log.Fields{"sink": sink, "event": event.Type, "event_id": event.ID})
+
+	data, err := json.Marshal(deadLetterRecord{
+		Time:     time.Now().UTC(),
+		Sink:     sink,
+		Attempts: attempts,
+		Error:    deliveryErr.Error(),
+		Event:    event,
+	})
+	if err != nil {
+		logger.WithError(err).Error("failed to serialize dead letter")
+		return
+	}
+
+	d.lock.Lock()
+	defer d.lock.Unlock()
+
+	f, err := os.OpenFile(d.path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		logger.WithError(err).Error("failed to open dead letter log")
+		return
+	}
+	defer f.Close()
+
+	if _, err := fmt.Fprintf(f, "%s\n", data); err != nil {
+		logger.WithError(err).Error("failed to write dead letter log")
+		return
+	}
+
+	logger.Debugf("undelivered event saved to %s", d.path)
+}
@@ -0,0 +1,110 @@
+package events
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWebhook(t *testing.T) {
+	var calls int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, err := io.ReadAll(r.Body)
+		require.NoError(t, err)
+
+		assert.Equal(t, "application/json", r.Header.Get("Content-Type"))
+		assert.Equal(t, "Bearer 123", r.Header.Get("Authorization"))
+		assert.Equal(t, string(DownloadFailed), r.Header.Get(EventHeader))
+		assert.Equal(t, "id1", r.Header.Get(DeliveryHeader))
+		assert.Equal(t, "sha256="+Sign("secret", body), r.Header.Get(SignatureHeader))
+
+		var event Event
+		require.NoError(t, json.Unmarshal(body, &event))
+		assert.Equal(t, "a", event.FeedID)
+
+		// Fail the first attempt
+		if atomic.AddInt32(&calls, 1) == 1 {
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+	}))
+	defer server.Close()
+
+	webhook := NewWebhook(&WebhookConfig{
+		URL:     server.URL,
+		Headers: map[string]string{"Authorization": "Bearer 123"},
+		Secret:  "secret",
+		Events:  []Type{DownloadFailed},
+	}, nil)
+	webhook.backoff = 0
+
+	err := webhook.Handle(context.Background(), &Event{ID: "id1", Type: DownloadFailed, FeedID: "a"})
+	assert.NoError(t, err)
+	assert.EqualValues(t, 2, calls)
+
+	// Not subscribed
+	err = webhook.Handle(context.Background(), &Event{ID: "id2", Type: FeedUpdated, FeedID: "a"})
+	assert.NoError(t, err)
+	assert.EqualValues(t, 2, calls)
+}
+
+func TestWebhookDeadLetter(t *testing.T) {
+	var calls int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		if strings.HasSuffix(r.URL.Path, "/bad") {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+
+	path := filepath.Join(t.TempDir(), "dead_letter.jsonl")
+	deadLetter := NewDeadLetter(path)
+
+	// Server errors are retried
+	retries := 2
+	webhook := NewWebhook(&WebhookConfig{URL: server.URL + "/down", Retries: &retries}, deadLetter)
+	webhook.backoff = 0
+	err := webhook.Handle(context.Background(), &Event{ID: "1", Type: FeedUpdated, FeedID: "a"})
+	assert.Error(t, err)
+	assert.EqualValues(t, 3, calls)
+
+	// Client errors are not
+	webhook = NewWebhook(&WebhookConfig{URL: server.URL + "/bad"}, deadLetter)
+	webhook.backoff = 0
+	err = webhook.Handle(context.Background(), &Event{ID: "2", Type: FeedUpdated, FeedID: "a"})
+	assert.Error(t, err)
+	assert.EqualValues(t, 4, calls)
+
+	// Zero disables retries
+	retries = 0
+	webhook = NewWebhook(&WebhookConfig{URL: server.URL + "/down", Retries: &retries}, deadLetter)
+	webhook.backoff = 0
+	err = webhook.Handle(context.Background(), &Event{ID: "3", Type: FeedUpdated, FeedID: "a"})
+	assert.Error(t, err)
+	assert.EqualValues(t, 5, calls)
+
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+
+	lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+	require.Len(t, lines, 3)
+
+	var record deadLetterRecord
+	require.NoError(t, json.Unmarshal([]byte(lines[0]), &record))
+	assert.Equal(t, server.URL+"/down", record.Sink)
+	assert.Equal(t, 3, record.Attempts)
+	assert.Equal(t, "1", record.Event.ID)
+}
@@ -0,0 +1,69 @@
+package feed
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"strings"
+
+	"github.com/pkg/errors"
+
+	"github.com/mxpv/podsync/pkg/model"
+)
+
+// Apple Podcasts requires square artwork between 1400x1400 and 3000x3000 pixels
+const (
+	DefaultArtworkSize = 1400
+	MinArtworkSize     = 1400
+	MaxArtworkSize     = 3000
+)
+
+const artworkDir = "artwork"
+
+// ArtworkSize returns the side of self-hosted artwork in pixels.
+func (a Artwork) ArtworkSize() int {
+	if a.Size == 0 {
+		return DefaultArtworkSize
+	}
+
+	return a.Size
+}
+
+// ValidateArtwork checks artwork settings of a feed
+func ValidateArtwork(artwork Artwork) error {
+	if artwork.Size != 0 && (artwork.Size < MinArtworkSize || artwork.Size > MaxArtworkSize) {
+		return errors.Errorf("size must be between %d and %d (got %d)", MinArtworkSize, MaxArtworkSize, artwork.Size)
+	}
+
+	return nil
+}
+
+// EpisodeArtworkPath returns the storage path of a self-hosted episode thumbnail.
+func EpisodeArtworkPath(feedConfig *Config, episode *model.Episode) string {
+	name := sanitizeFilename(episode.ID)
+	if name == "" {
+		name = "episode"
+	}
+
+	return fmt.Sprintf("%s/%s/%s.jpg", feedConfig.ID, artworkDir, name)
+}
+
+// CoverArtworkPath returns the storage path of self-hosted feed cover art.
+// The path depends on the source URL, so changed artwork is picked up by podcast clients.
+func CoverArtworkPath(feedConfig *Config, source string) string {
+	sum := sha1.Sum([]byte(source))
+	return fmt.Sprintf("%s/%s/cover-%s.jpg", feedConfig.ID, artworkDir, hex.EncodeToString(sum[:])[:12])
+}
+
+// CoverArtSource returns the URL of the feed cover art, preferring the configured custom artwork.
+func CoverArtSource(feedConfig *Config, feed *model.Feed) string {
+	if feedConfig.Custom.CoverArt != "" {
+		return feedConfig.Custom.CoverArt
+	}
+
+	return feed.CoverArt
+}
+
+func artworkURL(hostname string, path string) string {
+	return fmt.Sprintf("%s/%s", strings.TrimRight(hostname, "/"), path)
+}
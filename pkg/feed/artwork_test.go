@@ -0,0 +1,29 @@
+package feed
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/mxpv/podsync/pkg/model"
+)
+
+func TestArtworkPaths(t *testing.T) {
+	cfg := &Config{ID: "news"}
+
+	assert.Equal(t, "news/artwork/abc-123.jpg", EpisodeArtworkPath(cfg, &model.Episode{ID: "abc-123"}))
+
+	cover := CoverArtworkPath(cfg, "https://example.com/a.png")
+	assert.Regexp(t, `^news/artwork/cover-[0-9a-f]{12}\.jpg$`, cover)
+	assert.NotEqual(t, cover, CoverArtworkPath(cfg, "https://example.com/b.png"))
+}
+
+func TestValidateArtwork(t *testing.T) {
+	assert.NoError(t, ValidateArtwork(Artwork{}))
+	assert.NoError(t, ValidateArtwork(Artwork{Size: 3000}))
+	assert.Error(t, ValidateArtwork(Artwork{Size: 600}))
+	assert.Error(t, ValidateArtwork(Artwork{Size: 4000}))
+
+	assert.Equal(t, DefaultArtworkSize, Artwork{}.ArtworkSize())
+	assert.Equal(t, 2000, Artwork{Size: 2000}.ArtworkSize())
+}
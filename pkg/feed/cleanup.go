@@ -0,0 +1,181 @@
+package feed
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/mxpv/podsync/pkg/model"
+)
+
+// Eviction orders for disk quota
+const (
+	EvictOldest        = "oldest"
+	EvictLeastListened = "least_listened"
+)
+
+var byteSizePattern = regexp.MustCompile(`^([0-9]+(?:\.[0-9]+)?)\s*([A-Za-z]*)$`)
+
+var byteSizeUnits = map[string]int64{
+	"":    1,
+	"b":   1,
+	"k":   1000,
+	"kb":  1000,
+	"m":   1000 * 1000,
+	"mb":  1000 * 1000,
+	"g":   1000 * 1000 * 1000,
+	"gb":  1000 * 1000 * 1000,
+	"t":   1000 * 1000 * 1000 * 1000,
+	"tb":  1000 * 1000 * 1000 * 1000,
+	"kib": 1 << 10,
+	"mib": 1 << 20,
+	"gib": 1 << 30,
+	"tib": 1 << 40,
+}
+
+// ByteSize is a size in bytes, which can be specified in TOML either as
+// a number of bytes or as a string with a unit suffix: "500MB", "20GB", "1.5TiB".
+type ByteSize int64
+
+func (b *ByteSize) UnmarshalTOML(v interface{}) error {
+	switch value := v.(type) {
+	case int64:
+		*b = ByteSize(value)
+		return nil
+	case string:
+		size, err := ParseByteSize(value)
+		if err != nil {
+			return err
+		}
+		*b = size
+		return nil
+	default:
+		return errors.Errorf("failed to decode size %v", v)
+	}
+}
+
+func (b ByteSize) String() string {
+	const unit = 1000
+	if b < unit {
+		return fmt.Sprintf("%dB", int64(b))
+	}
+
+	div, exp := int64(unit), 0
+	for n := int64(b) / unit; n >= unit; n /= unit {
+		div *= unit
+		exp++
+	}
+
+	return fmt.Sprintf("%.1f%cB", float64(b)/float64(div), "kMGT"[exp])
+}
+
+// ParseByteSize parses sizes like "20GB", "512 MiB" or "1000".
+// KB, MB, GB and TB are decimal units, KiB, MiB, GiB and TiB are binary ones.
+func ParseByteSize(value string) (ByteSize, error) {
+	match := byteSizePattern.FindStringSubmatch(strings.TrimSpace(value))
+	if match == nil {
+		return 0, errors.Errorf("invalid size %q", value)
+	}
+
+	multiplier, ok := byteSizeUnits[strings.ToLower(match[2])]
+	if !ok {
+		return 0, errors.Errorf("unknown size unit %q", match[2])
+	}
+
+	number, err := strconv.ParseFloat(match[1], 64)
+	if err != nil {
+		return 0, errors.Wrapf(err, "invalid size %q", value)
+	}
+
+	return ByteSize(number * float64(multiplier)), nil
+}
+
+// Enabled returns true if at least one retention rule is set.
+func (c *Cleanup) Enabled() bool {
+	return c.KeepLast > 0 || c.MaxAge > 0 || c.MaxSize > 0
+}
+
+// IsProtected returns true if the episode is too new to be removed.
+func (c *Cleanup) IsProtected(episode *model.Episode, now time.Time) bool {
+	return c.KeepNewerThan > 0 && episode.PubDate.After(now.AddDate(0, 0, -c.KeepNewerThan))
+}
+
+// SelectForCleanup returns episodes to remove according to the policy.
+// Episodes must be sorted by publication date in descending order (newest first),
+// pinned episodes must be excluded by the caller.
+// Once the episodes exceed max_size, the episode crossing it and all older ones are removed.
+func (c *Cleanup) SelectForCleanup(episodes []*model.Episode, now time.Time) []*model.Episode {
+	var (
+		result    []*model.Episode
+		totalSize int64
+		oversized bool
+		ageCutoff = now.AddDate(0, 0, -c.MaxAge)
+	)
+
+	for idx, episode := range episodes {
+		if c.IsProtected(episode, now) {
+			totalSize += EpisodeDiskSize(episode)
+			continue
+		}
+
+		remove := false
+		if c.KeepLast > 0 && idx >= c.KeepLast {
+			remove = true
+		}
+		if c.MaxAge > 0 && episode.PubDate.Before(ageCutoff) {
+			remove = true
+		}
+		if c.MaxSize > 0 && totalSize+EpisodeDiskSize(episode) > int64(c.MaxSize) {
+			// Older episodes that would still fit are not kept in place of newer ones
+			oversized = true
+		}
+		if oversized {
+			remove = true
+		}
+
+		if remove {
+			result = append(result, episode)
+			continue
+		}
+
+		totalSize += EpisodeDiskSize(episode)
+	}
+
+	return result
+}
+
+// EpisodeDiskSize returns the total size of the episode files, renditions included.
+func EpisodeDiskSize(episode *model.Episode) int64 {
+	size := episode.Size
+	for _, renditionSize := range episode.Renditions {
+		size += renditionSize
+	}
+	return size
+}
+
+// ValidateCleanup checks retention rules of a cleanup policy
+func ValidateCleanup(c *Cleanup) error {
+	if c.KeepLast < 0 || c.MaxAge < 0 || c.KeepNewerThan < 0 || c.MaxSize < 0 {
+		return errors.New("keep_last, max_age, max_size and keep_newer_than can't be negative")
+	}
+
+	return nil
+}
+
+// ValidateDiskQuota checks global disk quota settings
+func ValidateDiskQuota(q *DiskQuota) error {
+	if q.MaxSize <= 0 {
+		return errors.New("max_size is required")
+	}
+
+	switch q.Evict {
+	case "", EvictOldest, EvictLeastListened:
+		return nil
+	default:
+		return errors.Errorf("unsupported eviction order %q (must be %q or %q)", q.Evict, EvictOldest, EvictLeastListened)
+	}
+}
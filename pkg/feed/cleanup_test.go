@@ -0,0 +1,114 @@
+package feed
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/mxpv/podsync/pkg/model"
+)
+
+func TestParseByteSize(t *testing.T) {
+	tests := []struct {
+		value  string
+		expect ByteSize
+	}{
+		{"1000", 1000},
+		{"500MB", 500 * 1000 * 1000},
+		{"20 GB", 20 * 1000 * 1000 * 1000},
+		{"1.5gib", ByteSize(1.5 * (1 << 30))},
+		{"2T", 2 * 1000 * 1000 * 1000 * 1000},
+	}
+
+	for _, tst := range tests {
+		t.Run(tst.value, func(t *testing.T) {
+			size, err := ParseByteSize(tst.value)
+			require.NoError(t, err)
+			assert.Equal(t, tst.expect, size)
+		})
+	}
+
+	_, err := ParseByteSize("20 parsecs")
+	assert.Error(t, err)
+	_, err = ParseByteSize("GB")
+	assert.Error(t, err)
+
+	assert.Equal(t, "20.0GB", ByteSize(20*1000*1000*1000).String())
+	assert.Equal(t, "512B", ByteSize(512).String())
+}
+
+func TestSelectForCleanup(t *testing.T) {
+	now := time.Date(2024, 6, 30, 0, 0, 0, 0, time.UTC)
+
+	// Newest first, one episode per day
+	var episodes []*model.Episode
+	for i := 0; i < 10; i++ {
+		episodes = append(episodes, &model.Episode{
+			ID:      string(rune('a' + i)),
+			PubDate: now.AddDate(0, 0, -i),
+			Size:    100,
+		})
+	}
+
+	ids := func(list []*model.Episode) string {
+		var out string
+		for _, episode := range list {
+			out += episode.ID
+		}
+		return out
+	}
+
+	tests := []struct {
+		name   string
+		policy Cleanup
+		expect string
+	}{
+		{"keep last", Cleanup{KeepLast: 7}, "hij"},
+		{"max age", Cleanup{MaxAge: 5}, "ghij"},
+		{"max size", Cleanup{MaxSize: 450}, "efghij"},
+		{"combined", Cleanup{KeepLast: 8, MaxAge: 6}, "hij"},
+		{"keep newer than", Cleanup{KeepLast: 2, KeepNewerThan: 4}, "efghij"},
+		{"protected episodes count towards size", Cleanup{MaxSize: 250, KeepNewerThan: 3}, "defghij"},
+	}
+
+	for _, tst := range tests {
+		t.Run(tst.name, func(t *testing.T) {
+			assert.Equal(t, tst.expect, ids(tst.policy.SelectForCleanup(episodes, now)))
+		})
+	}
+}
+
+func TestSelectForCleanupLargeNewestEpisode(t *testing.T) {
+	now := time.Date(2024, 6, 30, 0, 0, 0, 0, time.UTC)
+	episodes := []*model.Episode{
+		{ID: "a", PubDate: now, Size: 100},
+		{ID: "b", PubDate: now.AddDate(0, 0, -1), Size: 1000},
+		{ID: "c", PubDate: now.AddDate(0, 0, -2), Size: 100},
+		{ID: "d", PubDate: now.AddDate(0, 0, -3), Size: 100},
+	}
+
+	// Smaller older episodes are not kept in place of the large one
+	removed := (&Cleanup{MaxSize: 500}).SelectForCleanup(episodes, now)
+	require.Len(t, removed, 3)
+	assert.Equal(t, "b", removed[0].ID)
+	assert.Equal(t, "c", removed[1].ID)
+	assert.Equal(t, "d", removed[2].ID)
+
+	// The newest episode alone exceeds max_size
+	removed = (&Cleanup{MaxSize: 500}).SelectForCleanup(episodes[1:], now)
+	assert.Len(t, removed, 3)
+}
+
+func TestEpisodeDiskSize(t *testing.T) {
+	episode := &model.Episode{Size: 100, Renditions: map[string]int64{"audio": 10, "480p": 50}}
+	assert.EqualValues(t, 160, EpisodeDiskSize(episode))
+}
+
+func TestValidateDiskQuota(t *testing.T) {
+	assert.NoError(t, ValidateDiskQuota(&DiskQuota{MaxSize: 1}))
+	assert.NoError(t, ValidateDiskQuota(&DiskQuota{MaxSize: 1, Evict: EvictLeastListened}))
+	assert.Error(t, ValidateDiskQuota(&DiskQuota{}))
+	assert.Error(t, ValidateDiskQuota(&DiskQuota{MaxSize: 1, Evict: "random"}))
+}
@@ -1,6 +1,8 @@
 package feed
 
 import (
+	"regexp"
+	"strings"
 	"time"
 
 	"github.com/mxpv/podsync/pkg/model"
@@ -11,6 +13,14 @@ type Config struct {
 	ID string `toml:"-"`
 	// URL is a full URL of the field
 	URL string `toml:"url"`
+	// Sources turn the feed into a merged feed combining episodes of several URLs (see Source).
+	// Episodes are de-duplicated by ID, the first source listing an episode wins.
+	// Example:
+	//   [[feeds.ID1.sources]]
+	//   url = "https://www.youtube.com/channel/..."
+	//   page_size = 10
+	//   filters = { not_title = "(?i)shorts" }
+	Sources []*Source `toml:"sources"`
 	// PageSize is the number of pages to query from YouTube API.
 	// NOTE: larger page sizes/often requests might drain your API token.
 	PageSize int `toml:"page_size"`
@@ -30,10 +40,29 @@ type Config struct {
 	Format model.Format `toml:"format"`
 	// Custom format properties
 	CustomFormat CustomFormat `toml:"custom_format"`
+	// TranscodeProfile is the name of a transcoding profile (see [transcode_profiles]) to apply after download
+	TranscodeProfileName string `toml:"transcode_profile"`
+	// TranscodeProfile is resolved from TranscodeProfileName when loading the configuration
+	TranscodeProfile *TranscodeProfile `toml:"-"`
+	// Renditions are additional versions of each episode produced from the same download.
+	// Each rendition is published as a separate feed "<ID>-<rendition name>".
+	// Example:
+	//   [[feeds.ID1.renditions]]
+	//   name = "audio"
+	//   transcode_profile = "commute"
+	Renditions []*Rendition `toml:"renditions"`
+	// Rendition is the name of the rendition this configuration was derived for (see RenditionConfig)
+	Rendition string `toml:"-"`
+	// Metadata configures tags and cover art written into downloaded media files
+	Metadata Metadata `toml:"metadata"`
+	// Artwork configures self-hosting of episode thumbnails and feed cover art
+	Artwork Artwork `toml:"artwork"`
 	// Only download episodes that match the filters (defaults to matching anything)
 	Filters Filters `toml:"filters"`
 	// Clean is a cleanup policy to use for this feed
 	Clean *Cleanup `toml:"clean"`
+	// Pin protects matching episodes from cleanup
+	Pin Pins `toml:"pin"`
 	// Custom is a list of feed customizations
 	Custom Custom `toml:"custom"`
 	// List of additional youtube-dl arguments passed at download time
@@ -46,13 +75,26 @@ type Config struct {
 	//   timeout = 10
 	PostEpisodeDownload []*ExecHook `toml:"post_episode_download"`
 	// Episode download error hooks - executed when an episode download fails
-	// Available environment variables: FEED_NAME, EPISODE_TITLE, ERROR_MESSAGE
+	// Environment variables are described in ExecHook, ERROR_MESSAGE holds the error
 	// Multiple hooks can be configured and will execute in sequence
 	// Example:
 	//   [[feeds.ID1.on_episode_download_error]]
 	//   command = ["curl", "-X", "POST", "-d", "Download failed: $ERROR_MESSAGE", "https://webhook.example.com/notify"]
 	//   timeout = 30
 	OnEpisodeDownloadError []*ExecHook `toml:"on_episode_download_error"`
+	// Pre episode download hooks - executed before an episode is downloaded.
+	// A hook exiting with a non-zero code vetoes the download, the episode is reconsidered on next update.
+	PreEpisodeDownload []*ExecHook `toml:"pre_episode_download"`
+	// Post feed update hooks - executed after the feed was successfully updated
+	PostFeedUpdate []*ExecHook `toml:"post_feed_update"`
+	// Feed update error hooks - executed when a feed update fails
+	OnFeedUpdateError []*ExecHook `toml:"on_feed_update_error"`
+	// Post episode cleanup hooks - executed for each file deleted by cleanup, disk quota or manual deletion
+	PostEpisodeCleanup []*ExecHook `toml:"post_episode_cleanup"`
+	// Process episode hooks - executed on the downloaded file before it's uploaded to storage.
+	// Hooks can modify the file at EPISODE_PATH in place or write a replacement (possibly with
+	// a different extension) to OUTPUT_DIR. A failing hook fails the download.
+	ProcessEpisode []*ExecHook `toml:"process_episode"`
 	// Included in OPML file
 	OPML bool `toml:"opml"`
 	// Private feed (not indexed by podcast aggregators)
@@ -69,6 +111,62 @@ type CustomFormat struct {
 	Extension       string `toml:"extension"`
 }
 
+// TranscodeProfile describes how to re-encode an episode with ffmpeg once it has been downloaded.
+type TranscodeProfile struct {
+	// AudioCodec to encode audio with: "aac", "opus", "mp3", "vorbis", "flac" or "copy"
+	AudioCodec string `toml:"audio_codec"`
+	// AudioBitrate is the target audio bitrate (e.g. "48k")
+	AudioBitrate string `toml:"audio_bitrate"`
+	// Channels is the number of output audio channels (1 - mono, 2 - stereo, 0 - keep source layout)
+	Channels int `toml:"channels"`
+	// Loudnorm enables EBU R128 loudness normalization
+	Loudnorm bool `toml:"loudnorm"`
+	// Speed is a playback speed-up factor (e.g. 1.25), 0 keeps the original speed
+	Speed float64 `toml:"speed"`
+	// VideoCodec to encode video with: "h264", "h265", "copy", or empty to drop the video track
+	VideoCodec string `toml:"video_codec"`
+	// VideoBitrate is the target video bitrate (e.g. "1M")
+	VideoBitrate string `toml:"video_bitrate"`
+	// MaxHeight is the maximum height of the output video
+	MaxHeight int `toml:"max_height"`
+	// Extension of the resulting file, derived from the codecs if empty
+	Extension string `toml:"extension"`
+}
+
+// Rendition is an extra version of a feed's episodes (e.g. 720p video or 64k audio).
+type Rendition struct {
+	// Name of the rendition, used as suffix of the rendition's feed ID
+	Name string `toml:"name"`
+	// TranscodeProfileName refers to one of [transcode_profiles]
+	TranscodeProfileName string `toml:"transcode_profile"`
+	// TranscodeProfile is resolved from TranscodeProfileName when loading the configuration
+	TranscodeProfile *TranscodeProfile `toml:"-"`
+}
+
+// Metadata controls ID3/MP4 tags written into episode files after download.
+// Tags are filled from the episode and feed info unless overridden here.
+type Metadata struct {
+	// Enabled turns on writing of tags
+	Enabled bool `toml:"enabled"`
+	// Artist overrides the artist tag (feed author by default)
+	Artist string `toml:"artist"`
+	// Album overrides the album tag (feed title by default)
+	Album string `toml:"album"`
+	// Genre tag ("Podcast" by default)
+	Genre string `toml:"genre"`
+	// Cover selects embedded artwork: "episode" (default, falls back to feed cover art), "feed" or "none"
+	Cover string `toml:"cover"`
+}
+
+// Artwork controls downloading of episode thumbnails and feed cover art into storage.
+// Self-hosted images are converted to square JPEGs and served from the podsync hostname.
+type Artwork struct {
+	// Enabled turns on self-hosting of artwork
+	Enabled bool `toml:"enabled"`
+	// Size of the square image side in pixels (1400 by default, 1400-3000 as required by podcast directories)
+	Size int `toml:"size"`
+}
+
 type Filters struct {
 	Title          string `toml:"title"`
 	NotTitle       string `toml:"not_title"`
@@ -78,7 +176,51 @@ type Filters struct {
 	MaxDuration    int64  `toml:"max_duration"`
 	MaxAge         int    `toml:"max_age"`
 	MinAge         int    `toml:"min_age"`
+	// Expr is an optional expression episodes have to match in addition to other filters (see Expr)
+	Expr string `toml:"expr"`
+	// ExcludeShorts skips YouTube Shorts
+	ExcludeShorts bool `toml:"exclude_shorts"`
+	// ExcludeLiveVODs skips recordings of live streams
+	ExcludeLiveVODs bool `toml:"exclude_live_vods"`
+	// OnlyMembers keeps members-only episodes only
+	OnlyMembers bool `toml:"only_members"`
+	// LiveVODDelay postpones downloads of live stream recordings until this much time passed since
+	// the stream ended, so YouTube can finish processing them
+	LiveVODDelay time.Duration `toml:"live_vod_delay"`
+	// ApplyToExisting re-evaluates filters against downloaded episodes on each update and removes
+	// the ones that no longer match
+	ApplyToExisting bool `toml:"apply_to_existing"`
 	// More filters to be added here
+
+	// compiled is Expr compiled during config validation
+	compiled *Expr
+}
+
+// Compile parses Expr once, so episodes are matched against the compiled expression
+func (f *Filters) Compile() error {
+	f.compiled = nil
+	if strings.TrimSpace(f.Expr) == "" {
+		return nil
+	}
+
+	expr, err := CompileExpr(f.Expr)
+	if err != nil {
+		return err
+	}
+
+	f.compiled = expr
+	return nil
+}
+
+// CompiledExpr returns the expression compiled by Compile, nil if there is no expression
+func (f *Filters) CompiledExpr() *Expr {
+	return f.compiled
+}
+
+// DetectShorts returns true if the filters need to know which videos are YouTube Shorts,
+// which takes an extra request per short video
+func (f *Filters) DetectShorts() bool {
+	return f.ExcludeShorts || (f.compiled != nil && f.compiled.Uses("is_short"))
 }
 
 type Custom struct {
@@ -96,7 +238,46 @@ type Custom struct {
 	Link            string        `toml:"link"`
 }
 
+// Cleanup is a retention policy for downloaded episodes.
+// Rules can be combined, an episode is removed if any of them matches.
 type Cleanup struct {
 	// KeepLast defines how many episodes to keep
 	KeepLast int `toml:"keep_last"`
+	// MaxAge removes episodes published more than the given number of days ago
+	MaxAge int `toml:"max_age"`
+	// MaxSize limits the total size of the feed's episodes (e.g. "20GB"), older episodes are removed first
+	MaxSize ByteSize `toml:"max_size"`
+	// KeepNewerThan protects episodes published within the given number of days from removal
+	KeepNewerThan int `toml:"keep_newer_than"`
+	// DryRun only reports episodes that would be removed
+	DryRun bool `toml:"dry_run"`
+}
+
+// Pins selects episodes to keep forever, in addition to episodes pinned via API or web UI.
+type Pins struct {
+	// IDs is a list of episode IDs
+	IDs []string `toml:"ids"`
+	// Titles is a list of regular expressions matched against episode titles
+	Titles []string `toml:"titles"`
+	// titles are compiled Titles patterns, set by ValidatePins
+	titles []*regexp.Regexp
+}
+
+// DiskQuota limits the total size of episodes across all feeds.
+// When exceeded, episodes are evicted until the total size fits the quota.
+type DiskQuota struct {
+	// MaxSize is the total size of all episodes (e.g. "100GB")
+	MaxSize ByteSize `toml:"max_size"`
+	// Evict selects episodes to remove first: "oldest" (default) or "least_listened" (requires server.stats)
+	Evict string `toml:"evict"`
+	// DryRun only reports episodes that would be removed
+	DryRun bool `toml:"dry_run"`
+}
+
+// RemovedFeeds configures what happens to data of feeds deleted from the config
+type RemovedFeeds struct {
+	// Policy is one of "warn" (default), "grace" or "purge"
+	Policy string `toml:"policy"`
+	// GraceDays is the number of days to keep data of removed feeds with the "grace" policy
+	GraceDays int `toml:"grace_days"`
 }
@@ -0,0 +1,688 @@
+package feed
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/pkg/errors"
+
+	"github.com/mxpv/podsync/pkg/model"
+)
+
+// Expr is a compiled episode filter expression (see Filters.Expr).
+//
+// Expressions combine comparisons of episode fields with &&, || and !, parentheses group terms:
+//
+//	duration > 600 && !(title ~ "(?i)#shorts") || title ~ "Part \\d+"
+//
+// Fields:
+//   - title, description: strings
+//   - duration: seconds
+//   - pub_date: publication date, compared to "2006-01-02" or RFC 3339 strings
+//   - age: days since publication
+//   - order: position of the episode in the playlist
+//   - tags: list of strings
+//   - is_short, is_live, is_premiere, is_members_only: booleans
+//
+// Operators: == != < <= > >= for strings, numbers and dates, ~ and !~ match regular expressions
+// (a list matches when any item does), "in" checks whether a string is in a list or a substring of a string.
+type Expr struct {
+	source string
+	root   exprNode
+}
+
+// exprType is a static type of an expression node
+type exprType int
+
+const (
+	typeBool exprType = iota
+	typeString
+	typeNumber
+	typeTime
+	typeList
+)
+
+func (t exprType) String() string {
+	switch t {
+	case typeBool:
+		return "bool"
+	case typeString:
+		return "string"
+	case typeNumber:
+		return "number"
+	case typeTime:
+		return "date"
+	default:
+		return "list"
+	}
+}
+
+// exprFields are episode fields available to expressions
+var exprFields = map[string]exprType{
+	"title":           typeString,
+	"description":     typeString,
+	"duration":        typeNumber,
+	"pub_date":        typeTime,
+	"age":             typeNumber,
+	"order":           typeNumber,
+	"tags":            typeList,
+	"is_short":        typeBool,
+	"is_live":         typeBool,
+	"is_premiere":     typeBool,
+	"is_members_only": typeBool,
+}
+
+// CompileExpr parses and type checks a filter expression
+func CompileExpr(source string) (*Expr, error) {
+	p := &exprParser{}
+	if err := p.tokenize(source); err != nil {
+		return nil, err
+	}
+
+	root, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+
+	if tok := p.peek(); tok.kind != tokenEOF {
+		return nil, errors.Errorf("unexpected %q at position %d", tok.text, tok.pos+1)
+	}
+
+	if root.typ() != typeBool {
+		return nil, errors.Errorf("expression must be a condition, got %s", root.typ())
+	}
+
+	return &Expr{source: source, root: root}, nil
+}
+
+// ValidateExpr checks an optional filter expression
+func ValidateExpr(source string) error {
+	if strings.TrimSpace(source) == "" {
+		return nil
+	}
+
+	_, err := CompileExpr(source)
+	return err
+}
+
+func (e *Expr) String() string {
+	return e.source
+}
+
+// Uses returns true if the expression refers to the field
+func (e *Expr) Uses(field string) bool {
+	used := false
+	walkFields(e.root, func(n *fieldNode) {
+		used = used || n.name == field
+	})
+	return used
+}
+
+// Match evaluates the expression against the episode.
+// When the episode doesn't match, the reason lists the terms that decided the result along with field values.
+func (e *Expr) Match(episode *model.Episode) (bool, string) {
+	env := newExprEnv(episode)
+	if e.root.eval(env).(bool) {
+		return true, ""
+	}
+
+	var reasons []string
+	for _, node := range explain(e.root, env) {
+		reason := fmt.Sprintf("%s is false", node)
+		if values := env.describe(node); values != "" {
+			reason += fmt.Sprintf(" (%s)", values)
+		}
+		reasons = append(reasons, reason)
+	}
+
+	return false, strings.Join(reasons, "; ")
+}
+
+// explain returns the nodes that made a false node false
+func explain(node exprNode, env *exprEnv) []exprNode {
+	switch n := node.(type) {
+	case *logicalNode:
+		if n.op == "&&" {
+			for _, operand := range []exprNode{n.left, n.right} {
+				if !operand.eval(env).(bool) {
+					return explain(operand, env)
+				}
+			}
+		}
+		// Both sides of a false || are false
+		return append(explain(n.left, env), explain(n.right, env)...)
+	case *groupNode:
+		return explain(n.inner, env)
+	default:
+		return []exprNode{node}
+	}
+}
+
+type exprEnv struct {
+	values map[string]interface{}
+}
+
+func newExprEnv(episode *model.Episode) *exprEnv {
+	order, _ := strconv.ParseFloat(episode.Order, 64)
+	return &exprEnv{
+		values: map[string]interface{}{
+			"title":           episode.Title,
+			"description":     episode.Description,
+			"duration":        float64(episode.Duration),
+			"pub_date":        episode.PubDate,
+			"age":             float64(int(time.Since(episode.PubDate).Hours()) / 24),
+			"order":           order,
+			"tags":            episode.Tags,
+			"is_short":        episode.ContentType == model.ContentShort,
+			"is_live":         episode.ContentType == model.ContentLiveVOD,
+			"is_premiere":     episode.ContentType == model.ContentPremiere,
+			"is_members_only": episode.MembersOnly,
+		},
+	}
+}
+
+// describe formats values of the fields used by the node
+func (env *exprEnv) describe(node exprNode) string {
+	var (
+		seen  = map[string]bool{}
+		parts []string
+	)
+
+	walkFields(node, func(n *fieldNode) {
+		if seen[n.name] {
+			return
+		}
+		seen[n.name] = true
+
+		value := env.values[n.name]
+		switch v := value.(type) {
+		case string:
+			const maxLen = 80
+			if len(v) > maxLen {
+				v = v[:maxLen] + "..."
+			}
+			value = strconv.Quote(v)
+		case time.Time:
+			value = v.UTC().Format(time.RFC3339)
+		case []string:
+			value = fmt.Sprintf("%q", v)
+		}
+		parts = append(parts, fmt.Sprintf("%s = %v", n.name, value))
+	})
+
+	return strings.Join(parts, ", ")
+}
+
+// walkFields calls fn for each field the node refers to
+func walkFields(node exprNode, fn func(n *fieldNode)) {
+	switch n := node.(type) {
+	case *fieldNode:
+		fn(n)
+	case *notNode:
+		walkFields(n.inner, fn)
+	case *groupNode:
+		walkFields(n.inner, fn)
+	case *logicalNode:
+		walkFields(n.left, fn)
+		walkFields(n.right, fn)
+	case *compareNode:
+		walkFields(n.left, fn)
+		walkFields(n.right, fn)
+	}
+}
+
+// AST
+
+type exprNode interface {
+	typ() exprType
+	eval(env *exprEnv) interface{}
+	String() string
+}
+
+type literalNode struct {
+	value interface{}
+	text  string
+	t     exprType
+}
+
+func (n *literalNode) typ() exprType               { return n.t }
+func (n *literalNode) eval(_ *exprEnv) interface{} { return n.value }
+func (n *literalNode) String() string              { return n.text }
+
+type fieldNode struct {
+	name string
+}
+
+func (n *fieldNode) typ() exprType                 { return exprFields[n.name] }
+func (n *fieldNode) eval(env *exprEnv) interface{} { return env.values[n.name] }
+func (n *fieldNode) String() string                { return n.name }
+
+type notNode struct {
+	inner exprNode
+}
+
+func (n *notNode) typ() exprType                 { return typeBool }
+func (n *notNode) eval(env *exprEnv) interface{} { return !n.inner.eval(env).(bool) }
+func (n *notNode) String() string                { return "!" + n.inner.String() }
+
+type groupNode struct {
+	inner exprNode
+}
+
+func (n *groupNode) typ() exprType                 { return n.inner.typ() }
+func (n *groupNode) eval(env *exprEnv) interface{} { return n.inner.eval(env) }
+func (n *groupNode) String() string                { return "(" + n.inner.String() + ")" }
+
+type logicalNode struct {
+	op          string
+	left, right exprNode
+}
+
+func (n *logicalNode) typ() exprType { return typeBool }
+
+func (n *logicalNode) eval(env *exprEnv) interface{} {
+	left := n.left.eval(env).(bool)
+	if n.op == "&&" {
+		return left && n.right.eval(env).(bool)
+	}
+	return left || n.right.eval(env).(bool)
+}
+
+func (n *logicalNode) String() string {
+	return fmt.Sprintf("%s %s %s", n.left, n.op, n.right)
+}
+
+type compareNode struct {
+	op          string
+	left, right exprNode
+	// pattern is the compiled regular expression of a ~ or !~ comparison with a literal
+	pattern *regexp.Regexp
+}
+
+func (n *compareNode) typ() exprType { return typeBool }
+
+func (n *compareNode) String() string {
+	return fmt.Sprintf("%s %s %s", n.left, n.op, n.right)
+}
+
+func (n *compareNode) eval(env *exprEnv) interface{} {
+	left, right := n.left.eval(env), n.right.eval(env)
+
+	switch n.op {
+	case "~", "!~":
+		matched := false
+		switch value := left.(type) {
+		case string:
+			matched = n.pattern.MatchString(value)
+		case []string:
+			for _, item := range value {
+				if n.pattern.MatchString(item) {
+					matched = true
+					break
+				}
+			}
+		}
+		return matched == (n.op == "~")
+
+	case "in":
+		needle := left.(string)
+		switch haystack := right.(type) {
+		case string:
+			return strings.Contains(haystack, needle)
+		case []string:
+			for _, item := range haystack {
+				if item == needle {
+					return true
+				}
+			}
+		}
+		return false
+	}
+
+	var cmp int
+	switch l := left.(type) {
+	case bool:
+		if l == right.(bool) {
+			cmp = 0
+		} else {
+			cmp = 1
+		}
+	case string:
+		cmp = strings.Compare(l, right.(string))
+	case float64:
+		r := right.(float64)
+		switch {
+		case l < r:
+			cmp = -1
+		case l > r:
+			cmp = 1
+		}
+	case time.Time:
+		cmp = l.Compare(right.(time.Time))
+	}
+
+	switch n.op {
+	case "==":
+		return cmp == 0
+	case "!=":
+		return cmp != 0
+	case "<":
+		return cmp < 0
+	case "<=":
+		return cmp <= 0
+	case ">":
+		return cmp > 0
+	default:
+		return cmp >= 0
+	}
+}
+
+// Parser
+
+type tokenKind int
+
+const (
+	tokenEOF tokenKind = iota
+	tokenIdent
+	tokenString
+	tokenNumber
+	tokenOperator
+)
+
+type token struct {
+	kind tokenKind
+	text string
+	pos  int
+}
+
+type exprParser struct {
+	tokens []token
+	index  int
+}
+
+var comparisonOperators = map[string]bool{
+	"==": true, "!=": true, "<": true, "<=": true, ">": true, ">=": true, "~": true, "!~": true, "in": true,
+}
+
+// exprOperators are sorted so that longer ones are matched first
+var exprOperators = []string{"&&", "||", "==", "!=", "<=", ">=", "!~", "<", ">", "~", "!", "(", ")"}
+
+func (p *exprParser) tokenize(source string) error {
+	for i := 0; i < len(source); {
+		c := rune(source[i])
+
+		switch {
+		case unicode.IsSpace(c):
+			i++
+
+		case c == '"' || c == '`':
+			end := i + 1
+			for ; end < len(source); end++ {
+				if source[end] == '\\' && c == '"' {
+					end++
+					continue
+				}
+				if rune(source[end]) == c {
+					break
+				}
+			}
+			if end >= len(source) {
+				return errors.Errorf("unterminated string at position %d", i+1)
+			}
+			text := source[i : end+1]
+			if _, err := strconv.Unquote(text); err != nil {
+				return errors.Errorf("invalid string %s at position %d", text, i+1)
+			}
+			p.tokens = append(p.tokens, token{kind: tokenString, text: text, pos: i})
+			i = end + 1
+
+		case unicode.IsDigit(c):
+			end := i
+			for end < len(source) && (unicode.IsDigit(rune(source[end])) || source[end] == '.') {
+				end++
+			}
+			p.tokens = append(p.tokens, token{kind: tokenNumber, text: source[i:end], pos: i})
+			i = end
+
+		case unicode.IsLetter(c) || c == '_':
+			end := i
+			for end < len(source) && (unicode.IsLetter(rune(source[end])) || unicode.IsDigit(rune(source[end])) || source[end] == '_') {
+				end++
+			}
+			p.tokens = append(p.tokens, token{kind: tokenIdent, text: source[i:end], pos: i})
+			i = end
+
+		default:
+			matched := false
+			for _, op := range exprOperators {
+				if strings.HasPrefix(source[i:], op) {
+					p.tokens = append(p.tokens, token{kind: tokenOperator, text: op, pos: i})
+					i += len(op)
+					matched = true
+					break
+				}
+			}
+			if !matched {
+				return errors.Errorf("unexpected character %q at position %d", c, i+1)
+			}
+		}
+	}
+
+	p.tokens = append(p.tokens, token{kind: tokenEOF, pos: len(source)})
+	return nil
+}
+
+func (p *exprParser) peek() token {
+	return p.tokens[p.index]
+}
+
+func (p *exprParser) next() token {
+	tok := p.tokens[p.index]
+	if tok.kind != tokenEOF {
+		p.index++
+	}
+	return tok
+}
+
+func (p *exprParser) accept(op string) bool {
+	if tok := p.peek(); tok.kind == tokenOperator && tok.text == op {
+		p.index++
+		return true
+	}
+	return false
+}
+
+func (p *exprParser) parseOr() (exprNode, error) {
+	return p.parseLogical("||", p.parseAnd)
+}
+
+func (p *exprParser) parseAnd() (exprNode, error) {
+	return p.parseLogical("&&", p.parseUnary)
+}
+
+func (p *exprParser) parseLogical(op string, operand func() (exprNode, error)) (exprNode, error) {
+	left, err := operand()
+	if err != nil {
+		return nil, err
+	}
+
+	for {
+		pos := p.peek().pos
+		if !p.accept(op) {
+			return left, nil
+		}
+
+		right, err := operand()
+		if err != nil {
+			return nil, err
+		}
+
+		if left.typ() != typeBool || right.typ() != typeBool {
+			return nil, errors.Errorf("%s at position %d expects conditions on both sides", op, pos+1)
+		}
+
+		left = &logicalNode{op: op, left: left, right: right}
+	}
+}
+
+func (p *exprParser) parseUnary() (exprNode, error) {
+	pos := p.peek().pos
+	if p.accept("!") {
+		inner, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		if inner.typ() != typeBool {
+			return nil, errors.Errorf("! at position %d expects a condition", pos+1)
+		}
+		return &notNode{inner: inner}, nil
+	}
+
+	return p.parseComparison()
+}
+
+func (p *exprParser) parseComparison() (exprNode, error) {
+	left, err := p.parsePrimary()
+	if err != nil {
+		return nil, err
+	}
+
+	tok := p.peek()
+	if !comparisonOperators[tok.text] || tok.kind == tokenString {
+		return left, nil
+	}
+	p.next()
+	op := tok.text
+
+	right, err := p.parsePrimary()
+	if err != nil {
+		return nil, err
+	}
+
+	node := &compareNode{op: op, left: left, right: right}
+	if err := p.check(node, tok.pos); err != nil {
+		return nil, err
+	}
+
+	return node, nil
+}
+
+// check verifies operand types of a comparison, converting date literals
+func (p *exprParser) check(node *compareNode, pos int) error {
+	lt, rt := node.left.typ(), node.right.typ()
+	invalid := errors.Errorf("can't apply %s to %s and %s at position %d", node.op, lt, rt, pos+1)
+
+	switch node.op {
+	case "~", "!~":
+		literal, ok := node.right.(*literalNode)
+		if !ok || rt != typeString {
+			return errors.Errorf("%s at position %d expects a regular expression string", node.op, pos+1)
+		}
+		if lt != typeString && lt != typeList {
+			return invalid
+		}
+		pattern, err := regexp.Compile(literal.value.(string))
+		if err != nil {
+			return errors.Wrapf(err, "invalid regular expression at position %d", pos+1)
+		}
+		node.pattern = pattern
+		return nil
+
+	case "in":
+		if lt != typeString || (rt != typeList && rt != typeString) {
+			return invalid
+		}
+		return nil
+	}
+
+	// Dates are compared to string literals
+	if lt == typeTime && rt == typeString {
+		converted, err := dateLiteral(node.right)
+		if err != nil {
+			return err
+		}
+		node.right = converted
+		rt = typeTime
+	}
+	if lt == typeString && rt == typeTime {
+		converted, err := dateLiteral(node.left)
+		if err != nil {
+			return err
+		}
+		node.left = converted
+		lt = typeTime
+	}
+
+	if lt != rt || lt == typeList {
+		return invalid
+	}
+	if lt == typeBool && node.op != "==" && node.op != "!=" {
+		return invalid
+	}
+
+	return nil
+}
+
+func dateLiteral(node exprNode) (exprNode, error) {
+	literal, ok := node.(*literalNode)
+	if !ok {
+		return nil, errors.Errorf("dates can only be compared to date strings")
+	}
+
+	text := literal.value.(string)
+	for _, layout := range []string{time.RFC3339, "2006-01-02"} {
+		if value, err := time.Parse(layout, text); err == nil {
+			return &literalNode{value: value, text: literal.text, t: typeTime}, nil
+		}
+	}
+
+	return nil, errors.Errorf("invalid date %s, expected YYYY-MM-DD or RFC 3339", literal.text)
+}
+
+func (p *exprParser) parsePrimary() (exprNode, error) {
+	tok := p.next()
+
+	switch tok.kind {
+	case tokenString:
+		value, _ := strconv.Unquote(tok.text)
+		return &literalNode{value: value, text: tok.text, t: typeString}, nil
+
+	case tokenNumber:
+		value, err := strconv.ParseFloat(tok.text, 64)
+		if err != nil {
+			return nil, errors.Errorf("invalid number %q at position %d", tok.text, tok.pos+1)
+		}
+		return &literalNode{value: value, text: tok.text, t: typeNumber}, nil
+
+	case tokenIdent:
+		switch tok.text {
+		case "true", "false":
+			return &literalNode{value: tok.text == "true", text: tok.text, t: typeBool}, nil
+		}
+		if _, ok := exprFields[tok.text]; !ok {
+			return nil, errors.Errorf("unknown field %q at position %d", tok.text, tok.pos+1)
+		}
+		return &fieldNode{name: tok.text}, nil
+
+	case tokenOperator:
+		if tok.text == "(" {
+			inner, err := p.parseOr()
+			if err != nil {
+				return nil, err
+			}
+			if !p.accept(")") {
+				return nil, errors.Errorf("missing ) for ( at position %d", tok.pos+1)
+			}
+			return &groupNode{inner: inner}, nil
+		}
+
+	case tokenEOF:
+		return nil, errors.New("unexpected end of expression")
+	}
+
+	return nil, errors.Errorf("unexpected %q at position %d", tok.text, tok.pos+1)
+}
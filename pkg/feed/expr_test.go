@@ -0,0 +1,129 @@
+package feed
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/mxpv/podsync/pkg/model"
+)
+
+func TestExpr_Match(t *testing.T) {
+	episode := &model.Episode{
+		ID:          "1",
+		Title:       "Interview, Part 12",
+		Description: "We talk about Go",
+		Duration:    1800,
+		PubDate:     time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC),
+		Order:       "4",
+		Tags:        []string{"golang", "interview"},
+		ContentType: model.ContentLiveVOD,
+	}
+
+	tests := []struct {
+		expr     string
+		expected bool
+	}{
+		{`duration > 600`, true},
+		{`duration >= 1800 && duration <= 1800`, true},
+		{`duration < 60 || title ~ "Part \\d+"`, true},
+		{`duration > 600 && !(title ~ "(?i)#shorts") || title ~ "Part \\d+"`, true},
+		{"title ~ `(?i)interview`", true},
+		{`title !~ "Part"`, false},
+		{`title == "Interview, Part 12"`, true},
+		{`title != "Interview, Part 12"`, false},
+		{`"Go" in description`, true},
+		{`"interview" in tags`, true},
+		{`"music" in tags`, false},
+		{`tags ~ "^go"`, true},
+		{`pub_date >= "2024-03-01"`, true},
+		{`pub_date < "2024-03-01T00:00:00Z"`, false},
+		{`"2024-01-01" < pub_date`, true},
+		{`age > 30`, true},
+		{`order == 4`, true},
+		{`is_live && !is_short`, true},
+		{`is_short == false`, true},
+		{`!!is_live`, true},
+		{`is_premiere || is_members_only`, false},
+		{`(duration > 10 || is_short) && (order < 3 || "golang" in tags)`, true},
+	}
+
+	for _, tt := range tests {
+		expr, err := CompileExpr(tt.expr)
+		require.NoError(t, err, tt.expr)
+
+		matched, reason := expr.Match(episode)
+		assert.Equal(t, tt.expected, matched, tt.expr)
+		assert.Equal(t, matched, reason == "", tt.expr)
+	}
+}
+
+func TestExpr_Reason(t *testing.T) {
+	episode := &model.Episode{ID: "1", Title: "Teaser #shorts", Duration: 45}
+
+	expr, err := CompileExpr(`duration > 600 && !(title ~ "(?i)#shorts") || title ~ "Part \\d+"`)
+	require.NoError(t, err)
+
+	matched, reason := expr.Match(episode)
+	assert.False(t, matched)
+	assert.Equal(t, `duration > 600 is false (duration = 45); title ~ "Part \\d+" is false (title = "Teaser #shorts")`, reason)
+
+	episode.Duration = 3600
+	_, reason = expr.Match(episode)
+	assert.Equal(t, `!(title ~ "(?i)#shorts") is false (title = "Teaser #shorts"); title ~ "Part \\d+" is false (title = "Teaser #shorts")`, reason)
+}
+
+func TestValidateExpr(t *testing.T) {
+	assert.NoError(t, ValidateExpr(""))
+	assert.NoError(t, ValidateExpr(`is_short == false`))
+
+	for _, expr := range []string{
+		`duration`,
+		`duration > `,
+		`views > 100`,
+		`title > 5`,
+		`title ~ "(unclosed"`,
+		`title ~ description`,
+		`pub_date > "yesterday"`,
+		`(duration > 5`,
+		`duration > 5)`,
+		`"unterminated`,
+		`is_live < true`,
+		`tags == "x"`,
+		`duration > 5 && title`,
+		`!title`,
+		`duration $ 5`,
+	} {
+		assert.Error(t, ValidateExpr(expr), expr)
+	}
+}
+
+func TestFilters_DetectShorts(t *testing.T) {
+	detect := func(filters *Filters) bool {
+		require.NoError(t, filters.Compile())
+		return filters.DetectShorts()
+	}
+
+	assert.False(t, detect(&Filters{}))
+	assert.False(t, detect(&Filters{Expr: `duration > 60 && !is_live`}))
+	assert.True(t, detect(&Filters{ExcludeShorts: true}))
+	assert.True(t, detect(&Filters{Expr: `duration > 600 || !(is_short)`}))
+}
+
+func TestFilters_Compile(t *testing.T) {
+	filters := &Filters{Expr: `is_short == false`}
+	require.NoError(t, filters.Compile())
+	require.NotNil(t, filters.CompiledExpr())
+	assert.Equal(t, filters.Expr, filters.CompiledExpr().String())
+
+	// The compiled expression is dropped along with an invalid one
+	filters.Expr = `title ~`
+	assert.Error(t, filters.Compile())
+	assert.Nil(t, filters.CompiledExpr())
+
+	filters.Expr = " "
+	require.NoError(t, filters.Compile())
+	assert.Nil(t, filters.CompiledExpr())
+}
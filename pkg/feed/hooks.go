@@ -1,13 +1,59 @@
 package feed
 
 import (
+	"bytes"
 	"context"
+	"encoding/json"
 	"fmt"
 	"os"
 	"os/exec"
+	"strconv"
+	"strings"
 	"time"
+
+	"github.com/mxpv/podsync/pkg/model"
+)
+
+// Hook points
+const (
+	HookPreEpisodeDownload     = "pre_episode_download"
+	HookPostEpisodeDownload    = "post_episode_download"
+	HookOnEpisodeDownloadError = "on_episode_download_error"
+	HookPostFeedUpdate         = "post_feed_update"
+	HookOnFeedUpdateError      = "on_feed_update_error"
+	HookPostEpisodeCleanup     = "post_episode_cleanup"
+	HookProcessEpisode         = "process_episode"
 )
 
+// Hooks lists all hook points
+var Hooks = []string{
+	HookPreEpisodeDownload,
+	HookPostEpisodeDownload,
+	HookOnEpisodeDownloadError,
+	HookPostFeedUpdate,
+	HookOnFeedUpdateError,
+	HookPostEpisodeCleanup,
+	HookProcessEpisode,
+}
+
+// HookVariables are names of environment variables HookContext.Env sets for hooks
+var HookVariables = map[string]struct{}{
+	"HOOK":             {},
+	"FEED_NAME":        {},
+	"FEED_TITLE":       {},
+	"FEED_URL":         {},
+	"EPISODE_ID":       {},
+	"EPISODE_TITLE":    {},
+	"EPISODE_URL":      {},
+	"EPISODE_DURATION": {},
+	"EPISODE_SIZE":     {},
+	"EPISODE_PUB_DATE": {},
+	"EPISODE_FILE":     {},
+	"EPISODE_PATH":     {},
+	"OUTPUT_DIR":       {},
+	"ERROR_MESSAGE":    {},
+}
+
 // ExecHook represents a single hook configuration that executes commands
 // after specific lifecycle events (e.g., episode downloads).
 //
@@ -17,10 +63,17 @@ import (
 //	command = ["curl", "-X", "POST", "-d", "$EPISODE_TITLE", "webhook.example.com"]
 //	timeout = 30
 //
-// Environment variables available to hooks:
-//   - EPISODE_FILE: Path to downloaded file (e.g., "podcast-id/episode.mp3")
+// Environment variables available to hooks (see HookContext.Env):
+//   - HOOK: The hook point (e.g., "post_episode_download")
 //   - FEED_NAME: The feed identifier
-//   - EPISODE_TITLE: The episode title
+//   - FEED_TITLE, FEED_URL: The feed title and its XML URL
+//   - EPISODE_ID, EPISODE_TITLE, EPISODE_URL, EPISODE_DURATION (seconds), EPISODE_SIZE (bytes),
+//     EPISODE_PUB_DATE (RFC 3339): Episode details
+//   - EPISODE_FILE: Storage path of the episode file (e.g., "podcast-id/episode.mp3")
+//   - EPISODE_PATH: Absolute path of the episode file (local storage only),
+//     process hooks get the downloaded file before it's uploaded to storage
+//   - OUTPUT_DIR: Empty directory process hooks can write a replacement file to
+//   - ERROR_MESSAGE: The error of failure hooks
 type ExecHook struct {
 	// Command is the command and arguments to execute.
 	// For single commands, use shell parsing: ["echo hello"]
@@ -30,6 +83,84 @@ type ExecHook struct {
 	// Timeout in seconds for command execution.
 	// If 0 or unset, defaults to 60 seconds.
 	Timeout int `toml:"timeout"`
+
+	// Stdin passes the hook context as JSON to the command's standard input.
+	Stdin bool `toml:"stdin"`
+}
+
+// HookContext describes what a hook is invoked for
+type HookContext struct {
+	Hook      string         `json:"hook"`
+	FeedID    string         `json:"feed_id"`
+	FeedTitle string         `json:"feed_title,omitempty"`
+	FeedURL   string         `json:"feed_url,omitempty"`
+	Episode   *model.Episode `json:"episode,omitempty"`
+	// File is a storage path of the episode file
+	File string `json:"file,omitempty"`
+	// Path is an absolute path of the episode file, only set for local storage
+	Path string `json:"path,omitempty"`
+	// Output is a directory process hooks can write a replacement of the file to
+	Output string `json:"output_dir,omitempty"`
+	Error  string `json:"error,omitempty"`
+}
+
+// Env returns environment variables describing the hook context
+func (c *HookContext) Env() []string {
+	env := []string{
+		"HOOK=" + c.Hook,
+		"FEED_NAME=" + c.FeedID,
+		"FEED_TITLE=" + c.FeedTitle,
+		"FEED_URL=" + c.FeedURL,
+	}
+
+	if episode := c.Episode; episode != nil {
+		env = append(env,
+			"EPISODE_ID="+episode.ID,
+			"EPISODE_TITLE="+episode.Title,
+			"EPISODE_URL="+episode.VideoURL,
+			"EPISODE_DURATION="+strconv.FormatInt(episode.Duration, 10),
+			"EPISODE_SIZE="+strconv.FormatInt(episode.Size, 10),
+			"EPISODE_PUB_DATE="+episode.PubDate.UTC().Format(time.RFC3339),
+		)
+	}
+
+	if c.File != "" {
+		env = append(env, "EPISODE_FILE="+c.File)
+	}
+	if c.Path != "" {
+		env = append(env, "EPISODE_PATH="+c.Path)
+	}
+	if c.Output != "" {
+		env = append(env, "OUTPUT_DIR="+c.Output)
+	}
+	if c.Error != "" {
+		env = append(env, "ERROR_MESSAGE="+c.Error)
+	}
+
+	return env
+}
+
+// XMLURL returns the public URL of a feed's XML file
+func XMLURL(hostname string, feedID string) string {
+	return fmt.Sprintf("%s/%s.xml", strings.TrimRight(hostname, "/"), feedID)
+}
+
+// Run executes the hook with the context passed as environment variables, and as JSON on stdin if enabled.
+func (h *ExecHook) Run(hookContext *HookContext) error {
+	if h == nil {
+		return nil
+	}
+
+	var stdin []byte
+	if h.Stdin {
+		data, err := json.Marshal(hookContext)
+		if err != nil {
+			return fmt.Errorf("failed to serialize hook context: %v", err)
+		}
+		stdin = data
+	}
+
+	return h.invoke(hookContext.Env(), stdin)
 }
 
 // Invoke executes the hook command with the provided environment variables.
@@ -44,6 +175,10 @@ type ExecHook struct {
 // Returns an error if the command fails, times out, or returns a non-zero exit code.
 // The error includes the combined stdout/stderr output for debugging.
 func (h *ExecHook) Invoke(env []string) error {
+	return h.invoke(env, nil)
+}
+
+func (h *ExecHook) invoke(env []string, stdin []byte) error {
 	if h == nil {
 		return nil
 	}
@@ -72,6 +207,9 @@ func (h *ExecHook) Invoke(env []string) error {
 
 	// Set up environment variables
 	cmd.Env = append(os.Environ(), env...)
+	if stdin != nil {
+		cmd.Stdin = bytes.NewReader(stdin)
+	}
 
 	// Execute the command
 	data, err := cmd.CombinedOutput()
@@ -1,16 +1,21 @@
 package feed
 
 import (
+	"encoding/json"
 	"fmt"
 	"io"
 	"net/http"
 	"net/http/httptest"
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+
+	"github.com/mxpv/podsync/pkg/model"
 )
 
 func TestExecuteHook_WriteEnvToFile(t *testing.T) {
@@ -135,3 +140,94 @@ func TestExecuteHook_CurlWebhook(t *testing.T) {
 	assert.Equal(t, "Test Episode for Webhook", receivedData, "Server should receive the episode title")
 	assert.Contains(t, receivedHeaders["User-Agent"], "curl", "Request should be made by curl")
 }
+
+func TestHookContext_Env(t *testing.T) {
+	hookContext := &HookContext{
+		Hook:      HookPostEpisodeDownload,
+		FeedID:    "feed1",
+		FeedTitle: "Feed Title",
+		FeedURL:   XMLURL("https://example.com/", "feed1"),
+		Episode: &model.Episode{
+			ID:       "ep1",
+			Title:    "Episode 1",
+			VideoURL: "https://youtube.com/watch?v=ep1",
+			Duration: 120,
+			Size:     1024,
+			PubDate:  time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC),
+		},
+		File: "feed1/ep1.mp3",
+		Path: "/data/feed1/ep1.mp3",
+	}
+
+	assert.ElementsMatch(t, []string{
+		"HOOK=post_episode_download",
+		"FEED_NAME=feed1",
+		"FEED_TITLE=Feed Title",
+		"FEED_URL=https://example.com/feed1.xml",
+		"EPISODE_ID=ep1",
+		"EPISODE_TITLE=Episode 1",
+		"EPISODE_URL=https://youtube.com/watch?v=ep1",
+		"EPISODE_DURATION=120",
+		"EPISODE_SIZE=1024",
+		"EPISODE_PUB_DATE=2024-05-01T10:00:00Z",
+		"EPISODE_FILE=feed1/ep1.mp3",
+		"EPISODE_PATH=/data/feed1/ep1.mp3",
+	}, hookContext.Env())
+
+	// Feed hooks have no episode details
+	hookContext = &HookContext{Hook: HookOnFeedUpdateError, FeedID: "feed1", Error: "boom"}
+	assert.ElementsMatch(t, []string{
+		"HOOK=on_feed_update_error",
+		"FEED_NAME=feed1",
+		"FEED_TITLE=",
+		"FEED_URL=",
+		"ERROR_MESSAGE=boom",
+	}, hookContext.Env())
+}
+
+func TestHookVariables(t *testing.T) {
+	hookContext := &HookContext{
+		Episode: &model.Episode{},
+		File:    "file",
+		Path:    "path",
+		Output:  "output",
+		Error:   "error",
+	}
+
+	env := hookContext.Env()
+	assert.Len(t, env, len(HookVariables))
+	for _, variable := range env {
+		name := strings.SplitN(variable, "=", 2)[0]
+		assert.Contains(t, HookVariables, name)
+	}
+}
+
+func TestExecHook_RunWithStdin(t *testing.T) {
+	output := filepath.Join(t.TempDir(), "stdin.json")
+
+	hook := &ExecHook{
+		Command: []string{"cat > " + output + " && test \"$EPISODE_ID\" = ep1"},
+		Stdin:   true,
+	}
+
+	err := hook.Run(&HookContext{
+		Hook:    HookPreEpisodeDownload,
+		FeedID:  "feed1",
+		Episode: &model.Episode{ID: "ep1", Title: "Episode 1"},
+	})
+	require.NoError(t, err)
+
+	data, err := os.ReadFile(output)
+	require.NoError(t, err)
+
+	var payload HookContext
+	require.NoError(t, json.Unmarshal(data, &payload))
+	assert.Equal(t, HookPreEpisodeDownload, payload.Hook)
+	assert.Equal(t, "feed1", payload.FeedID)
+	require.NotNil(t, payload.Episode)
+	assert.Equal(t, "Episode 1", payload.Episode.Title)
+
+	// Non-zero exit codes are reported, so pre download hooks can veto downloads
+	hook = &ExecHook{Command: []string{"exit 1"}}
+	assert.Error(t, hook.Run(&HookContext{Hook: HookPreEpisodeDownload}))
+}
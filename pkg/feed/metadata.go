@@ -0,0 +1,22 @@
+package feed
+
+import (
+	"github.com/pkg/errors"
+)
+
+// Artwork embedded into episode files by the metadata stage
+const (
+	CoverEpisode = "episode"
+	CoverFeed    = "feed"
+	CoverNone    = "none"
+)
+
+// ValidateMetadata checks metadata overrides of a feed
+func ValidateMetadata(metadata Metadata) error {
+	switch metadata.Cover {
+	case "", CoverEpisode, CoverFeed, CoverNone:
+		return nil
+	default:
+		return errors.Errorf("unsupported cover %q (must be %q, %q or %q)", metadata.Cover, CoverEpisode, CoverFeed, CoverNone)
+	}
+}
@@ -3,7 +3,6 @@ package feed
 import (
 	"context"
 	"fmt"
-	"strings"
 
 	"github.com/gilliek/go-opml/opml"
 	"github.com/pkg/errors"
@@ -35,10 +34,19 @@ func BuildOPML(ctx context.Context, feeds map[string]*Config, db feedProvider, h
 			Title:  f.Title,
 			Text:   f.Description,
 			Type:   "rss",
-			XMLURL: fmt.Sprintf("%s/%s.xml", strings.TrimRight(hostname, "/"), feed.ID),
+			XMLURL: XMLURL(hostname, feed.ID),
 		}
 
 		doc.Body.Outlines = append(doc.Body.Outlines, outline)
+
+		for _, rendition := range feed.Renditions {
+			doc.Body.Outlines = append(doc.Body.Outlines, opml.Outline{
+				Title:  fmt.Sprintf("%s (%s)", f.Title, rendition.Name),
+				Text:   f.Description,
+				Type:   "rss",
+				XMLURL: XMLURL(hostname, fmt.Sprintf("%s-%s", feed.ID, rendition.Name)),
+			})
+		}
 	}
 
 	out, err := doc.XML()
@@ -0,0 +1,63 @@
+package feed
+
+import (
+	"regexp"
+
+	"github.com/pkg/errors"
+
+	"github.com/mxpv/podsync/pkg/model"
+)
+
+// IsPinned returns true if the episode is pinned either via API or by the feed configuration.
+func (c *Config) IsPinned(episode *model.Episode) bool {
+	if episode.Pinned {
+		return true
+	}
+
+	for _, id := range c.Pin.IDs {
+		if id == episode.ID {
+			return true
+		}
+	}
+
+	for _, pattern := range c.Pin.patterns() {
+		if pattern.MatchString(episode.Title) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// patterns returns compiled title patterns.
+// Patterns of configurations that didn't go through ValidatePins are compiled on each call,
+// invalid ones are skipped.
+func (p *Pins) patterns() []*regexp.Regexp {
+	if len(p.titles) == len(p.Titles) {
+		return p.titles
+	}
+
+	var list []*regexp.Regexp
+	for _, title := range p.Titles {
+		if pattern, err := regexp.Compile(title); err == nil {
+			list = append(list, pattern)
+		}
+	}
+
+	return list
+}
+
+// ValidatePins checks that title patterns are valid regular expressions and compiles them
+func ValidatePins(pins *Pins) error {
+	titles := make([]*regexp.Regexp, 0, len(pins.Titles))
+	for _, title := range pins.Titles {
+		pattern, err := regexp.Compile(title)
+		if err != nil {
+			return errors.Wrapf(err, "invalid title pattern %q", title)
+		}
+		titles = append(titles, pattern)
+	}
+
+	pins.titles = titles
+	return nil
+}
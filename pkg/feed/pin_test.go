@@ -0,0 +1,26 @@
+package feed
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/mxpv/podsync/pkg/model"
+)
+
+func TestIsPinned(t *testing.T) {
+	cfg := &Config{Pin: Pins{IDs: []string{"abc"}, Titles: []string{`(?i)^lecture \d+`}}}
+
+	assert.True(t, cfg.IsPinned(&model.Episode{ID: "abc"}))
+	assert.True(t, cfg.IsPinned(&model.Episode{ID: "1", Title: "Lecture 12: Compilers"}))
+	assert.True(t, cfg.IsPinned(&model.Episode{ID: "2", Pinned: true}))
+	assert.False(t, cfg.IsPinned(&model.Episode{ID: "3", Title: "Q&A after lecture 12"}))
+}
+
+func TestValidatePins(t *testing.T) {
+	pins := Pins{Titles: []string{"^a"}}
+	assert.NoError(t, ValidatePins(&pins))
+	assert.Len(t, pins.titles, 1)
+
+	assert.Error(t, ValidatePins(&Pins{Titles: []string{"("}}))
+}
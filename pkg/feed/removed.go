@@ -0,0 +1,50 @@
+package feed
+
+import (
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	// RemovedWarn only logs feeds that are in the database but not in the config
+	RemovedWarn = "warn"
+	// RemovedGrace purges removed feeds after a grace period
+	RemovedGrace = "grace"
+	// RemovedPurge purges removed feeds at startup
+	RemovedPurge = "purge"
+
+	DefaultRemovedGraceDays = 30
+)
+
+// PolicyName returns the configured policy, defaulting to "warn"
+func (r *RemovedFeeds) PolicyName() string {
+	if r == nil || r.Policy == "" {
+		return RemovedWarn
+	}
+	return r.Policy
+}
+
+// GracePeriod returns how long to keep data of removed feeds with the "grace" policy
+func (r *RemovedFeeds) GracePeriod() time.Duration {
+	days := DefaultRemovedGraceDays
+	if r != nil && r.GraceDays > 0 {
+		days = r.GraceDays
+	}
+	return time.Duration(days) * 24 * time.Hour
+}
+
+// ValidateRemovedFeeds checks the removed feeds policy
+func ValidateRemovedFeeds(r *RemovedFeeds) error {
+	switch r.Policy {
+	case "", RemovedWarn, RemovedGrace, RemovedPurge:
+	default:
+		return errors.Errorf("unsupported policy %q (must be %q, %q or %q)", r.Policy, RemovedWarn, RemovedGrace, RemovedPurge)
+	}
+
+	if r.GraceDays < 0 {
+		return errors.New("grace_days can't be negative")
+	}
+
+	return nil
+}
@@ -0,0 +1,59 @@
+package feed
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+var renditionNamePattern = regexp.MustCompile(`^[A-Za-z0-9_]+$`)
+
+// RenditionConfig derives the configuration of a rendition's feed.
+// The rendition is published under its own ID, so its XML and media files don't clash with the main feed,
+// while episodes are still read from the database under the main feed ID.
+func (c *Config) RenditionConfig(rendition *Rendition) *Config {
+	cfg := *c
+	cfg.ID = fmt.Sprintf("%s-%s", c.ID, rendition.Name)
+	cfg.Rendition = rendition.Name
+	cfg.TranscodeProfile = rendition.TranscodeProfile
+	cfg.Renditions = nil
+	return &cfg
+}
+
+// RenditionConfigs returns configurations of all renditions of the feed
+func (c *Config) RenditionConfigs() []*Config {
+	configs := make([]*Config, 0, len(c.Renditions))
+	for _, rendition := range c.Renditions {
+		configs = append(configs, c.RenditionConfig(rendition))
+	}
+	return configs
+}
+
+// SourceID returns the ID of the feed episodes are stored under in the database.
+// This is the main feed ID for renditions and ID otherwise.
+func (c *Config) SourceID() string {
+	if c.Rendition == "" {
+		return c.ID
+	}
+	return strings.TrimSuffix(c.ID, "-"+c.Rendition)
+}
+
+// FindRendition looks up a rendition by name
+func (c *Config) FindRendition(name string) *Rendition {
+	for _, rendition := range c.Renditions {
+		if rendition.Name == name {
+			return rendition
+		}
+	}
+	return nil
+}
+
+// ValidateRenditionName makes sure the rendition name can be used in feed IDs and file paths
+func ValidateRenditionName(name string) error {
+	if !renditionNamePattern.MatchString(name) {
+		return errors.Errorf("rendition name %q must contain only letters, numbers and underscores", name)
+	}
+	return nil
+}
@@ -0,0 +1,47 @@
+package feed
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/mxpv/podsync/pkg/model"
+)
+
+func TestRenditionConfig(t *testing.T) {
+	profile := &TranscodeProfile{AudioCodec: "opus"}
+	cfg := &Config{
+		ID:     "news",
+		Format: model.FormatVideo,
+		Renditions: []*Rendition{
+			{Name: "audio", TranscodeProfile: profile},
+		},
+	}
+
+	rendition := cfg.FindRendition("audio")
+	require.NotNil(t, rendition)
+	assert.Nil(t, cfg.FindRendition("missing"))
+
+	derived := cfg.RenditionConfig(rendition)
+	assert.Equal(t, "news-audio", derived.ID)
+	assert.Equal(t, "audio", derived.Rendition)
+	assert.Equal(t, profile, derived.TranscodeProfile)
+	assert.Empty(t, derived.Renditions)
+	assert.Equal(t, "news", derived.SourceID())
+	assert.Equal(t, "news", cfg.SourceID())
+
+	// Main config is left intact
+	assert.Equal(t, "news", cfg.ID)
+	assert.Len(t, cfg.RenditionConfigs(), 1)
+
+	episode := &model.Episode{ID: "123"}
+	assert.Equal(t, "123.mp4", EpisodeName(cfg, episode))
+	assert.Equal(t, "123.opus", EpisodeName(derived, episode))
+}
+
+func TestValidateRenditionName(t *testing.T) {
+	assert.NoError(t, ValidateRenditionName("audio_64k"))
+	assert.Error(t, ValidateRenditionName(""))
+	assert.Error(t, ValidateRenditionName("../audio"))
+}
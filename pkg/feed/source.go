@@ -0,0 +1,76 @@
+package feed
+
+import (
+	"github.com/hashicorp/go-multierror"
+	"github.com/pkg/errors"
+)
+
+// Source is one of the URLs a merged feed combines episodes from.
+// Sources may belong to different providers.
+type Source struct {
+	// URL of the channel, playlist or user
+	URL string `toml:"url"`
+	// PageSize overrides the page size of the feed for this source
+	PageSize int `toml:"page_size"`
+	// Filters episodes of this source have to match in addition to the filters of the feed
+	Filters Filters `toml:"filters"`
+}
+
+// IsMerged returns true if the feed combines episodes of several sources
+func (c *Config) IsMerged() bool {
+	return len(c.Sources) > 0
+}
+
+// SourceConfig derives the configuration used to query a source of a merged feed.
+// Episodes of all sources are stored under the ID of the merged feed.
+func (c *Config) SourceConfig(source *Source) *Config {
+	cfg := *c
+	cfg.URL = source.URL
+	if source.PageSize != 0 {
+		cfg.PageSize = source.PageSize
+	}
+	cfg.Sources = nil
+	return &cfg
+}
+
+// FindSource looks up a source of a merged feed by URL
+func (c *Config) FindSource(url string) *Source {
+	for _, source := range c.Sources {
+		if source.URL == url {
+			return source
+		}
+	}
+	return nil
+}
+
+// ValidateSources checks that a feed has either a URL or a list of unique sources
+func ValidateSources(url string, sources []*Source) error {
+	if url != "" && len(sources) > 0 {
+		return errors.New("url and sources can't be combined")
+	}
+
+	var (
+		result *multierror.Error
+		seen   = make(map[string]struct{}, len(sources))
+	)
+
+	for i, source := range sources {
+		if source.URL == "" {
+			result = multierror.Append(result, errors.Errorf("source %d has no url", i+1))
+			continue
+		}
+		if _, ok := seen[source.URL]; ok {
+			result = multierror.Append(result, errors.Errorf("duplicate source %q", source.URL))
+		}
+		seen[source.URL] = struct{}{}
+
+		if source.PageSize < 0 {
+			result = multierror.Append(result, errors.Errorf("page_size of source %q can't be negative", source.URL))
+		}
+		if err := source.Filters.Compile(); err != nil {
+			result = multierror.Append(result, errors.Wrapf(err, "invalid filters.expr of source %q", source.URL))
+		}
+	}
+
+	return result.ErrorOrNil()
+}
@@ -0,0 +1,43 @@
+package feed
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSourceConfig(t *testing.T) {
+	cfg := &Config{
+		ID:       "bundle",
+		PageSize: 50,
+		Sources: []*Source{
+			{URL: "https://youtube.com/channel/a", PageSize: 10},
+			{URL: "https://soundcloud.com/b/sets/c"},
+		},
+	}
+	assert.True(t, cfg.IsMerged())
+
+	source := cfg.FindSource("https://youtube.com/channel/a")
+	require.NotNil(t, source)
+	assert.Nil(t, cfg.FindSource("https://vimeo.com/d"))
+
+	derived := cfg.SourceConfig(source)
+	assert.Equal(t, "bundle", derived.ID)
+	assert.Equal(t, "https://youtube.com/channel/a", derived.URL)
+	assert.Equal(t, 10, derived.PageSize)
+	assert.False(t, derived.IsMerged())
+
+	assert.Equal(t, 50, cfg.SourceConfig(cfg.Sources[1]).PageSize)
+	assert.Empty(t, cfg.URL)
+}
+
+func TestValidateSources(t *testing.T) {
+	assert.NoError(t, ValidateSources("https://youtube.com/channel/a", nil))
+	assert.NoError(t, ValidateSources("", []*Source{{URL: "https://youtube.com/channel/a"}, {URL: "https://vimeo.com/b"}}))
+
+	assert.Error(t, ValidateSources("https://youtube.com/channel/a", []*Source{{URL: "https://vimeo.com/b"}}))
+	assert.Error(t, ValidateSources("", []*Source{{}}))
+	assert.Error(t, ValidateSources("", []*Source{{URL: "https://vimeo.com/b"}, {URL: "https://vimeo.com/b"}}))
+	assert.Error(t, ValidateSources("", []*Source{{URL: "https://vimeo.com/b", Filters: Filters{Expr: "title ~"}}}))
+}
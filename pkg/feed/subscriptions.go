@@ -0,0 +1,146 @@
+package feed
+
+import (
+	"bytes"
+	"encoding/csv"
+	"io"
+	"net/url"
+	"strings"
+
+	"github.com/gilliek/go-opml/opml"
+	"github.com/pkg/errors"
+)
+
+// Subscription is a channel or playlist listed in a subscriptions export
+type Subscription struct {
+	Title string `json:"title"`
+	URL   string `json:"url"`
+}
+
+// ReadSubscriptions parses a YouTube subscriptions export (Google Takeout CSV) or an OPML file
+func ReadSubscriptions(r io.Reader) ([]*Subscription, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+
+	data = bytes.TrimSpace(bytes.TrimPrefix(data, []byte("\xef\xbb\xbf")))
+	if bytes.HasPrefix(data, []byte("<")) {
+		return parseOPMLSubscriptions(data)
+	}
+
+	return parseTakeoutSubscriptions(data)
+}
+
+// parseTakeoutSubscriptions reads subscriptions.csv with "Channel Id", "Channel Url" and "Channel Title" columns
+func parseTakeoutSubscriptions(data []byte) ([]*Subscription, error) {
+	reader := csv.NewReader(bytes.NewReader(data))
+	reader.FieldsPerRecord = -1
+
+	records, err := reader.ReadAll()
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to parse CSV")
+	}
+	if len(records) == 0 {
+		return nil, nil
+	}
+
+	columns := map[string]int{}
+	for i, name := range records[0] {
+		columns[strings.ToLower(strings.TrimSpace(name))] = i
+	}
+
+	idColumn, hasID := columns["channel id"]
+	urlColumn, hasURL := columns["channel url"]
+	titleColumn, hasTitle := columns["channel title"]
+	if !hasID && !hasURL {
+		return nil, errors.New("unsupported CSV file, expected Channel Id or Channel Url column")
+	}
+
+	field := func(record []string, column int, ok bool) string {
+		if !ok || column >= len(record) {
+			return ""
+		}
+		return strings.TrimSpace(record[column])
+	}
+
+	var list []*Subscription
+	for _, record := range records[1:] {
+		sub := &Subscription{
+			Title: field(record, titleColumn, hasTitle),
+			URL:   field(record, urlColumn, hasURL),
+		}
+
+		if sub.URL == "" {
+			id := field(record, idColumn, hasID)
+			if id == "" {
+				continue
+			}
+			sub.URL = "https://www.youtube.com/channel/" + id
+		}
+
+		list = append(list, sub)
+	}
+
+	return list, nil
+}
+
+func parseOPMLSubscriptions(data []byte) ([]*Subscription, error) {
+	doc, err := opml.NewOPML(data)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to parse OPML")
+	}
+
+	var (
+		list []*Subscription
+		walk func(outlines []opml.Outline)
+	)
+
+	walk = func(outlines []opml.Outline) {
+		for _, outline := range outlines {
+			title := outline.Title
+			if title == "" {
+				title = outline.Text
+			}
+
+			// YouTube RSS feeds are converted back to channel and playlist links
+			link := youtubeFeedLink(outline.XMLURL)
+			if link == "" {
+				link = outline.HTMLURL
+			}
+			if link == "" {
+				link = outline.XMLURL
+			}
+
+			if link != "" {
+				list = append(list, &Subscription{Title: title, URL: link})
+			}
+
+			// Folders group outlines
+			walk(outline.Outlines)
+		}
+	}
+
+	walk(doc.Outlines())
+	return list, nil
+}
+
+// youtubeFeedLink converts https://www.youtube.com/feeds/videos.xml?channel_id=... URLs to page links
+func youtubeFeedLink(link string) string {
+	parsed, err := url.Parse(link)
+	if err != nil || !strings.HasSuffix(parsed.Host, "youtube.com") || parsed.Path != "/feeds/videos.xml" {
+		return ""
+	}
+
+	query := parsed.Query()
+	switch {
+	case query.Get("channel_id") != "":
+		return "https://www.youtube.com/channel/" + query.Get("channel_id")
+	case query.Get("playlist_id") != "":
+		return "https://www.youtube.com/playlist?list=" + query.Get("playlist_id")
+	case query.Get("user") != "":
+		return "https://www.youtube.com/user/" + query.Get("user")
+	default:
+		return ""
+	}
+}
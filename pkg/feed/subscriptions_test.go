@@ -0,0 +1,48 @@
+package feed
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReadSubscriptions_Takeout(t *testing.T) {
+	const data = "\xef\xbb\xbfChannel Id,Channel Url,Channel Title\n" +
+		"UCxC5Ls6DwqV0e-CYcAKkExQ,http://www.youtube.com/channel/UCxC5Ls6DwqV0e-CYcAKkExQ,\"Level1Techs, news\"\n" +
+		"UC5XPnUk8Vvv_pWslhwom6Og,,Other\n" +
+		"\n"
+
+	list, err := ReadSubscriptions(strings.NewReader(data))
+	require.NoError(t, err)
+	assert.Equal(t, []*Subscription{
+		{Title: "Level1Techs, news", URL: "http://www.youtube.com/channel/UCxC5Ls6DwqV0e-CYcAKkExQ"},
+		{Title: "Other", URL: "https://www.youtube.com/channel/UC5XPnUk8Vvv_pWslhwom6Og"},
+	}, list)
+
+	_, err = ReadSubscriptions(strings.NewReader("a,b\n1,2\n"))
+	assert.Error(t, err)
+}
+
+func TestReadSubscriptions_OPML(t *testing.T) {
+	const data = `<?xml version="1.0" encoding="UTF-8"?>
+<opml version="1.1">
+  <head><title>Subscriptions</title></head>
+  <body>
+    <outline text="YouTube Subscriptions" title="YouTube Subscriptions">
+      <outline text="Level1Techs" title="Level1Techs" type="rss" xmlUrl="https://www.youtube.com/feeds/videos.xml?channel_id=UCxC5Ls6DwqV0e-CYcAKkExQ"/>
+      <outline text="Playlist" type="rss" xmlUrl="https://www.youtube.com/feeds/videos.xml?playlist_id=PLCB9F975ECF01953C"/>
+    </outline>
+    <outline text="Sets" htmlUrl="https://soundcloud.com/user/sets/playlist" xmlUrl="https://feeds.soundcloud.com/users/1/sounds.rss"/>
+  </body>
+</opml>`
+
+	list, err := ReadSubscriptions(strings.NewReader(data))
+	require.NoError(t, err)
+	assert.Equal(t, []*Subscription{
+		{Title: "Level1Techs", URL: "https://www.youtube.com/channel/UCxC5Ls6DwqV0e-CYcAKkExQ"},
+		{Title: "Playlist", URL: "https://www.youtube.com/playlist?list=PLCB9F975ECF01953C"},
+		{Title: "Sets", URL: "https://soundcloud.com/user/sets/playlist"},
+	}, list)
+}
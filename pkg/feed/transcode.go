@@ -0,0 +1,106 @@
+package feed
+
+import (
+	"github.com/pkg/errors"
+)
+
+const (
+	minTranscodeSpeed = 0.5
+	maxTranscodeSpeed = 4.0
+)
+
+var (
+	transcodeAudioCodecs = map[string]string{
+		"":       "m4a",
+		"aac":    "m4a",
+		"opus":   "opus",
+		"mp3":    "mp3",
+		"vorbis": "ogg",
+		"flac":   "flac",
+		"copy":   "m4a",
+	}
+	transcodeVideoCodecs = map[string]struct{}{
+		"h264": {},
+		"h265": {},
+		"copy": {},
+	}
+)
+
+// IsVideo returns true if the profile keeps a video track.
+func (p *TranscodeProfile) IsVideo() bool {
+	return p.VideoCodec != ""
+}
+
+// FileExtension returns the extension of files produced by this profile.
+func (p *TranscodeProfile) FileExtension() string {
+	if ext := normalizeExtension(p.Extension); ext != "" {
+		return ext
+	}
+
+	if p.IsVideo() {
+		return "mp4"
+	}
+
+	if ext, ok := transcodeAudioCodecs[p.AudioCodec]; ok {
+		return ext
+	}
+
+	return "m4a"
+}
+
+// CheckAudioSource returns an error if the profile copies an audio track in a codec
+// the output container can't hold. Audio-only copies default to m4a, which expects AAC.
+func (p *TranscodeProfile) CheckAudioSource(codec string) error {
+	if p.AudioCodec != "copy" || p.IsVideo() || normalizeExtension(p.Extension) != "" {
+		return nil
+	}
+
+	if codec != "aac" {
+		return errors.Errorf("audio_codec = \"copy\" can't store %q audio in m4a files, set audio_codec or extension", codec)
+	}
+
+	return nil
+}
+
+// ValidateTranscodeProfile checks that the profile can be turned into a valid ffmpeg invocation.
+func ValidateTranscodeProfile(p *TranscodeProfile) error {
+	if _, ok := transcodeAudioCodecs[p.AudioCodec]; !ok {
+		return errors.Errorf("unsupported audio codec %q", p.AudioCodec)
+	}
+
+	if p.IsVideo() {
+		if _, ok := transcodeVideoCodecs[p.VideoCodec]; !ok {
+			return errors.Errorf("unsupported video codec %q", p.VideoCodec)
+		}
+	}
+
+	if p.Channels < 0 || p.Channels > 2 {
+		return errors.Errorf("channels must be 0, 1 or 2 (got %d)", p.Channels)
+	}
+
+	if p.Speed != 0 && (p.Speed < minTranscodeSpeed || p.Speed > maxTranscodeSpeed) {
+		return errors.Errorf("speed must be between %.1f and %.1f (got %.2f)", minTranscodeSpeed, maxTranscodeSpeed, p.Speed)
+	}
+
+	if p.MaxHeight < 0 {
+		return errors.Errorf("max_height can't be negative (got %d)", p.MaxHeight)
+	}
+
+	filtersAudio := p.Loudnorm || p.Speed != 0 || p.Channels != 0
+	if p.AudioCodec == "copy" && filtersAudio {
+		return errors.New("audio_codec = \"copy\" can't be combined with loudnorm, speed or channels")
+	}
+
+	filtersVideo := p.Speed != 0 || p.MaxHeight != 0
+	if p.VideoCodec == "copy" && filtersVideo {
+		return errors.New("video_codec = \"copy\" can't be combined with speed or max_height")
+	}
+
+	if p.Extension != "" {
+		if err := ValidateCustomExtension(p.Extension); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
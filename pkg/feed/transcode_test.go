@@ -0,0 +1,37 @@
+package feed
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTranscodeProfileExtension(t *testing.T) {
+	assert.Equal(t, "m4a", (&TranscodeProfile{}).FileExtension())
+	assert.Equal(t, "opus", (&TranscodeProfile{AudioCodec: "opus"}).FileExtension())
+	assert.Equal(t, "mp3", (&TranscodeProfile{AudioCodec: "mp3"}).FileExtension())
+	assert.Equal(t, "mp4", (&TranscodeProfile{VideoCodec: "h264", AudioCodec: "opus"}).FileExtension())
+	assert.Equal(t, "mkv", (&TranscodeProfile{VideoCodec: "h265", Extension: ".MKV"}).FileExtension())
+}
+
+func TestValidateTranscodeProfile(t *testing.T) {
+	assert.NoError(t, ValidateTranscodeProfile(&TranscodeProfile{AudioCodec: "opus", AudioBitrate: "32k", Channels: 1, Loudnorm: true, Speed: 1.5}))
+	assert.NoError(t, ValidateTranscodeProfile(&TranscodeProfile{VideoCodec: "h264", MaxHeight: 720}))
+
+	assert.Error(t, ValidateTranscodeProfile(&TranscodeProfile{AudioCodec: "wav"}))
+	assert.Error(t, ValidateTranscodeProfile(&TranscodeProfile{VideoCodec: "vp9"}))
+	assert.Error(t, ValidateTranscodeProfile(&TranscodeProfile{Channels: 6}))
+	assert.Error(t, ValidateTranscodeProfile(&TranscodeProfile{Speed: 10}))
+	assert.Error(t, ValidateTranscodeProfile(&TranscodeProfile{AudioCodec: "copy", Loudnorm: true}))
+	assert.Error(t, ValidateTranscodeProfile(&TranscodeProfile{VideoCodec: "copy", MaxHeight: 480}))
+	assert.Error(t, ValidateTranscodeProfile(&TranscodeProfile{Extension: "../mp3"}))
+}
+
+func TestCheckAudioSource(t *testing.T) {
+	assert.NoError(t, (&TranscodeProfile{AudioCodec: "copy"}).CheckAudioSource("aac"))
+	assert.NoError(t, (&TranscodeProfile{AudioCodec: "copy", Extension: "webm"}).CheckAudioSource("opus"))
+	assert.NoError(t, (&TranscodeProfile{AudioCodec: "copy", VideoCodec: "copy"}).CheckAudioSource("opus"))
+	assert.NoError(t, (&TranscodeProfile{AudioCodec: "mp3"}).CheckAudioSource("opus"))
+
+	assert.Error(t, (&TranscodeProfile{AudioCodec: "copy"}).CheckAudioSource("opus"))
+}
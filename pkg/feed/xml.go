@@ -3,6 +3,7 @@ package feed
 import (
 	"context"
 	"fmt"
+	"path/filepath"
 	"regexp"
 	"sort"
 	"strconv"
@@ -29,6 +30,13 @@ var (
 	multiWhitespacePattern             = regexp.MustCompile(`\s+`)
 )
 
+// extraEnclosureTypes maps extensions unknown to itunes.EnclosureType to their MIME types
+var extraEnclosureTypes = map[string]string{
+	"opus": "audio/ogg",
+	"ogg":  "audio/ogg",
+	"flac": "audio/flac",
+}
+
 var filenameTemplateAllowedTokens = map[string]struct{}{
 	"id":       {},
 	"title":    {},
@@ -83,6 +91,10 @@ func Build(_ctx context.Context, feed *model.Feed, cfg *Config, hostname string)
 		feedLink = cfg.Custom.Link
 	}
 
+	if cfg.Rendition != "" {
+		title = fmt.Sprintf("%s (%s)", title, cfg.Rendition)
+	}
+
 	p := itunes.New(title, feedLink, description, &feed.PubDate, &now)
 	p.Generator = podsyncGenerator
 	p.AddSubTitle(title)
@@ -100,10 +112,10 @@ func Build(_ctx context.Context, feed *model.Feed, cfg *Config, hostname string)
 		}
 	}
 
-	if cfg.Custom.CoverArt != "" {
-		p.AddImage(cfg.Custom.CoverArt)
+	if cfg.Artwork.Enabled && feed.Artwork != "" {
+		p.AddImage(artworkURL(hostname, feed.Artwork))
 	} else {
-		p.AddImage(feed.CoverArt)
+		p.AddImage(CoverArtSource(cfg, feed))
 	}
 
 	if cfg.Custom.Category != "" {
@@ -137,6 +149,16 @@ func Build(_ctx context.Context, feed *model.Feed, cfg *Config, hostname string)
 			continue
 		}
 
+		size := episode.Size
+		if cfg.Rendition != "" {
+			renditionSize, ok := episode.Renditions[cfg.Rendition]
+			if !ok {
+				// Episode was downloaded before the rendition was configured
+				continue
+			}
+			size = renditionSize
+		}
+
 		item := itunes.Item{
 			GUID:        episode.ID,
 			Link:        episode.VideoURL,
@@ -149,7 +171,11 @@ func Build(_ctx context.Context, feed *model.Feed, cfg *Config, hostname string)
 
 		item.AddPubDate(&episode.PubDate)
 		item.AddSummary(episode.Description)
-		item.AddImage(episode.Thumbnail)
+		if cfg.Artwork.Enabled && episode.Artwork != "" {
+			item.AddImage(artworkURL(hostname, episode.Artwork))
+		} else {
+			item.AddImage(episode.Thumbnail)
+		}
 		item.AddDuration(episode.Duration)
 
 		enclosureType := itunes.MP4
@@ -160,12 +186,32 @@ func Build(_ctx context.Context, feed *model.Feed, cfg *Config, hostname string)
 			enclosureType = EnclosureFromExtension(cfg)
 		}
 
+		// Transcoded episodes are typed by the profile's output container
+		if cfg.TranscodeProfile != nil {
+			enclosureType = enclosureFromExt(cfg.TranscodeProfile.FileExtension())
+		}
+
+		// Process hooks may have produced a different container
+		if processed := processedExtension(cfg, episode); processed != "" {
+			enclosureType = enclosureFromExt(processed)
+		}
+
+		// The iTunes library knows only a handful of MIME types, so use a placeholder
+		// for the others and overwrite the formatted type once the item is added.
+		mimeType := ""
+		if enclosureType < 0 {
+			if mime, ok := extraEnclosureTypes[fileExtension(cfg, episode)]; ok {
+				enclosureType = itunes.M4A
+				mimeType = mime
+			}
+		}
+
 		var (
 			episodeName = EpisodeName(cfg, episode)
 			downloadURL = fmt.Sprintf("%s/%s/%s", strings.TrimRight(hostname, "/"), cfg.ID, episodeName)
 		)
 
-		item.AddEnclosure(downloadURL, enclosureType, episode.Size)
+		item.AddEnclosure(downloadURL, enclosureType, size)
 
 		// p.AddItem requires description to be not empty, use workaround
 		if item.Description == "" {
@@ -181,22 +227,33 @@ func Build(_ctx context.Context, feed *model.Feed, cfg *Config, hostname string)
 		if _, err := p.AddItem(item); err != nil {
 			return nil, errors.Wrapf(err, "failed to add item to podcast (id %q)", episode.ID)
 		}
+
+		if mimeType != "" {
+			p.Items[len(p.Items)-1].Enclosure.TypeFormatted = mimeType
+		}
 	}
 
 	return &p, nil
 }
 
 func EpisodeName(feedConfig *Config, episode *model.Episode) string {
-	return fmt.Sprintf("%s.%s", EpisodeBaseName(feedConfig, episode), episodeExtension(feedConfig))
+	return fmt.Sprintf("%s.%s", EpisodeBaseName(feedConfig, episode), fileExtension(feedConfig, episode))
 }
 
 func LegacyEpisodeName(feedConfig *Config, episode *model.Episode) string {
 	return fmt.Sprintf("%s.%s", episode.ID, episodeExtension(feedConfig))
 }
 
+// SourceEpisodeName returns the file name of an episode as produced by youtube-dl, before any transcoding.
+func SourceEpisodeName(feedConfig *Config, episode *model.Episode) string {
+	return fmt.Sprintf("%s.%s", EpisodeBaseName(feedConfig, episode), sourceExtension(feedConfig))
+}
+
 func EnclosureFromExtension(feedConfig *Config) itunes.EnclosureType {
-	ext := normalizeExtension(feedConfig.CustomFormat.Extension)
+	return enclosureFromExt(normalizeExtension(feedConfig.CustomFormat.Extension))
+}
 
+func enclosureFromExt(ext string) itunes.EnclosureType {
 	switch ext {
 	case "m4a":
 		return itunes.M4A
@@ -287,7 +344,50 @@ func ValidateCustomExtension(extension string) error {
 	return nil
 }
 
+// fileExtension returns the extension of the episode file, which is the one of the feed format
+// unless process hooks produced a different file
+func fileExtension(feedConfig *Config, episode *model.Episode) string {
+	if processed := processedExtension(feedConfig, episode); processed != "" {
+		return processed
+	}
+
+	return episodeExtension(feedConfig)
+}
+
+// processedExtension returns the extension recorded by process hooks.
+// Renditions are transcoded from the downloaded file, so keep their own extension.
+func processedExtension(feedConfig *Config, episode *model.Episode) string {
+	if feedConfig.Rendition != "" {
+		return ""
+	}
+
+	return episode.Extension
+}
+
+// FileExtension returns the extension of a processed episode file to record in the episode,
+// or an empty string when it's the extension of the feed format
+func FileExtension(feedConfig *Config, path string) (string, error) {
+	ext := normalizeExtension(filepath.Ext(path))
+	if !validExtensionPattern.MatchString(ext) {
+		return "", errors.Errorf("invalid extension of file %q", filepath.Base(path))
+	}
+
+	if ext == episodeExtension(feedConfig) {
+		return "", nil
+	}
+
+	return ext, nil
+}
+
 func episodeExtension(feedConfig *Config) string {
+	if feedConfig.TranscodeProfile != nil {
+		return feedConfig.TranscodeProfile.FileExtension()
+	}
+
+	return sourceExtension(feedConfig)
+}
+
+func sourceExtension(feedConfig *Config) string {
 	defaultExt := "mp4"
 	if feedConfig.Format == model.FormatAudio {
 		defaultExt = "mp3"
@@ -119,3 +119,155 @@ func TestEpisodeNameWithCustomExtensionNormalization(t *testing.T) {
 	cfg.CustomFormat.Extension = "../bad"
 	assert.Equal(t, "abc123.mp4", EpisodeName(cfg, episode))
 }
+
+func TestBuildXMLWithTranscodeProfile(t *testing.T) {
+	feed := model.Feed{
+		Format: model.FormatVideo,
+		Episodes: []*model.Episode{
+			{
+				ID:          "1",
+				Status:      model.EpisodeDownloaded,
+				Title:       "title",
+				Description: "description",
+			},
+		},
+	}
+
+	cfg := Config{
+		ID:               "test",
+		Format:           model.FormatVideo,
+		TranscodeProfile: &TranscodeProfile{AudioCodec: "opus", Channels: 1},
+	}
+
+	out, err := Build(context.Background(), &feed, &cfg, "http://localhost/")
+	require.NoError(t, err)
+	require.Len(t, out.Items, 1)
+	require.NotNil(t, out.Items[0].Enclosure)
+	assert.Equal(t, "http://localhost/test/1.opus", out.Items[0].Enclosure.URL)
+	assert.Equal(t, "audio/ogg", out.Items[0].Enclosure.TypeFormatted)
+
+	// youtube-dl still produces the source format
+	assert.Equal(t, "1.mp4", SourceEpisodeName(&cfg, feed.Episodes[0]))
+}
+
+func TestBuildXMLWithProcessedExtension(t *testing.T) {
+	feed := model.Feed{
+		Format: model.FormatVideo,
+		Episodes: []*model.Episode{
+			{
+				ID:          "1",
+				Status:      model.EpisodeDownloaded,
+				Title:       "processed",
+				Description: "description",
+				Extension:   "flac",
+			},
+		},
+	}
+
+	cfg := &Config{ID: "test", Format: model.FormatVideo}
+
+	out, err := Build(context.Background(), &feed, cfg, "http://localhost/")
+	require.NoError(t, err)
+	require.Len(t, out.Items, 1)
+	assert.Equal(t, "http://localhost/test/1.flac", out.Items[0].Enclosure.URL)
+	assert.Equal(t, "audio/flac", out.Items[0].Enclosure.TypeFormatted)
+
+	// Renditions are transcoded from the downloaded file and keep their extension
+	cfg.Renditions = []*Rendition{{Name: "audio", TranscodeProfile: &TranscodeProfile{AudioCodec: "aac"}}}
+	assert.Equal(t, "1.m4a", EpisodeName(cfg.RenditionConfig(cfg.Renditions[0]), feed.Episodes[0]))
+}
+
+func TestFileExtension(t *testing.T) {
+	cfg := &Config{ID: "test", Format: model.FormatAudio}
+
+	ext, err := FileExtension(cfg, "/tmp/out/1.MP3")
+	require.NoError(t, err)
+	assert.Equal(t, "", ext)
+
+	ext, err = FileExtension(cfg, "/tmp/out/1.opus")
+	require.NoError(t, err)
+	assert.Equal(t, "opus", ext)
+
+	_, err = FileExtension(cfg, "/tmp/out/noext")
+	assert.Error(t, err)
+}
+
+func TestBuildXMLForRendition(t *testing.T) {
+	feed := model.Feed{
+		Title:  "News",
+		Format: model.FormatVideo,
+		Episodes: []*model.Episode{
+			{
+				ID:          "1",
+				Status:      model.EpisodeDownloaded,
+				Title:       "with rendition",
+				Description: "description",
+				Size:        1000,
+				Renditions:  map[string]int64{"audio": 100},
+			},
+			{
+				ID:          "2",
+				Status:      model.EpisodeDownloaded,
+				Title:       "downloaded before rendition was added",
+				Description: "description",
+				Size:        2000,
+			},
+		},
+	}
+
+	cfg := &Config{
+		ID:     "news",
+		Format: model.FormatVideo,
+		Renditions: []*Rendition{
+			{Name: "audio", TranscodeProfile: &TranscodeProfile{AudioCodec: "aac"}},
+		},
+	}
+
+	out, err := Build(context.Background(), &feed, cfg.RenditionConfig(cfg.Renditions[0]), "http://localhost/")
+	require.NoError(t, err)
+	assert.Equal(t, "News (audio)", out.Title)
+	require.Len(t, out.Items, 1)
+	assert.Equal(t, "http://localhost/news-audio/1.m4a", out.Items[0].Enclosure.URL)
+	assert.EqualValues(t, 100, out.Items[0].Enclosure.Length)
+	assert.Equal(t, itunes.M4A, out.Items[0].Enclosure.Type)
+}
+
+func TestBuildXMLWithSelfHostedArtwork(t *testing.T) {
+	feed := model.Feed{
+		Title:    "News",
+		CoverArt: "https://yt3.ggpht.com/cover",
+		Artwork:  "news/artwork/cover-0123456789ab.jpg",
+		Episodes: []*model.Episode{
+			{
+				ID:          "1",
+				Status:      model.EpisodeDownloaded,
+				Title:       "hosted",
+				Description: "description",
+				Thumbnail:   "https://i.ytimg.com/vi/1/maxresdefault.webp",
+				Artwork:     "news/artwork/1.jpg",
+			},
+			{
+				ID:          "2",
+				Status:      model.EpisodeDownloaded,
+				Title:       "not hosted yet",
+				Description: "description",
+				Thumbnail:   "https://i.ytimg.com/vi/2/maxresdefault.webp",
+			},
+		},
+	}
+
+	cfg := &Config{ID: "news", Artwork: Artwork{Enabled: true}}
+
+	out, err := Build(context.Background(), &feed, cfg, "http://localhost/")
+	require.NoError(t, err)
+	assert.Equal(t, "http://localhost/news/artwork/cover-0123456789ab.jpg", out.IImage.HREF)
+	require.Len(t, out.Items, 2)
+	assert.Equal(t, "http://localhost/news/artwork/1.jpg", out.Items[0].IImage.HREF)
+	assert.Equal(t, "https://i.ytimg.com/vi/2/maxresdefault.webp", out.Items[1].IImage.HREF)
+
+	// Remote URLs are used once self-hosting is turned off
+	cfg.Artwork.Enabled = false
+	out, err = Build(context.Background(), &feed, cfg, "http://localhost/")
+	require.NoError(t, err)
+	assert.Equal(t, "https://yt3.ggpht.com/cover", out.IImage.HREF)
+}
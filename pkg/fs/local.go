@@ -7,6 +7,7 @@ import (
 	"net/http"
 	"os"
 	"path/filepath"
+	"sort"
 
 	"github.com/pkg/errors"
 	log "github.com/sirupsen/logrus"
@@ -17,6 +18,8 @@ type LocalConfig struct {
 	DataDir string `toml:"data_dir"`
 }
 
+var _ Locator = (*Local)(nil)
+
 // Local implements local file storage
 type Local struct {
 	rootDir      string
@@ -54,6 +57,10 @@ func (l *Local) Open(name string) (http.File, error) {
 	return file, nil
 }
 
+func (l *Local) LocalPath(name string) (string, error) {
+	return filepath.Abs(filepath.Join(l.rootDir, name))
+}
+
 func (l *Local) Delete(_ctx context.Context, name string) error {
 	path := filepath.Join(l.rootDir, name)
 	if err := os.Remove(path); err != nil {
@@ -112,3 +119,49 @@ func (l *Local) Size(_ctx context.Context, name string) (int64, error) {
 
 	return stat.Size(), nil
 }
+
+func (l *Local) List(_ctx context.Context, dir string) ([]File, error) {
+	var (
+		root  = filepath.Join(l.rootDir, filepath.FromSlash(dir))
+		files []File
+	)
+
+	err := filepath.WalkDir(root, func(path string, entry os.DirEntry, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) && path == root {
+				return filepath.SkipDir
+			}
+			return err
+		}
+
+		if entry.IsDir() {
+			return nil
+		}
+
+		info, err := entry.Info()
+		if err != nil {
+			return err
+		}
+
+		name, err := filepath.Rel(l.rootDir, path)
+		if err != nil {
+			return err
+		}
+
+		files = append(files, File{
+			Name:    filepath.ToSlash(name),
+			Size:    info.Size(),
+			ModTime: info.ModTime(),
+		})
+		return nil
+	})
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to list %s", root)
+	}
+
+	sort.Slice(files, func(i, j int) bool {
+		return files[i].Name < files[j].Name
+	})
+
+	return files, nil
+}
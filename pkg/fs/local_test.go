@@ -145,3 +145,29 @@ func TestLocal_NoListing_Disabled(t *testing.T) {
 	assert.NoError(t, err)
 	file.Close()
 }
+
+func TestLocal_List(t *testing.T) {
+	stor, err := NewLocal(t.TempDir(), false, false)
+	assert.NoError(t, err)
+
+	for _, name := range []string{"1/a.mp3", "1/artwork/a.jpg", "2/b.mp3", "1.xml"} {
+		_, err := stor.Create(testCtx, name, bytes.NewBuffer([]byte{1, 2, 3}))
+		assert.NoError(t, err)
+	}
+
+	files, err := stor.List(testCtx, "1")
+	assert.NoError(t, err)
+	if assert.Len(t, files, 2) {
+		assert.Equal(t, "1/a.mp3", files[0].Name)
+		assert.EqualValues(t, 3, files[0].Size)
+		assert.Equal(t, "1/artwork/a.jpg", files[1].Name)
+	}
+
+	files, err = stor.List(testCtx, "")
+	assert.NoError(t, err)
+	assert.Len(t, files, 4)
+
+	files, err = stor.List(testCtx, "missing")
+	assert.NoError(t, err)
+	assert.Empty(t, files)
+}
@@ -7,9 +7,11 @@ import (
 	"net/http"
 	"os"
 	"path"
+	"strings"
 
 	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/credentials"
 	"github.com/aws/aws-sdk-go/aws/session"
 	"github.com/aws/aws-sdk-go/service/s3"
 	"github.com/aws/aws-sdk-go/service/s3/s3iface"
@@ -29,6 +31,10 @@ type S3Config struct {
 	EndpointURL string `toml:"endpoint_url"`
 	// Prefix is a prefix (subfolder) to use to build key names
 	Prefix string `toml:"prefix"`
+	// AccessKeyID and SecretAccessKey are optional static credentials.
+	// When empty, credentials are taken from the AWS environment (env variables, shared config, instance role).
+	AccessKeyID     string `toml:"access_key_id"`
+	SecretAccessKey string `toml:"secret_access_key"`
 }
 
 // S3 implements file storage for S3-compatible providers.
@@ -45,6 +51,9 @@ func NewS3(c S3Config) (*S3, error) {
 		WithRegion(c.Region).
 		WithLogger(s3logger{}).
 		WithLogLevel(aws.LogDebug)
+	if c.AccessKeyID != "" {
+		cfg = cfg.WithCredentials(credentials.NewStaticCredentials(c.AccessKeyID, c.SecretAccessKey, ""))
+	}
 	sess, err := session.NewSessionWithOptions(session.Options{Config: *cfg})
 	if err != nil {
 		return nil, errors.Wrap(err, "failed to initialize S3 session")
@@ -128,6 +137,38 @@ func (s *S3) Size(ctx context.Context, name string) (int64, error) {
 	return *resp.ContentLength, nil
 }
 
+func (s *S3) List(ctx context.Context, dir string) ([]File, error) {
+	prefix := s.buildKey(dir)
+	if prefix != "" {
+		prefix += "/"
+	}
+
+	var files []File
+	err := s.api.ListObjectsV2PagesWithContext(ctx, &s3.ListObjectsV2Input{
+		Bucket: &s.bucket,
+		Prefix: &prefix,
+	}, func(page *s3.ListObjectsV2Output, _ bool) bool {
+		for _, object := range page.Contents {
+			name := aws.StringValue(object.Key)
+			if s.prefix != "" {
+				name = strings.TrimPrefix(name, path.Clean(s.prefix)+"/")
+			}
+
+			files = append(files, File{
+				Name:    name,
+				Size:    aws.Int64Value(object.Size),
+				ModTime: aws.TimeValue(object.LastModified),
+			})
+		}
+		return true
+	})
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to list objects with prefix %q", prefix)
+	}
+
+	return files, nil
+}
+
 func (s *S3) buildKey(name string) string {
 	return path.Join(s.prefix, name)
 }
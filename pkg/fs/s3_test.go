@@ -4,6 +4,8 @@ import (
 	"bytes"
 	"io"
 	"os"
+	"sort"
+	"strings"
 	"testing"
 
 	"github.com/aws/aws-sdk-go/aws"
@@ -74,6 +76,31 @@ func TestS3_Delete(t *testing.T) {
 	assert.True(t, errors.Is(err, os.ErrNotExist))
 }
 
+func TestS3_List(t *testing.T) {
+	files := map[string][]byte{
+		"mock-prefix/1/a.mp3":          {1, 2, 3},
+		"mock-prefix/1/artwork/a.jpg":  {1},
+		"mock-prefix/10/b.mp3":         {1},
+		"mock-prefix/1.xml":            {1},
+		"another-prefix/1/ignored.mp3": {1},
+	}
+
+	stor, err := newMockS3(files, "mock-prefix")
+	assert.NoError(t, err)
+
+	list, err := stor.List(testCtx, "1")
+	assert.NoError(t, err)
+	if assert.Len(t, list, 2) {
+		assert.Equal(t, "1/a.mp3", list[0].Name)
+		assert.EqualValues(t, 3, list[0].Size)
+		assert.Equal(t, "1/artwork/a.jpg", list[1].Name)
+	}
+
+	list, err = stor.List(testCtx, "")
+	assert.NoError(t, err)
+	assert.Len(t, list, 4)
+}
+
 func TestS3_BuildKey(t *testing.T) {
 	files := make(map[string][]byte)
 
@@ -122,3 +149,24 @@ func (m *mockS3API) DeleteObjectWithContext(ctx aws.Context, input *s3.DeleteObj
 	}
 	return nil, awserr.New("NotFound", "", nil)
 }
+
+func (m *mockS3API) ListObjectsV2PagesWithContext(ctx aws.Context, input *s3.ListObjectsV2Input, fn func(*s3.ListObjectsV2Output, bool) bool, opts ...request.Option) error {
+	keys := make([]string, 0, len(m.files))
+	for key := range m.files {
+		if strings.HasPrefix(key, aws.StringValue(input.Prefix)) {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+
+	page := &s3.ListObjectsV2Output{}
+	for _, key := range keys {
+		page.Contents = append(page.Contents, &s3.Object{
+			Key:  aws.String(key),
+			Size: aws.Int64(int64(len(m.files[key]))),
+		})
+	}
+
+	fn(page, true)
+	return nil
+}
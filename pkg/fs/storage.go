@@ -4,6 +4,7 @@ import (
 	"context"
 	"io"
 	"net/http"
+	"time"
 )
 
 // Storage is a file system interface to host downloaded episodes and feeds.
@@ -19,6 +20,24 @@ type Storage interface {
 
 	// Size returns a storage object's size in bytes
 	Size(ctx context.Context, name string) (int64, error)
+
+	// List returns all files under the directory, including nested ones.
+	// Names are relative to the storage root and use forward slashes.
+	// An empty directory name lists the whole storage.
+	List(ctx context.Context, dir string) ([]File, error)
+}
+
+// Locator is implemented by storages keeping files on the local file system
+type Locator interface {
+	// LocalPath returns an absolute path of the file
+	LocalPath(name string) (string, error)
+}
+
+// File describes a file stored in the file system
+type File struct {
+	Name    string
+	Size    int64
+	ModTime time.Time
 }
 
 // Config is a configuration for the file storage backend
@@ -0,0 +1,57 @@
+package media
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+)
+
+// ConvertArtwork downloads an image (JPEG, PNG, WebP, etc) and converts it to a square JPEG of the given size.
+// Non-square images are center cropped.
+// The result is written to a new temp directory, which is removed when the returned file is closed.
+func (f *FFmpeg) ConvertArtwork(ctx context.Context, url string, size int) (r io.ReadCloser, err error) {
+	tmpDir, err := os.MkdirTemp("", "podsync-")
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to get temp dir for artwork")
+	}
+
+	defer func() {
+		if err != nil {
+			if err1 := os.RemoveAll(tmpDir); err1 != nil {
+				log.Errorf("could not remove temp dir: %v", err1)
+			}
+		}
+	}()
+
+	var (
+		input  = filepath.Join(tmpDir, "source")
+		output = filepath.Join(tmpDir, "artwork.jpg")
+	)
+
+	if err := downloadFile(ctx, url, input); err != nil {
+		return nil, errors.Wrapf(err, "failed to download artwork %q", url)
+	}
+
+	if logs, err := f.exec(ctx, buildArtworkArgs(input, output, size)...); err != nil {
+		log.Error(logs)
+		return nil, err
+	}
+
+	file, err := os.Open(output)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to open artwork")
+	}
+
+	return &tempFile{File: file, dir: tmpDir}, nil
+}
+
+func buildArtworkArgs(input string, output string, size int) []string {
+	return []string{"-hide_banner", "-nostdin", "-y", "-i", input,
+		"-vf", fmt.Sprintf("crop=min(iw\\,ih):min(iw\\,ih),scale=%d:%d", size, size),
+		"-frames:v", "1", "-q:v", "2", output}
+}
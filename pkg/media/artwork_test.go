@@ -0,0 +1,13 @@
+package media
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBuildArtworkArgs(t *testing.T) {
+	args := buildArtworkArgs("/tmp/source", "/tmp/artwork.jpg", 1400)
+	assert.Equal(t, []string{"-hide_banner", "-nostdin", "-y", "-i", "/tmp/source",
+		"-vf", "crop=min(iw\\,ih):min(iw\\,ih),scale=1400:1400", "-frames:v", "1", "-q:v", "2", "/tmp/artwork.jpg"}, args)
+}
@@ -0,0 +1,196 @@
+package media
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/mxpv/podsync/pkg/feed"
+)
+
+// EBU R128 targets recommended for podcasts
+const loudnormFilter = "loudnorm=I=-16:TP=-1.5:LRA=11"
+
+var (
+	audioEncoders = map[string]string{
+		"":       "aac",
+		"aac":    "aac",
+		"opus":   "libopus",
+		"mp3":    "libmp3lame",
+		"vorbis": "libvorbis",
+		"flac":   "flac",
+		"copy":   "copy",
+	}
+	videoEncoders = map[string]string{
+		"h264": "libx264",
+		"h265": "libx265",
+		"copy": "copy",
+	}
+)
+
+// FFmpeg post-processes downloaded episodes.
+type FFmpeg struct {
+	path string
+}
+
+func NewFFmpeg() (*FFmpeg, error) {
+	path, err := exec.LookPath("ffmpeg")
+	if err != nil {
+		return nil, errors.Wrap(err, "ffmpeg binary not found")
+	}
+
+	log.Debugf("found ffmpeg binary at %q", path)
+	return &FFmpeg{path: path}, nil
+}
+
+// Transcode re-encodes the input file according to the profile.
+// The result is written to a new temp directory, which is removed when the returned file is closed.
+func (f *FFmpeg) Transcode(ctx context.Context, profile *feed.TranscodeProfile, input string) (r io.ReadCloser, err error) {
+	tmpDir, err := os.MkdirTemp("", "podsync-")
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to get temp dir for transcoding")
+	}
+
+	defer func() {
+		if err != nil {
+			if err1 := os.RemoveAll(tmpDir); err1 != nil {
+				log.Errorf("could not remove temp dir: %v", err1)
+			}
+		}
+	}()
+
+	if profile.AudioCodec == "copy" && !profile.IsVideo() && profile.Extension == "" {
+		codec, err := probeAudioCodec(ctx, input)
+		if err != nil {
+			return nil, err
+		}
+
+		if err := profile.CheckAudioSource(codec); err != nil {
+			return nil, err
+		}
+	}
+
+	var (
+		baseName = strings.TrimSuffix(filepath.Base(input), filepath.Ext(input))
+		output   = filepath.Join(tmpDir, fmt.Sprintf("%s.%s", baseName, profile.FileExtension()))
+	)
+
+	if logs, err := f.exec(ctx, buildTranscodeArgs(profile, input, output)...); err != nil {
+		log.Error(logs)
+		return nil, err
+	}
+
+	file, err := os.Open(output)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to open transcoded file")
+	}
+
+	return &tempFile{File: file, dir: tmpDir}, nil
+}
+
+func (f *FFmpeg) exec(ctx context.Context, args ...string) (string, error) {
+	cmd := exec.CommandContext(ctx, f.path, args...)
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		return string(output), errors.Wrap(err, "failed to execute ffmpeg")
+	}
+
+	return string(output), nil
+}
+
+// probeAudioCodec returns the codec name of the first audio track of the input file
+func probeAudioCodec(ctx context.Context, input string) (string, error) {
+	path, err := exec.LookPath("ffprobe")
+	if err != nil {
+		return "", errors.Wrap(err, "ffprobe binary not found")
+	}
+
+	cmd := exec.CommandContext(ctx, path, "-v", "error", "-select_streams", "a:0",
+		"-show_entries", "stream=codec_name", "-of", "default=noprint_wrappers=1:nokey=1", input)
+	output, err := cmd.Output()
+	if err != nil {
+		return "", errors.Wrap(err, "failed to probe audio codec")
+	}
+
+	return strings.TrimSpace(string(output)), nil
+}
+
+func buildTranscodeArgs(profile *feed.TranscodeProfile, input string, output string) []string {
+	args := []string{"-hide_banner", "-nostdin", "-y", "-i", input}
+
+	var (
+		audioFilters []string
+		videoFilters []string
+	)
+
+	if profile.Loudnorm {
+		audioFilters = append(audioFilters, loudnormFilter)
+	}
+
+	if profile.Speed != 0 && profile.Speed != 1 {
+		audioFilters = append(audioFilters, atempoFilters(profile.Speed)...)
+		videoFilters = append(videoFilters, fmt.Sprintf("setpts=PTS/%s", formatFloat(profile.Speed)))
+	}
+
+	if profile.MaxHeight > 0 {
+		// Keep aspect ratio (and an even width), never upscale
+		videoFilters = append([]string{fmt.Sprintf("scale=-2:min(ih\\,%d)", profile.MaxHeight)}, videoFilters...)
+	}
+
+	if profile.IsVideo() {
+		args = append(args, "-map", "0:v:0", "-map", "0:a:0?", "-c:v", videoEncoders[profile.VideoCodec])
+		if profile.VideoBitrate != "" {
+			args = append(args, "-b:v", profile.VideoBitrate)
+		}
+		if len(videoFilters) > 0 {
+			args = append(args, "-vf", strings.Join(videoFilters, ","))
+		}
+	} else {
+		args = append(args, "-map", "0:a:0", "-vn")
+	}
+
+	args = append(args, "-c:a", audioEncoders[profile.AudioCodec])
+	if profile.AudioBitrate != "" {
+		args = append(args, "-b:a", profile.AudioBitrate)
+	}
+	if profile.Channels > 0 {
+		args = append(args, "-ac", strconv.Itoa(profile.Channels))
+	}
+	if len(audioFilters) > 0 {
+		args = append(args, "-af", strings.Join(audioFilters, ","))
+	}
+
+	switch profile.FileExtension() {
+	case "mp4", "m4a", "m4v", "mov":
+		// Let players start playback before the whole file is downloaded
+		args = append(args, "-movflags", "+faststart")
+	}
+
+	args = append(args, output)
+	return args
+}
+
+// atempoFilters splits the speed factor into a chain of atempo filters,
+// as older ffmpeg versions accept only factors between 0.5 and 2.0.
+func atempoFilters(speed float64) []string {
+	var filters []string
+	for speed > 2.0 {
+		filters = append(filters, "atempo=2")
+		speed /= 2.0
+	}
+
+	filters = append(filters, fmt.Sprintf("atempo=%s", formatFloat(speed)))
+	return filters
+}
+
+func formatFloat(value float64) string {
+	return strconv.FormatFloat(value, 'f', -1, 64)
+}
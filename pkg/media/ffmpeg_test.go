@@ -0,0 +1,50 @@
+package media
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/mxpv/podsync/pkg/feed"
+)
+
+func TestBuildTranscodeArgs(t *testing.T) {
+	tests := []struct {
+		name    string
+		profile feed.TranscodeProfile
+		expect  []string
+	}{
+		{
+			name:    "Default audio",
+			profile: feed.TranscodeProfile{},
+			expect: []string{"-hide_banner", "-nostdin", "-y", "-i", "/tmp/in.mp4",
+				"-map", "0:a:0", "-vn", "-c:a", "aac", "-movflags", "+faststart", "/tmp/out"},
+		},
+		{
+			name:    "Mono opus with loudness normalization",
+			profile: feed.TranscodeProfile{AudioCodec: "opus", AudioBitrate: "32k", Channels: 1, Loudnorm: true},
+			expect: []string{"-hide_banner", "-nostdin", "-y", "-i", "/tmp/in.mp4",
+				"-map", "0:a:0", "-vn", "-c:a", "libopus", "-b:a", "32k", "-ac", "1", "-af", "loudnorm=I=-16:TP=-1.5:LRA=11", "/tmp/out"},
+		},
+		{
+			name:    "Audio speed up",
+			profile: feed.TranscodeProfile{AudioCodec: "mp3", Speed: 3},
+			expect: []string{"-hide_banner", "-nostdin", "-y", "-i", "/tmp/in.mp4",
+				"-map", "0:a:0", "-vn", "-c:a", "libmp3lame", "-af", "atempo=2,atempo=1.5", "/tmp/out"},
+		},
+		{
+			name:    "Video with max height and speed",
+			profile: feed.TranscodeProfile{VideoCodec: "h264", VideoBitrate: "1M", MaxHeight: 720, Speed: 1.25},
+			expect: []string{"-hide_banner", "-nostdin", "-y", "-i", "/tmp/in.mp4",
+				"-map", "0:v:0", "-map", "0:a:0?", "-c:v", "libx264", "-b:v", "1M", "-vf", "scale=-2:min(ih\\,720),setpts=PTS/1.25",
+				"-c:a", "aac", "-af", "atempo=1.25", "-movflags", "+faststart", "/tmp/out"},
+		},
+	}
+
+	for _, tst := range tests {
+		t.Run(tst.name, func(t *testing.T) {
+			profile := tst.profile
+			assert.EqualValues(t, tst.expect, buildTranscodeArgs(&profile, "/tmp/in.mp4", "/tmp/out"))
+		})
+	}
+}
@@ -0,0 +1,173 @@
+package media
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+)
+
+const coverDownloadTimeout = 30 * time.Second
+
+// Tags are metadata fields written into media files.
+type Tags struct {
+	Title   string
+	Artist  string
+	Album   string
+	Date    string
+	Track   string
+	Comment string
+	Genre   string
+	// Cover is a URL of artwork to embed into the file
+	Cover string
+}
+
+// WriteTags writes tags (and cover art if supported by the container) into a copy of the input file.
+// Streams are copied as is, so this is cheap compared to transcoding.
+// The result is written to a new temp directory, which is removed when the returned file is closed.
+func (f *FFmpeg) WriteTags(ctx context.Context, input string, tags Tags) (r io.ReadCloser, err error) {
+	tmpDir, err := os.MkdirTemp("", "podsync-")
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to get temp dir for tagging")
+	}
+
+	defer func() {
+		if err != nil {
+			if err1 := os.RemoveAll(tmpDir); err1 != nil {
+				log.Errorf("could not remove temp dir: %v", err1)
+			}
+		}
+	}()
+
+	var (
+		ext    = strings.ToLower(strings.TrimPrefix(filepath.Ext(input), "."))
+		output = filepath.Join(tmpDir, filepath.Base(input))
+		cover  string
+	)
+
+	if tags.Cover != "" && supportsCover(ext) {
+		cover = filepath.Join(tmpDir, "cover")
+		if err := downloadFile(ctx, tags.Cover, cover); err != nil {
+			// Not fatal, the file is still tagged
+			log.WithError(err).Warnf("failed to download cover art %q", tags.Cover)
+			cover = ""
+		}
+	}
+
+	if logs, err := f.exec(ctx, buildTagArgs(input, cover, output, tags)...); err != nil {
+		log.Error(logs)
+		return nil, err
+	}
+
+	if cover != "" {
+		if err := os.Remove(cover); err != nil {
+			log.WithError(err).Warn("failed to remove cover art")
+		}
+	}
+
+	file, err := os.Open(output)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to open tagged file")
+	}
+
+	return &tempFile{File: file, dir: tmpDir}, nil
+}
+
+func buildTagArgs(input string, cover string, output string, tags Tags) []string {
+	var (
+		ext  = strings.ToLower(strings.TrimPrefix(filepath.Ext(output), "."))
+		args = []string{"-hide_banner", "-nostdin", "-y", "-i", input}
+	)
+
+	if cover != "" {
+		args = append(args, "-i", cover, "-map", "0:a", "-map", "1:v", "-c:a", "copy", "-c:v", "mjpeg", "-disposition:v:0", "attached_pic")
+		if ext == "mp3" {
+			args = append(args, "-metadata:s:v", "title=Album cover", "-metadata:s:v", "comment=Cover (front)")
+		}
+	} else {
+		args = append(args, "-map", "0", "-c", "copy")
+	}
+
+	fields := []struct {
+		key   string
+		value string
+	}{
+		{"title", tags.Title},
+		{"artist", tags.Artist},
+		{"album_artist", tags.Artist},
+		{"album", tags.Album},
+		{"date", tags.Date},
+		{"track", tags.Track},
+		{"genre", tags.Genre},
+		{"comment", tags.Comment},
+	}
+
+	for _, field := range fields {
+		if field.value != "" {
+			args = append(args, "-metadata", fmt.Sprintf("%s=%s", field.key, field.value))
+		}
+	}
+
+	switch ext {
+	case "mp3":
+		// ID3v2.3 is understood by most car stereos and DLNA players
+		args = append(args, "-id3v2_version", "3")
+	case "mp4", "m4a", "m4v", "mov":
+		if tags.Comment != "" {
+			args = append(args, "-metadata", fmt.Sprintf("description=%s", tags.Comment))
+		}
+		args = append(args, "-movflags", "+faststart")
+	}
+
+	args = append(args, output)
+	return args
+}
+
+// supportsCover returns true for containers ffmpeg can embed attached pictures into
+func supportsCover(ext string) bool {
+	switch ext {
+	case "mp3", "m4a", "flac":
+		return true
+	default:
+		return false
+	}
+}
+
+func downloadFile(ctx context.Context, url string, path string) error {
+	ctx, cancel := context.WithTimeout(ctx, coverDownloadTimeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return errors.Wrap(err, "failed to create request")
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return errors.Wrap(err, "failed to send request")
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return errors.Errorf("unexpected status code %d", resp.StatusCode)
+	}
+
+	file, err := os.Create(path)
+	if err != nil {
+		return errors.Wrap(err, "failed to create file")
+	}
+	defer file.Close()
+
+	if _, err := io.Copy(file, resp.Body); err != nil {
+		return errors.Wrap(err, "failed to write file")
+	}
+
+	return nil
+}
@@ -0,0 +1,30 @@
+package media
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBuildTagArgs(t *testing.T) {
+	tags := Tags{Title: "Episode", Artist: "Author", Album: "Show", Track: "3", Comment: "Description"}
+
+	args := buildTagArgs("/tmp/in.m4a", "", "/tmp/out.m4a", tags)
+	assert.Equal(t, []string{"-hide_banner", "-nostdin", "-y", "-i", "/tmp/in.m4a", "-map", "0", "-c", "copy",
+		"-metadata", "title=Episode", "-metadata", "artist=Author", "-metadata", "album_artist=Author",
+		"-metadata", "album=Show", "-metadata", "track=3", "-metadata", "comment=Description",
+		"-metadata", "description=Description", "-movflags", "+faststart", "/tmp/out.m4a"}, args)
+
+	args = buildTagArgs("/tmp/in.mp3", "/tmp/cover", "/tmp/out.mp3", Tags{Title: "Episode"})
+	assert.Equal(t, []string{"-hide_banner", "-nostdin", "-y", "-i", "/tmp/in.mp3",
+		"-i", "/tmp/cover", "-map", "0:a", "-map", "1:v", "-c:a", "copy", "-c:v", "mjpeg", "-disposition:v:0", "attached_pic",
+		"-metadata:s:v", "title=Album cover", "-metadata:s:v", "comment=Cover (front)",
+		"-metadata", "title=Episode", "-id3v2_version", "3", "/tmp/out.mp3"}, args)
+}
+
+func TestSupportsCover(t *testing.T) {
+	assert.True(t, supportsCover("mp3"))
+	assert.True(t, supportsCover("m4a"))
+	assert.False(t, supportsCover("mp4"))
+	assert.False(t, supportsCover("opus"))
+}
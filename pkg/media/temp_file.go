@@ -0,0 +1,23 @@
+package media
+
+import (
+	"os"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// tempFile is a file produced by ffmpeg in its own temp directory,
+// the directory is removed when the file is closed.
+type tempFile struct {
+	*os.File
+	dir string
+}
+
+func (f *tempFile) Close() error {
+	err := f.File.Close()
+	err1 := os.RemoveAll(f.dir)
+	if err1 != nil {
+		log.Errorf("could not remove temp dir: %v", err1)
+	}
+	return err
+}
@@ -0,0 +1,19 @@
+package model
+
+import (
+	"time"
+)
+
+// Access is a deduplicated record of a client fetching a feed XML or an episode file during a day.
+// Repeated (e.g. range) requests of the same file by the same client are merged into a single record,
+// so each episode record counts as one listen.
+type Access struct {
+	FeedID    string    `json:"feed_id"`
+	File      string    `json:"file,omitempty"` // Episode file name, empty for XML fetches
+	Day       string    `json:"day"`            // UTC date in YYYY-MM-DD format
+	Client    string    `json:"client"`         // Coarse hash of client network and user agent
+	UserAgent string    `json:"user_agent"`
+	Requests  int       `json:"requests"`
+	FirstSeen time.Time `json:"first_seen"`
+	LastSeen  time.Time `json:"last_seen"`
+}
@@ -21,6 +21,16 @@ const (
 	FormatCustom = Format("custom")
 )
 
+// ContentType tells regular videos apart from other kinds of content
+type ContentType string
+
+const (
+	ContentVideo    = ContentType("video")
+	ContentShort    = ContentType("short")
+	ContentLiveVOD  = ContentType("live_vod") // Recording of a finished live stream
+	ContentPremiere = ContentType("premiere")
+)
+
 // Playlist sorting style
 type Sorting string
 
@@ -41,6 +51,22 @@ type Episode struct {
 	Size        int64         `json:"size"`
 	Order       string        `json:"order"`
 	Status      EpisodeStatus `json:"status"` // Disk status
+	// Renditions holds file sizes of additional episode renditions by rendition name
+	Renditions map[string]int64 `json:"renditions,omitempty"`
+	// Artwork is a storage path of the self-hosted episode thumbnail
+	Artwork string `json:"artwork,omitempty"`
+	// Pinned episodes are never removed by cleanup
+	Pinned bool `json:"pinned,omitempty"`
+	// Extension of the episode file when process hooks changed the one of the feed format
+	Extension string `json:"extension,omitempty"`
+	// Tags are keywords the uploader assigned to the video
+	Tags []string `json:"tags,omitempty"`
+	// ContentType is set by builders able to tell it, empty when unknown
+	ContentType ContentType `json:"content_type,omitempty"`
+	// MembersOnly episodes are available to channel members only
+	MembersOnly bool `json:"members_only,omitempty"`
+	// Source is the URL of the merged feed source the episode was received from
+	Source string `json:"source,omitempty"`
 }
 
 type Feed struct {
@@ -65,6 +91,19 @@ type Feed struct {
 	UpdatedAt       time.Time  `json:"updated_at"`
 	PlaylistSort    Sorting    `json:"playlist_sort"`
 	PrivateFeed     bool       `json:"private_feed"`
+	Artwork         string     `json:"artwork,omitempty"`  // Storage path of the self-hosted cover art
+	RemovedAt       time.Time  `json:"removed_at"`         // When the feed was first found missing from the config
+	Sources         []*Source  `json:"sources,omitempty"`  // Update state of merged feed sources
+	Failures        int        `json:"failures,omitempty"` // Failed updates in a row, reset by a successful update
+}
+
+// Source is the update state of one source of a merged feed
+type Source struct {
+	URL       string    `json:"url"`
+	Provider  Provider  `json:"provider"`
+	UpdatedAt time.Time `json:"updated_at"`      // Last successful update
+	Error     string    `json:"error,omitempty"` // Error of the last update, empty if it succeeded
+	Episodes  int       `json:"episodes"`        // Number of episodes received in the last successful update
 }
 
 type EpisodeStatus string
@@ -74,4 +113,5 @@ const (
 	EpisodeDownloaded = EpisodeStatus("downloaded") // Downloaded, encoded and available for download
 	EpisodeError      = EpisodeStatus("error")      // Could not download, will retry
 	EpisodeCleaned    = EpisodeStatus("cleaned")    // Downloaded and later removed from disk due to update strategy
+	EpisodeFiltered   = EpisodeStatus("filtered")   // Downloaded and later removed from disk as it no longer matches filters
 )
@@ -0,0 +1,14 @@
+package model
+
+import (
+	"time"
+)
+
+// Token grants access to private feeds via a secret embedded in feed URLs
+type Token struct {
+	ID         string    `json:"id"`   // Public identifier, used to revoke the token
+	Name       string    `json:"name"` // Name of the user the token was issued to
+	Hash       string    `json:"hash"` // SHA-256 of the secret, the secret itself is never stored
+	CreatedAt  time.Time `json:"created_at"`
+	LastUsedAt time.Time `json:"last_used_at"`
+}
@@ -0,0 +1,240 @@
+package notify
+
+import (
+	"net/url"
+	"text/template"
+	"time"
+
+	"github.com/hashicorp/go-multierror"
+	"github.com/pkg/errors"
+)
+
+// Kind is a kind of notification
+type Kind string
+
+const (
+	// NewEpisode is sent when a downloaded episode becomes available in a feed
+	NewEpisode = Kind("new_episode")
+	// DownloadFailed is sent when an episode couldn't be downloaded
+	DownloadFailed = Kind("download_failed")
+	// FeedBroken is sent once a feed failed to update a number of times in a row
+	FeedBroken = Kind("feed_broken")
+)
+
+// Kinds lists all notification kinds
+var Kinds = []Kind{NewEpisode, DownloadFailed, FeedBroken}
+
+// ChannelType is a notification service
+type ChannelType string
+
+const (
+	ChannelEmail    = ChannelType("email")
+	ChannelNtfy     = ChannelType("ntfy")
+	ChannelGotify   = ChannelType("gotify")
+	ChannelTelegram = ChannelType("telegram")
+	ChannelMatrix   = ChannelType("matrix")
+	// ChannelWebhook posts to Slack or Discord compatible incoming webhooks
+	ChannelWebhook = ChannelType("webhook")
+)
+
+const (
+	// DefaultBrokenAfter is the number of failed updates in a row after which a feed is reported as broken
+	DefaultBrokenAfter = 3
+	// DefaultTimeout limits a single notification request
+	DefaultTimeout = 10 * time.Second
+	// DefaultTelegramURL is the Telegram Bot API endpoint
+	DefaultTelegramURL = "https://api.telegram.org"
+	// DefaultSMTPPort is the SMTP submission port
+	DefaultSMTPPort = 587
+)
+
+// Config configures notifications
+type Config struct {
+	// BrokenAfter is the number of failed updates in a row after which a feed is reported as broken (default 3)
+	BrokenAfter int `toml:"broken_after"`
+	// Templates override default message templates of all channels by notification kind
+	Templates map[Kind]*Template `toml:"templates"`
+	// Channels are notification services to send messages to
+	Channels []*ChannelConfig `toml:"channels"`
+}
+
+// Template is a Go text/template of a message, see Data for available fields
+type Template struct {
+	Title   string `toml:"title"`
+	Message string `toml:"message"`
+}
+
+// ChannelConfig configures a notification channel
+type ChannelConfig struct {
+	// Type is one of email, ntfy, gotify, telegram, matrix or webhook
+	Type ChannelType `toml:"type"`
+	// Kinds is a list of notifications to send, all kinds when empty
+	Kinds []Kind `toml:"kinds"`
+	// Feeds is a list of feed IDs to send notifications of, all feeds when empty
+	Feeds []string `toml:"feeds"`
+	// Templates override message templates for this channel by notification kind
+	Templates map[Kind]*Template `toml:"templates"`
+	// Timeout of a single request (default 10s)
+	Timeout time.Duration `toml:"timeout"`
+
+	// URL is the ntfy topic URL, Gotify server, Matrix homeserver, webhook URL
+	// or Telegram Bot API endpoint (optional, defaults to https://api.telegram.org)
+	URL string `toml:"url"`
+	// Token is the ntfy access token (optional), Gotify application token,
+	// Telegram bot token or Matrix access token
+	Token string `toml:"token"`
+	// ChatID is the Telegram chat to send messages to
+	ChatID string `toml:"chat_id"`
+	// Room is the Matrix room ID (e.g. "!abc:example.com")
+	Room string `toml:"room"`
+	// Priority of ntfy (1-5) and Gotify (0-10) messages, server default when 0
+	Priority int `toml:"priority"`
+
+	// Host is the SMTP server to send email through
+	Host string `toml:"host"`
+	// Port of the SMTP server (default 587), STARTTLS is used when the server supports it
+	Port int `toml:"port"`
+	// Username and Password authenticate to the SMTP server (optional)
+	Username string `toml:"username"`
+	Password string `toml:"password"`
+	// From is the sender address
+	From string `toml:"from"`
+	// To is a list of recipient addresses
+	To []string `toml:"to"`
+}
+
+// Accepts returns true if the channel is subscribed to the notification kind of the feed
+func (c *ChannelConfig) Accepts(kind Kind, feedID string) bool {
+	return contains(c.Kinds, kind) && contains(c.Feeds, feedID)
+}
+
+// contains returns true if list is empty or contains value
+func contains[T comparable](list []T, value T) bool {
+	if len(list) == 0 {
+		return true
+	}
+	for _, item := range list {
+		if item == value {
+			return true
+		}
+	}
+	return false
+}
+
+// Validate checks notification channels and templates
+func (c *Config) Validate() error {
+	var result *multierror.Error
+
+	if c.BrokenAfter < 0 {
+		result = multierror.Append(result, errors.New("broken_after can't be negative"))
+	}
+
+	if err := validateTemplates(c.Templates); err != nil {
+		result = multierror.Append(result, err)
+	}
+
+	for i, channel := range c.Channels {
+		if err := channel.Validate(); err != nil {
+			result = multierror.Append(result, errors.Wrapf(err, "channel #%d (%s)", i+1, channel.Type))
+		}
+	}
+
+	return result.ErrorOrNil()
+}
+
+// Validate checks settings required by the channel type
+func (c *ChannelConfig) Validate() error {
+	for _, kind := range c.Kinds {
+		if !isKnown(kind) {
+			return errors.Errorf("unknown notification kind %q", kind)
+		}
+	}
+
+	if err := validateTemplates(c.Templates); err != nil {
+		return err
+	}
+
+	if c.Timeout < 0 {
+		return errors.New("timeout can't be negative")
+	}
+
+	switch c.Type {
+	case ChannelEmail:
+		if c.Host == "" {
+			return errors.New("host is required")
+		}
+		if c.From == "" || len(c.To) == 0 {
+			return errors.New("from and to addresses are required")
+		}
+	case ChannelNtfy, ChannelWebhook:
+		if err := validateURL(c.URL); err != nil {
+			return err
+		}
+	case ChannelGotify:
+		if err := validateURL(c.URL); err != nil {
+			return err
+		}
+		if c.Token == "" {
+			return errors.New("token is required")
+		}
+	case ChannelTelegram:
+		if c.URL != "" {
+			if err := validateURL(c.URL); err != nil {
+				return err
+			}
+		}
+		if c.Token == "" || c.ChatID == "" {
+			return errors.New("token and chat_id are required")
+		}
+	case ChannelMatrix:
+		if err := validateURL(c.URL); err != nil {
+			return err
+		}
+		if c.Token == "" || c.Room == "" {
+			return errors.New("token and room are required")
+		}
+	default:
+		return errors.Errorf("unknown channel type %q", c.Type)
+	}
+
+	return nil
+}
+
+func validateURL(value string) error {
+	parsed, err := url.Parse(value)
+	if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+		return errors.Errorf("invalid url %q", value)
+	}
+	return nil
+}
+
+func validateTemplates(templates map[Kind]*Template) error {
+	for kind, tmpl := range templates {
+		if !isKnown(kind) {
+			return errors.Errorf("unknown notification kind %q in templates", kind)
+		}
+		if tmpl == nil {
+			continue
+		}
+		if _, err := parseTemplate(tmpl.Title); err != nil {
+			return errors.Wrapf(err, "invalid %s title template", kind)
+		}
+		if _, err := parseTemplate(tmpl.Message); err != nil {
+			return errors.Wrapf(err, "invalid %s message template", kind)
+		}
+	}
+	return nil
+}
+
+func parseTemplate(text string) (*template.Template, error) {
+	return template.New("").Option("missingkey=zero").Parse(text)
+}
+
+func isKnown(kind Kind) bool {
+	for _, known := range Kinds {
+		if kind == known {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,227 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/hashicorp/go-multierror"
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/mxpv/podsync/pkg/events"
+	"github.com/mxpv/podsync/pkg/feed"
+	"github.com/mxpv/podsync/pkg/model"
+)
+
+// defaultTemplates are used for kinds without templates in the configuration
+var defaultTemplates = map[Kind]*Template{
+	NewEpisode: {
+		Title:   "New episode: {{.Episode.Title}}",
+		Message: "{{.FeedTitle}}: {{.Episode.Title}}\n{{.EpisodeURL}}",
+	},
+	DownloadFailed: {
+		Title:   "Download failed: {{.Episode.Title}}",
+		Message: "Failed to download {{.Episode.Title}} ({{.Episode.VideoURL}}) of {{.FeedTitle}}: {{.Error}}",
+	},
+	FeedBroken: {
+		Title:   "Feed is broken: {{.FeedTitle}}",
+		Message: "{{.FeedTitle}} failed to update {{.Failures}} times in a row: {{.Error}}\n{{.FeedURL}}",
+	},
+}
+
+// Data is passed to message templates
+type Data struct {
+	Kind      Kind
+	FeedID    string
+	FeedTitle string
+	// FeedURL is the public URL of the feed XML
+	FeedURL string
+	// Episode is set for episode notifications
+	Episode *model.Episode
+	// EpisodeURL is the public URL of the downloaded episode file
+	EpisodeURL string
+	// Error is set for failure notifications
+	Error string
+	// Failures is the number of failed updates in a row
+	Failures int
+}
+
+// Message is a rendered notification
+type Message struct {
+	Kind  Kind
+	Title string
+	Body  string
+}
+
+// Sender delivers messages to a notification service
+type Sender interface {
+	Send(ctx context.Context, message *Message) error
+}
+
+// FeedLookup queries feed details for messages
+type FeedLookup interface {
+	GetFeed(ctx context.Context, feedID string) (*model.Feed, error)
+}
+
+type channel struct {
+	config *ChannelConfig
+	sender Sender
+}
+
+// Notifier turns feed and episode events into notifications sent to configured channels.
+// It's an events.Handler expected to be subscribed to the event bus.
+type Notifier struct {
+	config   *Config
+	hostname string
+	feeds    FeedLookup
+	channels []channel
+}
+
+func New(config *Config, hostname string, feeds FeedLookup) *Notifier {
+	notifier := &Notifier{
+		config:   config,
+		hostname: hostname,
+		feeds:    feeds,
+	}
+
+	for _, channelConfig := range config.Channels {
+		notifier.channels = append(notifier.channels, channel{config: channelConfig, sender: NewSender(channelConfig)})
+	}
+
+	return notifier
+}
+
+// Handle sends notifications for the event to subscribed channels
+func (n *Notifier) Handle(ctx context.Context, event *events.Event) error {
+	data := n.notification(ctx, event)
+	if data == nil {
+		return nil
+	}
+
+	data.FeedTitle = n.feedTitle(ctx, event.FeedID)
+	data.FeedURL = feed.XMLURL(n.hostname, event.FeedID)
+
+	var result *multierror.Error
+	for _, ch := range n.channels {
+		if !ch.config.Accepts(data.Kind, data.FeedID) {
+			continue
+		}
+
+		message, err := n.render(ch.config, data)
+		if err != nil {
+			result = multierror.Append(result, errors.Wrapf(err, "failed to render %s notification", data.Kind))
+			continue
+		}
+
+		if err := ch.sender.Send(ctx, message); err != nil {
+			result = multierror.Append(result, errors.Wrapf(err, "failed to send %s notification via %s", data.Kind, ch.config.Type))
+			continue
+		}
+
+		log.WithFields(log.Fields{"feed_id": data.FeedID, "channel": ch.config.Type}).Debugf("sent %s notification", data.Kind)
+	}
+
+	return result.ErrorOrNil()
+}
+
+// notification returns template data of the notification to send for the event, if any
+func (n *Notifier) notification(ctx context.Context, event *events.Event) *Data {
+	data := &Data{FeedID: event.FeedID, Episode: event.Episode, Error: event.Error}
+
+	switch event.Type {
+	case events.DownloadSucceeded:
+		data.Kind = NewEpisode
+		if event.File != "" {
+			data.EpisodeURL = fmt.Sprintf("%s/%s", strings.TrimRight(n.hostname, "/"), event.File)
+		}
+		return data
+
+	case events.DownloadFailed:
+		data.Kind = DownloadFailed
+		return data
+
+	case events.FeedUpdateFailed:
+		// The updater stores failures in a row on the feed, so the count survives restarts
+		if n.feeds == nil {
+			return nil
+		}
+		info, err := n.feeds.GetFeed(ctx, event.FeedID)
+		if err != nil {
+			log.WithError(err).WithField("feed_id", event.FeedID).Warn("failed to query feed failures")
+			return nil
+		}
+		failures := info.Failures
+
+		brokenAfter := n.config.BrokenAfter
+		if brokenAfter == 0 {
+			brokenAfter = DefaultBrokenAfter
+		}
+
+		// Notify once, until the feed updates successfully again
+		if failures != brokenAfter {
+			return nil
+		}
+
+		data.Kind = FeedBroken
+		data.Failures = failures
+		return data
+	}
+
+	return nil
+}
+
+func (n *Notifier) feedTitle(ctx context.Context, feedID string) string {
+	if n.feeds != nil {
+		if info, err := n.feeds.GetFeed(ctx, feedID); err == nil && info.Title != "" {
+			return info.Title
+		}
+	}
+	return feedID
+}
+
+// render executes templates of the channel, falling back to global and default templates
+func (n *Notifier) render(config *ChannelConfig, data *Data) (*Message, error) {
+	var (
+		title   = defaultTemplates[data.Kind].Title
+		message = defaultTemplates[data.Kind].Message
+	)
+
+	for _, templates := range []map[Kind]*Template{n.config.Templates, config.Templates} {
+		if tmpl := templates[data.Kind]; tmpl != nil {
+			if tmpl.Title != "" {
+				title = tmpl.Title
+			}
+			if tmpl.Message != "" {
+				message = tmpl.Message
+			}
+		}
+	}
+
+	renderedTitle, err := execute(title, data)
+	if err != nil {
+		return nil, err
+	}
+
+	renderedMessage, err := execute(message, data)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Message{Kind: data.Kind, Title: renderedTitle, Body: renderedMessage}, nil
+}
+
+func execute(text string, data *Data) (string, error) {
+	tmpl, err := parseTemplate(text)
+	if err != nil {
+		return "", err
+	}
+
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, data); err != nil {
+		return "", err
+	}
+
+	return strings.TrimSpace(buf.String()), nil
+}
@@ -0,0 +1,157 @@
+package notify
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/mxpv/podsync/pkg/events"
+	"github.com/mxpv/podsync/pkg/model"
+)
+
+type recorder struct {
+	messages []*Message
+}
+
+func (r *recorder) Send(_ context.Context, message *Message) error {
+	r.messages = append(r.messages, message)
+	return nil
+}
+
+type feeds map[string]*model.Feed
+
+func (f feeds) GetFeed(_ context.Context, feedID string) (*model.Feed, error) {
+	if info, ok := f[feedID]; ok {
+		return info, nil
+	}
+	return nil, model.ErrNotFound
+}
+
+func newTestNotifier(config *Config) (*Notifier, *recorder, feeds) {
+	lookup := feeds{"news": {ID: "news", Title: "Daily News"}}
+	notifier := New(config, "https://podsync.example.com/", lookup)
+	sender := &recorder{}
+	for i := range notifier.channels {
+		notifier.channels[i].sender = sender
+	}
+	return notifier, sender, lookup
+}
+
+func TestNotifier_NewEpisode(t *testing.T) {
+	notifier, sender, _ := newTestNotifier(&Config{Channels: []*ChannelConfig{{Type: ChannelWebhook}}})
+
+	err := notifier.Handle(context.Background(), &events.Event{
+		Type:    events.DownloadSucceeded,
+		FeedID:  "news",
+		Episode: &model.Episode{ID: "1", Title: "Episode <1> & more"},
+		File:    "news/1.mp3",
+	})
+	require.NoError(t, err)
+
+	require.Len(t, sender.messages, 1)
+	assert.Equal(t, NewEpisode, sender.messages[0].Kind)
+	assert.Equal(t, "New episode: Episode <1> & more", sender.messages[0].Title)
+	assert.Equal(t, "Daily News: Episode <1> & more\nhttps://podsync.example.com/news/1.mp3", sender.messages[0].Body)
+}
+
+func TestNotifier_Templates(t *testing.T) {
+	notifier, sender, _ := newTestNotifier(&Config{
+		Templates: map[Kind]*Template{
+			DownloadFailed: {Title: "Oops", Message: "global {{.Error}}"},
+		},
+		Channels: []*ChannelConfig{
+			{Type: ChannelNtfy},
+			{Type: ChannelNtfy, Templates: map[Kind]*Template{
+				DownloadFailed: {Message: "{{.FeedTitle}} / {{.Episode.Title}} / {{.Error}}"},
+			}},
+		},
+	})
+
+	err := notifier.Handle(context.Background(), &events.Event{
+		Type:    events.DownloadFailed,
+		FeedID:  "news",
+		Episode: &model.Episode{ID: "1", Title: "Episode 1"},
+		Error:   "403",
+	})
+	require.NoError(t, err)
+
+	require.Len(t, sender.messages, 2)
+	assert.Equal(t, &Message{Kind: DownloadFailed, Title: "Oops", Body: "global 403"}, sender.messages[0])
+	assert.Equal(t, &Message{Kind: DownloadFailed, Title: "Oops", Body: "Daily News / Episode 1 / 403"}, sender.messages[1])
+}
+
+func TestNotifier_Subscriptions(t *testing.T) {
+	notifier, sender, _ := newTestNotifier(&Config{Channels: []*ChannelConfig{
+		{Type: ChannelNtfy, Kinds: []Kind{DownloadFailed}},
+		{Type: ChannelNtfy, Feeds: []string{"other"}},
+	}})
+
+	ctx := context.Background()
+	require.NoError(t, notifier.Handle(ctx, &events.Event{Type: events.DownloadSucceeded, FeedID: "news", Episode: &model.Episode{ID: "1"}}))
+	require.NoError(t, notifier.Handle(ctx, &events.Event{Type: events.DownloadStarted, FeedID: "news", Episode: &model.Episode{ID: "1"}}))
+	assert.Empty(t, sender.messages)
+
+	require.NoError(t, notifier.Handle(ctx, &events.Event{Type: events.DownloadFailed, FeedID: "news", Episode: &model.Episode{ID: "1"}}))
+	assert.Len(t, sender.messages, 1)
+}
+
+func TestNotifier_FeedBroken(t *testing.T) {
+	notifier, sender, lookup := newTestNotifier(&Config{BrokenAfter: 2, Channels: []*ChannelConfig{{Type: ChannelNtfy}}})
+
+	ctx := context.Background()
+	failed := &events.Event{Type: events.FeedUpdateFailed, FeedID: "news", Error: "playlist not found"}
+
+	// The updater counts failures on the feed before publishing the event
+	fail := func() {
+		lookup["news"].Failures++
+		require.NoError(t, notifier.Handle(ctx, failed))
+	}
+
+	fail()
+	assert.Empty(t, sender.messages)
+
+	fail()
+	require.Len(t, sender.messages, 1)
+	assert.Equal(t, "Feed is broken: Daily News", sender.messages[0].Title)
+	assert.Equal(t, "Daily News failed to update 2 times in a row: playlist not found\nhttps://podsync.example.com/news.xml", sender.messages[0].Body)
+
+	// Reported once until the feed recovers
+	fail()
+	assert.Len(t, sender.messages, 1)
+
+	lookup["news"].Failures = 0
+	require.NoError(t, notifier.Handle(ctx, &events.Event{Type: events.FeedUpdated, FeedID: "news"}))
+	fail()
+	fail()
+	assert.Len(t, sender.messages, 2)
+
+	// Unknown feeds are not reported
+	require.NoError(t, notifier.Handle(ctx, &events.Event{Type: events.FeedUpdateFailed, FeedID: "missing"}))
+	assert.Len(t, sender.messages, 2)
+}
+
+func TestConfig_Validate(t *testing.T) {
+	valid := &Config{Channels: []*ChannelConfig{
+		{Type: ChannelEmail, Host: "smtp.example.com", From: "podsync@example.com", To: []string{"me@example.com"}},
+		{Type: ChannelNtfy, URL: "https://ntfy.sh/podsync"},
+		{Type: ChannelGotify, URL: "https://gotify.example.com", Token: "token"},
+		{Type: ChannelTelegram, Token: "123:abc", ChatID: "42"},
+		{Type: ChannelMatrix, URL: "https://matrix.org", Token: "token", Room: "!room:matrix.org"},
+		{Type: ChannelWebhook, URL: "https://hooks.slack.com/services/x", Kinds: []Kind{NewEpisode}},
+	}}
+	assert.NoError(t, valid.Validate())
+
+	for name, config := range map[string]*Config{
+		"unknown type":     {Channels: []*ChannelConfig{{Type: "pager"}}},
+		"missing url":      {Channels: []*ChannelConfig{{Type: ChannelNtfy}}},
+		"missing chat":     {Channels: []*ChannelConfig{{Type: ChannelTelegram, Token: "123:abc"}}},
+		"missing to":       {Channels: []*ChannelConfig{{Type: ChannelEmail, Host: "smtp.example.com", From: "a@example.com"}}},
+		"unknown kind":     {Channels: []*ChannelConfig{{Type: ChannelNtfy, URL: "https://ntfy.sh/x", Kinds: []Kind{"sometimes"}}}},
+		"invalid template": {Templates: map[Kind]*Template{NewEpisode: {Message: "{{.Episode"}}},
+		"negative":         {BrokenAfter: -1},
+	} {
+		assert.Error(t, config.Validate(), name)
+	}
+}
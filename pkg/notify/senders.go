@@ -0,0 +1,287 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/tls"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime"
+	"net"
+	"net/http"
+	"net/smtp"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// NewSender creates a sender of the channel type
+func NewSender(config *ChannelConfig) Sender {
+	timeout := config.Timeout
+	if timeout == 0 {
+		timeout = DefaultTimeout
+	}
+
+	client := &http.Client{Timeout: timeout}
+
+	switch config.Type {
+	case ChannelEmail:
+		return &Email{config: config, timeout: timeout}
+	case ChannelNtfy:
+		return &Ntfy{config: config, client: client}
+	case ChannelGotify:
+		return &Gotify{config: config, client: client}
+	case ChannelTelegram:
+		return &Telegram{config: config, client: client}
+	case ChannelMatrix:
+		return &Matrix{config: config, client: client}
+	default:
+		return &Webhook{config: config, client: client}
+	}
+}
+
+// Ntfy publishes messages to a ntfy topic
+type Ntfy struct {
+	config *ChannelConfig
+	client *http.Client
+}
+
+func (s *Ntfy) Send(ctx context.Context, message *Message) error {
+	headers := map[string]string{
+		// Non-ASCII headers have to be encoded
+		"Title": mime.BEncoding.Encode("UTF-8", message.Title),
+	}
+	if s.config.Priority != 0 {
+		headers["Priority"] = strconv.Itoa(s.config.Priority)
+	}
+	if s.config.Token != "" {
+		headers["Authorization"] = "Bearer " + s.config.Token
+	}
+
+	return send(ctx, s.client, http.MethodPost, s.config.URL, headers, "text/plain; charset=utf-8", []byte(message.Body))
+}
+
+// Gotify pushes messages to a Gotify server
+type Gotify struct {
+	config *ChannelConfig
+	client *http.Client
+}
+
+func (s *Gotify) Send(ctx context.Context, message *Message) error {
+	payload := map[string]interface{}{
+		"title":   message.Title,
+		"message": message.Body,
+	}
+	if s.config.Priority != 0 {
+		payload["priority"] = s.config.Priority
+	}
+
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+
+	endpoint := strings.TrimRight(s.config.URL, "/") + "/message"
+	return send(ctx, s.client, http.MethodPost, endpoint, map[string]string{"X-Gotify-Key": s.config.Token}, "application/json", body)
+}
+
+// Telegram sends messages to a chat with the Telegram Bot API
+type Telegram struct {
+	config *ChannelConfig
+	client *http.Client
+}
+
+func (s *Telegram) Send(ctx context.Context, message *Message) error {
+	// Plain text messages don't need any escaping
+	body, err := json.Marshal(map[string]string{
+		"chat_id": s.config.ChatID,
+		"text":    join(message),
+	})
+	if err != nil {
+		return err
+	}
+
+	api := s.config.URL
+	if api == "" {
+		api = DefaultTelegramURL
+	}
+
+	endpoint := fmt.Sprintf("%s/bot%s/sendMessage", strings.TrimRight(api, "/"), s.config.Token)
+	return send(ctx, s.client, http.MethodPost, endpoint, nil, "application/json", body)
+}
+
+// Matrix sends text messages to a Matrix room
+type Matrix struct {
+	config *ChannelConfig
+	client *http.Client
+}
+
+func (s *Matrix) Send(ctx context.Context, message *Message) error {
+	body, err := json.Marshal(map[string]string{
+		"msgtype": "m.text",
+		"body":    join(message),
+	})
+	if err != nil {
+		return err
+	}
+
+	// Transaction IDs make retried requests idempotent
+	txn := make([]byte, 16)
+	_, _ = rand.Read(txn)
+
+	endpoint := fmt.Sprintf("%s/_matrix/client/v3/rooms/%s/send/m.room.message/%s",
+		strings.TrimRight(s.config.URL, "/"), url.PathEscape(s.config.Room), hex.EncodeToString(txn))
+
+	return send(ctx, s.client, http.MethodPut, endpoint, map[string]string{"Authorization": "Bearer " + s.config.Token}, "application/json", body)
+}
+
+// Webhook posts messages to Slack or Discord compatible incoming webhooks
+type Webhook struct {
+	config *ChannelConfig
+	client *http.Client
+}
+
+// slackEscaper escapes control characters of Slack message formatting
+var slackEscaper = strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;")
+
+func (s *Webhook) Send(ctx context.Context, message *Message) error {
+	text := join(message)
+
+	// Slack reads "text" and Discord reads "content", each ignores the other field
+	body, err := json.Marshal(map[string]string{
+		"text":    slackEscaper.Replace(text),
+		"content": text,
+	})
+	if err != nil {
+		return err
+	}
+
+	return send(ctx, s.client, http.MethodPost, s.config.URL, nil, "application/json", body)
+}
+
+// Email sends messages with SMTP
+type Email struct {
+	config  *ChannelConfig
+	timeout time.Duration
+}
+
+func (s *Email) Send(ctx context.Context, message *Message) error {
+	port := s.config.Port
+	if port == 0 {
+		port = DefaultSMTPPort
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, s.timeout)
+	defer cancel()
+
+	dialer := &net.Dialer{}
+	conn, err := dialer.DialContext(ctx, "tcp", net.JoinHostPort(s.config.Host, strconv.Itoa(port)))
+	if err != nil {
+		return errors.Wrap(err, "failed to connect to SMTP server")
+	}
+
+	deadline, _ := ctx.Deadline()
+	_ = conn.SetDeadline(deadline)
+
+	client, err := smtp.NewClient(conn, s.config.Host)
+	if err != nil {
+		conn.Close()
+		return errors.Wrap(err, "failed to connect to SMTP server")
+	}
+	defer client.Close()
+
+	if ok, _ := client.Extension("STARTTLS"); ok {
+		if err := client.StartTLS(&tls.Config{ServerName: s.config.Host}); err != nil {
+			return errors.Wrap(err, "STARTTLS failed")
+		}
+	}
+
+	if s.config.Username != "" {
+		if err := client.Auth(smtp.PlainAuth("", s.config.Username, s.config.Password, s.config.Host)); err != nil {
+			return errors.Wrap(err, "SMTP authentication failed")
+		}
+	}
+
+	if err := client.Mail(s.config.From); err != nil {
+		return err
+	}
+	for _, to := range s.config.To {
+		if err := client.Rcpt(to); err != nil {
+			return errors.Wrapf(err, "recipient %s rejected", to)
+		}
+	}
+
+	writer, err := client.Data()
+	if err != nil {
+		return err
+	}
+	if _, err := writer.Write(s.compose(message)); err != nil {
+		return err
+	}
+	if err := writer.Close(); err != nil {
+		return err
+	}
+
+	return client.Quit()
+}
+
+func (s *Email) compose(message *Message) []byte {
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "From: %s\r\n", s.config.From)
+	fmt.Fprintf(&buf, "To: %s\r\n", strings.Join(s.config.To, ", "))
+	fmt.Fprintf(&buf, "Subject: %s\r\n", mime.QEncoding.Encode("UTF-8", message.Title))
+	fmt.Fprintf(&buf, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	buf.WriteString("MIME-Version: 1.0\r\n")
+	buf.WriteString("Content-Type: text/plain; charset=UTF-8\r\n")
+	buf.WriteString("Content-Transfer-Encoding: 8bit\r\n")
+	buf.WriteString("\r\n")
+	buf.WriteString(strings.ReplaceAll(message.Body, "\n", "\r\n"))
+	buf.WriteString("\r\n")
+	return buf.Bytes()
+}
+
+// join formats the message for services without a separate title
+func join(message *Message) string {
+	if message.Title == "" {
+		return message.Body
+	}
+	return message.Title + "\n\n" + message.Body
+}
+
+func send(ctx context.Context, client *http.Client, method string, endpoint string, headers map[string]string, contentType string, body []byte) error {
+	req, err := http.NewRequestWithContext(ctx, method, endpoint, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+
+	req.Header.Set("Content-Type", contentType)
+	req.Header.Set("User-Agent", "Podsync")
+	for name, value := range headers {
+		req.Header.Set(name, value)
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		// Don't leak tokens embedded in URLs (e.g. Telegram) to logs
+		var urlErr *url.Error
+		if errors.As(err, &urlErr) {
+			return urlErr.Err
+		}
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 64*1024))
+		return nil
+	}
+
+	data, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+	return errors.Errorf("unexpected status %s: %s", resp.Status, strings.TrimSpace(string(data)))
+}
@@ -0,0 +1,202 @@
+package notify
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type request struct {
+	method string
+	path   string
+	header http.Header
+	body   string
+}
+
+func newServer(t *testing.T, status int) (*httptest.Server, *[]request) {
+	var requests []request
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		requests = append(requests, request{method: r.Method, path: r.URL.Path, header: r.Header, body: string(body)})
+		w.WriteHeader(status)
+	}))
+	t.Cleanup(server.Close)
+	return server, &requests
+}
+
+var testMessage = &Message{Kind: NewEpisode, Title: "New episode: Ünïcode <b>", Body: "Feed: Episode & more"}
+
+func TestNtfy(t *testing.T) {
+	server, requests := newServer(t, http.StatusOK)
+
+	sender := NewSender(&ChannelConfig{Type: ChannelNtfy, URL: server.URL + "/podsync", Token: "tk", Priority: 4})
+	require.NoError(t, sender.Send(context.Background(), testMessage))
+
+	require.Len(t, *requests, 1)
+	req := (*requests)[0]
+	assert.Equal(t, "/podsync", req.path)
+	assert.Equal(t, "Feed: Episode & more", req.body)
+	assert.Equal(t, "=?UTF-8?b?TmV3IGVwaXNvZGU6IMOcbsOvY29kZSA8Yj4=?=", req.header.Get("Title"))
+	assert.Equal(t, "4", req.header.Get("Priority"))
+	assert.Equal(t, "Bearer tk", req.header.Get("Authorization"))
+}
+
+func TestGotify(t *testing.T) {
+	server, requests := newServer(t, http.StatusOK)
+
+	sender := NewSender(&ChannelConfig{Type: ChannelGotify, URL: server.URL + "/", Token: "app"})
+	require.NoError(t, sender.Send(context.Background(), testMessage))
+
+	require.Len(t, *requests, 1)
+	req := (*requests)[0]
+	assert.Equal(t, "/message", req.path)
+	assert.Equal(t, "app", req.header.Get("X-Gotify-Key"))
+	assert.JSONEq(t, `{"title": "New episode: Ünïcode <b>", "message": "Feed: Episode & more"}`, req.body)
+}
+
+func TestTelegram(t *testing.T) {
+	server, requests := newServer(t, http.StatusOK)
+
+	sender := NewSender(&ChannelConfig{Type: ChannelTelegram, URL: server.URL, Token: "123:abc", ChatID: "-100"})
+	require.NoError(t, sender.Send(context.Background(), testMessage))
+
+	require.Len(t, *requests, 1)
+	req := (*requests)[0]
+	assert.Equal(t, "/bot123:abc/sendMessage", req.path)
+	assert.JSONEq(t, `{"chat_id": "-100", "text": "New episode: Ünïcode <b>\n\nFeed: Episode & more"}`, req.body)
+}
+
+func TestTelegram_ErrorHidesToken(t *testing.T) {
+	sender := NewSender(&ChannelConfig{Type: ChannelTelegram, URL: "http://127.0.0.1:1", Token: "secret-token", ChatID: "1"})
+	err := sender.Send(context.Background(), testMessage)
+	require.Error(t, err)
+	assert.NotContains(t, err.Error(), "secret-token")
+}
+
+func TestMatrix(t *testing.T) {
+	server, requests := newServer(t, http.StatusOK)
+
+	sender := NewSender(&ChannelConfig{Type: ChannelMatrix, URL: server.URL, Token: "tk", Room: "!room:example.com"})
+	require.NoError(t, sender.Send(context.Background(), testMessage))
+
+	require.Len(t, *requests, 1)
+	req := (*requests)[0]
+	assert.Equal(t, http.MethodPut, req.method)
+	assert.True(t, strings.HasPrefix(req.path, "/_matrix/client/v3/rooms/!room:example.com/send/m.room.message/"), req.path)
+	assert.Equal(t, "Bearer tk", req.header.Get("Authorization"))
+	assert.JSONEq(t, `{"msgtype": "m.text", "body": "New episode: Ünïcode <b>\n\nFeed: Episode & more"}`, req.body)
+}
+
+func TestWebhook(t *testing.T) {
+	server, requests := newServer(t, http.StatusNoContent)
+
+	sender := NewSender(&ChannelConfig{Type: ChannelWebhook, URL: server.URL})
+	require.NoError(t, sender.Send(context.Background(), testMessage))
+
+	require.Len(t, *requests, 1)
+
+	var payload map[string]string
+	require.NoError(t, json.Unmarshal([]byte((*requests)[0].body), &payload))
+	assert.Equal(t, "New episode: Ünïcode &lt;b&gt;\n\nFeed: Episode &amp; more", payload["text"])
+	assert.Equal(t, "New episode: Ünïcode <b>\n\nFeed: Episode & more", payload["content"])
+}
+
+func TestWebhook_Status(t *testing.T) {
+	server, _ := newServer(t, http.StatusBadRequest)
+
+	sender := NewSender(&ChannelConfig{Type: ChannelWebhook, URL: server.URL})
+	assert.Error(t, sender.Send(context.Background(), testMessage))
+}
+
+// smtpServer is a minimal SMTP server accepting a single message
+func smtpServer(t *testing.T) (string, int, chan string) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	t.Cleanup(func() { listener.Close() })
+
+	received := make(chan string, 1)
+
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+
+		var (
+			reader = bufio.NewReader(conn)
+			log    strings.Builder
+		)
+
+		reply := func(line string) { fmt.Fprintf(conn, "%s\r\n", line) }
+		reply("220 localhost ESMTP")
+
+		for {
+			line, err := reader.ReadString('\n')
+			if err != nil {
+				return
+			}
+			log.WriteString(line)
+
+			switch cmd := strings.ToUpper(strings.TrimSpace(line)); {
+			case strings.HasPrefix(cmd, "EHLO"):
+				reply("250 localhost")
+			case strings.HasPrefix(cmd, "MAIL"), strings.HasPrefix(cmd, "RCPT"):
+				reply("250 OK")
+			case cmd == "DATA":
+				reply("354 Go ahead")
+				for {
+					line, err := reader.ReadString('\n')
+					if err != nil {
+						return
+					}
+					if line == ".\r\n" {
+						break
+					}
+					log.WriteString(line)
+				}
+				reply("250 Queued")
+			case cmd == "QUIT":
+				reply("221 Bye")
+				received <- log.String()
+				return
+			default:
+				reply("502 Not implemented")
+			}
+		}
+	}()
+
+	addr := listener.Addr().(*net.TCPAddr)
+	return addr.IP.String(), addr.Port, received
+}
+
+func TestEmail(t *testing.T) {
+	host, port, received := smtpServer(t)
+
+	sender := NewSender(&ChannelConfig{
+		Type: ChannelEmail,
+		Host: host,
+		Port: port,
+		From: "podsync@example.com",
+		To:   []string{"a@example.com", "b@example.com"},
+	})
+	require.NoError(t, sender.Send(context.Background(), testMessage))
+
+	session := <-received
+	assert.Contains(t, session, "MAIL FROM:<podsync@example.com>")
+	assert.Contains(t, session, "RCPT TO:<a@example.com>")
+	assert.Contains(t, session, "RCPT TO:<b@example.com>")
+	assert.Contains(t, session, "To: a@example.com, b@example.com\r\n")
+	assert.Contains(t, session, "Subject: =?UTF-8?q?New_episode:_=C3=9Cn=C3=AFcode_<b>?=\r\n")
+	assert.Contains(t, session, "\r\n\r\nFeed: Episode & more\r\n")
+}
@@ -244,7 +244,7 @@ func (dl *YoutubeDl) Download(ctx context.Context, feedConfig *feed.Config, epis
 	}
 
 	// filePath now with the final extension
-	filePath = filepath.Join(tmpDir, feed.EpisodeName(feedConfig, episode))
+	filePath = filepath.Join(tmpDir, feed.SourceEpisodeName(feedConfig, episode))
 	f, err := os.Open(filePath)
 	if err != nil {
 		return nil, errors.Wrap(err, "failed to open downloaded file")
@@ -57,63 +57,34 @@ func (s *Service) Run(ctx context.Context) (*Result, error) {
 			}
 
 			result.Episodes++
-			newName := feed.EpisodeName(cfg, episode)
-			newPath := fmt.Sprintf("%s/%s", feedID, newName)
-			legacyName := feed.LegacyEpisodeName(cfg, episode)
-			legacyPath := fmt.Sprintf("%s/%s", feedID, legacyName)
-
-			newSize, newErr := s.fs.Size(ctx, newPath)
-			if newErr == nil {
-				result.AlreadyGood++
-				return s.updateEpisode(feedID, episode.ID, newSize)
-			}
-			if !os.IsNotExist(newErr) {
-				return errors.Wrapf(newErr, "failed to stat target file %q", newPath)
-			}
-
-			if _, legacyErr := s.fs.Size(ctx, legacyPath); legacyErr != nil {
-				if os.IsNotExist(legacyErr) {
-					result.MissingOld++
-					return nil
-				}
-				return errors.Wrapf(legacyErr, "failed to stat legacy file %q", legacyPath)
-			}
-
-			if s.dryRun {
-				result.Migrated++
-				return nil
-			}
-
-			if _, existingErr := s.fs.Size(ctx, newPath); existingErr == nil {
-				result.SkippedDueToExistingTarget++
-				return nil
-			} else if !os.IsNotExist(existingErr) {
-				return errors.Wrapf(existingErr, "failed to stat target file %q during migration", newPath)
-			}
-
-			legacyFile, err := s.fs.Open(legacyPath)
+			size, found, err := s.migrateFile(ctx, cfg, episode, result)
 			if err != nil {
-				return errors.Wrapf(err, "failed to open legacy file %q", legacyPath)
-			}
-
-			size, err := s.fs.Create(ctx, newPath, legacyFile)
-			closeErr := legacyFile.Close()
-			if err != nil {
-				return errors.Wrapf(err, "failed to create migrated file %q", newPath)
+				return err
 			}
-			if closeErr != nil {
-				return errors.Wrapf(closeErr, "failed to close legacy file %q", legacyPath)
+			if found {
+				if err := s.updateEpisode(feedID, episode.ID, "", size); err != nil {
+					return err
+				}
 			}
 
-			if err := s.fs.Delete(ctx, legacyPath); err != nil && !os.IsNotExist(err) {
-				return errors.Wrapf(err, "failed to delete legacy file %q", legacyPath)
-			}
+			// Renditions of an episode are migrated along with the main file
+			for name := range episode.Renditions {
+				rendition := cfg.FindRendition(name)
+				if rendition == nil {
+					continue
+				}
 
-			if err := s.updateEpisode(feedID, episode.ID, size); err != nil {
-				return err
+				size, found, err := s.migrateFile(ctx, cfg.RenditionConfig(rendition), episode, result)
+				if err != nil {
+					return err
+				}
+				if found {
+					if err := s.updateEpisode(feedID, episode.ID, name, size); err != nil {
+						return err
+					}
+				}
 			}
 
-			result.Migrated++
 			return nil
 		})
 		if err != nil {
@@ -124,12 +95,80 @@ func (s *Service) Run(ctx context.Context) (*Result, error) {
 	return result, allErr.ErrorOrNil()
 }
 
-func (s *Service) updateEpisode(feedID string, episodeID string, size int64) error {
+// migrateFile moves a single episode file to its current name.
+// Returns the file size and whether the file exists under the new name.
+func (s *Service) migrateFile(ctx context.Context, cfg *feed.Config, episode *model.Episode, result *Result) (int64, bool, error) {
+	newName := feed.EpisodeName(cfg, episode)
+	newPath := fmt.Sprintf("%s/%s", cfg.ID, newName)
+	legacyName := feed.LegacyEpisodeName(cfg, episode)
+	legacyPath := fmt.Sprintf("%s/%s", cfg.ID, legacyName)
+
+	newSize, newErr := s.fs.Size(ctx, newPath)
+	if newErr == nil {
+		result.AlreadyGood++
+		return newSize, true, nil
+	}
+	if !os.IsNotExist(newErr) {
+		return 0, false, errors.Wrapf(newErr, "failed to stat target file %q", newPath)
+	}
+
+	if _, legacyErr := s.fs.Size(ctx, legacyPath); legacyErr != nil {
+		if os.IsNotExist(legacyErr) {
+			result.MissingOld++
+			return 0, false, nil
+		}
+		return 0, false, errors.Wrapf(legacyErr, "failed to stat legacy file %q", legacyPath)
+	}
+
+	if s.dryRun {
+		result.Migrated++
+		return 0, false, nil
+	}
+
+	if _, existingErr := s.fs.Size(ctx, newPath); existingErr == nil {
+		result.SkippedDueToExistingTarget++
+		return 0, false, nil
+	} else if !os.IsNotExist(existingErr) {
+		return 0, false, errors.Wrapf(existingErr, "failed to stat target file %q during migration", newPath)
+	}
+
+	legacyFile, err := s.fs.Open(legacyPath)
+	if err != nil {
+		return 0, false, errors.Wrapf(err, "failed to open legacy file %q", legacyPath)
+	}
+
+	size, err := s.fs.Create(ctx, newPath, legacyFile)
+	closeErr := legacyFile.Close()
+	if err != nil {
+		return 0, false, errors.Wrapf(err, "failed to create migrated file %q", newPath)
+	}
+	if closeErr != nil {
+		return 0, false, errors.Wrapf(closeErr, "failed to close legacy file %q", legacyPath)
+	}
+
+	if err := s.fs.Delete(ctx, legacyPath); err != nil && !os.IsNotExist(err) {
+		return 0, false, errors.Wrapf(err, "failed to delete legacy file %q", legacyPath)
+	}
+
+	result.Migrated++
+	return size, true, nil
+}
+
+// updateEpisode records the size of the migrated file, rendition is empty for the main episode file
+func (s *Service) updateEpisode(feedID string, episodeID string, rendition string, size int64) error {
 	if s.dryRun {
 		return nil
 	}
 
 	return s.db.UpdateEpisode(feedID, episodeID, func(episode *model.Episode) error {
+		if rendition != "" {
+			if episode.Renditions == nil {
+				episode.Renditions = map[string]int64{}
+			}
+			episode.Renditions[rendition] = size
+			return nil
+		}
+
 		episode.Size = size
 		episode.Status = model.EpisodeDownloaded
 		return nil
@@ -36,6 +36,26 @@ func (t *testDB) GetFeed(_ context.Context, _ string) (*model.Feed, error) {
 func (t *testDB) WalkFeeds(_ context.Context, _ func(feed *model.Feed) error) error { return nil }
 func (t *testDB) DeleteFeed(_ context.Context, _ string) error                      { return errors.New("not implemented") }
 func (t *testDB) DeleteEpisode(_ string, _ string) error                            { return errors.New("not implemented") }
+func (t *testDB) AddToken(_ context.Context, _ *model.Token) error {
+	return errors.New("not implemented")
+}
+func (t *testDB) GetToken(_ context.Context, _ string) (*model.Token, error) {
+	return nil, errors.New("not implemented")
+}
+func (t *testDB) CountEpisodes(_ context.Context, _ model.EpisodeStatus, _ time.Time) (int, error) {
+	return 0, errors.New("not implemented")
+}
+func (t *testDB) WalkTokens(_ context.Context, _ func(token *model.Token) error) error { return nil }
+func (t *testDB) DeleteToken(_ context.Context, _ string) error                        { return errors.New("not implemented") }
+func (t *testDB) RecordAccess(_ context.Context, _ *model.Access) error {
+	return errors.New("not implemented")
+}
+func (t *testDB) WalkAccess(_ context.Context, _ string, _ func(access *model.Access) error) error {
+	return nil
+}
+func (t *testDB) DeleteAccess(_ context.Context, _ string, _ string) error {
+	return errors.New("not implemented")
+}
 
 func (t *testDB) GetEpisode(_ context.Context, feedID string, episodeID string) (*model.Episode, error) {
 	if f, ok := t.episodes[feedID]; ok {
@@ -213,3 +233,49 @@ func TestRunFailsOnUnexpectedSecondTargetStatError(t *testing.T) {
 	_, err = baseStorage.Size(ctx, legacyPath)
 	require.NoError(t, err)
 }
+
+func TestRunMigratesRenditions(t *testing.T) {
+	ctx := context.Background()
+	tmpDir := t.TempDir()
+
+	storage, err := fs.NewLocal(tmpDir, false, false)
+	require.NoError(t, err)
+
+	tdb := newTestDB()
+	feedID := "A"
+	episode := &model.Episode{
+		ID:         "abc123",
+		Title:      "Title",
+		PubDate:    time.Date(2026, 2, 8, 9, 0, 0, 0, time.UTC),
+		Status:     model.EpisodeDownloaded,
+		Renditions: map[string]int64{"audio": 1},
+	}
+	tdb.episodes[feedID] = map[string]*model.Episode{episode.ID: episode}
+
+	cfg := &feed.Config{
+		ID:               feedID,
+		Format:           model.FormatVideo,
+		FilenameTemplate: "{{title}}_{{id}}",
+		Renditions: []*feed.Rendition{
+			{Name: "audio", TranscodeProfile: &feed.TranscodeProfile{AudioCodec: "opus"}},
+		},
+	}
+	audioCfg := cfg.RenditionConfig(cfg.Renditions[0])
+
+	_, err = storage.Create(ctx, filepath.Join(feedID, feed.LegacyEpisodeName(cfg, episode)), strings.NewReader("video-bytes"))
+	require.NoError(t, err)
+	_, err = storage.Create(ctx, filepath.Join(audioCfg.ID, feed.LegacyEpisodeName(audioCfg, episode)), strings.NewReader("audio"))
+	require.NoError(t, err)
+
+	svc := New(map[string]*feed.Config{feedID: cfg}, tdb, storage, false)
+	result, err := svc.Run(ctx)
+	require.NoError(t, err)
+
+	_, err = storage.Size(ctx, filepath.Join("A-audio", "Title_abc123.opus"))
+	require.NoError(t, err)
+
+	assert.Equal(t, int64(len("video-bytes")), episode.Size)
+	assert.Equal(t, int64(len("audio")), episode.Renditions["audio"])
+	assert.Equal(t, 1, result.Episodes)
+	assert.Equal(t, 2, result.Migrated)
+}
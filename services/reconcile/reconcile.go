@@ -0,0 +1,463 @@
+package reconcile
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/hashicorp/go-multierror"
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/mxpv/podsync/pkg/db"
+	"github.com/mxpv/podsync/pkg/feed"
+	"github.com/mxpv/podsync/pkg/fs"
+	"github.com/mxpv/podsync/pkg/model"
+)
+
+// Action is what to do with orphaned files
+type Action string
+
+const (
+	// ActionReport only logs discrepancies and doesn't change anything
+	ActionReport = Action("report")
+	// ActionDelete deletes orphaned files and fixes episode records
+	ActionDelete = Action("delete")
+	// ActionQuarantine moves orphaned files to QuarantineDir and fixes episode records
+	ActionQuarantine = Action("quarantine")
+)
+
+const (
+	// QuarantineDir is the storage directory orphaned files are moved to
+	QuarantineDir = ".quarantine"
+	// DefaultGracePeriod protects files that are being written by a concurrent update
+	DefaultGracePeriod = 6 * time.Hour
+
+	tempDirPrefix = "podsync-"
+	opmlName      = "podsync.opml"
+)
+
+// Config configures storage reconciliation
+type Config struct {
+	// Schedule is an optional cron expression to run reconciliation periodically
+	Schedule string `toml:"schedule"`
+	// Action is what to do with orphaned files: "report" (default), "delete" or "quarantine"
+	Action Action `toml:"action"`
+	// GracePeriod is the minimum age of orphaned files and temp dirs to act on
+	GracePeriod time.Duration `toml:"grace_period"`
+}
+
+// Validate checks the reconcile configuration
+func (c Config) Validate() error {
+	switch c.Action {
+	case "", ActionReport, ActionDelete, ActionQuarantine:
+	default:
+		return errors.Errorf("unknown action %q (supported: report, delete, quarantine)", c.Action)
+	}
+
+	if c.GracePeriod < 0 {
+		return errors.New("grace_period can't be negative")
+	}
+
+	return nil
+}
+
+// Result summarizes discrepancies found between storage and database
+type Result struct {
+	Files          int
+	Orphans        int
+	OrphanSize     int64
+	Missing        int
+	SizeMismatches int
+	TempDirs       int
+}
+
+type Service struct {
+	feeds       map[string]*feed.Config
+	db          db.Storage
+	fs          fs.Storage
+	action      Action
+	gracePeriod time.Duration
+	tempDir     string
+}
+
+func New(feeds map[string]*feed.Config, db db.Storage, storage fs.Storage, action Action, gracePeriod time.Duration) *Service {
+	if action == "" {
+		action = ActionReport
+	}
+
+	if gracePeriod == 0 {
+		gracePeriod = DefaultGracePeriod
+	}
+
+	return &Service{
+		feeds:       feeds,
+		db:          db,
+		fs:          storage,
+		action:      action,
+		gracePeriod: gracePeriod,
+		tempDir:     os.TempDir(),
+	}
+}
+
+// missingFile is a downloaded episode file (or rendition) absent from the storage
+type missingFile struct {
+	feedID    string
+	episodeID string
+	rendition string
+}
+
+// sizeMismatch is an episode file with a size different from the one recorded in database
+type sizeMismatch struct {
+	missingFile
+	size int64
+}
+
+// Run compares storage contents with database records and fixes discrepancies according to the configured action
+func (s *Service) Run(ctx context.Context) (*Result, error) {
+	var (
+		allErr *multierror.Error
+		result = &Result{}
+		now    = time.Now()
+	)
+
+	log.Infof("reconciling storage (action=%s)", s.action)
+
+	files, err := s.fs.List(ctx, "")
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to list storage")
+	}
+
+	stored := make(map[string]fs.File, len(files))
+	for _, file := range files {
+		stored[file.Name] = file
+	}
+
+	// Collect files referenced by the database
+	var (
+		expected   = map[string]struct{}{opmlName: {}}
+		known      = map[string]struct{}{}
+		missing    []missingFile
+		mismatches []sizeMismatch
+	)
+
+	for _, cfg := range s.configs() {
+		known[cfg.ID] = struct{}{}
+		expected[cfg.ID+".xml"] = struct{}{}
+
+		if info, err := s.db.GetFeed(ctx, cfg.SourceID()); err == nil {
+			if info.Artwork != "" {
+				expected[info.Artwork] = struct{}{}
+			}
+		} else if !errors.Is(err, model.ErrNotFound) {
+			return nil, errors.Wrapf(err, "failed to query feed %q", cfg.SourceID())
+		}
+
+		if err := s.db.WalkEpisodes(ctx, cfg.SourceID(), func(episode *model.Episode) error {
+			if episode.Artwork != "" {
+				expected[episode.Artwork] = struct{}{}
+			}
+
+			// Renditions removed from the config still belong to the feed
+			for name := range episode.Renditions {
+				known[fmt.Sprintf("%s-%s", cfg.SourceID(), name)] = struct{}{}
+			}
+
+			if episode.Status != model.EpisodeDownloaded {
+				return nil
+			}
+
+			size := episode.Size
+			if cfg.Rendition != "" {
+				var ok bool
+				if size, ok = episode.Renditions[cfg.Rendition]; !ok {
+					return nil
+				}
+			}
+
+			var (
+				name = fmt.Sprintf("%s/%s", cfg.ID, feed.EpisodeName(cfg, episode))
+				ref  = missingFile{feedID: cfg.SourceID(), episodeID: episode.ID, rendition: cfg.Rendition}
+			)
+
+			expected[name] = struct{}{}
+
+			file, ok := stored[name]
+			if !ok {
+				log.WithFields(log.Fields{"feed_id": cfg.ID, "episode_id": episode.ID, "path": name}).Warn("episode file is missing")
+				missing = append(missing, ref)
+				return nil
+			}
+
+			if size > 0 && file.Size != size {
+				log.WithFields(log.Fields{"feed_id": cfg.ID, "episode_id": episode.ID, "path": name}).
+					Warnf("episode size mismatch (database: %d, storage: %d)", size, file.Size)
+				mismatches = append(mismatches, sizeMismatch{missingFile: ref, size: file.Size})
+			}
+
+			return nil
+		}); err != nil {
+			return nil, errors.Wrapf(err, "failed to walk episodes of %q", cfg.ID)
+		}
+	}
+
+	// Feeds removed from the config are handled by the removed feeds policy
+	retained, err := s.removedFeeds(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	result.Files = len(files)
+	result.Missing = len(missing)
+	result.SizeMismatches = len(mismatches)
+
+	// Anything else under a feed directory, or left from a feed the database doesn't know about, is an orphan.
+	// Only orphans of configured feeds are acted on, other files might not be written by podsync.
+	for _, file := range files {
+		if _, ok := expected[file.Name]; ok || !isManaged(file.Name) {
+			continue
+		}
+
+		logger := log.WithFields(log.Fields{"path": file.Name, "size": file.Size})
+
+		if _, ok := retained[owner(file.Name)]; ok {
+			logger.Debug("skipping file of removed feed")
+			continue
+		}
+
+		if now.Sub(file.ModTime) < s.gracePeriod {
+			logger.Debug("skipping recently modified file")
+			continue
+		}
+
+		result.Orphans++
+		result.OrphanSize += file.Size
+
+		if _, ok := known[owner(file.Name)]; !ok {
+			logger.Warn("orphaned file of unknown feed (report only)")
+			continue
+		}
+
+		logger.Warn("orphaned file")
+		if err := s.removeOrphan(ctx, file.Name); err != nil {
+			allErr = multierror.Append(allErr, err)
+		}
+	}
+
+	if s.action != ActionReport {
+		for _, ref := range missing {
+			if err := s.markMissing(ref); err != nil {
+				allErr = multierror.Append(allErr, err)
+			}
+		}
+
+		for _, mismatch := range mismatches {
+			if err := s.fixSize(mismatch); err != nil {
+				allErr = multierror.Append(allErr, err)
+			}
+		}
+	}
+
+	tempDirs, err := s.cleanupTempDirs(now)
+	if err != nil {
+		allErr = multierror.Append(allErr, err)
+	}
+	result.TempDirs = tempDirs
+
+	return result, allErr.ErrorOrNil()
+}
+
+// configs returns configurations of all feeds and their renditions sorted by ID
+func (s *Service) configs() []*feed.Config {
+	var configs []*feed.Config
+	for _, cfg := range s.feeds {
+		configs = append(configs, cfg)
+		configs = append(configs, cfg.RenditionConfigs()...)
+	}
+
+	sort.Slice(configs, func(i, j int) bool {
+		return configs[i].ID < configs[j].ID
+	})
+
+	return configs
+}
+
+// removedFeeds returns IDs of feeds and renditions saved to the database, but missing from the config
+func (s *Service) removedFeeds(ctx context.Context) (map[string]struct{}, error) {
+	var removed []string
+	if err := s.db.WalkFeeds(ctx, func(f *model.Feed) error {
+		if _, ok := s.feeds[f.ID]; !ok {
+			removed = append(removed, f.ID)
+		}
+		return nil
+	}); err != nil {
+		return nil, errors.Wrap(err, "failed to walk feeds")
+	}
+
+	ids := map[string]struct{}{}
+	for _, feedID := range removed {
+		ids[feedID] = struct{}{}
+		if err := s.db.WalkEpisodes(ctx, feedID, func(episode *model.Episode) error {
+			for name := range episode.Renditions {
+				ids[fmt.Sprintf("%s-%s", feedID, name)] = struct{}{}
+			}
+			return nil
+		}); err != nil {
+			return nil, errors.Wrapf(err, "failed to walk episodes of %q", feedID)
+		}
+	}
+
+	return ids, nil
+}
+
+// owner returns the ID of the feed a storage path belongs to
+func owner(name string) string {
+	if dir := feedDir(name); dir != "" {
+		return dir
+	}
+
+	return strings.TrimSuffix(name, ".xml")
+}
+
+// isManaged returns true for storage paths written by podsync: XML feeds and files in feed directories.
+// Other files in the storage root and quarantined files are left alone.
+func isManaged(name string) bool {
+	dir := feedDir(name)
+	if dir == QuarantineDir {
+		return false
+	}
+
+	if dir == "" {
+		return strings.HasSuffix(name, ".xml")
+	}
+
+	return true
+}
+
+// feedDir returns the top level directory of a storage path, or an empty string for files in the root
+func feedDir(name string) string {
+	dir, _, ok := strings.Cut(name, "/")
+	if !ok {
+		return ""
+	}
+
+	return dir
+}
+
+func (s *Service) removeOrphan(ctx context.Context, name string) error {
+	switch s.action {
+	case ActionDelete:
+		if err := s.fs.Delete(ctx, name); err != nil && !os.IsNotExist(err) {
+			return errors.Wrapf(err, "failed to delete orphaned file %q", name)
+		}
+	case ActionQuarantine:
+		if err := s.quarantine(ctx, name); err != nil {
+			return errors.Wrapf(err, "failed to quarantine orphaned file %q", name)
+		}
+	}
+
+	return nil
+}
+
+func (s *Service) quarantine(ctx context.Context, name string) error {
+	file, err := s.fs.Open("/" + name)
+	if err != nil {
+		return err
+	}
+
+	_, err = s.fs.Create(ctx, fmt.Sprintf("%s/%s", QuarantineDir, name), file)
+	closeErr := file.Close()
+	if err != nil {
+		return err
+	}
+	if closeErr != nil {
+		return closeErr
+	}
+
+	return s.fs.Delete(ctx, name)
+}
+
+// markMissing re-marks an episode whose file vanished, so the updater downloads it again
+func (s *Service) markMissing(ref missingFile) error {
+	err := s.db.UpdateEpisode(ref.feedID, ref.episodeID, func(episode *model.Episode) error {
+		if episode.Status != model.EpisodeDownloaded {
+			return nil
+		}
+
+		if ref.rendition != "" {
+			delete(episode.Renditions, ref.rendition)
+			return nil
+		}
+
+		episode.Status = model.EpisodeNew
+		episode.Size = 0
+		episode.Renditions = nil
+		return nil
+	})
+	if err != nil && !errors.Is(err, model.ErrNotFound) {
+		return errors.Wrapf(err, "failed to update episode %q of %q", ref.episodeID, ref.feedID)
+	}
+
+	return nil
+}
+
+func (s *Service) fixSize(mismatch sizeMismatch) error {
+	err := s.db.UpdateEpisode(mismatch.feedID, mismatch.episodeID, func(episode *model.Episode) error {
+		if mismatch.rendition != "" {
+			if _, ok := episode.Renditions[mismatch.rendition]; ok {
+				episode.Renditions[mismatch.rendition] = mismatch.size
+			}
+			return nil
+		}
+
+		episode.Size = mismatch.size
+		return nil
+	})
+	if err != nil && !errors.Is(err, model.ErrNotFound) {
+		return errors.Wrapf(err, "failed to update size of episode %q of %q", mismatch.episodeID, mismatch.feedID)
+	}
+
+	return nil
+}
+
+// cleanupTempDirs removes temp directories left behind by crashed downloads and post-processing
+func (s *Service) cleanupTempDirs(now time.Time) (int, error) {
+	entries, err := os.ReadDir(s.tempDir)
+	if err != nil {
+		return 0, errors.Wrapf(err, "failed to read temp dir %q", s.tempDir)
+	}
+
+	var (
+		count  int
+		allErr *multierror.Error
+	)
+
+	for _, entry := range entries {
+		if !entry.IsDir() || !strings.HasPrefix(entry.Name(), tempDirPrefix) {
+			continue
+		}
+
+		info, err := entry.Info()
+		if err != nil || now.Sub(info.ModTime()) < s.gracePeriod {
+			continue
+		}
+
+		path := filepath.Join(s.tempDir, entry.Name())
+		log.WithField("path", path).Warn("stale temp directory")
+		count++
+
+		if s.action == ActionReport {
+			continue
+		}
+
+		if err := os.RemoveAll(path); err != nil {
+			allErr = multierror.Append(allErr, errors.Wrapf(err, "failed to remove temp dir %q", path))
+		}
+	}
+
+	return count, allErr.ErrorOrNil()
+}
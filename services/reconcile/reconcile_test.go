@@ -0,0 +1,206 @@
+package reconcile
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/mxpv/podsync/pkg/db"
+	"github.com/mxpv/podsync/pkg/feed"
+	"github.com/mxpv/podsync/pkg/fs"
+	"github.com/mxpv/podsync/pkg/model"
+)
+
+type fixture struct {
+	database *db.Badger
+	storage  *fs.Local
+	dataDir  string
+	tempDir  string
+	feeds    map[string]*feed.Config
+}
+
+func newFixture(t *testing.T) *fixture {
+	ctx := context.Background()
+
+	database, err := db.NewBadger(&db.Config{Dir: t.TempDir()})
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = database.Close() })
+
+	dataDir := t.TempDir()
+	storage, err := fs.NewLocal(dataDir, false, false)
+	require.NoError(t, err)
+
+	err = database.AddFeed(ctx, "a", &model.Feed{ID: "a", Episodes: []*model.Episode{
+		{ID: "1", Status: model.EpisodeDownloaded, Size: 3},
+		{ID: "2", Status: model.EpisodeDownloaded, Size: 3},
+		{ID: "3", Status: model.EpisodeDownloaded, Size: 3},
+		{ID: "4", Status: model.EpisodeNew},
+	}})
+	require.NoError(t, err)
+
+	for name, size := range map[string]int{
+		"a.xml":         1,
+		"podsync.opml":  1,
+		"a/1.mp3":       3,
+		"a/3.mp3":       5, // Size mismatch
+		"a/old.mp3":     3, // Orphan
+		"removed.xml":   1, // Removed feed
+		"removed/x.mp3": 3,
+		"notes.txt":     1, // Unmanaged
+	} {
+		_, err := storage.Create(ctx, name, bytes.NewReader(make([]byte, size)))
+		require.NoError(t, err)
+	}
+
+	tempDir := t.TempDir()
+	stale := filepath.Join(tempDir, "podsync-123")
+	require.NoError(t, os.Mkdir(stale, 0755))
+	require.NoError(t, os.Chtimes(stale, time.Now().Add(-48*time.Hour), time.Now().Add(-48*time.Hour)))
+	require.NoError(t, os.Mkdir(filepath.Join(tempDir, "podsync-456"), 0755))
+
+	return &fixture{
+		database: database,
+		storage:  storage,
+		dataDir:  dataDir,
+		tempDir:  tempDir,
+		feeds:    map[string]*feed.Config{"a": {ID: "a", Format: model.FormatAudio}},
+	}
+}
+
+func (f *fixture) run(t *testing.T, action Action) *Result {
+	service := New(f.feeds, f.database, f.storage, action, time.Nanosecond)
+	service.tempDir = f.tempDir
+
+	result, err := service.Run(context.Background())
+	require.NoError(t, err)
+	return result
+}
+
+func (f *fixture) exists(name string) bool {
+	_, err := os.Stat(filepath.Join(f.dataDir, name))
+	return err == nil
+}
+
+func TestReconcile_Report(t *testing.T) {
+	f := newFixture(t)
+
+	result := f.run(t, ActionReport)
+	assert.Equal(t, 8, result.Files)
+	assert.Equal(t, 3, result.Orphans)
+	assert.EqualValues(t, 7, result.OrphanSize)
+	assert.Equal(t, 1, result.Missing)
+	assert.Equal(t, 1, result.SizeMismatches)
+	assert.Equal(t, 2, result.TempDirs)
+
+	// Nothing changes
+	assert.True(t, f.exists("a/old.mp3"))
+	assert.True(t, f.exists("removed/x.mp3"))
+
+	episode, err := f.database.GetEpisode(context.Background(), "a", "2")
+	require.NoError(t, err)
+	assert.Equal(t, model.EpisodeDownloaded, episode.Status)
+
+	_, err = os.Stat(filepath.Join(f.tempDir, "podsync-123"))
+	assert.NoError(t, err)
+}
+
+func TestReconcile_Delete(t *testing.T) {
+	f := newFixture(t)
+
+	f.run(t, ActionDelete)
+
+	assert.False(t, f.exists("a/old.mp3"))
+	assert.True(t, f.exists("a/1.mp3"))
+	assert.True(t, f.exists("a.xml"))
+	assert.True(t, f.exists("podsync.opml"))
+	assert.True(t, f.exists("notes.txt"))
+
+	// Files of feeds neither configured nor known to the database are only reported
+	assert.True(t, f.exists("removed/x.mp3"))
+	assert.True(t, f.exists("removed.xml"))
+
+	// Vanished episode is downloaded again
+	episode, err := f.database.GetEpisode(context.Background(), "a", "2")
+	require.NoError(t, err)
+	assert.Equal(t, model.EpisodeNew, episode.Status)
+
+	episode, err = f.database.GetEpisode(context.Background(), "a", "3")
+	require.NoError(t, err)
+	assert.EqualValues(t, 5, episode.Size)
+
+	_, err = os.Stat(filepath.Join(f.tempDir, "podsync-123"))
+	assert.True(t, os.IsNotExist(err))
+}
+
+func TestReconcile_Quarantine(t *testing.T) {
+	f := newFixture(t)
+
+	f.run(t, ActionQuarantine)
+
+	assert.False(t, f.exists("a/old.mp3"))
+	assert.True(t, f.exists(".quarantine/a/old.mp3"))
+	assert.True(t, f.exists("removed/x.mp3"))
+
+	// Quarantined files are not orphans on the next run, files of unknown feeds are reported again
+	result := f.run(t, ActionReport)
+	assert.Equal(t, 2, result.Orphans)
+}
+
+func TestReconcile_GracePeriod(t *testing.T) {
+	f := newFixture(t)
+
+	service := New(f.feeds, f.database, f.storage, ActionDelete, time.Hour)
+	service.tempDir = f.tempDir
+
+	result, err := service.Run(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, 0, result.Orphans)
+	assert.Equal(t, 1, result.TempDirs)
+	assert.True(t, f.exists("a/old.mp3"))
+}
+
+func TestReconcile_SkipsRemovedFeeds(t *testing.T) {
+	f := newFixture(t)
+
+	// Data of a feed removed from the config is left to the removed feeds policy
+	err := f.database.AddFeed(context.Background(), "removed", &model.Feed{ID: "removed"})
+	require.NoError(t, err)
+
+	result := f.run(t, ActionDelete)
+	assert.Equal(t, 1, result.Orphans)
+	assert.True(t, f.exists("removed/x.mp3"))
+	assert.True(t, f.exists("removed.xml"))
+}
+
+func TestConfig_Validate(t *testing.T) {
+	assert.NoError(t, Config{}.Validate())
+	assert.NoError(t, Config{Action: ActionQuarantine}.Validate())
+	assert.Error(t, Config{Action: "purge"}.Validate())
+	assert.Error(t, Config{GracePeriod: -time.Hour}.Validate())
+}
+
+func TestReconcile_RemovedRenditions(t *testing.T) {
+	f := newFixture(t)
+	ctx := context.Background()
+
+	// Rendition dropped from the config, recorded in the database
+	require.NoError(t, f.database.UpdateEpisode("a", "1", func(episode *model.Episode) error {
+		episode.Renditions = map[string]int64{"low": 3}
+		return nil
+	}))
+
+	for _, name := range []string{"a-low/1.mp3", "a-other/1.mp3"} {
+		_, err := f.storage.Create(ctx, name, bytes.NewReader(make([]byte, 3)))
+		require.NoError(t, err)
+	}
+
+	f.run(t, ActionDelete)
+	assert.False(t, f.exists("a-low/1.mp3"))
+	assert.True(t, f.exists("a-other/1.mp3"))
+}
@@ -0,0 +1,110 @@
+package update
+
+import (
+	"context"
+	"os"
+
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/mxpv/podsync/pkg/feed"
+	"github.com/mxpv/podsync/pkg/model"
+)
+
+// hostCoverArt makes sure the feed cover art is available in storage and returns its path.
+// Returns an empty string if the artwork can't be hosted, so the XML falls back to the remote URL.
+func (u *Manager) hostCoverArt(ctx context.Context, feedConfig *feed.Config, info *model.Feed) string {
+	source := feed.CoverArtSource(feedConfig, info)
+	if source == "" {
+		return ""
+	}
+
+	path := feed.CoverArtworkPath(feedConfig, source)
+	if err := u.hostArtwork(ctx, feedConfig, source, path); err != nil {
+		log.WithError(err).Warnf("failed to host cover art %q", source)
+		return ""
+	}
+
+	// Remove the replaced cover art, so old versions don't pile up in storage
+	if previous, err := u.db.GetFeed(ctx, feedConfig.ID); err == nil && previous.Artwork != "" && previous.Artwork != path {
+		if err := u.fs.Delete(ctx, previous.Artwork); err != nil && !errors.Is(err, os.ErrNotExist) {
+			log.WithError(err).Warnf("failed to delete previous cover art %q", previous.Artwork)
+		}
+	}
+
+	return path
+}
+
+// hostEpisodeArtwork downloads thumbnails of downloaded episodes that are not hosted yet
+func (u *Manager) hostEpisodeArtwork(ctx context.Context, feedConfig *feed.Config) error {
+	var list []*model.Episode
+	if err := u.db.WalkEpisodes(ctx, feedConfig.ID, func(episode *model.Episode) error {
+		if episode.Status == model.EpisodeDownloaded && episode.Artwork == "" && episode.Thumbnail != "" {
+			list = append(list, episode)
+		}
+		return nil
+	}); err != nil {
+		return err
+	}
+
+	for _, episode := range list {
+		var (
+			logger = log.WithField("episode_id", episode.ID)
+			path   = feed.EpisodeArtworkPath(feedConfig, episode)
+		)
+
+		if err := u.hostArtwork(ctx, feedConfig, episode.Thumbnail, path); err != nil {
+			// Will retry on next update, the XML refers to the remote thumbnail meanwhile
+			logger.WithError(err).Warn("failed to host episode artwork")
+			continue
+		}
+
+		if err := u.db.UpdateEpisode(feedConfig.ID, episode.ID, func(episode *model.Episode) error {
+			episode.Artwork = path
+			return nil
+		}); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// hostArtwork converts the image at source URL and uploads it to path, unless it already exists
+func (u *Manager) hostArtwork(ctx context.Context, feedConfig *feed.Config, source string, path string) error {
+	if _, err := u.fs.Size(ctx, path); err == nil {
+		return nil
+	} else if !os.IsNotExist(err) {
+		return err
+	}
+
+	if u.processor == nil {
+		return errors.New("artwork conversion is not available")
+	}
+
+	log.Debugf("hosting artwork %q as %q", source, path)
+	file, err := u.processor.ConvertArtwork(ctx, source, feedConfig.Artwork.ArtworkSize())
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	if _, err := u.fs.Create(ctx, path, file); err != nil {
+		return errors.Wrap(err, "failed to copy artwork")
+	}
+
+	return nil
+}
+
+// deleteArtwork removes the self-hosted thumbnail of a cleaned up episode
+func (u *Manager) deleteArtwork(ctx context.Context, episode *model.Episode) error {
+	if episode.Artwork == "" {
+		return nil
+	}
+
+	if err := u.fs.Delete(ctx, episode.Artwork); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+
+	return nil
+}
@@ -24,6 +24,21 @@ func matchRegexpFilter(pattern, str string, negative bool, logger log.FieldLogge
 	return true
 }
 
+// matchFeedFilters checks filters of the feed and, for merged feeds, of the source the episode came from
+func matchFeedFilters(episode *model.Episode, feedConfig *feed.Config) bool {
+	if !matchFilters(episode, &feedConfig.Filters) {
+		return false
+	}
+
+	if episode.Source != "" {
+		if source := feedConfig.FindSource(episode.Source); source != nil {
+			return matchFilters(episode, &source.Filters)
+		}
+	}
+
+	return true
+}
+
 func matchFilters(episode *model.Episode, filters *feed.Filters) bool {
 	logger := log.WithFields(log.Fields{"episode_id": episode.ID})
 	if !matchRegexpFilter(filters.Title, episode.Title, false, logger.WithField("filter", "title")) {
@@ -68,5 +83,36 @@ func matchFilters(episode *model.Episode, filters *feed.Filters) bool {
 		}
 	}
 
+	if filters.ExcludeShorts && episode.ContentType == model.ContentShort {
+		logger.WithField("filter", "exclude_shorts").Info("skipping due to exclude_shorts filter")
+		return false
+	}
+
+	if filters.ExcludeLiveVODs && episode.ContentType == model.ContentLiveVOD {
+		logger.WithField("filter", "exclude_live_vods").Info("skipping due to exclude_live_vods filter")
+		return false
+	}
+
+	if filters.OnlyMembers && !episode.MembersOnly {
+		logger.WithField("filter", "only_members").Info("skipping due to only_members filter")
+		return false
+	}
+
+	if filters.LiveVODDelay > 0 && episode.ContentType == model.ContentLiveVOD {
+		// Recordings still being processed have no duration yet
+		ended := episode.PubDate.Add(time.Duration(episode.Duration) * time.Second)
+		if episode.Duration <= 1 || time.Since(ended) < filters.LiveVODDelay {
+			logger.WithField("filter", "live_vod_delay").Infof("postponing live stream recording until processed (ended %s ago)", time.Since(ended).Round(time.Minute))
+			return false
+		}
+	}
+
+	if expr := filters.CompiledExpr(); expr != nil {
+		if matched, reason := expr.Match(episode); !matched {
+			logger.WithField("filter", "expr").Infof("skipping due to expr filter: %s", reason)
+			return false
+		}
+	}
+
 	return true
 }
@@ -2,8 +2,10 @@ package update
 
 import (
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 
 	"github.com/mxpv/podsync/pkg/feed"
 	"github.com/mxpv/podsync/pkg/model"
@@ -86,3 +88,66 @@ func TestNotTitleFilterIssue798(t *testing.T) {
 	assert.True(t, matchFilters(&model.Episode{ID: "5", Title: "Sermon — Love Your Enemies", Duration: 1800}, filters))
 	assert.True(t, matchFilters(&model.Episode{ID: "6", Title: "Reflection on Today's Gospel", Duration: 900}, filters))
 }
+
+func TestExprFilter(t *testing.T) {
+	filters := &feed.Filters{
+		MaxDuration: 7200,
+		Expr:        `duration > 600 && !(title ~ "(?i)#shorts") || title ~ "Part \\d+"`,
+	}
+	require.NoError(t, filters.Compile())
+
+	assert.True(t, matchFilters(&model.Episode{ID: "1", Title: "Full episode", Duration: 3600}, filters))
+	assert.False(t, matchFilters(&model.Episode{ID: "2", Title: "Teaser #Shorts", Duration: 3600}, filters))
+	assert.False(t, matchFilters(&model.Episode{ID: "3", Title: "Clip", Duration: 60}, filters))
+	assert.True(t, matchFilters(&model.Episode{ID: "4", Title: "Part 2", Duration: 60}, filters))
+
+	// Expressions are combined with other filters
+	assert.False(t, matchFilters(&model.Episode{ID: "5", Title: "Part 3", Duration: 9000}, filters))
+}
+
+func TestContentTypeFilters(t *testing.T) {
+	var (
+		short   = &model.Episode{ID: "1", ContentType: model.ContentShort}
+		live    = &model.Episode{ID: "2", ContentType: model.ContentLiveVOD, PubDate: time.Now().Add(-3 * time.Hour), Duration: 3600}
+		video   = &model.Episode{ID: "3", ContentType: model.ContentVideo}
+		members = &model.Episode{ID: "4", ContentType: model.ContentVideo, MembersOnly: true}
+	)
+
+	filters := &feed.Filters{ExcludeShorts: true}
+	assert.False(t, matchFilters(short, filters))
+	assert.True(t, matchFilters(live, filters))
+	assert.True(t, matchFilters(video, filters))
+
+	filters = &feed.Filters{ExcludeLiveVODs: true}
+	assert.True(t, matchFilters(short, filters))
+	assert.False(t, matchFilters(live, filters))
+
+	filters = &feed.Filters{OnlyMembers: true}
+	assert.False(t, matchFilters(video, filters))
+	assert.True(t, matchFilters(members, filters))
+
+	// Stream ended 2 hours ago
+	assert.True(t, matchFilters(live, &feed.Filters{LiveVODDelay: time.Hour}))
+	assert.False(t, matchFilters(live, &feed.Filters{LiveVODDelay: 6 * time.Hour}))
+	// Recordings being processed have no duration yet
+	assert.False(t, matchFilters(&model.Episode{ID: "5", ContentType: model.ContentLiveVOD, Duration: 1}, &feed.Filters{LiveVODDelay: time.Hour}))
+	assert.True(t, matchFilters(video, &feed.Filters{LiveVODDelay: time.Hour}))
+}
+
+func TestSourceFilters(t *testing.T) {
+	feedConfig := &feed.Config{
+		Filters: feed.Filters{NotTitle: "(?i)trailer"},
+		Sources: []*feed.Source{
+			{URL: "https://youtube.com/channel/a", Filters: feed.Filters{MinDuration: 600}},
+			{URL: "https://soundcloud.com/b/sets/c"},
+		},
+	}
+
+	assert.True(t, matchFeedFilters(&model.Episode{ID: "1", Duration: 3600, Source: "https://youtube.com/channel/a"}, feedConfig))
+	assert.False(t, matchFeedFilters(&model.Episode{ID: "2", Duration: 60, Source: "https://youtube.com/channel/a"}, feedConfig))
+	assert.True(t, matchFeedFilters(&model.Episode{ID: "3", Duration: 60, Source: "https://soundcloud.com/b/sets/c"}, feedConfig))
+	assert.False(t, matchFeedFilters(&model.Episode{ID: "4", Title: "Trailer", Duration: 60, Source: "https://soundcloud.com/b/sets/c"}, feedConfig))
+
+	// Episodes of removed sources only match feed filters
+	assert.True(t, matchFeedFilters(&model.Episode{ID: "5", Duration: 60, Source: "https://vimeo.com/d"}, feedConfig))
+}
@@ -0,0 +1,90 @@
+package update
+
+import (
+	"context"
+	"io"
+
+	"github.com/pkg/errors"
+
+	"github.com/mxpv/podsync/pkg/feed"
+	"github.com/mxpv/podsync/pkg/media"
+	"github.com/mxpv/podsync/pkg/model"
+)
+
+const defaultGenre = "Podcast"
+
+// buildTags fills media tags from episode and feed info, applying per-feed overrides
+func buildTags(feedConfig *feed.Config, info *model.Feed, episode *model.Episode) media.Tags {
+	var (
+		metadata = feedConfig.Metadata
+		artist   = info.Author
+		album    = info.Title
+		genre    = defaultGenre
+		cover    = info.CoverArt
+		date     string
+	)
+
+	if artist == "<notfound>" {
+		artist = info.Title
+	}
+	if feedConfig.Custom.Author != "" {
+		artist = feedConfig.Custom.Author
+	}
+	if metadata.Artist != "" {
+		artist = metadata.Artist
+	}
+
+	if feedConfig.Custom.Title != "" {
+		album = feedConfig.Custom.Title
+	}
+	if metadata.Album != "" {
+		album = metadata.Album
+	}
+
+	if metadata.Genre != "" {
+		genre = metadata.Genre
+	}
+
+	if feedConfig.Custom.CoverArt != "" {
+		cover = feedConfig.Custom.CoverArt
+	}
+
+	switch metadata.Cover {
+	case feed.CoverNone:
+		cover = ""
+	case feed.CoverFeed:
+		// Keep feed cover art
+	default:
+		if episode.Thumbnail != "" {
+			cover = episode.Thumbnail
+		}
+	}
+
+	if !episode.PubDate.IsZero() {
+		date = episode.PubDate.UTC().Format("2006-01-02")
+	}
+
+	return media.Tags{
+		Title:   episode.Title,
+		Artist:  artist,
+		Album:   album,
+		Date:    date,
+		Track:   episode.Order,
+		Comment: episode.Description,
+		Genre:   genre,
+		Cover:   cover,
+	}
+}
+
+func (u *Manager) writeTags(ctx context.Context, feedConfig *feed.Config, info *model.Feed, episode *model.Episode, file io.ReadCloser) (io.ReadCloser, error) {
+	if u.processor == nil {
+		return nil, errors.New("tagging is not available")
+	}
+
+	path, err := localPath(file)
+	if err != nil {
+		return nil, err
+	}
+
+	return u.processor.WriteTags(ctx, path, buildTags(feedConfig, info, episode))
+}
@@ -0,0 +1,42 @@
+package update
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/mxpv/podsync/pkg/feed"
+	"github.com/mxpv/podsync/pkg/model"
+)
+
+func TestBuildTags(t *testing.T) {
+	info := &model.Feed{Title: "Show", Author: "<notfound>", CoverArt: "http://feed/cover.jpg"}
+	episode := &model.Episode{
+		Title:     "Episode",
+		Order:     "2",
+		Thumbnail: "http://episode/thumb.jpg",
+		PubDate:   time.Date(2024, 5, 6, 23, 0, 0, 0, time.UTC),
+	}
+
+	tags := buildTags(&feed.Config{}, info, episode)
+	assert.Equal(t, "Show", tags.Artist)
+	assert.Equal(t, "Show", tags.Album)
+	assert.Equal(t, "Podcast", tags.Genre)
+	assert.Equal(t, "2024-05-06", tags.Date)
+	assert.Equal(t, "2", tags.Track)
+	assert.Equal(t, "http://episode/thumb.jpg", tags.Cover)
+
+	cfg := &feed.Config{
+		Custom:   feed.Custom{Author: "Custom author", CoverArt: "http://custom/cover.jpg"},
+		Metadata: feed.Metadata{Album: "Album", Genre: "Talk", Cover: feed.CoverFeed},
+	}
+	tags = buildTags(cfg, info, episode)
+	assert.Equal(t, "Custom author", tags.Artist)
+	assert.Equal(t, "Album", tags.Album)
+	assert.Equal(t, "Talk", tags.Genre)
+	assert.Equal(t, "http://custom/cover.jpg", tags.Cover)
+
+	cfg.Metadata.Cover = feed.CoverNone
+	assert.Empty(t, buildTags(cfg, info, episode).Cover)
+}
@@ -0,0 +1,188 @@
+package update
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	"github.com/hashicorp/go-multierror"
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/mxpv/podsync/pkg/feed"
+	"github.com/mxpv/podsync/pkg/model"
+)
+
+type evictionCandidate struct {
+	feedConfig *feed.Config
+	episode    *model.Episode
+	size       int64
+	listens    int
+}
+
+// EnforceDiskQuota evicts episodes across all feeds until their total size fits the global disk quota.
+// In dry run mode episodes are only selected and logged.
+func (u *Manager) EnforceDiskQuota(ctx context.Context, dryRun bool) ([]Removal, error) {
+	var (
+		now        = time.Now()
+		total      int64
+		candidates []*evictionCandidate
+		removed    []Removal
+		result     *multierror.Error
+	)
+
+	if u.quota == nil {
+		return nil, nil
+	}
+
+	dryRun = dryRun || u.quota.DryRun
+
+	for _, feedConfig := range u.feeds {
+		var listens map[string]int
+		if u.quota.Evict == feed.EvictLeastListened {
+			counts, err := u.countListens(ctx, feedConfig)
+			if err != nil {
+				return nil, err
+			}
+			listens = counts
+		}
+
+		if err := u.db.WalkEpisodes(ctx, feedConfig.ID, func(episode *model.Episode) error {
+			if episode.Status != model.EpisodeDownloaded {
+				return nil
+			}
+
+			size := feed.EpisodeDiskSize(episode)
+			total += size
+
+			if feedConfig.IsPinned(episode) {
+				return nil
+			}
+
+			if feedConfig.Clean != nil && feedConfig.Clean.IsProtected(episode, now) {
+				return nil
+			}
+
+			candidates = append(candidates, &evictionCandidate{
+				feedConfig: feedConfig,
+				episode:    episode,
+				size:       size,
+				listens:    listens[episode.ID],
+			})
+			return nil
+		}); err != nil {
+			return nil, err
+		}
+	}
+
+	logger := log.WithFields(log.Fields{
+		"total": feed.ByteSize(total).String(),
+		"quota": u.quota.MaxSize.String(),
+	})
+
+	if total <= int64(u.quota.MaxSize) {
+		logger.Debug("disk quota is not exceeded")
+		return nil, nil
+	}
+
+	logger.Info("disk quota exceeded, evicting episodes")
+
+	sort.Slice(candidates, func(i, j int) bool {
+		if candidates[i].listens != candidates[j].listens {
+			return candidates[i].listens < candidates[j].listens
+		}
+		return candidates[i].episode.PubDate.Before(candidates[j].episode.PubDate)
+	})
+
+	for _, candidate := range candidates {
+		if total <= int64(u.quota.MaxSize) {
+			break
+		}
+
+		episodeLogger := log.WithFields(log.Fields{
+			"feed_id":    candidate.feedConfig.ID,
+			"episode_id": candidate.episode.ID,
+			"listens":    candidate.listens,
+		})
+
+		if dryRun {
+			episodeLogger.Infof("dry run: would evict %q", candidate.episode.Title)
+		} else {
+			episodeLogger.Infof("evicting %q", candidate.episode.Title)
+			if err := u.removeEpisode(ctx, candidate.feedConfig, candidate.episode, model.EpisodeCleaned); err != nil {
+				episodeLogger.WithError(err).Error("failed to evict episode")
+				result = multierror.Append(result, err)
+				continue
+			}
+		}
+
+		total -= candidate.size
+		removed = append(removed, Removal{FeedID: candidate.feedConfig.ID, Episode: candidate.episode})
+	}
+
+	if total > int64(u.quota.MaxSize) {
+		log.Warnf("disk quota can't be satisfied, %s left after eviction", feed.ByteSize(total))
+	}
+
+	return removed, result.ErrorOrNil()
+}
+
+// ApplyDiskQuota enforces the disk quota after a round of feed updates and rebuilds
+// XML feeds episodes were evicted from. The quota spans all feeds, so it is applied
+// once per update cycle rather than after each feed.
+func (u *Manager) ApplyDiskQuota(ctx context.Context) error {
+	removed, err := u.EnforceDiskQuota(ctx, false)
+	if err != nil {
+		log.WithError(err).Error("disk quota eviction failed")
+	}
+
+	if len(removed) == 0 || u.quota.DryRun {
+		return nil
+	}
+
+	changed := map[string]struct{}{}
+	for _, removal := range removed {
+		changed[removal.FeedID] = struct{}{}
+	}
+
+	for feedID := range changed {
+		if err := u.BuildXML(ctx, u.feeds[feedID]); err != nil {
+			return errors.Wrapf(err, "failed to rebuild XML feed of %q", feedID)
+		}
+	}
+
+	return nil
+}
+
+// countListens returns the number of listens by episode ID, renditions included
+func (u *Manager) countListens(ctx context.Context, feedConfig *feed.Config) (map[string]int, error) {
+	var (
+		configs = append([]*feed.Config{feedConfig}, feedConfig.RenditionConfigs()...)
+		byFile  = make(map[string]map[string]int, len(configs))
+	)
+
+	for _, cfg := range configs {
+		counts := map[string]int{}
+		if err := u.db.WalkAccess(ctx, cfg.ID, func(access *model.Access) error {
+			if access.File != "" {
+				counts[access.File]++
+			}
+			return nil
+		}); err != nil {
+			return nil, err
+		}
+		byFile[cfg.ID] = counts
+	}
+
+	listens := map[string]int{}
+	if err := u.db.WalkEpisodes(ctx, feedConfig.ID, func(episode *model.Episode) error {
+		for _, cfg := range configs {
+			listens[episode.ID] += byFile[cfg.ID][feed.EpisodeName(cfg, episode)]
+		}
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+
+	return listens, nil
+}
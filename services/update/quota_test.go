@@ -0,0 +1,148 @@
+package update
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/mxpv/podsync/pkg/db"
+	"github.com/mxpv/podsync/pkg/feed"
+	"github.com/mxpv/podsync/pkg/fs"
+	"github.com/mxpv/podsync/pkg/model"
+)
+
+func TestEnforceDiskQuota(t *testing.T) {
+	ctx := context.Background()
+	now := time.Now().UTC()
+
+	database, err := db.NewBadger(&db.Config{Dir: t.TempDir()})
+	require.NoError(t, err)
+	defer database.Close()
+
+	storage, err := fs.NewLocal(t.TempDir(), false, false)
+	require.NoError(t, err)
+
+	feeds := map[string]*feed.Config{
+		"a": {ID: "a", Format: model.FormatAudio},
+		"b": {ID: "b", Format: model.FormatAudio, Clean: &feed.Cleanup{KeepNewerThan: 30}},
+	}
+
+	// Each episode takes 100 bytes
+	add := func(feedID string, episodeID string, age int) {
+		err := database.AddFeed(ctx, feedID, &model.Feed{ID: feedID, Episodes: []*model.Episode{
+			{ID: episodeID, Status: model.EpisodeDownloaded, Size: 100, PubDate: now.AddDate(0, 0, -age)},
+		}})
+		require.NoError(t, err)
+
+		_, err = storage.Create(ctx, feedID+"/"+episodeID+".mp3", bytes.NewReader(make([]byte, 100)))
+		require.NoError(t, err)
+	}
+
+	add("a", "a1", 1)
+	add("a", "a2", 10)
+	add("a", "a3", 20)
+	add("b", "b1", 25) // Protected by keep_newer_than, even though it's older than a1 and a2
+
+	status := func(feedID string, episodeID string) model.EpisodeStatus {
+		episode, err := database.GetEpisode(ctx, feedID, episodeID)
+		require.NoError(t, err)
+		return episode.Status
+	}
+
+	manager := &Manager{db: database, fs: storage, feeds: feeds, quota: &feed.DiskQuota{MaxSize: 250, DryRun: true}}
+
+	// Dry run keeps all files
+	removed, err := manager.EnforceDiskQuota(ctx, false)
+	require.NoError(t, err)
+	assert.Len(t, removed, 2)
+	assert.Equal(t, model.EpisodeDownloaded, status("a", "a3"))
+
+	manager.quota.DryRun = false
+	removed, err = manager.EnforceDiskQuota(ctx, false)
+	require.NoError(t, err)
+	assert.Len(t, removed, 2)
+
+	assert.Equal(t, model.EpisodeCleaned, status("a", "a3"))
+	assert.Equal(t, model.EpisodeCleaned, status("a", "a2"))
+	assert.Equal(t, model.EpisodeDownloaded, status("a", "a1"))
+	assert.Equal(t, model.EpisodeDownloaded, status("b", "b1"))
+
+	_, err = storage.Size(ctx, "a/a3.mp3")
+	assert.True(t, os.IsNotExist(err))
+}
+
+func TestApplyDiskQuota(t *testing.T) {
+	ctx := context.Background()
+
+	database, err := db.NewBadger(&db.Config{Dir: t.TempDir()})
+	require.NoError(t, err)
+	defer database.Close()
+
+	storage, err := fs.NewLocal(t.TempDir(), false, false)
+	require.NoError(t, err)
+
+	feeds := map[string]*feed.Config{"a": {ID: "a", Format: model.FormatAudio}}
+	err = database.AddFeed(ctx, "a", &model.Feed{ID: "a", Title: "A", Episodes: []*model.Episode{
+		{ID: "a1", Title: "New", Status: model.EpisodeDownloaded, Size: 100, PubDate: time.Now()},
+		{ID: "a2", Title: "Old", Status: model.EpisodeDownloaded, Size: 100, PubDate: time.Now().AddDate(0, 0, -1)},
+	}})
+	require.NoError(t, err)
+
+	manager := &Manager{db: database, fs: storage, feeds: feeds, hostname: "http://localhost", quota: &feed.DiskQuota{MaxSize: 150}}
+	require.NoError(t, manager.ApplyDiskQuota(ctx))
+
+	episode, err := database.GetEpisode(ctx, "a", "a2")
+	require.NoError(t, err)
+	assert.Equal(t, model.EpisodeCleaned, episode.Status)
+
+	// XML of the feed the episode was evicted from is rebuilt
+	_, err = storage.Size(ctx, "a.xml")
+	assert.NoError(t, err)
+}
+
+func TestEnforceDiskQuotaLeastListened(t *testing.T) {
+	ctx := context.Background()
+	now := time.Now().UTC()
+
+	database, err := db.NewBadger(&db.Config{Dir: t.TempDir()})
+	require.NoError(t, err)
+	defer database.Close()
+
+	storage, err := fs.NewLocal(t.TempDir(), false, false)
+	require.NoError(t, err)
+
+	err = database.AddFeed(ctx, "a", &model.Feed{ID: "a", Episodes: []*model.Episode{
+		{ID: "old", Status: model.EpisodeDownloaded, Size: 100, PubDate: now.AddDate(0, 0, -10)},
+		{ID: "new", Status: model.EpisodeDownloaded, Size: 100, PubDate: now},
+	}})
+	require.NoError(t, err)
+
+	// The old episode is still popular
+	for _, client := range []string{"1", "2"} {
+		err = database.RecordAccess(ctx, &model.Access{FeedID: "a", File: "old.mp3", Day: "2024-01-01", Client: client, Requests: 1})
+		require.NoError(t, err)
+	}
+
+	manager := &Manager{
+		db:    database,
+		fs:    storage,
+		feeds: map[string]*feed.Config{"a": {ID: "a", Format: model.FormatAudio}},
+		quota: &feed.DiskQuota{MaxSize: 150, Evict: feed.EvictLeastListened},
+	}
+
+	_, err = manager.EnforceDiskQuota(ctx, false)
+	require.NoError(t, err)
+
+	episode, err := database.GetEpisode(ctx, "a", "new")
+	require.NoError(t, err)
+	assert.Equal(t, model.EpisodeCleaned, episode.Status)
+
+	episode, err = database.GetEpisode(ctx, "a", "old")
+	require.NoError(t, err)
+	assert.Equal(t, model.EpisodeDownloaded, episode.Status)
+}
@@ -0,0 +1,152 @@
+package update
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path"
+	"sort"
+	"time"
+
+	"github.com/hashicorp/go-multierror"
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/mxpv/podsync/pkg/feed"
+	"github.com/mxpv/podsync/pkg/model"
+)
+
+// HandleRemovedFeeds looks for feeds saved to the database, but no longer present in the config.
+// Depending on the policy their data is kept with a warning, purged after a grace period or purged right away.
+func (u *Manager) HandleRemovedFeeds(ctx context.Context, policy *feed.RemovedFeeds) error {
+	var removed, restored []*model.Feed
+	if err := u.db.WalkFeeds(ctx, func(f *model.Feed) error {
+		if _, ok := u.feeds[f.ID]; !ok {
+			removed = append(removed, f)
+		} else if !f.RemovedAt.IsZero() {
+			restored = append(restored, f)
+		}
+		return nil
+	}); err != nil {
+		return errors.Wrap(err, "failed to walk feeds")
+	}
+
+	var (
+		result *multierror.Error
+		now    = time.Now().UTC()
+	)
+
+	// Feeds added back to the config start a new grace period if removed again
+	for _, f := range restored {
+		log.WithField("feed_id", f.ID).Info("feed is back in the config, cancelling purge")
+		f.RemovedAt = time.Time{}
+		if err := u.db.AddFeed(ctx, f.ID, f); err != nil {
+			result = multierror.Append(result, errors.Wrapf(err, "failed to restore feed %q", f.ID))
+		}
+	}
+
+	for _, f := range removed {
+		logger := log.WithField("feed_id", f.ID)
+
+		switch policy.PolicyName() {
+		case feed.RemovedWarn:
+			logger.Warn("feed is not in the config anymore, set removed_feeds.policy to purge its data")
+			continue
+
+		case feed.RemovedGrace:
+			if f.RemovedAt.IsZero() {
+				f.RemovedAt = now
+				if err := u.db.AddFeed(ctx, f.ID, f); err != nil {
+					result = multierror.Append(result, errors.Wrapf(err, "failed to mark feed %q as removed", f.ID))
+					continue
+				}
+			}
+
+			if purgeAt := f.RemovedAt.Add(policy.GracePeriod()); now.Before(purgeAt) {
+				logger.Warnf("feed is not in the config anymore, its data will be purged after %s", purgeAt.Format(time.RFC3339))
+				continue
+			}
+		}
+
+		if err := u.purgeFeed(ctx, f.ID); err != nil {
+			result = multierror.Append(result, errors.Wrapf(err, "failed to purge feed %q", f.ID))
+		}
+	}
+
+	return result.ErrorOrNil()
+}
+
+// purgeFeed deletes files and database records of a feed and its renditions
+func (u *Manager) purgeFeed(ctx context.Context, feedID string) error {
+	logger := log.WithField("feed_id", feedID)
+	logger.Info("purging data of removed feed")
+
+	// Configured feeds may use IDs that look like renditions of the removed feed (e.g. "news-video")
+	configured := map[string]struct{}{}
+	for _, cfg := range u.feeds {
+		configured[cfg.ID] = struct{}{}
+		for _, renditionConfig := range cfg.RenditionConfigs() {
+			configured[renditionConfig.ID] = struct{}{}
+		}
+	}
+
+	// Rendition names are not in the config anymore, but episodes remember them
+	ids := map[string]struct{}{feedID: {}}
+	if err := u.db.WalkEpisodes(ctx, feedID, func(episode *model.Episode) error {
+		for name := range episode.Renditions {
+			id := fmt.Sprintf("%s-%s", feedID, name)
+			if _, ok := configured[id]; ok {
+				logger.Warnf("skipping %q, it belongs to a configured feed", id)
+				continue
+			}
+			ids[id] = struct{}{}
+		}
+		return nil
+	}); err != nil {
+		return errors.Wrap(err, "failed to walk episodes")
+	}
+
+	for id := range ids {
+		files, err := u.fs.List(ctx, id)
+		if err != nil {
+			return err
+		}
+
+		dirs := map[string]struct{}{id: {}}
+		for _, file := range files {
+			if err := u.fs.Delete(ctx, file.Name); err != nil && !errors.Is(err, os.ErrNotExist) {
+				return errors.Wrapf(err, "failed to delete %q", file.Name)
+			}
+			dirs[path.Dir(file.Name)] = struct{}{}
+		}
+
+		// Remove directories left behind, nested ones first
+		sorted := make([]string, 0, len(dirs))
+		for dir := range dirs {
+			sorted = append(sorted, dir)
+		}
+		sort.Slice(sorted, func(i, j int) bool {
+			return len(sorted[i]) > len(sorted[j])
+		})
+		for _, dir := range sorted {
+			if err := u.fs.Delete(ctx, dir); err != nil {
+				logger.WithError(err).Debugf("failed to remove directory %q", dir)
+			}
+		}
+
+		if err := u.fs.Delete(ctx, id+".xml"); err != nil {
+			logger.WithError(err).Debugf("failed to delete %s.xml", id)
+		}
+
+		logger.Infof("deleted %d file(s) of %q", len(files), id)
+
+		// DeleteFeed removes access records of the main feed along with it
+		if id != feedID {
+			if err := u.db.DeleteAccess(ctx, id, ""); err != nil {
+				return errors.Wrapf(err, "failed to delete access records of %q", id)
+			}
+		}
+	}
+
+	return u.db.DeleteFeed(ctx, feedID)
+}
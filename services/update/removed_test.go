@@ -0,0 +1,143 @@
+package update
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/mxpv/podsync/pkg/db"
+	"github.com/mxpv/podsync/pkg/feed"
+	"github.com/mxpv/podsync/pkg/fs"
+	"github.com/mxpv/podsync/pkg/model"
+)
+
+func TestHandleRemovedFeeds(t *testing.T) {
+	ctx := context.Background()
+
+	database, err := db.NewBadger(&db.Config{Dir: t.TempDir()})
+	require.NoError(t, err)
+	defer database.Close()
+
+	dataDir := t.TempDir()
+	storage, err := fs.NewLocal(dataDir, false, false)
+	require.NoError(t, err)
+
+	for _, feedID := range []string{"kept", "removed"} {
+		err = database.AddFeed(ctx, feedID, &model.Feed{Episodes: []*model.Episode{
+			{ID: "1", Status: model.EpisodeDownloaded, Renditions: map[string]int64{"audio": 1}},
+		}})
+		require.NoError(t, err)
+	}
+
+	for _, name := range []string{"kept.xml", "kept/1.mp3", "removed.xml", "removed/1.mp3", "removed/artwork/1.jpg", "removed-audio/1.mp3", "removed-audio.xml"} {
+		_, err := storage.Create(ctx, name, bytes.NewReader([]byte{1}))
+		require.NoError(t, err)
+	}
+
+	for _, feedID := range []string{"kept", "removed", "removed-audio"} {
+		err = database.RecordAccess(ctx, &model.Access{FeedID: feedID, File: "1.mp3", Day: "2024-01-01", Client: "abc", Requests: 1})
+		require.NoError(t, err)
+	}
+
+	manager := &Manager{db: database, fs: storage, feeds: map[string]*feed.Config{"kept": {ID: "kept"}}}
+
+	accessRecords := func(feedID string) int {
+		count := 0
+		err := database.WalkAccess(ctx, feedID, func(*model.Access) error {
+			count++
+			return nil
+		})
+		require.NoError(t, err)
+		return count
+	}
+
+	exists := func(name string) bool {
+		_, err := os.Stat(filepath.Join(dataDir, name))
+		return err == nil
+	}
+
+	// Warn keeps everything
+	require.NoError(t, manager.HandleRemovedFeeds(ctx, nil))
+	assert.True(t, exists("removed/1.mp3"))
+
+	// Grace period starts when the feed is first found missing
+	require.NoError(t, manager.HandleRemovedFeeds(ctx, &feed.RemovedFeeds{Policy: feed.RemovedGrace, GraceDays: 7}))
+	assert.True(t, exists("removed/1.mp3"))
+
+	info, err := database.GetFeed(ctx, "removed")
+	require.NoError(t, err)
+	assert.False(t, info.RemovedAt.IsZero())
+	assert.Len(t, info.Episodes, 1)
+
+	// Expired grace period purges the feed
+	info.RemovedAt = time.Now().UTC().AddDate(0, 0, -8)
+	require.NoError(t, database.AddFeed(ctx, "removed", info))
+	require.NoError(t, manager.HandleRemovedFeeds(ctx, &feed.RemovedFeeds{Policy: feed.RemovedGrace, GraceDays: 7}))
+
+	for _, name := range []string{"removed", "removed.xml", "removed-audio", "removed-audio.xml"} {
+		assert.False(t, exists(name), name)
+	}
+
+	_, err = database.GetFeed(ctx, "removed")
+	assert.ErrorIs(t, err, model.ErrNotFound)
+
+	// Download stats of renditions are purged along with the feed
+	assert.Zero(t, accessRecords("removed"))
+	assert.Zero(t, accessRecords("removed-audio"))
+
+	// Configured feeds are never touched
+	assert.True(t, exists("kept/1.mp3"))
+	assert.True(t, exists("kept.xml"))
+	assert.Equal(t, 1, accessRecords("kept"))
+
+	_, err = database.GetEpisode(ctx, "kept", "1")
+	assert.NoError(t, err)
+}
+
+func TestHandleRemovedFeedsConfiguredAgain(t *testing.T) {
+	ctx := context.Background()
+
+	database, err := db.NewBadger(&db.Config{Dir: t.TempDir()})
+	require.NoError(t, err)
+	defer database.Close()
+
+	dataDir := t.TempDir()
+	storage, err := fs.NewLocal(dataDir, false, false)
+	require.NoError(t, err)
+
+	err = database.AddFeed(ctx, "back", &model.Feed{RemovedAt: time.Now().UTC().AddDate(0, 0, -1)})
+	require.NoError(t, err)
+
+	err = database.AddFeed(ctx, "removed", &model.Feed{Episodes: []*model.Episode{
+		{ID: "1", Status: model.EpisodeDownloaded, Renditions: map[string]int64{"audio": 1}},
+	}})
+	require.NoError(t, err)
+
+	for _, name := range []string{"removed/1.mp3", "removed-audio/1.mp3"} {
+		_, err := storage.Create(ctx, name, bytes.NewReader([]byte{1}))
+		require.NoError(t, err)
+	}
+
+	// "removed-audio" is a separate feed now, not a rendition of the removed one
+	manager := &Manager{db: database, fs: storage, feeds: map[string]*feed.Config{
+		"back":          {ID: "back"},
+		"removed-audio": {ID: "removed-audio"},
+	}}
+
+	require.NoError(t, manager.HandleRemovedFeeds(ctx, &feed.RemovedFeeds{Policy: feed.RemovedPurge}))
+
+	info, err := database.GetFeed(ctx, "back")
+	require.NoError(t, err)
+	assert.True(t, info.RemovedAt.IsZero())
+
+	_, err = os.Stat(filepath.Join(dataDir, "removed", "1.mp3"))
+	assert.True(t, os.IsNotExist(err))
+	_, err = os.Stat(filepath.Join(dataDir, "removed-audio", "1.mp3"))
+	assert.NoError(t, err)
+}
@@ -6,6 +6,7 @@ import (
 	"fmt"
 	"io"
 	"os"
+	"path/filepath"
 	"sort"
 	"time"
 
@@ -15,8 +16,10 @@ import (
 
 	"github.com/mxpv/podsync/pkg/builder"
 	"github.com/mxpv/podsync/pkg/db"
+	"github.com/mxpv/podsync/pkg/events"
 	"github.com/mxpv/podsync/pkg/feed"
 	"github.com/mxpv/podsync/pkg/fs"
+	"github.com/mxpv/podsync/pkg/media"
 	"github.com/mxpv/podsync/pkg/model"
 	"github.com/mxpv/podsync/pkg/ytdl"
 )
@@ -26,15 +29,30 @@ type Downloader interface {
 	PlaylistMetadata(ctx context.Context, url string) (metadata ytdl.PlaylistMetadata, err error)
 }
 
+// Processor post-processes downloaded episodes (see media.FFmpeg)
+type Processor interface {
+	// Transcode re-encodes the file according to a transcoding profile
+	Transcode(ctx context.Context, profile *feed.TranscodeProfile, input string) (io.ReadCloser, error)
+	// WriteTags writes metadata tags and cover art into the file
+	WriteTags(ctx context.Context, input string, tags media.Tags) (io.ReadCloser, error)
+	// ConvertArtwork downloads an image and converts it to square podcast artwork
+	ConvertArtwork(ctx context.Context, url string, size int) (io.ReadCloser, error)
+}
+
 type TokenList []string
 
 type Manager struct {
 	hostname   string
 	downloader Downloader
+	processor  Processor
 	db         db.Storage
 	fs         fs.Storage
 	feeds      map[string]*feed.Config
 	keys       map[model.Provider]feed.KeyProvider
+	quota      *feed.DiskQuota
+	events     *events.Bus
+	// newBuilder creates builders of feed providers, builder.New when nil
+	newBuilder func(ctx context.Context, provider model.Provider, key string, downloader builder.Downloader) (builder.Builder, error)
 }
 
 func NewUpdater(
@@ -42,28 +60,100 @@ func NewUpdater(
 	keys map[model.Provider]feed.KeyProvider,
 	hostname string,
 	downloader Downloader,
+	processor Processor,
 	db db.Storage,
 	fs fs.Storage,
+	quota *feed.DiskQuota,
+	bus *events.Bus,
 ) (*Manager, error) {
 	return &Manager{
 		hostname:   hostname,
 		downloader: downloader,
+		processor:  processor,
 		db:         db,
 		fs:         fs,
 		feeds:      feeds,
 		keys:       keys,
+		quota:      quota,
+		events:     bus,
 	}, nil
 }
 
 func (u *Manager) Update(ctx context.Context, feedConfig *feed.Config) error {
+	target := feedConfig.URL
+	if feedConfig.IsMerged() {
+		target = fmt.Sprintf("%d merged sources", len(feedConfig.Sources))
+	}
+
 	log.WithFields(log.Fields{
 		"feed_id": feedConfig.ID,
 		"format":  feedConfig.Format,
 		"quality": feedConfig.Quality,
-	}).Infof("-> updating %s", feedConfig.URL)
+	}).Infof("-> updating %s", target)
 
 	started := time.Now()
 
+	if err := u.update(ctx, feedConfig); err != nil {
+		// Stored before publishing, notifications read the number of failures from the feed
+		u.recordFailure(ctx, feedConfig.ID)
+		u.events.Publish(events.Event{Type: events.FeedUpdateFailed, FeedID: feedConfig.ID, Error: err.Error()})
+		if hookErr := u.runHooks(ctx, feedConfig, feedConfig.OnFeedUpdateError, &feed.HookContext{
+			Hook:  feed.HookOnFeedUpdateError,
+			Error: err.Error(),
+		}); hookErr != nil {
+			log.WithError(hookErr).Error("failed to execute feed update error hooks")
+		}
+		return err
+	}
+
+	u.resetFailures(ctx, feedConfig.ID)
+	u.events.Publish(events.Event{Type: events.FeedUpdated, FeedID: feedConfig.ID})
+	if err := u.runHooks(ctx, feedConfig, feedConfig.PostFeedUpdate, &feed.HookContext{Hook: feed.HookPostFeedUpdate}); err != nil {
+		log.WithError(err).Error("failed to execute post feed update hooks")
+	}
+
+	elapsed := time.Since(started)
+	log.Infof("successfully updated feed in %s", elapsed)
+	return nil
+}
+
+// recordFailure counts failed updates in a row, the counter is reset once an update fully succeeds
+func (u *Manager) recordFailure(ctx context.Context, feedID string) {
+	info, err := u.db.GetFeed(ctx, feedID)
+	if errors.Is(err, model.ErrNotFound) {
+		// The very first update failed, keep the count until the feed is saved
+		info = &model.Feed{ID: feedID}
+	} else if err != nil {
+		log.WithError(err).Error("failed to query feed to record update failure")
+		return
+	}
+
+	info.Episodes = nil
+	info.Failures++
+	if err := u.db.AddFeed(ctx, feedID, info); err != nil {
+		log.WithError(err).Error("failed to record update failure")
+	}
+}
+
+// resetFailures clears the counter of failed updates after a successful update
+func (u *Manager) resetFailures(ctx context.Context, feedID string) {
+	info, err := u.db.GetFeed(ctx, feedID)
+	if err != nil {
+		log.WithError(err).Error("failed to query feed to reset update failures")
+		return
+	}
+	if info.Failures == 0 {
+		return
+	}
+
+	info.Episodes = nil
+	info.Failures = 0
+	if err := u.db.AddFeed(ctx, feedID, info); err != nil {
+		log.WithError(err).Error("failed to reset update failures")
+	}
+}
+
+func (u *Manager) update(ctx context.Context, feedConfig *feed.Config) error {
 	if err := u.updateFeed(ctx, feedConfig); err != nil {
 		return errors.Wrap(err, "update failed")
 	}
@@ -78,11 +168,23 @@ func (u *Manager) Update(ctx context.Context, feedConfig *feed.Config) error {
 		return errors.Wrap(err, "download failed")
 	}
 
-	if err := u.cleanup(ctx, feedConfig); err != nil {
+	if feedConfig.Artwork.Enabled {
+		if err := u.hostEpisodeArtwork(ctx, feedConfig); err != nil {
+			log.WithError(err).Error("failed to host episode artwork")
+		}
+	}
+
+	if feedConfig.Filters.ApplyToExisting {
+		if _, err := u.ApplyFilters(ctx, feedConfig, false); err != nil {
+			log.WithError(err).Error("failed to apply filters to downloaded episodes")
+		}
+	}
+
+	if _, err := u.Cleanup(ctx, feedConfig, false); err != nil {
 		log.WithError(err).Error("cleanup failed")
 	}
 
-	if err := u.buildXML(ctx, feedConfig); err != nil {
+	if err := u.BuildXML(ctx, feedConfig); err != nil {
 		return errors.Wrap(err, "xml build failed")
 	}
 
@@ -90,41 +192,46 @@ func (u *Manager) Update(ctx context.Context, feedConfig *feed.Config) error {
 		return errors.Wrap(err, "opml build failed")
 	}
 
-	elapsed := time.Since(started)
-	log.Infof("successfully updated feed in %s", elapsed)
 	return nil
 }
 
 // updateFeed pulls API for new episodes and saves them to database
 func (u *Manager) updateFeed(ctx context.Context, feedConfig *feed.Config) error {
-	info, err := builder.ParseURL(feedConfig.URL)
-	if err != nil {
-		return errors.Wrapf(err, "failed to parse URL: %s", feedConfig.URL)
-	}
-
-	keyProvider, ok := u.keys[info.Provider]
-	if !ok {
-		return errors.Errorf("key provider %q not loaded", info.Provider)
-	}
+	var (
+		result *model.Feed
+		err    error
+	)
 
-	// Create an updater for this feed type
-	provider, err := builder.New(ctx, info.Provider, keyProvider.Get(), u.downloader)
-	if err != nil {
-		return err
+	if feedConfig.IsMerged() {
+		result, err = u.buildMerged(ctx, feedConfig)
+	} else {
+		result, err = u.buildFeed(ctx, feedConfig, feedConfig.Filters.DetectShorts())
 	}
-
-	// Query API to get episodes
-	log.Debug("building feed")
-	result, err := provider.Build(ctx, feedConfig)
 	if err != nil {
 		return err
 	}
 
 	log.Debugf("received %d episode(s) for %q", len(result.Episodes), result.Title)
 
-	episodeSet := make(map[string]struct{})
+	// Episodes of sources that failed to update are kept as is
+	failed := make(map[string]struct{})
+	for _, source := range result.Sources {
+		if source.Error != "" {
+			failed[source.URL] = struct{}{}
+		}
+	}
+
+	var (
+		episodeSet = make(map[string]struct{})
+		known      = make(map[string]struct{})
+	)
 	if err := u.db.WalkEpisodes(ctx, feedConfig.ID, func(episode *model.Episode) error {
-		if episode.Status != model.EpisodeDownloaded && episode.Status != model.EpisodeCleaned {
+		known[episode.ID] = struct{}{}
+		if _, ok := failed[episode.Source]; ok && episode.Source != "" {
+			return nil
+		}
+		// Pinned episodes are kept even when removed from the source playlist
+		if episode.Status != model.EpisodeDownloaded && episode.Status != model.EpisodeCleaned && !feedConfig.IsPinned(episode) {
 			episodeSet[episode.ID] = struct{}{}
 		}
 		return nil
@@ -132,12 +239,25 @@ func (u *Manager) updateFeed(ctx context.Context, feedConfig *feed.Config) error
 		return err
 	}
 
+	if feedConfig.Artwork.Enabled {
+		result.Artwork = u.hostCoverArt(ctx, feedConfig, result)
+	}
+
+	// Failures are counted until the whole update succeeds, later steps may still fail
+	if info, err := u.db.GetFeed(ctx, feedConfig.ID); err == nil {
+		result.Failures = info.Failures
+	}
+
 	if err := u.db.AddFeed(ctx, feedConfig.ID, result); err != nil {
 		return err
 	}
 
 	for _, episode := range result.Episodes {
 		delete(episodeSet, episode.ID)
+
+		if _, ok := known[episode.ID]; !ok {
+			u.events.Publish(events.Event{Type: events.EpisodeDiscovered, FeedID: feedConfig.ID, Episode: episode})
+		}
 	}
 
 	// removing episodes that are no longer available in the feed and not downloaded or cleaned
@@ -153,6 +273,133 @@ func (u *Manager) updateFeed(ctx context.Context, feedConfig *feed.Config) error
 	return nil
 }
 
+// buildFeed queries the provider of the feed URL for feed info and episodes.
+// shorts tells whether filters need YouTube Shorts to be detected.
+func (u *Manager) buildFeed(ctx context.Context, feedConfig *feed.Config, shorts bool) (*model.Feed, error) {
+	info, err := builder.ParseURL(feedConfig.URL)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to parse URL: %s", feedConfig.URL)
+	}
+
+	keyProvider, ok := u.keys[info.Provider]
+	if !ok {
+		return nil, errors.Errorf("key provider %q not loaded", info.Provider)
+	}
+
+	newBuilder := builder.New
+	if u.newBuilder != nil {
+		newBuilder = u.newBuilder
+	}
+
+	// Create an updater for this feed type
+	provider, err := newBuilder(ctx, info.Provider, keyProvider.Get(), u.downloader)
+	if err != nil {
+		return nil, err
+	}
+
+	if classifier, ok := provider.(builder.Classifier); ok {
+		// Content types of stored episodes are kept, there is no need to detect them again
+		known := make(map[string]model.ContentType)
+		if err := u.db.WalkEpisodes(ctx, feedConfig.ID, func(episode *model.Episode) error {
+			known[episode.ID] = episode.ContentType
+			return nil
+		}); err != nil {
+			return nil, err
+		}
+		classifier.Classify(shorts, known)
+	}
+
+	// Query API to get episodes
+	log.WithField("url", feedConfig.URL).Debug("building feed")
+	return provider.Build(ctx, feedConfig)
+}
+
+// buildMerged queries all sources of a merged feed.
+// A failing source doesn't fail the update unless all sources fail.
+func (u *Manager) buildMerged(ctx context.Context, feedConfig *feed.Config) (*model.Feed, error) {
+	var (
+		results  = make([]*model.Feed, len(feedConfig.Sources))
+		errs     = make([]error, len(feedConfig.Sources))
+		failed   *multierror.Error
+		failures int
+	)
+
+	for i, source := range feedConfig.Sources {
+		shorts := feedConfig.Filters.DetectShorts() || source.Filters.DetectShorts()
+		results[i], errs[i] = u.buildFeed(ctx, feedConfig.SourceConfig(source), shorts)
+		if errs[i] != nil {
+			log.WithError(errs[i]).WithField("source", source.URL).Error("failed to update source")
+			failed = multierror.Append(failed, errors.Wrapf(errs[i], "source %s", source.URL))
+			failures++
+		}
+	}
+
+	if failures == len(feedConfig.Sources) {
+		return nil, failed
+	}
+
+	var previous []*model.Source
+	if info, err := u.db.GetFeed(ctx, feedConfig.ID); err == nil {
+		previous = info.Sources
+	}
+
+	return mergeFeeds(feedConfig, results, errs, previous, time.Now().UTC()), nil
+}
+
+// mergeFeeds combines feeds built from the sources of a merged feed into one.
+// Feed info is taken from the first source that updated successfully.
+func mergeFeeds(feedConfig *feed.Config, results []*model.Feed, errs []error, previous []*model.Source, now time.Time) *model.Feed {
+	var (
+		merged   *model.Feed
+		states   []*model.Source
+		episodes []*model.Episode
+		seen     = make(map[string]struct{})
+	)
+
+	for i, source := range feedConfig.Sources {
+		state := &model.Source{URL: source.URL}
+		for _, prev := range previous {
+			if prev.URL == source.URL {
+				*state = *prev
+			}
+		}
+
+		if errs[i] != nil {
+			state.Error = errs[i].Error()
+		} else {
+			result := results[i]
+			if merged == nil {
+				info := *result
+				merged = &info
+			}
+
+			state.Provider = result.Provider
+			state.UpdatedAt = now
+			state.Error = ""
+			state.Episodes = len(result.Episodes)
+
+			for _, episode := range result.Episodes {
+				if _, ok := seen[episode.ID]; ok {
+					log.WithField("episode_id", episode.ID).Debugf("skipping duplicate from %s", source.URL)
+					continue
+				}
+				seen[episode.ID] = struct{}{}
+
+				episode.Source = source.URL
+				episodes = append(episodes, episode)
+			}
+		}
+
+		states = append(states, state)
+	}
+
+	merged.Episodes = episodes
+	merged.Sources = states
+	merged.ID = feedConfig.ID
+	merged.PageSize = feedConfig.PageSize
+	return merged
+}
+
 func (u *Manager) fetchEpisodes(ctx context.Context, feedConfig *feed.Config) ([]*model.Episode, error) {
 	var (
 		feedID       = feedConfig.ID
@@ -167,13 +414,14 @@ func (u *Manager) fetchEpisodes(ctx context.Context, feedConfig *feed.Config) ([
 		var (
 			logger = log.WithFields(log.Fields{"episode_id": episode.ID})
 		)
-		if episode.Status != model.EpisodeNew && episode.Status != model.EpisodeError {
+		// Filtered episodes are downloaded again once filters match them
+		if episode.Status != model.EpisodeNew && episode.Status != model.EpisodeError && episode.Status != model.EpisodeFiltered {
 			// File already downloaded
 			logger.Infof("skipping due to already downloaded")
 			return nil
 		}
 
-		if !matchFilters(episode, &feedConfig.Filters) {
+		if !matchFeedFilters(episode, feedConfig) {
 			return nil
 		}
 
@@ -209,6 +457,16 @@ func (u *Manager) downloadEpisodes(ctx context.Context, feedConfig *feed.Config,
 		return nil
 	}
 
+	// Feed info is needed to fill in album and artist tags
+	var info *model.Feed
+	if feedConfig.Metadata.Enabled {
+		f, err := u.db.GetFeed(ctx, feedID)
+		if err != nil {
+			return errors.Wrap(err, "failed to query feed info for tagging")
+		}
+		info = f
+	}
+
 	// Download pending episodes
 
 	for idx, episode := range downloadList {
@@ -244,7 +502,19 @@ func (u *Manager) downloadEpisodes(ctx context.Context, feedConfig *feed.Config,
 		// We download the episode to a temp directory first to avoid downloading this file by clients
 		// while still being processed by youtube-dl (e.g. a file is being downloaded from YT or encoding in progress)
 
+		// Pre download hooks can veto the download by exiting with a non-zero code,
+		// the episode is left as is and considered again on next update
+		if err := u.runHooks(ctx, feedConfig, feedConfig.PreEpisodeDownload, &feed.HookContext{
+			Hook:    feed.HookPreEpisodeDownload,
+			Episode: episode,
+			File:    fmt.Sprintf("%s/%s", feedID, episodeName),
+		}); err != nil {
+			logger.WithError(err).Info("download vetoed by pre episode download hook")
+			continue
+		}
+
 		logger.Infof("! downloading episode %s", episode.VideoURL)
+		u.events.Publish(events.Event{Type: events.DownloadStarted, FeedID: feedID, Episode: episode})
 		tempFile, err := u.downloader.Download(ctx, feedConfig, episode)
 		if err != nil {
 			// YouTube might block host with HTTP Error 429: Too Many Requests
@@ -255,31 +525,81 @@ func (u *Manager) downloadEpisodes(ctx context.Context, feedConfig *feed.Config,
 				break
 			}
 
-			// Execute episode download error hooks
-			if len(feedConfig.OnEpisodeDownloadError) > 0 {
-				env := []string{
-					"FEED_NAME=" + feedID,
-					"EPISODE_TITLE=" + episode.Title,
-					"ERROR_MESSAGE=" + err.Error(),
+			if err := u.markFailed(ctx, feedConfig, episode, err, logger); err != nil {
+				return err
+			}
+
+			continue
+		}
+
+		// Renditions are produced from the same download before the source file is released
+		renditions, err := u.createRenditions(ctx, feedConfig, info, episode, tempFile)
+		if err != nil {
+			tempFile.Close()
+			logger.WithError(err).Error("failed to create renditions")
+			if err := u.markFailed(ctx, feedConfig, episode, err, logger); err != nil {
+				return err
+			}
+
+			continue
+		}
+
+		if feedConfig.TranscodeProfile != nil {
+			logger.Info("transcoding episode")
+			transcoded, err := u.transcode(ctx, feedConfig.TranscodeProfile, tempFile)
+			tempFile.Close()
+			if err != nil {
+				logger.WithError(err).Error("failed to transcode episode")
+				u.deleteRenditions(ctx, feedConfig, episode, renditions)
+				if err := u.markFailed(ctx, feedConfig, episode, err, logger); err != nil {
+					return err
 				}
 
-				for i, hook := range feedConfig.OnEpisodeDownloadError {
-					if hookErr := hook.Invoke(env); hookErr != nil {
-						logger.Errorf("failed to execute episode download error hook %d: %v", i+1, hookErr)
-					} else {
-						logger.Infof("episode download error hook %d executed successfully", i+1)
-					}
+				continue
+			}
+
+			tempFile = transcoded
+		}
+
+		if info != nil {
+			logger.Info("writing tags")
+			tagged, err := u.writeTags(ctx, feedConfig, info, episode, tempFile)
+			tempFile.Close()
+			if err != nil {
+				logger.WithError(err).Error("failed to write tags")
+				u.deleteRenditions(ctx, feedConfig, episode, renditions)
+				if err := u.markFailed(ctx, feedConfig, episode, err, logger); err != nil {
+					return err
 				}
+
+				continue
 			}
 
-			if err := u.db.UpdateEpisode(feedID, episode.ID, func(episode *model.Episode) error {
-				episode.Status = model.EpisodeError
-				return nil
-			}); err != nil {
-				return err
+			tempFile = tagged
+		}
+
+		// Process hooks run last, so they see the final file and may change its extension
+		extension := ""
+		if len(feedConfig.ProcessEpisode) > 0 {
+			logger.Info("processing episode")
+			processed, ext, err := u.processEpisode(ctx, feedConfig, episode, tempFile)
+			if err != nil {
+				tempFile.Close()
+				logger.WithError(err).Error("failed to process episode")
+				u.deleteRenditions(ctx, feedConfig, episode, renditions)
+				if err := u.markFailed(ctx, feedConfig, episode, err, logger); err != nil {
+					return err
+				}
+
+				continue
 			}
 
-			continue
+			tempFile = processed
+			extension = ext
+
+			renamed := *episode
+			renamed.Extension = extension
+			episodeName = feed.EpisodeName(feedConfig, &renamed)
 		}
 
 		logger.Debug("copying file")
@@ -287,37 +607,44 @@ func (u *Manager) downloadEpisodes(ctx context.Context, feedConfig *feed.Config,
 		tempFile.Close()
 		if err != nil {
 			logger.WithError(err).Error("failed to copy file")
+			u.deleteRenditions(ctx, feedConfig, episode, renditions)
 			return err
 		}
 
 		// Execute post episode download hooks
-		if len(feedConfig.PostEpisodeDownload) > 0 {
-			env := []string{
-				"EPISODE_FILE=" + fmt.Sprintf("%s/%s", feedID, episodeName),
-				"FEED_NAME=" + feedID,
-				"EPISODE_TITLE=" + episode.Title,
-			}
-
-			for i, hook := range feedConfig.PostEpisodeDownload {
-				if err := hook.Invoke(env); err != nil {
-					logger.Errorf("failed to execute post episode download hook %d: %v", i+1, err)
-				} else {
-					logger.Infof("post episode download hook %d executed successfully", i+1)
-				}
-			}
+		downloadedEpisode := *episode
+		downloadedEpisode.Size = fileSize
+		downloadedEpisode.Extension = extension
+		if err := u.runHooks(ctx, feedConfig, feedConfig.PostEpisodeDownload, &feed.HookContext{
+			Hook:    feed.HookPostEpisodeDownload,
+			Episode: &downloadedEpisode,
+			File:    fmt.Sprintf("%s/%s", feedID, episodeName),
+		}); err != nil {
+			logger.WithError(err).Error("failed to execute post episode download hooks")
 		}
 
 		// Update file status in database
 
 		logger.Infof("successfully downloaded file %q", episode.ID)
+		var updated model.Episode
 		if err := u.db.UpdateEpisode(feedID, episode.ID, func(episode *model.Episode) error {
 			episode.Size = fileSize
+			episode.Renditions = renditions
+			episode.Extension = extension
 			episode.Status = model.EpisodeDownloaded
+			updated = *episode
 			return nil
 		}); err != nil {
 			return err
 		}
 
+		u.events.Publish(events.Event{
+			Type:    events.DownloadSucceeded,
+			FeedID:  feedID,
+			Episode: &updated,
+			File:    fmt.Sprintf("%s/%s", feedID, episodeName),
+		})
+
 		downloaded++
 	}
 
@@ -325,26 +652,267 @@ func (u *Manager) downloadEpisodes(ctx context.Context, feedConfig *feed.Config,
 	return nil
 }
 
-func (u *Manager) buildXML(ctx context.Context, feedConfig *feed.Config) error {
-	f, err := u.db.GetFeed(ctx, feedConfig.ID)
+// createRenditions transcodes the downloaded source into each of the feed's renditions and uploads them.
+// Returns file sizes by rendition name.
+// Tags are written to renditions as well when info is not nil.
+// Renditions uploaded before a failure are deleted, so no untracked files are left behind.
+func (u *Manager) createRenditions(ctx context.Context, feedConfig *feed.Config, info *model.Feed, episode *model.Episode, source io.ReadCloser) (_ map[string]int64, err error) {
+	if len(feedConfig.Renditions) == 0 {
+		return nil, nil
+	}
+
+	sizes := make(map[string]int64, len(feedConfig.Renditions))
+	defer func() {
+		if err != nil {
+			u.deleteRenditions(ctx, feedConfig, episode, sizes)
+		}
+	}()
+
+	for _, renditionConfig := range feedConfig.RenditionConfigs() {
+		logger := log.WithFields(log.Fields{"episode_id": episode.ID, "rendition": renditionConfig.Rendition})
+		logger.Info("creating rendition")
+
+		file, err := u.transcode(ctx, renditionConfig.TranscodeProfile, source)
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to transcode rendition %q", renditionConfig.Rendition)
+		}
+
+		if info != nil {
+			tagged, err := u.writeTags(ctx, renditionConfig, info, episode, file)
+			file.Close()
+			if err != nil {
+				return nil, errors.Wrapf(err, "failed to write tags to rendition %q", renditionConfig.Rendition)
+			}
+			file = tagged
+		}
+
+		path := fmt.Sprintf("%s/%s", renditionConfig.ID, feed.EpisodeName(renditionConfig, episode))
+		size, err := u.fs.Create(ctx, path, file)
+		file.Close()
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to copy rendition %q", renditionConfig.Rendition)
+		}
+
+		sizes[renditionConfig.Rendition] = size
+	}
+
+	return sizes, nil
+}
+
+// deleteRenditions removes uploaded renditions of an episode that failed to download.
+// Errors are only logged, the episode is retried on next update and renditions are overwritten.
+func (u *Manager) deleteRenditions(ctx context.Context, feedConfig *feed.Config, episode *model.Episode, sizes map[string]int64) {
+	for name := range sizes {
+		rendition := feedConfig.FindRendition(name)
+		if rendition == nil {
+			continue
+		}
+
+		renditionConfig := feedConfig.RenditionConfig(rendition)
+		path := fmt.Sprintf("%s/%s", renditionConfig.ID, feed.EpisodeName(renditionConfig, episode))
+		if err := u.fs.Delete(ctx, path); err != nil && !errors.Is(err, os.ErrNotExist) {
+			log.WithError(err).WithField("episode_id", episode.ID).Warnf("failed to delete rendition %q", path)
+		}
+	}
+}
+
+// markFailed executes download error hooks and flags the episode for retry on next update
+func (u *Manager) markFailed(ctx context.Context, feedConfig *feed.Config, episode *model.Episode, downloadErr error, logger log.FieldLogger) error {
+	// Execute episode download error hooks
+	if err := u.runHooks(ctx, feedConfig, feedConfig.OnEpisodeDownloadError, &feed.HookContext{
+		Hook:    feed.HookOnEpisodeDownloadError,
+		Episode: episode,
+		Error:   downloadErr.Error(),
+	}); err != nil {
+		logger.WithError(err).Error("failed to execute episode download error hooks")
+	}
+
+	u.events.Publish(events.Event{Type: events.DownloadFailed, FeedID: feedConfig.ID, Episode: episode, Error: downloadErr.Error()})
+
+	return u.db.UpdateEpisode(feedConfig.ID, episode.ID, func(episode *model.Episode) error {
+		episode.Status = model.EpisodeError
+		return nil
+	})
+}
+
+// processEpisode runs process hooks one after another on the downloaded file.
+// Each hook either modifies the file in place or writes a replacement to its output directory.
+// Returns the resulting file, closing it releases the source file as well, and its extension
+// when it differs from the feed format (see model.Episode.Extension).
+func (u *Manager) processEpisode(ctx context.Context, feedConfig *feed.Config, episode *model.Episode, source io.ReadCloser) (io.ReadCloser, string, error) {
+	path, err := localPath(source)
 	if err != nil {
-		return err
+		return nil, "", err
+	}
+
+	var dirs []string
+	cleanup := func() {
+		for _, dir := range dirs {
+			if err := os.RemoveAll(dir); err != nil {
+				log.WithError(err).Errorf("failed to remove %s", dir)
+			}
+		}
+	}
+
+	for i, hook := range feedConfig.ProcessEpisode {
+		dir, err := os.MkdirTemp("", "podsync-process-")
+		if err != nil {
+			cleanup()
+			return nil, "", errors.Wrap(err, "failed to create output directory")
+		}
+		dirs = append(dirs, dir)
+
+		if err := u.runHooks(ctx, feedConfig, []*feed.ExecHook{hook}, &feed.HookContext{
+			Hook:    feed.HookProcessEpisode,
+			Episode: episode,
+			File:    fmt.Sprintf("%s/%s", feedConfig.ID, feed.EpisodeName(feedConfig, episode)),
+			Path:    path,
+			Output:  dir,
+		}); err != nil {
+			cleanup()
+			return nil, "", errors.Wrapf(err, "process hook %d failed", i+1)
+		}
+
+		entries, err := os.ReadDir(dir)
+		if err != nil {
+			cleanup()
+			return nil, "", errors.Wrap(err, "failed to read output directory")
+		}
+
+		switch len(entries) {
+		case 0:
+			// File was modified in place
+		case 1:
+			path = filepath.Join(dir, entries[0].Name())
+		default:
+			cleanup()
+			return nil, "", errors.Errorf("process hook %d produced %d files, expected one", i+1, len(entries))
+		}
 	}
 
-	// Build iTunes XML feed with data received from builder
-	log.Debug("building iTunes podcast feed")
-	podcast, err := feed.Build(ctx, f, feedConfig, u.hostname)
+	extension, err := feed.FileExtension(feedConfig, path)
+	if err != nil {
+		cleanup()
+		return nil, "", err
+	}
+
+	// Reopen the file, hooks may have replaced it rather than writing to it
+	file, err := os.Open(path)
+	if err != nil {
+		cleanup()
+		return nil, "", errors.Wrap(err, "failed to open processed file")
+	}
+
+	return &processedFile{File: file, source: source, dirs: dirs}, extension, nil
+}
+
+// processedFile is an episode file produced by process hooks
+type processedFile struct {
+	*os.File
+	source io.Closer
+	dirs   []string
+}
+
+func (f *processedFile) Close() error {
+	var result *multierror.Error
+	if err := f.File.Close(); err != nil {
+		result = multierror.Append(result, err)
+	}
+	if err := f.source.Close(); err != nil {
+		result = multierror.Append(result, err)
+	}
+	for _, dir := range f.dirs {
+		if err := os.RemoveAll(dir); err != nil {
+			result = multierror.Append(result, err)
+		}
+	}
+	return result.ErrorOrNil()
+}
+
+// runHooks fills in feed details of the hook context and executes the hooks one by one.
+// All hooks are executed even if some of them fail.
+func (u *Manager) runHooks(ctx context.Context, feedConfig *feed.Config, hooks []*feed.ExecHook, hookContext *feed.HookContext) error {
+	if len(hooks) == 0 {
+		return nil
+	}
+
+	hookContext.FeedID = feedConfig.ID
+	hookContext.FeedURL = feed.XMLURL(u.hostname, feedConfig.ID)
+	hookContext.FeedTitle = feedConfig.Custom.Title
+	if hookContext.FeedTitle == "" {
+		if info, err := u.db.GetFeed(ctx, feedConfig.ID); err == nil {
+			hookContext.FeedTitle = info.Title
+		}
+	}
+
+	if locator, ok := u.fs.(fs.Locator); ok && hookContext.File != "" && hookContext.Path == "" {
+		if path, err := locator.LocalPath(hookContext.File); err == nil {
+			hookContext.Path = path
+		}
+	}
+
+	var result *multierror.Error
+	for i, hook := range hooks {
+		if err := hook.Run(hookContext); err != nil {
+			result = multierror.Append(result, errors.Wrapf(err, "%s hook %d", hookContext.Hook, i+1))
+			continue
+		}
+
+		log.WithField("feed_id", feedConfig.ID).Infof("%s hook %d executed successfully", hookContext.Hook, i+1)
+	}
+
+	return result.ErrorOrNil()
+}
+
+func (u *Manager) transcode(ctx context.Context, profile *feed.TranscodeProfile, source io.ReadCloser) (io.ReadCloser, error) {
+	if u.processor == nil {
+		return nil, errors.New("transcoding is not available")
+	}
+
+	path, err := localPath(source)
+	if err != nil {
+		return nil, err
+	}
+
+	return u.processor.Transcode(ctx, profile, path)
+}
+
+// localPath returns the path of a downloaded file on the local file system
+func localPath(file io.ReadCloser) (string, error) {
+	named, ok := file.(interface{ Name() string })
+	if !ok {
+		return "", errors.New("downloaded episode is not a local file")
+	}
+
+	return named.Name(), nil
+}
+
+// BuildXML uploads XML feeds of the feed and its renditions built from the database
+func (u *Manager) BuildXML(ctx context.Context, feedConfig *feed.Config) error {
+	f, err := u.db.GetFeed(ctx, feedConfig.ID)
 	if err != nil {
 		return err
 	}
 
-	var (
-		reader  = bytes.NewReader([]byte(podcast.String()))
-		xmlName = fmt.Sprintf("%s.xml", feedConfig.ID)
-	)
+	// Each rendition is published as a separate XML feed built from the same episodes
+	configs := append([]*feed.Config{feedConfig}, feedConfig.RenditionConfigs()...)
 
-	if _, err := u.fs.Create(ctx, xmlName, reader); err != nil {
-		return errors.Wrap(err, "failed to upload new XML feed")
+	for _, cfg := range configs {
+		// Build iTunes XML feed with data received from builder
+		log.Debugf("building iTunes podcast feed %q", cfg.ID)
+		podcast, err := feed.Build(ctx, f, cfg, u.hostname)
+		if err != nil {
+			return err
+		}
+
+		var (
+			reader  = bytes.NewReader([]byte(podcast.String()))
+			xmlName = fmt.Sprintf("%s.xml", cfg.ID)
+		)
+
+		if _, err := u.fs.Create(ctx, xmlName, reader); err != nil {
+			return errors.Wrap(err, "failed to upload new XML feed")
+		}
 	}
 
 	return nil
@@ -370,72 +938,201 @@ func (u *Manager) buildOPML(ctx context.Context) error {
 	return nil
 }
 
-func (u *Manager) cleanup(ctx context.Context, feedConfig *feed.Config) error {
+// Removal is an episode removed by cleanup or disk quota, or selected for removal in dry run mode
+type Removal struct {
+	FeedID  string         `json:"feed_id"`
+	Episode *model.Episode `json:"episode"`
+}
+
+// Cleanup removes episodes according to the feed's cleanup policy.
+// In dry run mode episodes are only selected and logged.
+func (u *Manager) Cleanup(ctx context.Context, feedConfig *feed.Config, dryRun bool) ([]Removal, error) {
 	var (
-		feedID = feedConfig.ID
-		logger = log.WithField("feed_id", feedID)
-		list   []*model.Episode
-		result *multierror.Error
+		feedID  = feedConfig.ID
+		logger  = log.WithField("feed_id", feedID)
+		policy  = feedConfig.Clean
+		list    []*model.Episode
+		removed []Removal
+		result  *multierror.Error
 	)
 
-	if feedConfig.Clean == nil {
+	if policy == nil {
 		logger.Debug("no cleanup policy configured")
-		return nil
+		return nil, nil
 	}
 
-	count := feedConfig.Clean.KeepLast
-	if count < 1 {
+	if !policy.Enabled() {
 		logger.Info("nothing to clean")
-		return nil
+		return nil, nil
 	}
 
-	logger.WithField("count", count).Info("running cleaner")
+	dryRun = dryRun || policy.DryRun
+
+	logger.WithFields(log.Fields{
+		"keep_last":       policy.KeepLast,
+		"max_age":         policy.MaxAge,
+		"max_size":        policy.MaxSize.String(),
+		"keep_newer_than": policy.KeepNewerThan,
+	}).Info("running cleaner")
+
+	// Pinned episodes are neither removed nor counted towards the limits
 	if err := u.db.WalkEpisodes(ctx, feedConfig.ID, func(episode *model.Episode) error {
-		if episode.Status == model.EpisodeDownloaded {
+		if episode.Status == model.EpisodeDownloaded && !feedConfig.IsPinned(episode) {
 			list = append(list, episode)
 		}
 		return nil
 	}); err != nil {
-		return err
+		return nil, err
 	}
 
-	if count > len(list) {
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].PubDate.After(list[j].PubDate)
+	})
+
+	for _, episode := range policy.SelectForCleanup(list, time.Now()) {
+		episodeLogger := logger.WithField("episode_id", episode.ID)
+
+		if dryRun {
+			episodeLogger.Infof("dry run: would delete %q", episode.Title)
+			removed = append(removed, Removal{FeedID: feedID, Episode: episode})
+			continue
+		}
+
+		episodeLogger.Infof("deleting %q", episode.Title)
+		if err := u.removeEpisode(ctx, feedConfig, episode, model.EpisodeCleaned); err != nil {
+			episodeLogger.WithError(err).Error("failed to delete episode")
+			result = multierror.Append(result, err)
+			continue
+		}
+
+		removed = append(removed, Removal{FeedID: feedID, Episode: episode})
+	}
+
+	return removed, result.ErrorOrNil()
+}
+
+// ApplyFilters removes downloaded episodes that don't match the feed's filters anymore.
+// Removed episodes are marked as filtered and downloaded again if filters change to match them.
+// In dry run mode episodes are only selected and logged.
+func (u *Manager) ApplyFilters(ctx context.Context, feedConfig *feed.Config, dryRun bool) ([]Removal, error) {
+	var (
+		feedID  = feedConfig.ID
+		logger  = log.WithField("feed_id", feedID)
+		list    []*model.Episode
+		removed []Removal
+		result  *multierror.Error
+	)
+
+	logger.Info("applying filters to downloaded episodes")
+
+	if err := u.db.WalkEpisodes(ctx, feedID, func(episode *model.Episode) error {
+		if episode.Status == model.EpisodeDownloaded && !feedConfig.IsPinned(episode) && !matchFeedFilters(episode, feedConfig) {
+			list = append(list, episode)
+		}
 		return nil
+	}); err != nil {
+		return nil, err
 	}
 
 	sort.Slice(list, func(i, j int) bool {
 		return list[i].PubDate.After(list[j].PubDate)
 	})
 
-	for _, episode := range list[count:] {
-		logger.WithField("episode_id", episode.ID).Infof("deleting %q", episode.Title)
+	for _, episode := range list {
+		episodeLogger := logger.WithField("episode_id", episode.ID)
 
-		var (
-			episodeName = feed.EpisodeName(feedConfig, episode)
-			path        = fmt.Sprintf("%s/%s", feedConfig.ID, episodeName)
-		)
+		if dryRun {
+			episodeLogger.Infof("dry run: would delete %q", episode.Title)
+			removed = append(removed, Removal{FeedID: feedID, Episode: episode})
+			continue
+		}
 
-		err := u.fs.Delete(ctx, path)
-		if err != nil {
+		episodeLogger.Infof("deleting %q", episode.Title)
+		if err := u.removeEpisode(ctx, feedConfig, episode, model.EpisodeFiltered); err != nil {
+			episodeLogger.WithError(err).Error("failed to delete episode")
+			result = multierror.Append(result, err)
+			continue
+		}
+
+		removed = append(removed, Removal{FeedID: feedID, Episode: episode})
+	}
+
+	return removed, result.ErrorOrNil()
+}
+
+// DeleteEpisode deletes files of an episode and marks it as cleaned, so it's not downloaded again
+func (u *Manager) DeleteEpisode(ctx context.Context, feedConfig *feed.Config, episodeID string) error {
+	episode, err := u.db.GetEpisode(ctx, feedConfig.ID, episodeID)
+	if err != nil {
+		return errors.Wrapf(err, "failed to query episode %q", episodeID)
+	}
+
+	return u.removeEpisode(ctx, feedConfig, episode, model.EpisodeCleaned)
+}
+
+// removeEpisode deletes episode files and sets the episode status to cleaned or filtered
+func (u *Manager) removeEpisode(ctx context.Context, feedConfig *feed.Config, episode *model.Episode, status model.EpisodeStatus) error {
+	if err := u.deleteEpisodeFiles(ctx, feedConfig, episode); err != nil {
+		return errors.Wrapf(err, "failed to delete episode: %s", episode.ID)
+	}
+
+	if err := u.deleteArtwork(ctx, episode); err != nil {
+		log.WithError(err).Errorf("failed to delete episode artwork: %s", episode.ID)
+	}
+
+	if err := u.db.UpdateEpisode(feedConfig.ID, episode.ID, func(episode *model.Episode) error {
+		episode.Status = status
+		// Filtered episodes keep metadata, so filters can be evaluated again
+		if status == model.EpisodeCleaned {
+			episode.Title = ""
+			episode.Description = ""
+		}
+		episode.Renditions = nil
+		episode.Artwork = ""
+		return nil
+	}); err != nil {
+		return errors.Wrapf(err, "failed to set state for %s episode: %s", status, episode.ID)
+	}
+
+	u.events.Publish(events.Event{Type: events.EpisodeCleaned, FeedID: feedConfig.ID, Episode: episode})
+
+	return nil
+}
+
+// deleteEpisodeFiles removes the episode file along with all its renditions and their download stats
+func (u *Manager) deleteEpisodeFiles(ctx context.Context, feedConfig *feed.Config, episode *model.Episode) error {
+	configs := []*feed.Config{feedConfig}
+	for name := range episode.Renditions {
+		if rendition := feedConfig.FindRendition(name); rendition != nil {
+			configs = append(configs, feedConfig.RenditionConfig(rendition))
+		}
+	}
+
+	for _, cfg := range configs {
+		name := feed.EpisodeName(cfg, episode)
+		if err := u.db.DeleteAccess(ctx, cfg.ID, name); err != nil {
+			log.WithError(err).WithField("episode_id", episode.ID).Errorf("failed to delete access records of %q", name)
+		}
+
+		path := fmt.Sprintf("%s/%s", cfg.ID, name)
+		if err := u.fs.Delete(ctx, path); err != nil {
 			if !errors.Is(err, os.ErrNotExist) {
-				logger.WithError(err).Errorf("failed to delete episode file: %s", episode.ID)
-				result = multierror.Append(result, errors.Wrapf(err, "failed to delete episode: %s", episode.ID))
-				continue
+				return err
 			}
 
-			logger.WithField("episode_id", episode.ID).Info("episode was not found - file does not exist")
+			log.WithField("episode_id", episode.ID).Infof("file %q was not found - file does not exist", path)
+			continue
 		}
 
-		if err := u.db.UpdateEpisode(feedID, episode.ID, func(episode *model.Episode) error {
-			episode.Status = model.EpisodeCleaned
-			episode.Title = ""
-			episode.Description = ""
-			return nil
+		// Renditions share hooks of the parent feed
+		if err := u.runHooks(ctx, feedConfig, feedConfig.PostEpisodeCleanup, &feed.HookContext{
+			Hook:    feed.HookPostEpisodeCleanup,
+			Episode: episode,
+			File:    path,
 		}); err != nil {
-			result = multierror.Append(result, errors.Wrapf(err, "failed to set state for cleaned episode: %s", episode.ID))
-			continue
+			log.WithError(err).WithField("episode_id", episode.ID).Error("failed to execute post episode cleanup hooks")
 		}
 	}
 
-	return result.ErrorOrNil()
+	return nil
 }
@@ -0,0 +1,606 @@
+package update
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/mxpv/podsync/pkg/builder"
+	"github.com/mxpv/podsync/pkg/db"
+	"github.com/mxpv/podsync/pkg/events"
+	"github.com/mxpv/podsync/pkg/feed"
+	"github.com/mxpv/podsync/pkg/fs"
+	"github.com/mxpv/podsync/pkg/media"
+	"github.com/mxpv/podsync/pkg/model"
+	"github.com/mxpv/podsync/pkg/notify"
+	"github.com/mxpv/podsync/pkg/ytdl"
+)
+
+func TestCleanupSkipsPinnedEpisodes(t *testing.T) {
+	ctx := context.Background()
+	now := time.Now().UTC()
+
+	database, err := db.NewBadger(&db.Config{Dir: t.TempDir()})
+	require.NoError(t, err)
+	defer database.Close()
+
+	storage, err := fs.NewLocal(t.TempDir(), false, false)
+	require.NoError(t, err)
+
+	err = database.AddFeed(ctx, "a", &model.Feed{ID: "a", Episodes: []*model.Episode{
+		{ID: "1", Title: "Newest", Status: model.EpisodeDownloaded, PubDate: now},
+		{ID: "2", Title: "Pinned via API", Status: model.EpisodeDownloaded, PubDate: now.AddDate(0, 0, -1), Pinned: true},
+		{ID: "3", Title: "Lecture 1", Status: model.EpisodeDownloaded, PubDate: now.AddDate(0, 0, -2)},
+		{ID: "4", Title: "Second newest unpinned", Status: model.EpisodeDownloaded, PubDate: now.AddDate(0, 0, -3)},
+		{ID: "5", Title: "Oldest", Status: model.EpisodeDownloaded, PubDate: now.AddDate(0, 0, -4)},
+	}})
+	require.NoError(t, err)
+
+	feedConfig := &feed.Config{
+		ID:     "a",
+		Format: model.FormatAudio,
+		Clean:  &feed.Cleanup{KeepLast: 2},
+		Pin:    feed.Pins{Titles: []string{"^Lecture"}},
+	}
+
+	for _, id := range []string{"1", "5"} {
+		name := feed.EpisodeName(feedConfig, &model.Episode{ID: id})
+		err = database.RecordAccess(ctx, &model.Access{FeedID: "a", File: name, Day: "2024-01-01", Client: "abc", Requests: 1})
+		require.NoError(t, err)
+	}
+
+	var cleaned []string
+	bus := events.NewBus()
+	bus.Subscribe(events.HandlerFunc(func(_ context.Context, event *events.Event) error {
+		if event.Type == events.EpisodeCleaned {
+			cleaned = append(cleaned, event.Episode.ID)
+		}
+		return nil
+	}))
+
+	manager := &Manager{db: database, fs: storage, feeds: map[string]*feed.Config{"a": feedConfig}, events: bus}
+	removed, err := manager.Cleanup(ctx, feedConfig, false)
+	require.NoError(t, err)
+	assert.Len(t, removed, 1)
+
+	bus.Close(ctx)
+	assert.Equal(t, []string{"5"}, cleaned)
+
+	// Pinned episodes don't count towards keep_last
+	for id, expected := range map[string]model.EpisodeStatus{
+		"1": model.EpisodeDownloaded,
+		"2": model.EpisodeDownloaded,
+		"3": model.EpisodeDownloaded,
+		"4": model.EpisodeDownloaded,
+		"5": model.EpisodeCleaned,
+	} {
+		episode, err := database.GetEpisode(ctx, "a", id)
+		require.NoError(t, err)
+		assert.Equal(t, expected, episode.Status, "episode %s", id)
+	}
+
+	// Download stats of cleaned episodes are removed with their files
+	var files []string
+	err = database.WalkAccess(ctx, "a", func(access *model.Access) error {
+		files = append(files, access.File)
+		return nil
+	})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"1.mp3"}, files)
+}
+
+func TestApplyFilters(t *testing.T) {
+	ctx := context.Background()
+	now := time.Now().UTC()
+
+	database, err := db.NewBadger(&db.Config{Dir: t.TempDir()})
+	require.NoError(t, err)
+	defer database.Close()
+
+	dir := t.TempDir()
+	storage, err := fs.NewLocal(dir, false, false)
+	require.NoError(t, err)
+
+	err = database.AddFeed(ctx, "a", &model.Feed{ID: "a", Episodes: []*model.Episode{
+		{ID: "1", Title: "Episode 1", Status: model.EpisodeDownloaded, PubDate: now},
+		{ID: "2", Title: "Trailer", Status: model.EpisodeDownloaded, PubDate: now.AddDate(0, 0, -1)},
+		{ID: "3", Title: "Pinned trailer", Status: model.EpisodeDownloaded, PubDate: now.AddDate(0, 0, -2), Pinned: true},
+		{ID: "4", Title: "New trailer", Status: model.EpisodeNew, PubDate: now.AddDate(0, 0, -3)},
+	}})
+	require.NoError(t, err)
+
+	for _, id := range []string{"1", "2", "3"} {
+		_, err := storage.Create(ctx, "a/"+id+".mp3", strings.NewReader("data"))
+		require.NoError(t, err)
+	}
+
+	feedConfig := &feed.Config{
+		ID:       "a",
+		Format:   model.FormatAudio,
+		PageSize: 10,
+		Filters:  feed.Filters{NotTitle: "(?i)trailer"},
+	}
+	manager := &Manager{db: database, fs: storage, feeds: map[string]*feed.Config{"a": feedConfig}}
+
+	removed, err := manager.ApplyFilters(ctx, feedConfig, true)
+	require.NoError(t, err)
+	require.Len(t, removed, 1)
+	assert.Equal(t, "2", removed[0].Episode.ID)
+	assert.FileExists(t, filepath.Join(dir, "a", "2.mp3"))
+
+	removed, err = manager.ApplyFilters(ctx, feedConfig, false)
+	require.NoError(t, err)
+	require.Len(t, removed, 1)
+	assert.NoFileExists(t, filepath.Join(dir, "a", "2.mp3"))
+	assert.FileExists(t, filepath.Join(dir, "a", "3.mp3"))
+
+	episode, err := database.GetEpisode(ctx, "a", "2")
+	require.NoError(t, err)
+	assert.Equal(t, model.EpisodeFiltered, episode.Status)
+	assert.Equal(t, "Trailer", episode.Title)
+
+	// Filtered episodes are downloaded again once filters match them
+	list, err := manager.fetchEpisodes(ctx, feedConfig)
+	require.NoError(t, err)
+	assert.Empty(t, list)
+
+	feedConfig.Filters.NotTitle = ""
+	list, err = manager.fetchEpisodes(ctx, feedConfig)
+	require.NoError(t, err)
+	require.Len(t, list, 2)
+	assert.Equal(t, "2", list[0].ID)
+	assert.Equal(t, "4", list[1].ID)
+}
+
+func TestMergeFeeds(t *testing.T) {
+	var (
+		now     = time.Now().UTC()
+		earlier = now.Add(-time.Hour)
+	)
+
+	feedConfig := &feed.Config{
+		ID:       "bundle",
+		PageSize: 5,
+		Sources: []*feed.Source{
+			{URL: "https://youtube.com/channel/a"},
+			{URL: "https://vimeo.com/b"},
+			{URL: "https://soundcloud.com/c/sets/d"},
+		},
+	}
+
+	results := []*model.Feed{
+		nil,
+		{Title: "B", Provider: model.ProviderVimeo, Episodes: []*model.Episode{{ID: "1"}, {ID: "2"}}},
+		{Title: "C", Provider: model.ProviderSoundcloud, Episodes: []*model.Episode{{ID: "2"}, {ID: "3"}}},
+	}
+	errs := []error{errors.New("quota exceeded"), nil, nil}
+	previous := []*model.Source{{URL: "https://youtube.com/channel/a", Provider: model.ProviderYoutube, UpdatedAt: earlier, Episodes: 7}}
+
+	merged := mergeFeeds(feedConfig, results, errs, previous, now)
+	assert.Equal(t, "bundle", merged.ID)
+	assert.Equal(t, "B", merged.Title)
+	assert.Equal(t, 5, merged.PageSize)
+
+	// Duplicates are taken from the first source
+	require.Len(t, merged.Episodes, 3)
+	for i, source := range []string{"https://vimeo.com/b", "https://vimeo.com/b", "https://soundcloud.com/c/sets/d"} {
+		assert.Equal(t, source, merged.Episodes[i].Source)
+	}
+
+	// Failed sources keep the state of the last successful update
+	require.Len(t, merged.Sources, 3)
+	assert.Equal(t, &model.Source{URL: "https://youtube.com/channel/a", Provider: model.ProviderYoutube, UpdatedAt: earlier, Error: "quota exceeded", Episodes: 7}, merged.Sources[0])
+	assert.Equal(t, &model.Source{URL: "https://vimeo.com/b", Provider: model.ProviderVimeo, UpdatedAt: now, Episodes: 2}, merged.Sources[1])
+	assert.Equal(t, 2, merged.Sources[2].Episodes)
+}
+
+// stubBuilder returns copies of prepared feeds by URL, unknown URLs fail
+type stubBuilder struct {
+	feeds map[string]*model.Feed
+}
+
+func (b *stubBuilder) Build(_ context.Context, cfg *feed.Config) (*model.Feed, error) {
+	result, ok := b.feeds[cfg.URL]
+	if !ok {
+		return nil, errors.Errorf("failed to query %s", cfg.URL)
+	}
+	info := *result
+	return &info, nil
+}
+
+func TestUpdateMergedFeed(t *testing.T) {
+	const (
+		first  = "https://youtube.com/channel/UCfirst"
+		second = "https://youtube.com/channel/UCsecond"
+	)
+
+	stub := &stubBuilder{feeds: map[string]*model.Feed{
+		first:  {Title: "First", Episodes: []*model.Episode{{ID: "1", Status: model.EpisodeNew}}},
+		second: {Title: "Second", Episodes: []*model.Episode{{ID: "2", Status: model.EpisodeNew}}},
+	}}
+
+	newManager := func(t *testing.T) (*Manager, db.Storage) {
+		database, err := db.NewBadger(&db.Config{Dir: t.TempDir()})
+		require.NoError(t, err)
+		t.Cleanup(func() { database.Close() })
+
+		key, err := feed.NewFixedKey("key")
+		require.NoError(t, err)
+
+		return &Manager{
+			db:   database,
+			keys: map[model.Provider]feed.KeyProvider{model.ProviderYoutube: key},
+			newBuilder: func(context.Context, model.Provider, string, builder.Downloader) (builder.Builder, error) {
+				return stub, nil
+			},
+		}, database
+	}
+
+	t.Run("all sources succeed", func(t *testing.T) {
+		ctx := context.Background()
+		manager, database := newManager(t)
+
+		feedConfig := &feed.Config{ID: "bundle", PageSize: 10, Sources: []*feed.Source{{URL: first}, {URL: second}}}
+		require.NoError(t, manager.updateFeed(ctx, feedConfig))
+
+		info, err := database.GetFeed(ctx, "bundle")
+		require.NoError(t, err)
+		assert.Equal(t, "First", info.Title)
+		require.Len(t, info.Sources, 2)
+		assert.Empty(t, info.Sources[0].Error)
+		assert.Empty(t, info.Sources[1].Error)
+
+		_, err = database.GetEpisode(ctx, "bundle", "2")
+		assert.NoError(t, err)
+	})
+
+	t.Run("some sources fail", func(t *testing.T) {
+		ctx := context.Background()
+		manager, database := newManager(t)
+
+		missing := "https://youtube.com/channel/UCmissing"
+		feedConfig := &feed.Config{ID: "bundle", PageSize: 10, Sources: []*feed.Source{{URL: missing}, {URL: second}}}
+		require.NoError(t, manager.updateFeed(ctx, feedConfig))
+
+		info, err := database.GetFeed(ctx, "bundle")
+		require.NoError(t, err)
+		assert.Equal(t, "Second", info.Title)
+		require.Len(t, info.Sources, 2)
+		assert.Contains(t, info.Sources[0].Error, "failed to query")
+		assert.Empty(t, info.Sources[1].Error)
+	})
+
+	t.Run("all sources fail", func(t *testing.T) {
+		manager, _ := newManager(t)
+
+		feedConfig := &feed.Config{ID: "bundle", Sources: []*feed.Source{{URL: "https://youtube.com/channel/UCmissing"}}}
+		assert.Error(t, manager.updateFeed(context.Background(), feedConfig))
+	})
+}
+
+func TestCleanupRunsHooks(t *testing.T) {
+	ctx := context.Background()
+	now := time.Now().UTC()
+
+	database, err := db.NewBadger(&db.Config{Dir: t.TempDir()})
+	require.NoError(t, err)
+	defer database.Close()
+
+	rootDir := t.TempDir()
+	storage, err := fs.NewLocal(rootDir, false, false)
+	require.NoError(t, err)
+
+	err = database.AddFeed(ctx, "a", &model.Feed{ID: "a", Title: "Feed A", Episodes: []*model.Episode{
+		{ID: "1", Title: "Newest", Status: model.EpisodeDownloaded, PubDate: now},
+		{ID: "2", Title: "Oldest", Status: model.EpisodeDownloaded, PubDate: now.AddDate(0, 0, -1)},
+	}})
+	require.NoError(t, err)
+
+	_, err = storage.Create(ctx, "a/2.mp3", strings.NewReader("data"))
+	require.NoError(t, err)
+
+	output := filepath.Join(t.TempDir(), "hook.txt")
+	feedConfig := &feed.Config{
+		ID:     "a",
+		Format: model.FormatAudio,
+		Clean:  &feed.Cleanup{KeepLast: 1},
+		PostEpisodeCleanup: []*feed.ExecHook{
+			{Command: []string{`echo "$HOOK|$FEED_TITLE|$EPISODE_ID|$EPISODE_FILE|$EPISODE_PATH" >> ` + output}},
+		},
+	}
+
+	manager := &Manager{hostname: "http://localhost", db: database, fs: storage, feeds: map[string]*feed.Config{"a": feedConfig}}
+	removed, err := manager.Cleanup(ctx, feedConfig, false)
+	require.NoError(t, err)
+	assert.Len(t, removed, 1)
+
+	data, err := os.ReadFile(output)
+	require.NoError(t, err)
+
+	path, err := filepath.Abs(filepath.Join(rootDir, "a", "2.mp3"))
+	require.NoError(t, err)
+	assert.Equal(t, "post_episode_cleanup|Feed A|2|a/2.mp3|"+path+"\n", string(data))
+}
+
+// fileDownloader writes episode IDs to temp files instead of downloading episodes
+type fileDownloader struct {
+	dir string
+}
+
+func (d *fileDownloader) Download(_ context.Context, _ *feed.Config, episode *model.Episode) (io.ReadCloser, error) {
+	path := filepath.Join(d.dir, episode.ID+".mp3")
+	if err := os.WriteFile(path, []byte(episode.ID), 0644); err != nil {
+		return nil, err
+	}
+	return os.Open(path)
+}
+
+func (d *fileDownloader) PlaylistMetadata(_ context.Context, _ string) (ytdl.PlaylistMetadata, error) {
+	return ytdl.PlaylistMetadata{}, nil
+}
+
+func TestDownloadRunsProcessHooks(t *testing.T) {
+	ctx := context.Background()
+
+	database, err := db.NewBadger(&db.Config{Dir: t.TempDir()})
+	require.NoError(t, err)
+	defer database.Close()
+
+	rootDir := t.TempDir()
+	storage, err := fs.NewLocal(rootDir, false, false)
+	require.NoError(t, err)
+
+	err = database.AddFeed(ctx, "a", &model.Feed{ID: "a", Episodes: []*model.Episode{
+		{ID: "1", Title: "In place", Status: model.EpisodeNew},
+		{ID: "2", Title: "Replaced", Status: model.EpisodeNew},
+	}})
+	require.NoError(t, err)
+
+	feedConfig := &feed.Config{
+		ID:       "a",
+		Format:   model.FormatAudio,
+		PageSize: 10,
+		ProcessEpisode: []*feed.ExecHook{
+			{Command: []string{`echo -n "-processed" >> "$EPISODE_PATH"`}},
+			{Command: []string{`if [ "$EPISODE_ID" = 2 ]; then cat "$EPISODE_PATH" > "$OUTPUT_DIR/out.opus"; fi`}},
+		},
+	}
+
+	manager := &Manager{downloader: &fileDownloader{dir: t.TempDir()}, db: database, fs: storage}
+
+	episodes, err := manager.fetchEpisodes(ctx, feedConfig)
+	require.NoError(t, err)
+	require.NoError(t, manager.downloadEpisodes(ctx, feedConfig, episodes))
+
+	data, err := os.ReadFile(filepath.Join(rootDir, "a", "1.mp3"))
+	require.NoError(t, err)
+	assert.Equal(t, "1-processed", string(data))
+
+	data, err = os.ReadFile(filepath.Join(rootDir, "a", "2.opus"))
+	require.NoError(t, err)
+	assert.Equal(t, "2-processed", string(data))
+
+	episode, err := database.GetEpisode(ctx, "a", "1")
+	require.NoError(t, err)
+	assert.Equal(t, model.EpisodeDownloaded, episode.Status)
+	assert.Equal(t, "", episode.Extension)
+	assert.EqualValues(t, 11, episode.Size)
+
+	episode, err = database.GetEpisode(ctx, "a", "2")
+	require.NoError(t, err)
+	assert.Equal(t, model.EpisodeDownloaded, episode.Status)
+	assert.Equal(t, "opus", episode.Extension)
+	assert.Equal(t, "2.opus", feed.EpisodeName(feedConfig, episode))
+}
+
+// failingProcessor copies the input file as is, transcoding with the failing profile returns an error
+type failingProcessor struct {
+	failing *feed.TranscodeProfile
+}
+
+func (p *failingProcessor) Transcode(_ context.Context, profile *feed.TranscodeProfile, input string) (io.ReadCloser, error) {
+	if profile == p.failing {
+		return nil, errors.New("transcoding failed")
+	}
+	return os.Open(input)
+}
+
+func (p *failingProcessor) WriteTags(_ context.Context, input string, _ media.Tags) (io.ReadCloser, error) {
+	return os.Open(input)
+}
+
+func (p *failingProcessor) ConvertArtwork(_ context.Context, url string, _ int) (io.ReadCloser, error) {
+	return io.NopCloser(strings.NewReader(url)), nil
+}
+
+func TestDownloadDeletesRenditionsOnFailure(t *testing.T) {
+	ctx := context.Background()
+
+	database, err := db.NewBadger(&db.Config{Dir: t.TempDir()})
+	require.NoError(t, err)
+	defer database.Close()
+
+	rootDir := t.TempDir()
+	storage, err := fs.NewLocal(rootDir, false, false)
+	require.NoError(t, err)
+
+	err = database.AddFeed(ctx, "a", &model.Feed{ID: "a", Episodes: []*model.Episode{
+		{ID: "1", Title: "Episode", Status: model.EpisodeNew},
+	}})
+	require.NoError(t, err)
+
+	broken := &feed.TranscodeProfile{AudioCodec: "opus"}
+	feedConfig := &feed.Config{
+		ID:       "a",
+		Format:   model.FormatAudio,
+		PageSize: 10,
+		Renditions: []*feed.Rendition{
+			{Name: "low", TranscodeProfile: &feed.TranscodeProfile{AudioCodec: "mp3"}},
+			{Name: "broken", TranscodeProfile: broken},
+		},
+	}
+
+	manager := &Manager{
+		downloader: &fileDownloader{dir: t.TempDir()},
+		processor:  &failingProcessor{failing: broken},
+		db:         database,
+		fs:         storage,
+		events:     events.NewBus(),
+	}
+
+	episodes, err := manager.fetchEpisodes(ctx, feedConfig)
+	require.NoError(t, err)
+	require.NoError(t, manager.downloadEpisodes(ctx, feedConfig, episodes))
+
+	_, err = os.Stat(filepath.Join(rootDir, "a-low", "1.mp3"))
+	assert.True(t, os.IsNotExist(err))
+
+	episode, err := database.GetEpisode(ctx, "a", "1")
+	require.NoError(t, err)
+	assert.Equal(t, model.EpisodeError, episode.Status)
+}
+
+func TestHostCoverArtDeletesPrevious(t *testing.T) {
+	ctx := context.Background()
+
+	database, err := db.NewBadger(&db.Config{Dir: t.TempDir()})
+	require.NoError(t, err)
+	defer database.Close()
+
+	rootDir := t.TempDir()
+	storage, err := fs.NewLocal(rootDir, false, false)
+	require.NoError(t, err)
+
+	feedConfig := &feed.Config{ID: "a", Artwork: feed.Artwork{Enabled: true}}
+	manager := &Manager{processor: &failingProcessor{}, db: database, fs: storage}
+
+	previous := manager.hostCoverArt(ctx, feedConfig, &model.Feed{CoverArt: "http://localhost/old.jpg"})
+	require.NotEmpty(t, previous)
+	require.NoError(t, database.AddFeed(ctx, "a", &model.Feed{ID: "a", Artwork: previous}))
+
+	current := manager.hostCoverArt(ctx, feedConfig, &model.Feed{CoverArt: "http://localhost/new.jpg"})
+	require.NotEmpty(t, current)
+	assert.NotEqual(t, previous, current)
+
+	_, err = os.Stat(filepath.Join(rootDir, previous))
+	assert.True(t, os.IsNotExist(err))
+	_, err = os.Stat(filepath.Join(rootDir, current))
+	assert.NoError(t, err)
+}
+
+func TestRecordFailure(t *testing.T) {
+	ctx := context.Background()
+
+	database, err := db.NewBadger(&db.Config{Dir: t.TempDir()})
+	require.NoError(t, err)
+	defer database.Close()
+
+	err = database.AddFeed(ctx, "a", &model.Feed{ID: "a", Title: "A", Episodes: []*model.Episode{{ID: "1"}}})
+	require.NoError(t, err)
+
+	manager := &Manager{db: database}
+	manager.recordFailure(ctx, "a")
+	manager.recordFailure(ctx, "a")
+	// Feed that never updated successfully
+	manager.recordFailure(ctx, "new")
+
+	info, err := database.GetFeed(ctx, "a")
+	require.NoError(t, err)
+	assert.Equal(t, 2, info.Failures)
+	assert.Equal(t, "A", info.Title)
+	assert.Len(t, info.Episodes, 1)
+
+	info, err = database.GetFeed(ctx, "new")
+	require.NoError(t, err)
+	assert.Equal(t, 1, info.Failures)
+
+	manager.resetFailures(ctx, "a")
+	info, err = database.GetFeed(ctx, "a")
+	require.NoError(t, err)
+	assert.Equal(t, 0, info.Failures)
+	assert.Len(t, info.Episodes, 1)
+}
+
+// brokenStorage fails to stat files, which fails the download step of updates
+type brokenStorage struct {
+	fs.Storage
+}
+
+func (s *brokenStorage) Size(_ context.Context, _ string) (int64, error) {
+	return 0, errors.New("storage is unavailable")
+}
+
+func TestFeedBrokenAfterFailedDownloads(t *testing.T) {
+	ctx := context.Background()
+
+	var (
+		lock     sync.Mutex
+		received []string
+	)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body struct {
+			Text string `json:"text"`
+		}
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(&body))
+		lock.Lock()
+		received = append(received, body.Text)
+		lock.Unlock()
+	}))
+	defer server.Close()
+
+	database, err := db.NewBadger(&db.Config{Dir: t.TempDir()})
+	require.NoError(t, err)
+	defer database.Close()
+
+	storage, err := fs.NewLocal(t.TempDir(), false, false)
+	require.NoError(t, err)
+
+	key, err := feed.NewFixedKey("key")
+	require.NoError(t, err)
+
+	const url = "https://youtube.com/channel/UCnews"
+	stub := &stubBuilder{feeds: map[string]*model.Feed{
+		url: {Title: "News", Episodes: []*model.Episode{{ID: "1", Status: model.EpisodeNew}}},
+	}}
+
+	bus := events.NewBus()
+	bus.Subscribe(notify.New(&notify.Config{
+		BrokenAfter: 3,
+		Channels:    []*notify.ChannelConfig{{Type: notify.ChannelWebhook, URL: server.URL}},
+	}, "https://podsync.example.com/", database))
+
+	manager := &Manager{
+		db:     database,
+		fs:     &brokenStorage{Storage: storage},
+		keys:   map[model.Provider]feed.KeyProvider{model.ProviderYoutube: key},
+		events: bus,
+		newBuilder: func(context.Context, model.Provider, string, builder.Downloader) (builder.Builder, error) {
+			return stub, nil
+		},
+	}
+
+	feedConfig := &feed.Config{ID: "news", URL: url, Format: model.FormatAudio, PageSize: 10}
+	for i := 0; i < 3; i++ {
+		require.Error(t, manager.Update(ctx, feedConfig))
+	}
+
+	info, err := database.GetFeed(ctx, "news")
+	require.NoError(t, err)
+	assert.Equal(t, 3, info.Failures)
+
+	bus.Close(ctx)
+	require.Len(t, received, 1)
+	assert.Contains(t, received[0], "failed to update 3 times in a row")
+}
@@ -0,0 +1,320 @@
+package web
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/mxpv/podsync/pkg/feed"
+	"github.com/mxpv/podsync/pkg/model"
+)
+
+const (
+	tokenSecretSize = 16
+	tokenIDSize     = 4
+)
+
+var tokenSecretPattern = regexp.MustCompile(`^[0-9a-f]{32}$`)
+
+// Auth configures access control for feeds and episodes served by the web server.
+// When enabled, every file requires either valid basic auth credentials or a token URL.
+type Auth struct {
+	// Users is a map of user names to passwords accepted via HTTP basic auth.
+	// These users can also manage tokens via /api/tokens.
+	Users map[string]string `toml:"users"`
+	// Tokens enables per-user secret URLs: /<token>/<feed>.xml
+	Tokens bool `toml:"tokens"`
+}
+
+// Enabled returns true if the server requires authentication.
+func (a Auth) Enabled() bool {
+	return len(a.Users) > 0 || a.Tokens
+}
+
+// NewToken generates a new access token.
+// Returns the secret to hand out to the user, only its hash is kept in the token.
+func NewToken(name string) (string, *model.Token, error) {
+	secret, err := randomHex(tokenSecretSize)
+	if err != nil {
+		return "", nil, errors.Wrap(err, "failed to generate token secret")
+	}
+
+	id, err := randomHex(tokenIDSize)
+	if err != nil {
+		return "", nil, errors.Wrap(err, "failed to generate token id")
+	}
+
+	token := &model.Token{
+		ID:        id,
+		Name:      name,
+		Hash:      hashSecret(secret),
+		CreatedAt: time.Now().UTC(),
+	}
+
+	return secret, token, nil
+}
+
+func randomHex(size int) (string, error) {
+	buf := make([]byte, size)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(buf), nil
+}
+
+func hashSecret(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])
+}
+
+// authMiddleware lets requests through if they carry valid basic auth credentials or a token prefix
+func (s *Server) authMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if s.auth.Tokens {
+			if secret, rest, ok := splitTokenPath(strings.TrimPrefix(r.URL.Path, s.prefix)); ok {
+				token, err := s.db.GetToken(r.Context(), hashSecret(secret))
+				if err == nil {
+					s.serveWithToken(w, r, next, secret, token, rest)
+					return
+				}
+
+				if !errors.Is(err, model.ErrNotFound) {
+					log.WithError(err).Error("failed to query token")
+					http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+					return
+				}
+			}
+		}
+
+		if s.checkBasicAuth(r) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		unauthorized(w)
+	})
+}
+
+// requireBasicAuth restricts a handler to users configured for basic auth
+func (s *Server) requireBasicAuth(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !s.checkBasicAuth(r) {
+			unauthorized(w)
+			return
+		}
+
+		next(w, r)
+	}
+}
+
+// protect requires basic auth for a handler when authentication is enabled
+func (s *Server) protect(next http.HandlerFunc) http.HandlerFunc {
+	if !s.auth.Enabled() {
+		return next
+	}
+
+	return s.requireBasicAuth(next)
+}
+
+func (s *Server) checkBasicAuth(r *http.Request) bool {
+	user, password, ok := r.BasicAuth()
+	if !ok {
+		return false
+	}
+
+	expected, ok := s.auth.Users[user]
+	if !ok || expected == "" {
+		return false
+	}
+
+	return subtle.ConstantTimeCompare([]byte(password), []byte(expected)) == 1
+}
+
+func unauthorized(w http.ResponseWriter) {
+	w.Header().Set("WWW-Authenticate", `Basic realm="podsync", charset="UTF-8"`)
+	http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+}
+
+// splitTokenPath splits "/<token>/<rest>" into the token secret and the remaining path
+func splitTokenPath(path string) (string, string, bool) {
+	path = strings.TrimPrefix(path, "/")
+
+	secret, rest, ok := strings.Cut(path, "/")
+	if !ok || !tokenSecretPattern.MatchString(secret) {
+		return "", "", false
+	}
+
+	return secret, rest, true
+}
+
+// serveWithToken serves XML feeds with enclosure URLs carrying the token, other files are served as is
+func (s *Server) serveWithToken(w http.ResponseWriter, r *http.Request, next http.Handler, secret string, token *model.Token, path string) {
+	logger := log.WithFields(log.Fields{
+		"token_id":    token.ID,
+		"token_name":  token.Name,
+		"path":        path,
+		"remote_addr": r.RemoteAddr,
+	})
+
+	logger.Info("token access")
+
+	if feedID, ok := strings.CutSuffix(path, ".xml"); ok {
+		if cfg, ok := s.feeds[feedID]; ok {
+			if s.serveTokenXML(w, r, cfg, secret, logger) {
+				s.recordAccess(r, cfg.ID, "")
+			}
+
+			token.LastUsedAt = time.Now().UTC()
+			if err := s.db.AddToken(r.Context(), token); err != nil {
+				logger.WithError(err).Warn("failed to update token usage")
+			}
+			return
+		}
+	}
+
+	// Strip the token and let the file server handle the rest
+	req := r.Clone(r.Context())
+	req.URL.Path = s.prefix + "/" + path
+	req.URL.RawPath = ""
+	next.ServeHTTP(w, req)
+}
+
+// serveTokenXML writes the feed XML, returns false if the feed could not be served
+func (s *Server) serveTokenXML(w http.ResponseWriter, r *http.Request, cfg *feed.Config, secret string, logger log.FieldLogger) bool {
+	info, err := s.db.GetFeed(r.Context(), cfg.SourceID())
+	if errors.Is(err, model.ErrNotFound) {
+		http.NotFound(w, r)
+		return false
+	} else if err != nil {
+		logger.WithError(err).Error("failed to query feed")
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return false
+	}
+
+	hostname := strings.TrimRight(s.hostname, "/") + "/" + secret
+	podcast, err := feed.Build(r.Context(), info, cfg, hostname)
+	if err != nil {
+		logger.WithError(err).Error("failed to build feed")
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return false
+	}
+
+	w.Header().Set("Content-Type", "text/xml; charset=utf-8")
+	http.ServeContent(w, r, cfg.ID+".xml", time.Time{}, bytes.NewReader([]byte(podcast.String())))
+	return true
+}
+
+type tokenResponse struct {
+	ID         string     `json:"id"`
+	Name       string     `json:"name"`
+	Token      string     `json:"token,omitempty"`
+	CreatedAt  time.Time  `json:"created_at"`
+	LastUsedAt *time.Time `json:"last_used_at,omitempty"`
+}
+
+func newTokenResponse(token *model.Token) tokenResponse {
+	resp := tokenResponse{
+		ID:        token.ID,
+		Name:      token.Name,
+		CreatedAt: token.CreatedAt,
+	}
+
+	if !token.LastUsedAt.IsZero() {
+		resp.LastUsedAt = &token.LastUsedAt
+	}
+
+	return resp
+}
+
+func (s *Server) listTokensHandler(w http.ResponseWriter, r *http.Request) {
+	list := []tokenResponse{}
+	if err := s.db.WalkTokens(r.Context(), func(token *model.Token) error {
+		list = append(list, newTokenResponse(token))
+		return nil
+	}); err != nil {
+		log.WithError(err).Error("failed to list tokens")
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, list)
+}
+
+func (s *Server) createTokenHandler(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Name string `json:"name"`
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || strings.TrimSpace(req.Name) == "" {
+		http.Error(w, "token name is required", http.StatusBadRequest)
+		return
+	}
+
+	secret, token, err := NewToken(strings.TrimSpace(req.Name))
+	if err != nil {
+		log.WithError(err).Error("failed to create token")
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+
+	if err := s.db.AddToken(r.Context(), token); err != nil {
+		log.WithError(err).Error("failed to save token")
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+
+	log.WithFields(log.Fields{"token_id": token.ID, "token_name": token.Name}).Info("token created")
+
+	resp := newTokenResponse(token)
+	resp.Token = secret
+	writeJSON(w, http.StatusCreated, resp)
+}
+
+func (s *Server) revokeTokenHandler(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+
+	var found *model.Token
+	if err := s.db.WalkTokens(r.Context(), func(token *model.Token) error {
+		if token.ID == id {
+			found = token
+		}
+		return nil
+	}); err != nil {
+		log.WithError(err).Error("failed to list tokens")
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+
+	if found == nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	if err := s.db.DeleteToken(r.Context(), found.Hash); err != nil {
+		log.WithError(err).Error("failed to delete token")
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+
+	log.WithFields(log.Fields{"token_id": found.ID, "token_name": found.Name}).Info("token revoked")
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		log.WithError(err).Error("failed to write response")
+	}
+}
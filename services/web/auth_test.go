@@ -0,0 +1,136 @@
+package web
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/mxpv/podsync/pkg/db"
+	"github.com/mxpv/podsync/pkg/feed"
+	"github.com/mxpv/podsync/pkg/fs"
+	"github.com/mxpv/podsync/pkg/model"
+)
+
+func newAuthServer(t *testing.T) (*Server, db.Storage) {
+	t.Helper()
+
+	storage, err := fs.NewLocal(t.TempDir(), false, false)
+	require.NoError(t, err)
+
+	_, err = storage.Create(context.Background(), "news/1.mp4", bytes.NewReader([]byte("video")))
+	require.NoError(t, err)
+
+	database, err := db.NewBadger(&db.Config{Dir: t.TempDir()})
+	require.NoError(t, err)
+	t.Cleanup(func() { database.Close() })
+
+	err = database.AddFeed(context.Background(), "news", &model.Feed{
+		ID:    "news",
+		Title: "News",
+		Episodes: []*model.Episode{
+			{ID: "1", Title: "First", Description: "description", Status: model.EpisodeDownloaded, Size: 5},
+		},
+	})
+	require.NoError(t, err)
+
+	cfg := Config{
+		Hostname: "http://localhost:8080",
+		Auth: Auth{
+			Users:  map[string]string{"admin": "secret"},
+			Tokens: true,
+		},
+	}
+
+	feeds := map[string]*feed.Config{
+		"news": {ID: "news", Format: model.FormatVideo},
+	}
+
+	return New(cfg, storage, database, feeds), database
+}
+
+func TestBasicAuth(t *testing.T) {
+	srv, _ := newAuthServer(t)
+
+	req := httptest.NewRequest(http.MethodGet, "/news/1.mp4", nil)
+	rec := httptest.NewRecorder()
+	srv.Handler.ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusUnauthorized, rec.Code)
+	assert.Contains(t, rec.Header().Get("WWW-Authenticate"), "Basic")
+
+	req = httptest.NewRequest(http.MethodGet, "/news/1.mp4", nil)
+	req.SetBasicAuth("admin", "wrong")
+	rec = httptest.NewRecorder()
+	srv.Handler.ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusUnauthorized, rec.Code)
+
+	req = httptest.NewRequest(http.MethodGet, "/news/1.mp4", nil)
+	req.SetBasicAuth("admin", "secret")
+	rec = httptest.NewRecorder()
+	srv.Handler.ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "video", rec.Body.String())
+
+	// Health check stays public
+	req = httptest.NewRequest(http.MethodGet, "/health", nil)
+	rec = httptest.NewRecorder()
+	srv.Handler.ServeHTTP(rec, req)
+	assert.NotEqual(t, http.StatusUnauthorized, rec.Code)
+}
+
+func TestTokenAccess(t *testing.T) {
+	srv, database := newAuthServer(t)
+
+	// Create a token via API
+	req := httptest.NewRequest(http.MethodPost, "/api/tokens", strings.NewReader(`{"name": "alice"}`))
+	rec := httptest.NewRecorder()
+	srv.Handler.ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusUnauthorized, rec.Code)
+
+	req = httptest.NewRequest(http.MethodPost, "/api/tokens", strings.NewReader(`{"name": "alice"}`))
+	req.SetBasicAuth("admin", "secret")
+	rec = httptest.NewRecorder()
+	srv.Handler.ServeHTTP(rec, req)
+	require.Equal(t, http.StatusCreated, rec.Code)
+
+	var created tokenResponse
+	require.NoError(t, json.NewDecoder(rec.Body).Decode(&created))
+	assert.Equal(t, "alice", created.Name)
+	require.NotEmpty(t, created.Token)
+
+	// XML is generated with tokenized enclosure URLs
+	req = httptest.NewRequest(http.MethodGet, "/"+created.Token+"/news.xml", nil)
+	rec = httptest.NewRecorder()
+	srv.Handler.ServeHTTP(rec, req)
+	require.Equal(t, http.StatusOK, rec.Code)
+	assert.Contains(t, rec.Body.String(), "http://localhost:8080/"+created.Token+"/news/1.mp4")
+
+	// Media files are served with the token
+	req = httptest.NewRequest(http.MethodGet, "/"+created.Token+"/news/1.mp4", nil)
+	rec = httptest.NewRecorder()
+	srv.Handler.ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "video", rec.Body.String())
+
+	token, err := database.GetToken(context.Background(), hashSecret(created.Token))
+	require.NoError(t, err)
+	assert.False(t, token.LastUsedAt.IsZero())
+
+	// Revoke
+	req = httptest.NewRequest(http.MethodDelete, "/api/tokens/"+created.ID, nil)
+	req.SetBasicAuth("admin", "secret")
+	rec = httptest.NewRecorder()
+	srv.Handler.ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusNoContent, rec.Code)
+
+	req = httptest.NewRequest(http.MethodGet, "/"+created.Token+"/news.xml", nil)
+	rec = httptest.NewRecorder()
+	srv.Handler.ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusUnauthorized, rec.Code)
+}
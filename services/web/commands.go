@@ -0,0 +1,55 @@
+package web
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// CommandRunner runs a podsync command line (e.g. ["list", "feeds"]) and writes its output to out
+type CommandRunner func(ctx context.Context, args []string, out io.Writer) error
+
+// CommandRequest asks a running server to run a command against its database
+type CommandRequest struct {
+	Args []string `json:"args"`
+}
+
+// CommandResponse holds the output of a command and the error it failed with, if any
+type CommandResponse struct {
+	Output string `json:"output"`
+	Error  string `json:"error,omitempty"`
+}
+
+// HandleCommands lets basic auth users run commands against the database of the running server,
+// which can't be opened by another process while the server is running.
+func (s *Server) HandleCommands(run CommandRunner) {
+	if len(s.auth.Users) == 0 {
+		log.Debug("commands API is disabled, it requires basic auth users")
+		return
+	}
+
+	s.mux.HandleFunc("POST /api/commands", s.requireBasicAuth(func(w http.ResponseWriter, r *http.Request) {
+		var req CommandRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil || len(req.Args) == 0 {
+			http.Error(w, "command arguments are required", http.StatusBadRequest)
+			return
+		}
+
+		log.WithField("args", req.Args).Info("running command")
+
+		var (
+			out  bytes.Buffer
+			resp CommandResponse
+		)
+		if err := run(r.Context(), req.Args, &out); err != nil {
+			resp.Error = err.Error()
+		}
+		resp.Output = out.String()
+
+		writeJSON(w, http.StatusOK, resp)
+	}))
+}
@@ -0,0 +1,63 @@
+package web
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHandleCommands(t *testing.T) {
+	run := func(_ context.Context, args []string, out io.Writer) error {
+		fmt.Fprintf(out, "ran %s\n", strings.Join(args, " "))
+		if args[0] == "fail" {
+			return errors.New("command failed")
+		}
+		return nil
+	}
+
+	post := func(srv *Server, user, password string, args ...string) *httptest.ResponseRecorder {
+		body, err := json.Marshal(CommandRequest{Args: args})
+		require.NoError(t, err)
+
+		req := httptest.NewRequest(http.MethodPost, "/api/commands", bytes.NewReader(body))
+		if user != "" {
+			req.SetBasicAuth(user, password)
+		}
+		rec := httptest.NewRecorder()
+		srv.Handler.ServeHTTP(rec, req)
+		return rec
+	}
+
+	srv := New(Config{Auth: Auth{Users: map[string]string{"admin": "secret"}}}, http.Dir(t.TempDir()), nil, nil)
+	srv.HandleCommands(run)
+
+	assert.Equal(t, http.StatusUnauthorized, post(srv, "", "", "list", "feeds").Code)
+	assert.Equal(t, http.StatusUnauthorized, post(srv, "admin", "wrong", "list", "feeds").Code)
+	assert.Equal(t, http.StatusBadRequest, post(srv, "admin", "secret").Code)
+
+	rec := post(srv, "admin", "secret", "list", "feeds")
+	require.Equal(t, http.StatusOK, rec.Code)
+	var resp CommandResponse
+	require.NoError(t, json.NewDecoder(rec.Body).Decode(&resp))
+	assert.Equal(t, CommandResponse{Output: "ran list feeds\n"}, resp)
+
+	rec = post(srv, "admin", "secret", "fail")
+	require.Equal(t, http.StatusOK, rec.Code)
+	require.NoError(t, json.NewDecoder(rec.Body).Decode(&resp))
+	assert.Equal(t, CommandResponse{Output: "ran fail\n", Error: "command failed"}, resp)
+
+	// Commands are never available without users to authenticate
+	srv = New(Config{Auth: Auth{Tokens: true}}, http.Dir(t.TempDir()), nil, nil)
+	srv.HandleCommands(run)
+	assert.NotEqual(t, http.StatusOK, post(srv, "admin", "secret", "list", "feeds").Code)
+}
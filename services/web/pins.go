@@ -0,0 +1,93 @@
+package web
+
+import (
+	"net/http"
+	"sort"
+
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/mxpv/podsync/pkg/model"
+)
+
+// PinnedEpisode is an episode protected from cleanup
+type PinnedEpisode struct {
+	FeedID    string `json:"feed_id"`
+	EpisodeID string `json:"episode_id"`
+	Title     string `json:"title"`
+	// Config is true if the episode is pinned by the feed configuration and can't be unpinned via API
+	Config bool `json:"config,omitempty"`
+}
+
+func (s *Server) listPinsHandler(w http.ResponseWriter, r *http.Request) {
+	list := []PinnedEpisode{}
+	for feedID, cfg := range s.feeds {
+		if cfg.Rendition != "" {
+			// Renditions share episodes with the main feed
+			continue
+		}
+
+		if err := s.db.WalkEpisodes(r.Context(), feedID, func(episode *model.Episode) error {
+			if cfg.IsPinned(episode) {
+				list = append(list, PinnedEpisode{
+					FeedID:    feedID,
+					EpisodeID: episode.ID,
+					Title:     episode.Title,
+					Config:    !episode.Pinned,
+				})
+			}
+			return nil
+		}); err != nil {
+			log.WithError(err).Error("failed to query episodes")
+			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+			return
+		}
+	}
+
+	sort.Slice(list, func(i, j int) bool {
+		if list[i].FeedID != list[j].FeedID {
+			return list[i].FeedID < list[j].FeedID
+		}
+		return list[i].EpisodeID < list[j].EpisodeID
+	})
+
+	writeJSON(w, http.StatusOK, list)
+}
+
+func (s *Server) pinHandler(w http.ResponseWriter, r *http.Request) {
+	s.setPinned(w, r, true)
+}
+
+func (s *Server) unpinHandler(w http.ResponseWriter, r *http.Request) {
+	s.setPinned(w, r, false)
+}
+
+func (s *Server) setPinned(w http.ResponseWriter, r *http.Request, pinned bool) {
+	cfg, ok := s.feeds[r.PathValue("feed")]
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+
+	var (
+		feedID    = cfg.SourceID()
+		episodeID = r.PathValue("episode")
+	)
+
+	err := s.db.UpdateEpisode(feedID, episodeID, func(episode *model.Episode) error {
+		episode.Pinned = pinned
+		return nil
+	})
+
+	if errors.Is(err, model.ErrNotFound) {
+		http.NotFound(w, r)
+		return
+	} else if err != nil {
+		log.WithError(err).Error("failed to update episode")
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+
+	log.WithFields(log.Fields{"feed_id": feedID, "episode_id": episodeID, "pinned": pinned}).Info("episode pin updated")
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,76 @@
+package web
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/mxpv/podsync/pkg/db"
+	"github.com/mxpv/podsync/pkg/feed"
+	"github.com/mxpv/podsync/pkg/model"
+)
+
+func TestPins(t *testing.T) {
+	database, err := db.NewBadger(&db.Config{Dir: t.TempDir()})
+	require.NoError(t, err)
+	defer database.Close()
+
+	err = database.AddFeed(context.Background(), "news", &model.Feed{ID: "news", Episodes: []*model.Episode{
+		{ID: "1", Title: "First"},
+		{ID: "2", Title: "Lecture"},
+	}})
+	require.NoError(t, err)
+
+	feeds := map[string]*feed.Config{
+		"news": {ID: "news", Pin: feed.Pins{Titles: []string{"^Lecture"}}},
+	}
+
+	// Pin API is open when authentication is disabled
+	srv := New(Config{}, &mockFileSystem{}, database, feeds)
+	rec := httptest.NewRecorder()
+	srv.Handler.ServeHTTP(rec, httptest.NewRequest(http.MethodPut, "/api/feeds/news/episodes/1/pin", nil))
+	assert.Equal(t, http.StatusNoContent, rec.Code)
+
+	rec = httptest.NewRecorder()
+	srv.Handler.ServeHTTP(rec, httptest.NewRequest(http.MethodDelete, "/api/feeds/news/episodes/1/pin", nil))
+	assert.Equal(t, http.StatusNoContent, rec.Code)
+
+	srv = New(Config{Auth: Auth{Users: map[string]string{"admin": "secret"}}}, &mockFileSystem{}, database, feeds)
+
+	// Otherwise it requires basic auth
+	rec = httptest.NewRecorder()
+	srv.Handler.ServeHTTP(rec, httptest.NewRequest(http.MethodPut, "/api/feeds/news/episodes/1/pin", nil))
+	assert.Equal(t, http.StatusUnauthorized, rec.Code)
+
+	do := func(method string, path string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, nil)
+		req.SetBasicAuth("admin", "secret")
+		rec := httptest.NewRecorder()
+		srv.Handler.ServeHTTP(rec, req)
+		return rec
+	}
+
+	assert.Equal(t, http.StatusNoContent, do(http.MethodPut, "/api/feeds/news/episodes/1/pin").Code)
+	assert.Equal(t, http.StatusNotFound, do(http.MethodPut, "/api/feeds/news/episodes/missing/pin").Code)
+	assert.Equal(t, http.StatusNotFound, do(http.MethodPut, "/api/feeds/missing/episodes/1/pin").Code)
+
+	var pins []PinnedEpisode
+	rec = do(http.MethodGet, "/api/pins")
+	require.Equal(t, http.StatusOK, rec.Code)
+	require.NoError(t, json.NewDecoder(rec.Body).Decode(&pins))
+	assert.Equal(t, []PinnedEpisode{
+		{FeedID: "news", EpisodeID: "1", Title: "First"},
+		{FeedID: "news", EpisodeID: "2", Title: "Lecture", Config: true},
+	}, pins)
+
+	assert.Equal(t, http.StatusNoContent, do(http.MethodDelete, "/api/feeds/news/episodes/1/pin").Code)
+
+	episode, err := database.GetEpisode(context.Background(), "news", "1")
+	require.NoError(t, err)
+	assert.False(t, episode.Pinned)
+}
@@ -4,18 +4,27 @@ import (
 	"encoding/json"
 	"expvar"
 	"fmt"
+	"net"
 	"net/http"
 	"time"
 
 	log "github.com/sirupsen/logrus"
 
 	"github.com/mxpv/podsync/pkg/db"
+	"github.com/mxpv/podsync/pkg/feed"
 	"github.com/mxpv/podsync/pkg/model"
 )
 
 type Server struct {
 	http.Server
-	db db.Storage
+	db       db.Storage
+	auth     Auth
+	stats    bool
+	hostname string
+	prefix   string
+	proxies  []*net.IPNet            // Proxies trusted to set X-Forwarded-For
+	feeds    map[string]*feed.Config // Feed configs by XML name, renditions included
+	mux      *http.ServeMux
 }
 
 type Config struct {
@@ -46,9 +55,16 @@ type Config struct {
 	NoIndex bool `toml:"no_index"`
 	// NoListing returns 404 for directory listings, only serving actual files (disabled by default)
 	NoListing bool `toml:"no_listing"`
+	// Auth enables basic auth and/or per-user token URLs (disabled by default)
+	Auth Auth `toml:"auth"`
+	// Stats enables recording of feed and episode downloads into the database (disabled by default)
+	Stats bool `toml:"stats"`
+	// TrustedProxies is a list of reverse proxy addresses or CIDR ranges allowed to set X-Forwarded-For.
+	// Client addresses are taken from the connection when empty.
+	TrustedProxies []string `toml:"trusted_proxies"`
 }
 
-func New(cfg Config, storage http.FileSystem, database db.Storage) *Server {
+func New(cfg Config, storage http.FileSystem, database db.Storage, feeds map[string]*feed.Config) *Server {
 	port := cfg.Port
 	if port == 0 {
 		port = 8080
@@ -60,7 +76,29 @@ func New(cfg Config, storage http.FileSystem, database db.Storage) *Server {
 	}
 
 	srv := Server{
-		db: database,
+		db:       database,
+		auth:     cfg.Auth,
+		stats:    cfg.Stats,
+		hostname: cfg.Hostname,
+		feeds:    make(map[string]*feed.Config),
+	}
+
+	if cfg.Path != "" {
+		srv.prefix = "/" + cfg.Path
+	}
+
+	// The list is checked when loading the configuration
+	proxies, err := ParseTrustedProxies(cfg.TrustedProxies)
+	if err != nil {
+		log.WithError(err).Warn("ignoring invalid trusted proxies")
+	}
+	srv.proxies = proxies
+
+	for _, feedConfig := range feeds {
+		srv.feeds[feedConfig.ID] = feedConfig
+		for _, renditionConfig := range feedConfig.RenditionConfigs() {
+			srv.feeds[renditionConfig.ID] = renditionConfig
+		}
 	}
 
 	srv.Addr = fmt.Sprintf("%s:%d", bindAddress, port)
@@ -69,12 +107,38 @@ func New(cfg Config, storage http.FileSystem, database db.Storage) *Server {
 	// Use a custom mux instead of http.DefaultServeMux to avoid exposing
 	// debug endpoints registered by imported packages (security fix for #799)
 	mux := http.NewServeMux()
+	srv.mux = mux
 
-	fileServer := http.FileServer(storage)
+	var fileServer http.Handler = http.FileServer(storage)
+	if cfg.Stats {
+		log.Info("download stats enabled")
+		fileServer = srv.statsMiddleware(fileServer)
+	}
+	if cfg.Auth.Enabled() {
+		log.Info("authentication enabled")
+		fileServer = srv.authMiddleware(fileServer)
+	}
 
 	log.Debugf("handle path: /%s", cfg.Path)
 	mux.Handle(fmt.Sprintf("/%s", cfg.Path), fileServer)
 
+	// Token management is available to basic auth users only
+	if cfg.Auth.Tokens && len(cfg.Auth.Users) > 0 {
+		mux.HandleFunc("GET /api/tokens", srv.requireBasicAuth(srv.listTokensHandler))
+		mux.HandleFunc("POST /api/tokens", srv.requireBasicAuth(srv.createTokenHandler))
+		mux.HandleFunc("DELETE /api/tokens/{id}", srv.requireBasicAuth(srv.revokeTokenHandler))
+	}
+
+	// Pins change what cleanup removes, so they require basic auth if [server.auth] is enabled
+	mux.HandleFunc("GET /api/pins", srv.protect(srv.listPinsHandler))
+	mux.HandleFunc("PUT /api/feeds/{feed}/episodes/{episode}/pin", srv.protect(srv.pinHandler))
+	mux.HandleFunc("DELETE /api/feeds/{feed}/episodes/{episode}/pin", srv.protect(srv.unpinHandler))
+
+	if cfg.Stats {
+		mux.HandleFunc("GET /api/stats", srv.protect(srv.feedStatsHandler))
+		mux.HandleFunc("GET /api/stats/{feed}", srv.protect(srv.episodeStatsHandler))
+	}
+
 	// Add health check endpoint
 	mux.HandleFunc("/health", srv.healthCheckHandler)
 
@@ -105,18 +169,9 @@ func (s *Server) healthCheckHandler(w http.ResponseWriter, r *http.Request) {
 	ctx := r.Context()
 
 	// Check for recent download failures within the last 24 hours
-	failedCount := 0
 	cutoffTime := time.Now().Add(-24 * time.Hour)
 
-	// Walk through all feeds to count recent failures
-	err := s.db.WalkFeeds(ctx, func(feed *model.Feed) error {
-		return s.db.WalkEpisodes(ctx, feed.ID, func(episode *model.Episode) error {
-			if episode.Status == model.EpisodeError && episode.PubDate.After(cutoffTime) {
-				failedCount++
-			}
-			return nil
-		})
-	})
+	failedCount, err := s.db.CountEpisodes(ctx, model.EpisodeError, cutoffTime)
 
 	w.Header().Set("Content-Type", "application/json")
 
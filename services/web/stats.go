@@ -0,0 +1,341 @@
+package web
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"net"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/mxpv/podsync/pkg/feed"
+	"github.com/mxpv/podsync/pkg/model"
+)
+
+const defaultStatsDays = 30
+
+// FeedStats summarizes access records of a feed
+type FeedStats struct {
+	FeedID string `json:"feed_id"`
+	// Fetches is the number of XML requests
+	Fetches int `json:"fetches"`
+	// Subscribers is the number of unique clients fetching the XML feed
+	Subscribers int `json:"subscribers"`
+	// Listens is the number of unique client/episode/day combinations
+	Listens int `json:"listens"`
+	// Listeners is the number of unique clients downloading episodes
+	Listeners  int        `json:"listeners"`
+	LastAccess *time.Time `json:"last_access,omitempty"`
+}
+
+// EpisodeStats summarizes downloads of an episode file
+type EpisodeStats struct {
+	File       string     `json:"file"`
+	EpisodeID  string     `json:"episode_id,omitempty"`
+	Title      string     `json:"title,omitempty"`
+	Listens    int        `json:"listens"`
+	Listeners  int        `json:"listeners"`
+	Requests   int        `json:"requests"`
+	LastAccess *time.Time `json:"last_access,omitempty"`
+}
+
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (r *statusRecorder) WriteHeader(status int) {
+	r.status = status
+	r.ResponseWriter.WriteHeader(status)
+}
+
+// statsMiddleware records successful feed and episode downloads
+func (s *Server) statsMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		rec := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(rec, r)
+
+		if rec.status != http.StatusOK && rec.status != http.StatusPartialContent {
+			return
+		}
+
+		if feedID, file, ok := s.parseStatsPath(strings.TrimPrefix(r.URL.Path, s.prefix)); ok {
+			s.recordAccess(r, feedID, file)
+		}
+	})
+}
+
+// parseStatsPath extracts feed ID and episode file name from "/<feed>.xml" and "/<feed>/<file>" paths
+func (s *Server) parseStatsPath(path string) (string, string, bool) {
+	path = strings.TrimPrefix(path, "/")
+
+	if feedID, ok := strings.CutSuffix(path, ".xml"); ok && !strings.Contains(feedID, "/") {
+		_, known := s.feeds[feedID]
+		return feedID, "", known
+	}
+
+	feedID, file, ok := strings.Cut(path, "/")
+	if !ok || file == "" || strings.Contains(file, "/") {
+		// Artwork and other nested files are not counted
+		return "", "", false
+	}
+
+	_, known := s.feeds[feedID]
+	return feedID, file, known
+}
+
+func (s *Server) recordAccess(r *http.Request, feedID string, file string) {
+	if !s.stats {
+		return
+	}
+
+	var (
+		now       = time.Now().UTC()
+		userAgent = r.UserAgent()
+	)
+
+	access := &model.Access{
+		FeedID:    feedID,
+		File:      file,
+		Day:       now.Format("2006-01-02"),
+		Client:    clientHash(s.clientIP(r), userAgent),
+		UserAgent: userAgent,
+		Requests:  1,
+		FirstSeen: now,
+		LastSeen:  now,
+	}
+
+	if err := s.db.RecordAccess(r.Context(), access); err != nil {
+		log.WithError(err).Warn("failed to record access")
+	}
+}
+
+// ParseTrustedProxies parses a list of IP addresses and CIDR ranges
+func ParseTrustedProxies(list []string) ([]*net.IPNet, error) {
+	proxies := make([]*net.IPNet, 0, len(list))
+	for _, value := range list {
+		if !strings.Contains(value, "/") {
+			ip := net.ParseIP(value)
+			if ip == nil {
+				return nil, errors.Errorf("invalid trusted proxy address %q", value)
+			}
+
+			bits := 8 * net.IPv6len
+			if ip.To4() != nil {
+				ip, bits = ip.To4(), 8*net.IPv4len
+			}
+
+			proxies = append(proxies, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+
+		_, network, err := net.ParseCIDR(value)
+		if err != nil {
+			return nil, errors.Wrapf(err, "invalid trusted proxy range %q", value)
+		}
+
+		proxies = append(proxies, network)
+	}
+
+	return proxies, nil
+}
+
+// clientIP returns the client address.
+// X-Forwarded-For is honored only for requests coming from trusted proxies,
+// the client is the last address in the chain not added by a trusted proxy.
+func (s *Server) clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+
+	if !s.isTrustedProxy(host) {
+		return host
+	}
+
+	hops := strings.Split(strings.Join(r.Header.Values("X-Forwarded-For"), ","), ",")
+	for i := len(hops) - 1; i >= 0; i-- {
+		hop := strings.TrimSpace(hops[i])
+		if hop == "" {
+			continue
+		}
+
+		host = hop
+		if !s.isTrustedProxy(hop) {
+			break
+		}
+	}
+
+	return host
+}
+
+func (s *Server) isTrustedProxy(addr string) bool {
+	ip := net.ParseIP(addr)
+	if ip == nil {
+		return false
+	}
+
+	for _, network := range s.proxies {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// clientHash identifies a client without storing its address.
+// Only the network part of the address is used (/24 for IPv4, /48 for IPv6).
+func clientHash(ip string, userAgent string) string {
+	network := ip
+	if parsed := net.ParseIP(ip); parsed != nil {
+		if v4 := parsed.To4(); v4 != nil {
+			network = v4.Mask(net.CIDRMask(24, 32)).String()
+		} else {
+			network = parsed.Mask(net.CIDRMask(48, 128)).String()
+		}
+	}
+
+	sum := sha256.Sum256([]byte(network + "|" + userAgent))
+	return hex.EncodeToString(sum[:8])
+}
+
+// statsCutoff returns the first day to include, based on the "days" query parameter
+func statsCutoff(r *http.Request) string {
+	days := defaultStatsDays
+	if value := r.URL.Query().Get("days"); value != "" {
+		if parsed, err := strconv.Atoi(value); err == nil && parsed > 0 {
+			days = parsed
+		}
+	}
+
+	return time.Now().UTC().AddDate(0, 0, -days+1).Format("2006-01-02")
+}
+
+func (s *Server) feedStatsHandler(w http.ResponseWriter, r *http.Request) {
+	cutoff := statsCutoff(r)
+
+	list := make([]*FeedStats, 0, len(s.feeds))
+	for feedID := range s.feeds {
+		var (
+			stats       = &FeedStats{FeedID: feedID}
+			subscribers = map[string]struct{}{}
+			listeners   = map[string]struct{}{}
+		)
+
+		if err := s.db.WalkAccess(r.Context(), feedID, func(access *model.Access) error {
+			if access.Day < cutoff {
+				return nil
+			}
+
+			if access.File == "" {
+				stats.Fetches += access.Requests
+				subscribers[access.Client] = struct{}{}
+			} else {
+				stats.Listens++
+				listeners[access.Client] = struct{}{}
+			}
+
+			if stats.LastAccess == nil || access.LastSeen.After(*stats.LastAccess) {
+				lastSeen := access.LastSeen
+				stats.LastAccess = &lastSeen
+			}
+
+			return nil
+		}); err != nil {
+			log.WithError(err).Error("failed to query access stats")
+			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+			return
+		}
+
+		stats.Subscribers = len(subscribers)
+		stats.Listeners = len(listeners)
+		list = append(list, stats)
+	}
+
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].FeedID < list[j].FeedID
+	})
+
+	writeJSON(w, http.StatusOK, list)
+}
+
+func (s *Server) episodeStatsHandler(w http.ResponseWriter, r *http.Request) {
+	cfg, ok := s.feeds[r.PathValue("feed")]
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+
+	var (
+		cutoff    = statsCutoff(r)
+		byFile    = map[string]*EpisodeStats{}
+		listeners = map[string]map[string]struct{}{}
+	)
+
+	if err := s.db.WalkAccess(r.Context(), cfg.ID, func(access *model.Access) error {
+		if access.File == "" || access.Day < cutoff {
+			return nil
+		}
+
+		stats, ok := byFile[access.File]
+		if !ok {
+			stats = &EpisodeStats{File: access.File}
+			byFile[access.File] = stats
+			listeners[access.File] = map[string]struct{}{}
+		}
+
+		stats.Listens++
+		stats.Requests += access.Requests
+		listeners[access.File][access.Client] = struct{}{}
+
+		if stats.LastAccess == nil || access.LastSeen.After(*stats.LastAccess) {
+			lastSeen := access.LastSeen
+			stats.LastAccess = &lastSeen
+		}
+
+		return nil
+	}); err != nil {
+		log.WithError(err).Error("failed to query access stats")
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+
+	// Map file names back to episodes
+	if err := s.db.WalkEpisodes(r.Context(), cfg.SourceID(), func(episode *model.Episode) error {
+		if stats, ok := byFile[feed.EpisodeName(cfg, episode)]; ok {
+			stats.EpisodeID = episode.ID
+			stats.Title = episode.Title
+		}
+		return nil
+	}); err != nil {
+		log.WithError(err).Error("failed to query episodes")
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+
+	list := make([]*EpisodeStats, 0, len(byFile))
+	for file, stats := range byFile {
+		stats.Listeners = len(listeners[file])
+		list = append(list, stats)
+	}
+
+	sort.Slice(list, func(i, j int) bool {
+		if list[i].Listens != list[j].Listens {
+			return list[i].Listens > list[j].Listens
+		}
+		return list[i].File < list[j].File
+	})
+
+	writeJSON(w, http.StatusOK, list)
+}
@@ -0,0 +1,134 @@
+package web
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/mxpv/podsync/pkg/db"
+	"github.com/mxpv/podsync/pkg/feed"
+	"github.com/mxpv/podsync/pkg/fs"
+	"github.com/mxpv/podsync/pkg/model"
+)
+
+func TestStats(t *testing.T) {
+	storage, err := fs.NewLocal(t.TempDir(), false, false)
+	require.NoError(t, err)
+
+	for _, name := range []string{"news.xml", "news/1.mp4", "news/artwork/1.jpg", "unused.xml"} {
+		_, err = storage.Create(context.Background(), name, bytes.NewReader([]byte("content")))
+		require.NoError(t, err)
+	}
+
+	database, err := db.NewBadger(&db.Config{Dir: t.TempDir()})
+	require.NoError(t, err)
+	defer database.Close()
+
+	err = database.AddFeed(context.Background(), "news", &model.Feed{
+		ID:       "news",
+		Episodes: []*model.Episode{{ID: "1", Title: "First", Status: model.EpisodeDownloaded}},
+	})
+	require.NoError(t, err)
+
+	feeds := map[string]*feed.Config{
+		"news":   {ID: "news", Format: model.FormatVideo},
+		"unused": {ID: "unused", Format: model.FormatVideo},
+	}
+
+	srv := New(Config{Stats: true}, storage, database, feeds)
+
+	get := func(path string, remoteAddr string, userAgent string, header map[string]string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		req.RemoteAddr = remoteAddr
+		req.Header.Set("User-Agent", userAgent)
+		for key, value := range header {
+			req.Header.Set(key, value)
+		}
+		rec := httptest.NewRecorder()
+		srv.Handler.ServeHTTP(rec, req)
+		return rec
+	}
+
+	get("/news.xml", "10.0.0.1:1234", "Overcast", nil)
+	get("/news.xml", "10.0.0.2:1234", "Overcast", nil) // Same /24 network and user agent
+	get("/news.xml", "10.0.0.3:1234", "AntennaPod", nil)
+
+	// Range requests of the same client are counted as a single listen
+	get("/news/1.mp4", "10.0.0.1:1234", "Overcast", map[string]string{"Range": "bytes=0-1"})
+	get("/news/1.mp4", "10.0.0.1:5678", "Overcast", map[string]string{"Range": "bytes=2-"})
+	get("/news/1.mp4", "192.168.0.1:1234", "AntennaPod", nil)
+
+	// Not counted
+	get("/news/artwork/1.jpg", "10.0.0.1:1234", "Overcast", nil)
+	get("/news/missing.mp4", "10.0.0.1:1234", "Overcast", nil)
+
+	rec := get("/api/stats", "10.0.0.1:1234", "curl", nil)
+	require.Equal(t, http.StatusOK, rec.Code)
+
+	var feedStats []FeedStats
+	require.NoError(t, json.NewDecoder(rec.Body).Decode(&feedStats))
+	require.Len(t, feedStats, 2)
+	assert.Equal(t, "news", feedStats[0].FeedID)
+	assert.Equal(t, 3, feedStats[0].Fetches)
+	assert.Equal(t, 2, feedStats[0].Subscribers)
+	assert.Equal(t, 2, feedStats[0].Listens)
+	assert.Equal(t, 2, feedStats[0].Listeners)
+	assert.NotNil(t, feedStats[0].LastAccess)
+
+	// Nobody uses this feed
+	assert.Equal(t, "unused", feedStats[1].FeedID)
+	assert.Zero(t, feedStats[1].Fetches)
+	assert.Nil(t, feedStats[1].LastAccess)
+
+	rec = get("/api/stats/news", "10.0.0.1:1234", "curl", nil)
+	require.Equal(t, http.StatusOK, rec.Code)
+
+	var episodeStats []EpisodeStats
+	require.NoError(t, json.NewDecoder(rec.Body).Decode(&episodeStats))
+	require.Len(t, episodeStats, 1)
+	assert.Equal(t, "1.mp4", episodeStats[0].File)
+	assert.Equal(t, "1", episodeStats[0].EpisodeID)
+	assert.Equal(t, "First", episodeStats[0].Title)
+	assert.Equal(t, 2, episodeStats[0].Listens)
+	assert.Equal(t, 3, episodeStats[0].Requests)
+}
+
+func TestClientHash(t *testing.T) {
+	assert.Equal(t, clientHash("10.0.0.1", "ua"), clientHash("10.0.0.200", "ua"))
+	assert.NotEqual(t, clientHash("10.0.0.1", "ua"), clientHash("10.0.1.1", "ua"))
+	assert.NotEqual(t, clientHash("10.0.0.1", "ua"), clientHash("10.0.0.1", "other"))
+	assert.Equal(t, clientHash("2001:db8:1::1", "ua"), clientHash("2001:db8:1:2::1", "ua"))
+}
+
+func TestClientIP(t *testing.T) {
+	proxies, err := ParseTrustedProxies([]string{"127.0.0.1", "172.16.0.0/12"})
+	require.NoError(t, err)
+
+	srv := &Server{proxies: proxies}
+	request := func(remoteAddr string, forwarded string) *http.Request {
+		req := httptest.NewRequest(http.MethodGet, "/news.xml", nil)
+		req.RemoteAddr = remoteAddr
+		if forwarded != "" {
+			req.Header.Set("X-Forwarded-For", forwarded)
+		}
+		return req
+	}
+
+	assert.Equal(t, "10.0.0.1", srv.clientIP(request("10.0.0.1:1234", "")))
+	// Untrusted clients can't spoof their address
+	assert.Equal(t, "10.0.0.1", srv.clientIP(request("10.0.0.1:1234", "1.2.3.4")))
+	assert.Equal(t, "1.2.3.4", srv.clientIP(request("127.0.0.1:1234", "1.2.3.4")))
+	// Addresses added before the last untrusted hop are ignored
+	assert.Equal(t, "1.2.3.4", srv.clientIP(request("127.0.0.1:1234", "9.9.9.9, 1.2.3.4, 172.17.0.2")))
+
+	_, err = ParseTrustedProxies([]string{"proxy"})
+	assert.Error(t, err)
+	_, err = ParseTrustedProxies([]string{"10.0.0.0/33"})
+	assert.Error(t, err)
+}